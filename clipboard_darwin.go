@@ -0,0 +1,7 @@
+//go:build darwin
+
+package main
+
+// clipboardCommands read text on stdin and put it on the clipboard, tried
+// in order
+var clipboardCommands = [][]string{{"pbcopy"}}
@@ -0,0 +1,12 @@
+//go:build !(darwin || windows)
+
+package main
+
+// clipboardCommands read text on stdin and put it on the clipboard, tried
+// in order: Wayland, then X11, then Termux on Android
+var clipboardCommands = [][]string{
+	{"wl-copy"},
+	{"xclip", "-selection", "clipboard"},
+	{"xsel", "--clipboard", "--input"},
+	{"termux-clipboard-set"},
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package main
+
+// clipboardCommands read text on stdin and put it on the clipboard, tried
+// in order. PowerShell is told the input is UTF-8; clip.exe, the fallback,
+// reads it in the console code page and garbles non-ASCII candidates.
+var clipboardCommands = [][]string{
+	{"powershell", "-NoProfile", "-Command", "[Console]::InputEncoding = [Text.Encoding]::UTF8; Set-Clipboard -Value ([Console]::In.ReadToEnd())"},
+	{"clip"},
+}
@@ -0,0 +1,29 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// enableVTProcessing is ENABLE_VIRTUAL_TERMINAL_PROCESSING
+const enableVTProcessing = 0x0004
+
+var procSetConsoleMode = syscall.NewLazyDLL("kernel32.dll").NewProc("SetConsoleMode")
+
+// consoleANSI switches a Windows console to VT mode so it renders ANSI
+// escapes. It fails for a redirected handle and on consoles that predate
+// Windows 10, which print the escapes as text.
+func consoleANSI(f *os.File) bool {
+	h := syscall.Handle(f.Fd())
+	var mode uint32
+	if err := syscall.GetConsoleMode(h, &mode); err != nil {
+		return false
+	}
+	if mode&enableVTProcessing != 0 {
+		return true
+	}
+	ok, _, _ := procSetConsoleMode.Call(uintptr(h), uintptr(mode|enableVTProcessing))
+	return ok != 0
+}
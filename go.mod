@@ -1,3 +1,8 @@
 module github.com/ron7/passmut
 
 go 1.21
+
+require (
+	github.com/tetratelabs/wazero v1.8.2
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -3,22 +3,51 @@ package main
 import (
 	"archive/tar"
 	"bufio"
+	"bytes"
 	"compress/gzip"
+	"container/heap"
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"hash"
 	"hash/crc32"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
 	"io"
+	"maps"
 	"math"
+	"math/bits"
+	"math/rand"
+	"net"
 	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
+	"unicode/utf8"
+	"unsafe"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"gopkg.in/yaml.v3"
 )
 
 const version = "0.0.2"
@@ -33,17 +62,28 @@ type Config struct {
 	perms           bool
 	double          bool
 	reverse         bool
+	rot             int    // --rot shift for alphabetic characters (0 = off)
+	repeatTo        string // Length range --repeat-to tiles words up to, e.g. "8..12"
+	repeatSep       string // Separator characters also interleaved by --repeat-to
+	repeatMin       int    // Length bounds parsed from repeatTo
+	repeatMax       int
 	leet            bool
 	fullLeet        bool
+	leetPositions   string // Only leet these positions: first, last, vowels or 1-based indexes
 	allCases        bool
 	capital         bool
+	capitalWords    bool // Capitalise every token: joined words, passphrase components, letter runs
 	upper           bool
 	lower           bool
 	swap            bool
 	prefixStrings   string
 	suffixStrings   string
+	interleave      string // Comma-separated strings zipped into each word (cat+123 = c1a2t3)
+	interleaveWords bool   // Also zip every ordered pair of input words
 	punctuation     bool
 	yearsCount      string // range string
+	ordinals        string // Range of ordinal affixes, e.g. "1-31" (1st, 2nd, ...)
+	roman           string // Range of roman numeral affixes, e.g. "1-20" (I, II, ...)
 	acronym         bool
 	common          string
 	prefixRange     string
@@ -51,17 +91,25 @@ type Config struct {
 	space           bool
 	analyze         bool
 	crunchFilter    string
-	sortMode        string // "", "a", "e"
+	crunchPrefix    string // Crunch masks the start of a candidate must match, any length
+	crunchSuffix    string // Crunch masks the end of a candidate must match, any length
+	sortMode        string // "", "a", "e", "source-then-efficacy"
 	mutationLevel   int    // 0, 1, 2
 	helpLong        bool   // Extensive help
 	minStrength     int    // 0-4 score
 	passphraseCount int    // Number of words to combine
 	passphraseSep   string // Separator for passphrases
+	componentLen    string // Length range for passphrase components, e.g. "3-8"
+	ppWeighting     string // How random passphrases pick components: "uniform" or "efficacy"
+	ppMutate        bool   // Also write decorated passphrases (capitals, leet, suffixes)
+	ppUniqueWords   bool   // A component appears at most once per passphrase
+	ppSorted        bool   // Passphrases are combinations: one ordering of each set
+	ppExhaustiveMax int    // Write every passphrase when there are fewer than this, else sample (0 = 10000)
 	noNumbers       bool
 	noSymbols       bool
 	noCapitals      bool
 	threads         int    // Max goroutines
-	rulesList       string // Comma separated rules for sequencing
+	rulesList       string // Comma separated rules for sequencing, one recipe per line
 	excludeCommon   string // Path to common passwords file
 	checkUpdates    bool
 	upgrade         bool
@@ -69,8 +117,104 @@ type Config struct {
 	Rules           []string // Ordered list of rules to apply
 	seedWords       string
 	keyboardWalks   bool
+	kbShift         string // Comma-separated --kb-shift directions: left, right, up, down
+	kbLayout        string // Keyboard layout for --kb-shift: qwerty (default), qwertz, azerty
+	substitute      string // Comma-separated old=new token replacements
+	substituteFile  string // File of old=new token replacements, one per line
+	substitutions   []tokenSub // Pairs parsed from substitute and substituteFile
 	smartAffix      bool
+	numericPatterns bool   // Append numericPatterns (repeats, runs, PINs)
+	predictRotation bool   // Predict the next password of a rotation (Summer2023 -> Autumn2023)
+	yearBump        bool   // Replace embedded years with the current and adjacent years
+	seasonCycle     bool   // Replace season and month names with the others of their cycle
+	phonePatterns   string // Phone numbers to add as words, e.g. "NANP:415,650"
+	patternLocks    string // Dot counts of Android unlock patterns to add as words, e.g. "4-6"
+	patternTop      int    // Keep only the N likeliest --pattern-locks, 0 = all
+	zipcodes        string // Postal codes to add to start and end, e.g. "us:CA,94xxx"
+	zipPack         string // Extra postal code pack file or URL for --zipcodes
 	toggleVariations bool
+	restoreCase      bool // Also write each candidate with the input word's casing merged back
+	filterOnly      bool   // Apply output filters to the input without mutating
+	rawInput        bool   // Read input lines verbatim, split on '\n' only (job outputs)
+	sample          string // Reservoir sample size, e.g. 1000000 or 1M
+	shuffle         bool   // Shuffle the final output (disk-backed)
+	minDigits       int    // Character-class composition filters (0 = no limit)
+	maxDigits       int
+	minUpper        int
+	maxUpper        int
+	minLower        int
+	maxLower        int
+	minSymbols      int
+	maxSymbols      int
+	minClasses      int // Min distinct classes (lower, upper, digit, symbol)
+	maxRepeat       int // Max run of the same character
+	lengthMode      string // "runes" (default) or "bytes"
+	fitLength       int    // Exact candidate length, 0 = off
+	fitStrategy     string // How --fit-length coerces: truncate, pad:X or pad-digits
+	fitPad          string // Filler parsed from fitStrategy, "" = drop short candidates
+	maxBytes        int    // Longest candidate in UTF-8 bytes downstream tools take, 0 = off
+	maxBytesAction  string // What --max-bytes does to longer candidates: drop or truncate
+	wifi            bool   // WPA preset: 8-63 printable ASCII, SSID seeds first, input order kept
+	forHash         string // Hash format whose limits candidates are shaped to, e.g. "descrypt"
+	lmMode          string // "split" LM candidates into halves or "recombine" cracked halves
+	ssid            string // Network names whose parts are mangled before the input
+	domains         string // Comma-separated mail domains input names are expanded at
+	emailAs         string // "output" the addresses as they are or mangle them as "seeds"
+	chainDepth      int    // Number of mangling passes, overrides the level table
+	estimate        bool   // Print a keyspace estimate instead of generating
+	dedupScope      string // "global" (default), "worker", "word" or "none"
+	noDedup         bool   // Shorthand for --dedup-scope none
+	dedupOrder      string // "any" (default) or "first": accept candidates in job order
+	mmapInput       bool   // Memory-map input files instead of buffered reads
+	maxLineLen      int    // Skip input lines longer than this many bytes (0 = no limit)
+	commentPrefix   string // Skip input lines starting with this prefix
+	inputFormat     string // "plain" (default), "csv", "tsv", "userpass" or "jsonl"
+	column          int    // 1-based column to extract (0 = format default)
+	field           string // Dotted field path to extract from jsonl input
+	lineMode        string // Multi-word lines: "keep" (default), "split" or "both"
+	seedMin         int    // Drop input words shorter than this at load time (0 = off)
+	seedMax         int    // Drop input words longer than this at load time (0 = off)
+	stopwords       string // "en" or a file of words to drop from the input
+	pairMode        bool   // Mangle the password of user:pass lines and keep the pairing
+	withScores      bool   // Write word<TAB>strength<TAB>efficacy lines
+	outputFormat    string // "text" (default), "jsonl" or "parquet"
+	plugin          string // External transform command fed words on stdin
+	pluginFormat    string // Plugin protocol: "line" (default) or "json"
+	pluginTimeout   time.Duration // Longest wait for a plugin's answer to one word (0 = no limit)
+	wasmRule        string // WebAssembly rule module run inside the workers
+	dictFile        string // Extra dictionary words for strength scoring
+	freqList        string // Words by descending frequency that weight efficacy
+	clusters        bool   // Report password clusters in --analyze
+	clusterDistance int    // Max edit distance between clustered base words
+	sampleRate      float64 // Fraction of input words --analyze keeps (0 = all)
+	crackTime       string // Hash@rate for --estimate-cracktime, e.g. "NTLM@300GH/s"
+	chartsDir       string // Directory --analyze writes chart files to
+	chartFormat     string // Chart file format: "svg" (default), "png" or "both"
+	deterministic   bool   // Input order, sorted variants and a fixed random seed
+	randomSeed      int64  // Seed for sampling, shuffling and passphrases (0 = from the clock)
+	timeLimit       time.Duration // Stop generating after this long (0 = no limit)
+	maxOutput       string        // Stop after this many candidates, or bytes with a B suffix
+	checkpointFile  string        // Where a run stopped by a limit records its progress
+	resumeFile      string        // Checkpoint to continue from
+	control         string        // Control channel: "stdin", "fd:N" or a Unix socket path
+	session         string        // Run name; a manifest is written next to the output
+	assumeYes       bool          // Write even when the output may not fit on disk
+	window          string        // Candidates --sort keeps in memory at once ("" = all)
+	budget          string        // Candidate budget the rules are pruned to fit, e.g. 1e9
+	collapseRuns    bool          // Write complete digit runs as hashcat hybrid jobs
+	collapseMin     int           // Smallest run --collapse-runs collapses
+	punctSet        string // Characters used by --punctuation
+	punctMax        int    // Max length of punctuation affixes
+	punctPrefix     bool   // Also prepend punctuation affixes
+	currency        bool   // Add currencySymbols to start and end
+	detectLang      bool   // Apply the localePacks of each word's detected language
+	emoji           bool   // Add emojiSymbols to start and end
+	annotate        bool   // Append the input file each candidate came from
+	warmStart       string // Top leaked passwords written first, e.g. top1k
+	rulesFile       string // File of --rules recipes, one per line
+	ordered         bool   // Write candidates in input word order on every worker
+	noColor         bool   // Plain help and --analyze output without ANSI colors
+	lang            string // Language of help and --analyze reports: de, es, fr or a translation file
 }
 
 // ruleFlag is a custom flag type that appends the rule name to the config's Rules list
@@ -94,6 +238,113 @@ func (f *ruleFlag) IsBoolFlag() bool {
 	return true
 }
 
+// fileListFlag is -f/--file. Each occurrence adds its comma-separated list
+// to the ones before, so per-file overrides for several files can be given
+// one file at a time.
+type fileListFlag struct {
+	list *string
+}
+
+func (f *fileListFlag) String() string {
+	if f.list == nil {
+		return ""
+	}
+	return *f.list
+}
+
+func (f *fileListFlag) Set(value string) error {
+	if *f.list != "" && value != "" {
+		*f.list += ","
+	}
+	*f.list += value
+	return nil
+}
+
+// columnFlag is --column. Left unset it stays 0, the input format's
+// default column; a given column must be 1 or greater.
+type columnFlag struct {
+	n *int
+}
+
+func (f *columnFlag) String() string {
+	if f.n == nil {
+		return "0"
+	}
+	return strconv.Itoa(*f.n)
+}
+
+func (f *columnFlag) Set(value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return fmt.Errorf("must be 1 or greater")
+	}
+	*f.n = n
+	return nil
+}
+
+// rotFlag is --rot: a bare --rot shifts by 13, --rot=N by N
+type rotFlag struct {
+	n *int
+}
+
+func (f *rotFlag) String() string {
+	if f.n == nil {
+		return "0"
+	}
+	return strconv.Itoa(*f.n)
+}
+
+func (f *rotFlag) Set(value string) error {
+	switch value {
+	case "true":
+		*f.n = 13
+	case "false":
+		*f.n = 0
+	default:
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 25 {
+			return fmt.Errorf("shift must be 1-25")
+		}
+		*f.n = n
+	}
+	return nil
+}
+
+func (f *rotFlag) IsBoolFlag() bool {
+	return true
+}
+
+// lmModeFlag is --lm-mode: a bare --lm-mode splits candidates into LM
+// halves, --lm-mode=recombine joins cracked halves
+type lmModeFlag struct {
+	mode *string
+}
+
+func (f *lmModeFlag) String() string {
+	if f.mode == nil {
+		return ""
+	}
+	return *f.mode
+}
+
+func (f *lmModeFlag) Set(value string) error {
+	switch value {
+	case "true", "split":
+		*f.mode = "split"
+	case "false":
+		*f.mode = ""
+	case "recombine":
+		*f.mode = value
+	default:
+		return fmt.Errorf("use split or recombine")
+	}
+	return nil
+}
+
+func (f *lmModeFlag) IsBoolFlag() bool {
+	return true
+}
+
 // LeetMap defines character substitutions for leet speak
 var leetMap = map[rune][]rune{
 	'a': {'4', '@', '^'},
@@ -124,8 +375,184 @@ var leetMap = map[rune][]rune{
 	'z': {'2', '%', '7'},
 }
 
-// CommonWords to append/prepend
-var commonWords = []string{"pw", "pwd", "admin", "sys"}
+// leetKeys lists the leetMap keys in order, so substitutions are applied in
+// the same sequence on every run
+var leetKeys = func() []rune {
+	keys := make([]rune, 0, len(leetMap))
+	for k := range leetMap {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}()
+
+// deterministicSeed seeds every random source under --deterministic, and
+// deterministicYear stands in for the current year
+const (
+	deterministicSeed = 1
+	deterministicYear = 2024
+)
+
+// newRand returns the random source for sampling and shuffling: seeded from
+// the clock, from --random-seed, or fixed under --deterministic
+func newRand(cfg *Config) *rand.Rand {
+	if cfg.deterministic {
+		return rand.New(rand.NewSource(deterministicSeed))
+	}
+	if cfg.randomSeed != 0 {
+		return rand.New(rand.NewSource(cfg.randomSeed))
+	}
+	return rand.New(rand.NewSource(time.Now().UnixNano()))
+}
+
+// draws reports whether the output depends on the random source
+func (c *Config) draws() bool {
+	return c.sample != "" || c.shuffle || c.sampleRate > 0 || c.passphraseCount > 0
+}
+
+// currentYear is the year "current" ranges and smart affixes count from
+func (c *Config) currentYear() int {
+	if c.deterministic {
+		return deterministicYear
+	}
+	return time.Now().Year()
+}
+
+// defaultPunctSet is used by --punctuation when no --punct-set is given
+const defaultPunctSet = "!@$%^&*()"
+
+// currencySymbols and emojiSymbols are the --currency and --emoji affixes.
+// Every emoji is a single code point with emoji presentation by default (no
+// variation selectors or ZWJ sequences), so it is written, typed and counted
+// as one character the same way everywhere.
+var (
+	currencySymbols = []string{"$", "€", "£", "¥"}
+	emojiSymbols    = []string{"😀", "😂", "😍", "😎", "😊", "🔥", "💯", "⭐", "🎉", "👍"}
+)
+
+// commonCategories are the built-in --common word sets, selected with
+// builtin:<name> (or the name up to its dash, builtin:admin). A bare -C
+// uses admin-terms.
+var commonCategories = map[string][]string{
+	"admin-terms": {"pw", "pwd", "admin", "sys", "root", "adm", "pass", "login", "user", "test",
+		"temp", "default", "welcome", "changeme", "secret", "master", "super", "guest", "it", "helpdesk"},
+	"device-defaults": {"admin", "root", "1234", "12345", "password", "default", "support", "cisco",
+		"ubnt", "router", "wifi", "netgear", "linksys", "dlink", "tplink", "huawei", "zte", "private",
+		"public", "toor"},
+	"seasons": localePacks["en"].seasons,
+	"sports": {"football", "soccer", "baseball", "basketball", "hockey", "golf", "tennis", "rugby",
+		"cricket", "yankees", "lakers", "cowboys", "eagles", "giants", "patriots", "steelers",
+		"packers", "chelsea", "arsenal", "liverpool", "united", "barcelona", "madrid"},
+}
+
+// commonCategory returns the built-in --common set called name or, when
+// name is the part before its dash, the one that starts with it
+func commonCategory(name string) ([]string, bool) {
+	if words, ok := commonCategories[name]; ok {
+		return words, true
+	}
+	for cat, words := range commonCategories {
+		if strings.HasPrefix(cat, name+"-") {
+			return words, true
+		}
+	}
+	return nil, false
+}
+
+// commonCategoryNames lists the built-in --common sets, sorted
+func commonCategoryNames() []string {
+	names := make([]string, 0, len(commonCategories))
+	for name := range commonCategories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadCommon returns the words of a --common spec: comma-separated
+// builtin:<category> sets and files (or other builtin: lists), in order and
+// without duplicates. After a builtin: category, bare category names are
+// categories too, so builtin:admin,seasons selects both. "BUILT_IN" is a
+// bare -C.
+func loadCommon(spec string) ([]string, error) {
+	if spec == "BUILT_IN" {
+		spec = builtinPrefix + "admin-terms"
+	}
+	var words []string
+	categories := false
+	for _, item := range strings.Split(spec, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		name, builtin := strings.CutPrefix(item, builtinPrefix)
+		if cat, ok := commonCategory(name); ok && (builtin || categories) {
+			words = append(words, cat...)
+			categories = true
+			continue
+		}
+		f, err := openInput(item)
+		if err != nil {
+			if builtin {
+				return nil, fmt.Errorf("unknown built-in %q (categories: %s; lists: %s)", name,
+					strings.Join(commonCategoryNames(), ", "), strings.Join(builtinListNames(), ", "))
+			}
+			return nil, err
+		}
+		list, err := loadWords(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", item, err)
+		}
+		words = append(words, list...)
+	}
+	seen := make(map[string]struct{}, len(words))
+	unique := words[:0]
+	for _, w := range words {
+		if _, dup := seen[w]; !dup {
+			seen[w] = struct{}{}
+			unique = append(unique, w)
+		}
+	}
+	return unique, nil
+}
+
+// ruleFamily groups mangling rules so chained passes can apply subsets
+type ruleFamily uint8
+
+const (
+	familyShape ruleFamily = 1 << iota // double, reverse, rot, kb-shift, substitute
+	familyCase                         // capital, lower, upper, swap, all-cases, toggles
+	familyLeet                         // leet, full-leet
+	familyAffix                        // strings, common, punctuation, ranges, years
+
+	familyAll = familyShape | familyCase | familyLeet | familyAffix
+)
+
+// chainLevels defines the mangling passes for each --level. Every pass
+// re-mangles the output of the previous one using only the listed families,
+// so deeper levels stay tractable by limiting late passes to cheap rules.
+var chainLevels = [][]ruleFamily{
+	0: {familyAll},
+	1: {familyAll},
+	2: {familyAll, familyAll},
+	3: {familyAll, familyAll, familyCase | familyAffix},
+	4: {familyAll, familyAll, familyAll},
+}
+
+// chainPasses returns the rule families for each mangling pass
+func (c *Config) chainPasses() []ruleFamily {
+	if c.chainDepth > 0 {
+		passes := make([]ruleFamily, c.chainDepth)
+		for i := range passes {
+			passes[i] = familyAll
+		}
+		return passes
+	}
+	if c.mutationLevel >= 0 && c.mutationLevel < len(chainLevels) {
+		return chainLevels[c.mutationLevel]
+	}
+	return chainLevels[0]
+}
 
 // substitution represents a leet speak substitution at a specific position
 type substitution struct {
@@ -137,15 +564,86 @@ type substitution struct {
 type Mangler struct {
 	config           *Config
 	output           io.Writer
-	seenCRCs         map[uint32]struct{}
-	collectedResults []string
+	seen             *dedupSet // Global dedup of accepted candidates
 	blacklistedWords map[string]struct{}
 	currentCommon    []string
 	bufWriter        *bufio.Writer
+	crunchMasks      []crunchMask // Parsed --crunch
+	dict             *wordDict    // Strength scoring dictionary, with any --dict words
+	rng              *rand.Rand
+	sampler          *reservoirSampler
+	shuffler         *diskShuffler
+	collapser        *runCollapser
+	profiles         map[string]*Config // Per-word configs from file[key=value] overrides
+	weights          map[string]float64 // Per-word weights from file:weight=N, nil when unweighted
+	sources          map[string]int     // Input index of each word, nil when not tracked
+	sourceNames      []string           // Input file names, by index
+	crackRate        *hashRate          // Attack speed for --estimate-cracktime
+	forHash          *hashLimits        // --for-hash constraints, nil when not set
+	componentMin     int                // --component-len bounds (0 = open)
+	componentMax     int
+	emitted          atomic.Int64   // Candidates written to the output
+	limits           outputLimits   // --max-output and --time-limit state
+	skip             int            // Input words already done, from --resume
+	zipcodes         []string       // Expanded --zipcodes
+	window           int            // --window size, 0 = sort the whole output
+	budget           int64          // --budget candidates the rules are pruned to fit, 0 = none
+	sink             sink           // Output sink, created on first use
+	parquet          *parquetWriter // --output-format parquet, nil for text
+	control          *controller    // --control, nil when not enabled
+	overBytes        atomic.Int64   // Candidates longer than --max-bytes
 	mu               sync.Mutex
 }
 
+// subcommands are dispatched on the first argument before flag parsing
+var subcommands = map[string]func(args []string) error{
+	"merge":      runMerge,
+	"freq":       runFreq,
+	"run":        runJob,
+	"audit":      runAudit,
+	"score":      runScore,
+	"delta":      runDelta,
+	"defaults":   runDefaults,
+	"coverage":   runCoverage,
+	"suggest":    runSuggest,
+	"infer-rule": runInferRule,
+	"docs":       runDocs,
+	"recipe":     runRecipe,
+	"verify":     runVerify,
+	"word":       runWord,
+	"selftest":   runSelfTest,
+}
+
+// subcommandSummaries describe the subcommands in 'passmut docs'
+var subcommandSummaries = map[string]string{
+	"merge":      "merge and dedup wordlists with bounded memory (-o, -S a|e, --chunk)",
+	"freq":       "count word frequencies like sort | uniq -c (--top, --min-count)",
+	"run":        "run a pipeline declared in a YAML job file",
+	"audit":      "report how a password dump complies with a YAML policy (--policy)",
+	"score":      "compare wordlists' coverage and efficiency against cracked passwords (--against)",
+	"delta":      "predict the next rotation of last engagement's passwords (--old)",
+	"defaults":   "write known default user:password pairs (--vendor, --data)",
+	"coverage":   "attribute plaintexts a list missed to the rule classes it lacks (--generated, --cracked)",
+	"suggest":    "infer a ranked --rules-file from cracked passwords and their base words (--cracked, --base)",
+	"infer-rule": "print the passmut and hashcat rule chains between a word and a password (--from, --to)",
+	"docs":       "write this reference as a man page or markdown (--format man|markdown)",
+	"recipe":     "export, import, validate or diff .pmrecipe files: options, locale packs and SHA-256-pinned wordpacks",
+	"verify":     "check a recipe's deterministic output for a fixed sample against a golden file (--recipe, --golden, --sample)",
+	"word":       "mangle words given as arguments; --copy puts the top candidates on the clipboard (--top)",
+	"selftest":   "check the transforms against built-in vectors (-q)",
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			if err := cmd(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+	}
+
 	if len(os.Args) == 1 {
 		stat, _ := os.Stdin.Stat()
 		if (stat.Mode() & os.ModeCharDevice) != 0 {
@@ -154,26 +652,12 @@ func main() {
 		}
 	}
 
-	// Pre-process args to handle optional -y without value
-	var args []string
-	rawArgs := os.Args[1:]
-	for i := 0; i < len(rawArgs); i++ {
-		arg := rawArgs[i]
-		args = append(args, arg)
-		if arg == "-y" || arg == "--years" {
-			if i+1 == len(rawArgs) || strings.HasPrefix(rawArgs[i+1], "-") {
-				args = append(args, "1980-current")
-			}
-		}
-		if arg == "-C" || arg == "--common" {
-			if i+1 == len(rawArgs) || strings.HasPrefix(rawArgs[i+1], "-") {
-				args = append(args, "BUILT_IN")
-			}
-		}
+	config, err := parseFlags(optionalValues(os.Args[1:]))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
 	}
 
-	config := parseFlags(args)
-
 	if config.showVersion {
 		fmt.Printf("passmut v%s\n", version)
 		os.Exit(0)
@@ -194,20 +678,10 @@ func main() {
 		os.Exit(0)
 	}
 
-	// Custom glob processing for input file
-	var inputs []string
-	if config.inputFile == "" || config.inputFile == "-" {
-		inputs = append(inputs, "-")
-	} else {
-		for _, part := range strings.Split(config.inputFile, ",") {
-			part = strings.TrimSpace(part)
-			if strings.ContainsAny(part, "*?[]") {
-				matches, _ := filepath.Glob(part)
-				inputs = append(inputs, matches...)
-			} else {
-				inputs = append(inputs, part)
-			}
-		}
+	// Custom glob and per-file override processing for input file
+	inputs := []inputSpec{{path: "-"}}
+	if config.inputFile != "" && config.inputFile != "-" {
+		inputs = parseInputSpecs(config.inputFile)
 	}
 
 	if err := run(config, inputs); err != nil {
@@ -449,72 +923,349 @@ func upgradeTool() {
 	}
 
 	fmt.Printf("Successfully upgraded to %s\n", release.TagName)
+	fmt.Println("Run 'passmut selftest' to verify the new build.")
+}
+
+// optionalValues fills in the value of -y and -C when it is left out, and
+// joins a separate value onto --rot and --lm-mode, which the flag package
+// otherwise parses as bare booleans
+func optionalValues(rawArgs []string) []string {
+	var args []string
+	for i := 0; i < len(rawArgs); i++ {
+		arg := rawArgs[i]
+		if i+1 < len(rawArgs) {
+			next := rawArgs[i+1]
+			_, isShift := strconv.Atoi(next)
+			switch {
+			case (arg == "--rot" || arg == "-rot") && isShift == nil,
+				(arg == "--lm-mode" || arg == "-lm-mode") && (next == "split" || next == "recombine"):
+				args = append(args, arg+"="+next)
+				i++
+				continue
+			}
+		}
+		args = append(args, arg)
+		if arg == "-y" || arg == "--years" {
+			if i+1 == len(rawArgs) || strings.HasPrefix(rawArgs[i+1], "-") {
+				args = append(args, "1980-current")
+			}
+		}
+		if arg == "-C" || arg == "--common" {
+			if i+1 == len(rawArgs) || strings.HasPrefix(rawArgs[i+1], "-") {
+				args = append(args, "BUILT_IN")
+			}
+		}
+	}
+	return args
 }
 
-func parseFlags(args []string) *Config {
+func parseFlags(args []string) (*Config, error) {
 	config := &Config{}
-	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
-	fs.Usage = showUsage
-
-	fs.StringVar(&config.inputFile, "file", "", "input file(s)")
-	fs.StringVar(&config.inputFile, "f", "", "input file(s) (shorthand)")
-	fs.StringVar(&config.outputFile, "output", "-", "output file")
-	fs.StringVar(&config.outputFile, "o", "-", "output file (shorthand)")
-	fs.IntVar(&config.minLength, "min", 0, "min length")
-	fs.IntVar(&config.minLength, "m", 0, "min length (shorthand)")
-	fs.IntVar(&config.maxLength, "max", 0, "max length")
-	fs.IntVar(&config.maxLength, "x", 0, "max length (shorthand)")
-
-	fs.BoolVar(&config.perms, "perms", false, "permutations")
-	fs.BoolVar(&config.perms, "p", false, "permutations (shorthand)")
-	fs.BoolVar(&config.double, "double", false, "double")
-	fs.BoolVar(&config.double, "d", false, "double (shorthand)")
-	fs.BoolVar(&config.reverse, "reverse", false, "reverse")
-	fs.BoolVar(&config.reverse, "r", false, "reverse (shorthand)")
-	fs.BoolVar(&config.leet, "leet", false, "leet")
-	fs.BoolVar(&config.leet, "t", false, "leet (shorthand)")
-	fs.BoolVar(&config.fullLeet, "full-leet", false, "full leet")
-	fs.BoolVar(&config.fullLeet, "T", false, "full leet (shorthand)")
+	fs := newFlagSet(config, flag.ExitOnError)
+	fs.Usage = func() {
+		// -h is handled mid-parse, so pick up an earlier --no-color and
+		// --lang here
+		noColor = noColor || config.noColor
+		loadCatalog(config.lang)
+		showUsage()
+	}
+	fs.Parse(args)
+	noColor = noColor || config.noColor
+	if err := loadCatalog(config.lang); err != nil {
+		return nil, err
+	}
+	if err := checkDuplicateFlags(fs, args); err != nil {
+		return nil, err
+	}
+	config.applyImplied(fs)
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// checkDuplicateFlags rejects a valued option given more than once, under
+// the same or another name (-m and --min): the flag package would silently
+// keep the last value. Repeated boolean flags are harmless and allowed.
+func checkDuplicateFlags(fs *flag.FlagSet, args []string) error {
+	// Aliases share the pointer to their Config field, so their Values compare equal
+	seen := make(map[flag.Value]string)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || arg == "-" || !strings.HasPrefix(arg, "-") {
+			break
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		given := arg[:len(arg)-len(strings.TrimLeft(arg, "-"))] + name
+		f := fs.Lookup(name)
+		if f == nil {
+			continue
+		}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			continue
+		}
+		if !hasValue {
+			i++
+		}
+		if _, ok := f.Value.(*fileListFlag); ok {
+			continue
+		}
+		if prev, dup := seen[f.Value]; dup {
+			if prev == given {
+				return fmt.Errorf("%s is given more than once; only the last value would be used", given)
+			}
+			return fmt.Errorf("%s and %s set the same option; give it once", prev, given)
+		}
+		seen[f.Value] = given
+	}
+	return nil
+}
+
+// validate rejects option combinations that would silently produce empty or
+// misleading output
+func (c *Config) validate() error {
+	if err := c.parseRepeatTo(); err != nil {
+		return err
+	}
+	type option struct {
+		name string
+		on   bool
+	}
+	for _, check := range []struct {
+		adders []option // Options whose candidates all contain what the filter removes
+		filter option
+		what   string
+	}{
+		{[]option{{"--upper", c.upper}, {"--capital", c.capital}, {"--capital-words", c.capitalWords}, {"--all-cases", c.allCases}, {"--toggle-variations", c.toggleVariations}},
+			option{"--no-capitals", c.noCapitals}, "capitals"},
+		{[]option{{"--years", c.yearsCount != ""}, {"--prefix-range", c.prefixRange != ""}, {"--suffix-range", c.suffixRange != ""}, {"--ordinals", c.ordinals != ""}, {"--numeric-patterns", c.numericPatterns}, {"--zipcodes", c.zipcodes != ""}},
+			option{"--no-numbers", c.noNumbers}, "digits"},
+		{[]option{{"--punctuation", c.punctuation}, {"--currency", c.currency}, {"--emoji", c.emoji}}, option{"--no-symbols", c.noSymbols}, "symbols"},
+	} {
+		if !check.filter.on {
+			continue
+		}
+		for _, o := range check.adders {
+			if o.on {
+				return fmt.Errorf("%s only adds candidates with %s, which %s removes again", o.name, check.what, check.filter.name)
+			}
+		}
+	}
+
+	_, crunchErr := parseCrunchMasks(c.crunchFilter)
+	rulesErr := checkRuleSteps(c.rulesList)
+	switch {
+	case c.analyze && c.outputFile != "-" && c.outputFile != "":
+		return fmt.Errorf("--analyze prints a report and writes no wordlist; drop -o (redirect stdout to save the report)")
+	case c.analyze && c.estimate:
+		return fmt.Errorf("--analyze and --estimate are separate modes; use one at a time")
+	case c.budget != "" && (c.passphraseCount > 0 || c.rulesList != "" || c.rulesFile != ""):
+		return fmt.Errorf("--budget prunes the mangling options; it does not apply to --passphrase, --rules or --rules-file")
+	case c.rulesFile != "" && c.rulesList != "":
+		return fmt.Errorf("--rules-file and --rules both set the recipe; use one of them")
+	case c.ppMutate && c.passphraseCount == 0:
+		return fmt.Errorf("--pp-mutate decorates --passphrase output; add --passphrase")
+	case (c.ppUniqueWords || c.ppSorted) && c.passphraseCount == 0:
+		return fmt.Errorf("--pp-unique-words and --pp-sorted shape --passphrase output; add --passphrase")
+	case c.passphraseCount > 0 && c.sortMode != "":
+		return fmt.Errorf("--sort does not apply to --passphrase output; sort the result afterwards (e.g. passmut merge)")
+	case c.sortMode != "" && c.sortMode != "a" && c.sortMode != "e" && c.sortMode != "source-then-efficacy":
+		return fmt.Errorf("unknown --sort %q (use a, e or source-then-efficacy)", c.sortMode)
+	case c.window != "" && c.sortMode == "":
+		return fmt.Errorf("--window bounds the memory of --sort; add --sort")
+	case c.warmStart != "" && (c.passphraseCount > 0 || c.pairMode):
+		return fmt.Errorf("--warm-start writes single passwords; it does not apply to --passphrase or --pair-mode")
+	case c.annotate && c.outputFormat != "text":
+		return fmt.Errorf("--annotate adds a column to text output; --output-format jsonl records the file already and parquet has no column for it")
+	case c.lmMode != "" && c.forHash != "":
+		return fmt.Errorf("--lm-mode already shapes candidates for LM; drop --for-hash")
+	case c.wifi && (c.minLength < wpaMinLength || c.maxLength > wpaMaxLength):
+		return fmt.Errorf("--wifi candidates are %d-%d characters (WPA passphrases); --min/--max must stay within that", wpaMinLength, wpaMaxLength)
+	case c.fitStrategy != "truncate" && c.fitLength == 0:
+		return fmt.Errorf("--fit-strategy only applies to --fit-length; add --fit-length")
+	case c.maxBytesAction != "drop" && c.maxBytes == 0:
+		return fmt.Errorf("--max-bytes-action only applies to --max-bytes; add --max-bytes")
+	case c.fitLength > 0 && (c.minLength > c.fitLength || (c.maxLength > 0 && c.maxLength < c.fitLength)):
+		return fmt.Errorf("--fit-length %d is outside --min/--max, so every candidate would be filtered out", c.fitLength)
+	case c.emailAs != "output" && c.domains == "":
+		return fmt.Errorf("--email-as only applies to --domains; add --domains")
+	case c.patternTop != 0 && c.patternLocks == "":
+		return fmt.Errorf("--pattern-top limits --pattern-locks; add --pattern-locks")
+	case c.ordered && (c.dedupScope == "worker" || c.sortMode != "" || c.shuffle):
+		return fmt.Errorf("--ordered keeps the input order; it cannot be combined with --dedup-scope worker, --sort or --shuffle")
+	case c.dedupOrder == "first" && c.dedupScope == "worker":
+		return fmt.Errorf("--dedup-order first needs one shared dedup set; it cannot be combined with --dedup-scope worker")
+	case c.noDedup && c.dedupScope != "global" && c.dedupScope != "none":
+		return fmt.Errorf("--no-dedup turns deduplication off; it cannot be combined with --dedup-scope %s", c.dedupScope)
+	case c.zipPack != "" && c.zipcodes == "":
+		return fmt.Errorf("--zip-pack only provides regions for --zipcodes; add --zipcodes")
+	case c.shuffle && c.sortMode != "":
+		return fmt.Errorf("--shuffle discards the order --sort %s produces; use one of them", c.sortMode)
+	case c.randomSeed != 0 && c.deterministic:
+		return fmt.Errorf("--deterministic fixes the random seed; it cannot be combined with --random-seed")
+	case crunchErr != nil:
+		return crunchErr
+	case rulesErr != nil:
+		return rulesErr
+	case c.punctMax < 1:
+		return fmt.Errorf("invalid --punct-max %d (use 1 or more)", c.punctMax)
+	case c.punctuation && punctAffixCount(c.punctSet, c.punctMax) > maxPunctAffixes:
+		return fmt.Errorf("--punct-max %d makes more than %d punctuation affixes per word; lower it or shorten --punct-set", c.punctMax, maxPunctAffixes)
+	case c.minLength > 0 && c.maxLength > 0 && c.minLength > c.maxLength:
+		return fmt.Errorf("--min %d is greater than --max %d, so every candidate would be filtered out", c.minLength, c.maxLength)
+	case c.outputFormat == "jsonl" && (c.sortMode != "" || c.sample != "" || c.shuffle || c.dedupScope == "worker" || c.passphraseCount > 0):
+		return fmt.Errorf("--output-format jsonl writes each record as its candidate is found; it cannot be combined with --sort, --sample, --shuffle, --dedup-scope worker or --passphrase")
+	case c.withScores && c.outputFormat == "parquet":
+		return fmt.Errorf("--output-format parquet always includes the strength and efficacy columns; drop --with-scores")
+	case c.seedMin > 0 && c.seedMax > 0 && c.seedMin > c.seedMax:
+		return fmt.Errorf("--seed-min %d is greater than --seed-max %d, so every input word would be dropped", c.seedMin, c.seedMax)
+	case c.session != "" && (c.analyze || c.estimate):
+		return fmt.Errorf("--session records a generation run; it does not apply to --analyze or --estimate")
+	case c.collapseRuns && (c.outputFile == "-" || c.outputFile == ""):
+		return fmt.Errorf("--collapse-runs writes wordlist and mask files next to the output; add -o")
+	case c.collapseRuns && (c.sortMode != "" || c.sample != "" || c.shuffle || c.outputFormat != "text" || c.withScores || c.annotate || c.pairMode || c.passphraseCount > 0):
+		return fmt.Errorf("--collapse-runs needs plain text candidates; it cannot be combined with --sort, --sample, --shuffle, --output-format, --with-scores, --annotate, --pair-mode or --passphrase")
+	}
+	return nil
+}
+
+// newFlagSet registers every option on a flag set bound to config. Besides
+// the command line it is used to apply per-file overrides by flag name.
+func newFlagSet(config *Config, errorHandling flag.ErrorHandling) *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], errorHandling)
+
+	files := &fileListFlag{&config.inputFile}
+	fs.Var(files, "file", "input files as a comma-separated `list`, repeatable; file[key=value] sets per-file options")
+	fs.Var(files, "f", "input files as a comma-separated `list`, repeatable; file[key=value] sets per-file options (shorthand)")
+	fs.StringVar(&config.outputFile, "output", "-", "output file, - for stdout")
+	fs.StringVar(&config.outputFile, "o", "-", "output file, - for stdout (shorthand)")
+	fs.IntVar(&config.minLength, "min", 0, "minimum candidate length")
+	fs.IntVar(&config.minLength, "m", 0, "minimum candidate length (shorthand)")
+	fs.IntVar(&config.maxLength, "max", 0, "maximum candidate length")
+	fs.IntVar(&config.maxLength, "x", 0, "maximum candidate length (shorthand)")
+
+	fs.BoolVar(&config.perms, "perms", false, "permute all the input words")
+	fs.BoolVar(&config.perms, "p", false, "permute all the input words (shorthand)")
+	fs.BoolVar(&config.double, "double", false, "double each word")
+	fs.BoolVar(&config.double, "d", false, "double each word (shorthand)")
+	fs.StringVar(&config.repeatTo, "repeat-to", "", "repeat words up to a length range, e.g. 8..12")
+	fs.StringVar(&config.repeatSep, "repeat-sep", "-_.", "separators interleaved by --repeat-to (\"\" for none)")
+	fs.BoolVar(&config.reverse, "reverse", false, "reverse the word")
+	fs.BoolVar(&config.reverse, "r", false, "reverse the word (shorthand)")
+	fs.Var(&rotFlag{&config.rot}, "rot", "rotate letters by `N` (default 13)")
+	fs.BoolVar(&config.leet, "leet", false, "l33t speak the word")
+	fs.BoolVar(&config.leet, "t", false, "l33t speak the word (shorthand)")
+	fs.BoolVar(&config.fullLeet, "full-leet", false, "write every l33t combination")
+	fs.BoolVar(&config.fullLeet, "T", false, "write every l33t combination (shorthand)")
+	fs.StringVar(&config.leetPositions, "leet-positions", "", "only leet these positions: first, last, vowels, N (comma-separated)")
 	fs.BoolVar(&config.allCases, "all-cases", false, "generate all case permutations")
 	fs.BoolVar(&config.allCases, "ac", false, "generate all case permutations (shorthand)")
-	fs.BoolVar(&config.capital, "capital", false, "capitalize")
-	fs.BoolVar(&config.capital, "c", false, "capitalize (shorthand)")
-	fs.BoolVar(&config.upper, "upper", false, "upper")
-	fs.BoolVar(&config.upper, "u", false, "upper (shorthand)")
-	fs.BoolVar(&config.lower, "lower", false, "lower")
-	fs.BoolVar(&config.lower, "l", false, "lower (shorthand)")
-	fs.BoolVar(&config.swap, "swap", false, "swap")
-	fs.BoolVar(&config.swap, "s", false, "swap (shorthand)")
-	fs.StringVar(&config.prefixStrings, "prefix-strings", "", "prefix strings")
-	fs.StringVar(&config.prefixStrings, "ps", "", "prefix strings (shorthand)")
-	fs.StringVar(&config.suffixStrings, "suffix-strings", "", "suffix strings")
-	fs.StringVar(&config.suffixStrings, "ss", "", "suffix strings (shorthand)")
-	fs.BoolVar(&config.punctuation, "punctuation", false, "punctuation")
-	fs.StringVar(&config.yearsCount, "years", "", "years range")
-	fs.StringVar(&config.yearsCount, "y", "", "years range (shorthand)")
-	fs.BoolVar(&config.acronym, "acronym", false, "acronym")
-	fs.BoolVar(&config.acronym, "A", false, "acronym (shorthand)")
-	fs.StringVar(&config.common, "common", "", "common words")
-	fs.StringVar(&config.common, "C", "", "common words (shorthand)")
-	fs.StringVar(&config.prefixRange, "prefix-range", "", "prefix range")
-	fs.StringVar(&config.prefixRange, "pr", "", "prefix range (shorthand)")
-	fs.StringVar(&config.suffixRange, "suffix-range", "", "suffix range")
-	fs.StringVar(&config.suffixRange, "sr", "", "suffix range (shorthand)")
-	fs.BoolVar(&config.space, "space", false, "add spaces")
+	fs.BoolVar(&config.capital, "capital", false, "capitalize the word")
+	fs.BoolVar(&config.capital, "c", false, "capitalize the word (shorthand)")
+	fs.BoolVar(&config.capitalWords, "capital-words", false, "capitalize each word of joins, permutations and passphrases (BlueDog42)")
+	fs.BoolVar(&config.upper, "upper", false, "uppercase the word")
+	fs.BoolVar(&config.upper, "u", false, "uppercase the word (shorthand)")
+	fs.BoolVar(&config.lower, "lower", false, "lowercase the word")
+	fs.BoolVar(&config.lower, "l", false, "lowercase the word (shorthand)")
+	fs.BoolVar(&config.swap, "swap", false, "swap the case of the word")
+	fs.BoolVar(&config.swap, "s", false, "swap the case of the word (shorthand)")
+	fs.StringVar(&config.prefixStrings, "prefix-strings", "", "strings to add to the start (comma-separated)")
+	fs.StringVar(&config.prefixStrings, "ps", "", "strings to add to the start (comma-separated) (shorthand)")
+	fs.StringVar(&config.suffixStrings, "suffix-strings", "", "strings to add to the end (comma-separated)")
+	fs.StringVar(&config.suffixStrings, "ss", "", "strings to add to the end (comma-separated) (shorthand)")
+	fs.StringVar(&config.interleave, "interleave", "", "strings to interleave with each word, e.g. 123 (c1a2t3)")
+	fs.BoolVar(&config.interleaveWords, "interleave-words", false, "interleave every pair of input words")
+	fs.BoolVar(&config.punctuation, "punctuation", false, "add common punctuation to the end")
+	fs.StringVar(&config.punctSet, "punct-set", "", "characters used for punctuation affixes")
+	fs.IntVar(&config.punctMax, "punct-max", 1, "max length of punctuation affixes")
+	fs.BoolVar(&config.punctPrefix, "punct-prefix", false, "also prepend punctuation affixes")
+	fs.BoolVar(&config.currency, "currency", false, "add currency symbols ($€£¥) to start and end")
+	fs.BoolVar(&config.detectLang, "detect-lang", false, "detect each word's language and apply its locale pack")
+	fs.BoolVar(&config.emoji, "emoji", false, "add common emoji to start and end")
+	fs.StringVar(&config.yearsCount, "years", "", "add a range of years to the start and end, e.g. 1980-2020")
+	fs.StringVar(&config.yearsCount, "y", "", "add a range of years to the start and end, e.g. 1980-2020 (shorthand)")
+	fs.StringVar(&config.ordinals, "ordinals", "", "ordinal affixes for a range, e.g. 1-31 (1st, 2nd, ...)")
+	fs.StringVar(&config.roman, "roman", "", "roman numeral affixes for a range, e.g. 1-20 (I, II, ...)")
+	fs.BoolVar(&config.acronym, "acronym", false, "create acronyms from the input words")
+	fs.BoolVar(&config.acronym, "A", false, "create acronyms from the input words (shorthand)")
+	fs.StringVar(&config.common, "common", "", "add common words to the start and end: builtin:CATEGORY,... or a file")
+	fs.StringVar(&config.common, "C", "", "add common words to the start and end: builtin:CATEGORY,... or a file (shorthand)")
+	fs.StringVar(&config.prefixRange, "prefix-range", "", "add a range of numbers to the start, e.g. 01-99")
+	fs.StringVar(&config.prefixRange, "pr", "", "add a range of numbers to the start, e.g. 01-99 (shorthand)")
+	fs.StringVar(&config.suffixRange, "suffix-range", "", "add a range of numbers to the end, e.g. 100-999")
+	fs.StringVar(&config.suffixRange, "sr", "", "add a range of numbers to the end, e.g. 100-999 (shorthand)")
+	fs.BoolVar(&config.space, "space", false, "add spaces between words")
 	fs.BoolVar(&config.showVersion, "v", false, "show version")
-	fs.BoolVar(&config.analyze, "analyze", false, "analyze input")
-	fs.BoolVar(&config.analyze, "a", false, "analyze input (shorthand)")
-	fs.StringVar(&config.crunchFilter, "crunch", "", "crunch filter")
-	fs.StringVar(&config.crunchFilter, "cr", "", "crunch filter (shorthand)")
-	fs.StringVar(&config.sortMode, "sort", "", "sort mode")
-	fs.StringVar(&config.sortMode, "S", "", "sort mode (shorthand)")
-	fs.IntVar(&config.mutationLevel, "level", 0, "mutation level")
-	fs.IntVar(&config.mutationLevel, "L", 0, "mutation level (shorthand)")
-	fs.BoolVar(&config.helpLong, "hl", false, "long help")
-	fs.BoolVar(&config.helpLong, "long-help", false, "long help")
+	fs.BoolVar(&config.analyze, "analyze", false, "analyze the input wordlist and print statistics")
+	fs.BoolVar(&config.analyze, "a", false, "analyze the input wordlist and print statistics (shorthand)")
+	fs.StringVar(&config.crunchFilter, "crunch", "", "crunch-style mask the candidates must match, e.g. ...ket##&")
+	fs.StringVar(&config.crunchFilter, "cr", "", "crunch-style mask the candidates must match, e.g. ...ket##& (shorthand)")
+	fs.StringVar(&config.crunchPrefix, "crunch-prefix", "", "crunch mask for the start of candidates of any length, e.g. ^^")
+	fs.StringVar(&config.crunchSuffix, "crunch-suffix", "", "crunch mask for the end of candidates of any length, e.g. ##&")
+	fs.StringVar(&config.sortMode, "sort", "", "sort the output: a (alpha), e (efficacy) or source-then-efficacy")
+	fs.StringVar(&config.sortMode, "S", "", "sort the output: a (alpha), e (efficacy) or source-then-efficacy (shorthand)")
+	fs.BoolVar(&config.withScores, "with-scores", false, "write word<TAB>strength<TAB>efficacy")
+	fs.BoolVar(&config.annotate, "annotate", false, "append the input file each candidate came from")
+	fs.StringVar(&config.warmStart, "warm-start", "", "write the top N leaked passwords first, e.g. top1k")
+	fs.StringVar(&config.outputFormat, "output-format", "text", "output format: text, jsonl or parquet")
+	fs.IntVar(&config.mutationLevel, "level", 0, "mutation complexity level, 0-4")
+	fs.IntVar(&config.mutationLevel, "L", 0, "mutation complexity level, 0-4 (shorthand)")
+	fs.IntVar(&config.chainDepth, "chain-depth", 0, "number of chained mangling passes")
+	fs.BoolVar(&config.estimate, "estimate", false, "print a keyspace estimate and exit")
+	fs.StringVar(&config.dedupScope, "dedup-scope", "global", "dedup scope: global, worker, word or none")
+	fs.BoolVar(&config.noDedup, "no-dedup", false, "write duplicate candidates (same as --dedup-scope none)")
+	fs.StringVar(&config.dedupOrder, "dedup-order", "any", "which duplicate wins: any (fastest worker) or first (input order)")
+	fs.BoolVar(&config.mmapInput, "mmap", false, "memory-map input files")
+	fs.IntVar(&config.maxLineLen, "max-line-len", defaultMaxLineLen, "skip input lines longer than this many bytes (0 = no limit)")
+	fs.StringVar(&config.commentPrefix, "comment-prefix", "", "skip input lines starting with this prefix")
+	fs.StringVar(&config.inputFormat, "input-format", "plain", "input format: plain, csv, tsv, userpass or jsonl")
+	fs.Var(&columnFlag{&config.column}, "column", "1-based column `n` to extract from delimited input")
+	fs.StringVar(&config.field, "field", "password", "dotted field path to extract from jsonl input")
+	fs.StringVar(&config.lineMode, "line-mode", "keep", "multi-word lines: keep, split or both")
+	fs.IntVar(&config.seedMin, "seed-min", 0, "drop input words shorter than this before mangling")
+	fs.IntVar(&config.seedMax, "seed-max", 0, "drop input words longer than this before mangling")
+	fs.StringVar(&config.stopwords, "stopwords", "", "drop stop words from the input: en or a file")
+	fs.BoolVar(&config.pairMode, "pair-mode", false, "mangle the password of user:pass lines and re-emit user:mutation")
+	fs.StringVar(&config.plugin, "plugin", "", "external transform command (words on stdin, candidates on stdout)")
+	fs.StringVar(&config.pluginFormat, "plugin-format", "line", "plugin protocol: line or json")
+	fs.DurationVar(&config.pluginTimeout, "plugin-timeout", 30*time.Second, "longest wait for a plugin's answer to one word (0 = no limit)")
+	fs.StringVar(&config.wasmRule, "wasm", "", "WebAssembly rule module exporting mutate")
+	fs.StringVar(&config.dictFile, "dict", "", "extra dictionary words for strength scoring")
+	fs.StringVar(&config.freqList, "freq-list", "", "words by descending frequency that raise efficacy, e.g. builtin:en-freq")
+	fs.BoolVar(&config.clusters, "clusters", false, "report password clusters in --analyze")
+	fs.IntVar(&config.clusterDistance, "cluster-distance", 2, "max edit distance between clustered base words")
+	fs.Float64Var(&config.sampleRate, "sample-rate", 0, "analyze a random fraction of the input, e.g. 0.01")
+	fs.DurationVar(&config.timeLimit, "time-limit", 0, "stop generating after this long, e.g. 2h")
+	fs.StringVar(&config.maxOutput, "max-output", "", "stop after N candidates (500M) or bytes (2GB)")
+	fs.StringVar(&config.checkpointFile, "checkpoint", "passmut.checkpoint", "checkpoint written when a limit stops the run")
+	fs.StringVar(&config.resumeFile, "resume", "", "continue from a checkpoint")
+	fs.StringVar(&config.control, "control", "", "accept pause/resume/status/set-rate/stop-after on stdin, fd:N or a Unix socket")
+	fs.StringVar(&config.session, "session", "", "name the run and write <name>.manifest.json next to the output")
+	fs.StringVar(&config.window, "window", "", "bounded --sort window, e.g. 10M candidates")
+	fs.StringVar(&config.budget, "budget", "", "drop the least effective rules until the estimate fits N candidates, e.g. 1e9")
+	fs.BoolVar(&config.collapseRuns, "collapse-runs", false, "write complete runs of digits as hashcat hybrid wordlist + mask pairs")
+	fs.IntVar(&config.collapseMin, "collapse-min", 100, "smallest run --collapse-runs collapses")
+	fs.BoolVar(&config.assumeYes, "assume-yes", false, "write even if the estimated output exceeds free disk space")
+	fs.BoolVar(&config.deterministic, "deterministic", false, "byte-identical output across runs and machines")
+	fs.Int64Var(&config.randomSeed, "random-seed", 0, "seed --sample, --shuffle, --sample-rate and passphrases for repeatable draws")
+	fs.BoolVar(&config.ordered, "ordered", false, "write candidates in input word order while using every thread")
+	fs.StringVar(&config.chartsDir, "charts", "", "write --analyze charts to this directory")
+	fs.StringVar(&config.chartFormat, "chart-format", "svg", "chart file format: svg, png or both")
+	fs.StringVar(&config.crackTime, "estimate-cracktime", "", "estimate crack times at HASH@RATE, e.g. NTLM@300GH/s")
+	fs.BoolVar(&config.noColor, "no-color", false, "plain help and --analyze output without ANSI colors")
+	fs.StringVar(&config.lang, "lang", "", "language of help and --analyze reports: de, es, fr or a .json translation file")
+	fs.BoolVar(&config.helpLong, "hl", false, "show the long help")
+	fs.BoolVar(&config.helpLong, "long-help", false, "show the long help")
 	fs.IntVar(&config.minStrength, "ms", 0, "min strength score (0-4)")
-	fs.IntVar(&config.passphraseCount, "pp", 0, "generate random passphrases of N words")
+	fs.IntVar(&config.passphraseCount, "passphrase", 0, "generate random passphrases of N words")
+	fs.IntVar(&config.passphraseCount, "pp", 0, "generate random passphrases of N words (shorthand)")
+	fs.StringVar(&config.componentLen, "component-len", "", "length range for passphrase components, e.g. 3-8")
 	fs.StringVar(&config.passphraseSep, "sep", "-", "separator for passphrases")
+	fs.StringVar(&config.ppWeighting, "pp-weighting", "uniform", "pick random passphrase components uniformly or by efficacy")
+	fs.BoolVar(&config.ppMutate, "pp-mutate", false, "also write passphrases with capitals, leet and digit/symbol suffixes")
+	fs.BoolVar(&config.ppUniqueWords, "pp-unique-words", false, "use each component at most once per passphrase")
+	fs.BoolVar(&config.ppSorted, "pp-sorted", false, "treat passphrases as combinations: one ordering of each set of components")
+	fs.IntVar(&config.ppExhaustiveMax, "pp-exhaustive-max", 10000, "write every passphrase when there are fewer than N, otherwise sample")
 	fs.BoolVar(&config.noNumbers, "no-numbers", false, "exclude numbers from output")
 	fs.BoolVar(&config.noSymbols, "no-symbols", false, "exclude symbols from output")
 	fs.BoolVar(&config.noCapitals, "no-capitals", false, "exclude capitals from output")
@@ -522,200 +1273,1249 @@ func parseFlags(args []string) *Config {
 	fs.IntVar(&config.threads, "threads", runtime.NumCPU(), "number of goroutines to use")
 	fs.IntVar(&config.threads, "n", runtime.NumCPU(), "number of goroutines (shorthand)")
 	fs.StringVar(&config.rulesList, "rules", "", "ordered rules to apply (comma separated)")
+	fs.StringVar(&config.rulesFile, "rules-file", "", "file of --rules recipes, one per line, each applied on its own")
 	fs.StringVar(&config.excludeCommon, "exclude-common", "", "file containing common passwords to exclude")
 	fs.BoolVar(&config.checkUpdates, "check-updates", false, "check for updates")
 	fs.BoolVar(&config.upgrade, "upgrade", false, "perform self-upgrade")
 
 	fs.StringVar(&config.seedWords, "seed", "", "comma-separated seed words")
 	fs.BoolVar(&config.keyboardWalks, "walks", false, "add common keyboard walks")
+	fs.StringVar(&config.kbShift, "kb-shift", "", "type words one key left, right, up or down (comma-separated)")
+	fs.StringVar(&config.kbLayout, "kb-layout", "qwerty", "keyboard layout for --kb-shift: qwerty, qwertz or azerty")
+	fs.StringVar(&config.substitute, "substitute", "", "replace tokens inside words, e.g. acme=globex (comma-separated old=new)")
+	fs.StringVar(&config.substituteFile, "substitute-file", "", "file of old=new token replacements, one per line")
 	fs.BoolVar(&config.smartAffix, "smart-affix", false, "add smart affixes (years, 123, symbols)")
+	fs.BoolVar(&config.numericPatterns, "numeric-patterns", false, "append numeric patterns (repeats, runs, common PINs)")
+	fs.BoolVar(&config.seasonCycle, "season-cycle", false, "replace season and month names with the rest of their cycle (WinterXYZ -> SpringXYZ)")
+	fs.BoolVar(&config.yearBump, "year-bump", false, "replace years in the word with last, this and next year (Giants2019 -> Giants2024)")
+	fs.BoolVar(&config.predictRotation, "predict-rotation", false, "predict the next password: bump numbers and years, next season/month, one more '!'")
+	fs.StringVar(&config.phonePatterns, "phone-patterns", "", "add phone numbers for area codes, e.g. NANP:415,650")
+	fs.StringVar(&config.patternLocks, "pattern-locks", "", "add Android unlock patterns of N-M dots as digit strings, likeliest first")
+	fs.IntVar(&config.patternTop, "pattern-top", 0, "only add the N likeliest --pattern-locks")
+	fs.StringVar(&config.zipcodes, "zipcodes", "", "add postal codes of regions or patterns, e.g. us:CA,94xxx")
+	fs.StringVar(&config.zipPack, "zip-pack", "", "extra postal code pack (file or URL) for --zipcodes")
 	fs.BoolVar(&config.toggleVariations, "toggle-variations", false, "add toggle case permutations")
+	fs.BoolVar(&config.restoreCase, "restore-case", false, "also write candidates with the input word's casing restored")
+	fs.BoolVar(&config.filterOnly, "filter-only", false, "only apply output filters to the input")
+	fs.StringVar(&config.sample, "sample", "", "keep a random sample of N candidates")
+	fs.BoolVar(&config.shuffle, "shuffle", false, "shuffle the output")
+	fs.IntVar(&config.minDigits, "min-digits", 0, "min number of digits")
+	fs.IntVar(&config.maxDigits, "max-digits", 0, "max number of digits")
+	fs.IntVar(&config.minUpper, "min-upper", 0, "min number of uppercase letters")
+	fs.IntVar(&config.maxUpper, "max-upper", 0, "max number of uppercase letters")
+	fs.IntVar(&config.minLower, "min-lower", 0, "min number of lowercase letters")
+	fs.IntVar(&config.maxLower, "max-lower", 0, "max number of lowercase letters")
+	fs.IntVar(&config.minSymbols, "min-symbols", 0, "min number of symbols")
+	fs.IntVar(&config.maxSymbols, "max-symbols", 0, "max number of symbols")
+	fs.IntVar(&config.minClasses, "min-classes", 0, "min number of character classes (1-4)")
+	fs.IntVar(&config.maxRepeat, "max-repeat", 0, "max consecutive repeats of a character")
+	fs.StringVar(&config.lengthMode, "length-mode", "runes", "measure length in runes or bytes")
+	fs.IntVar(&config.fitLength, "fit-length", 0, "truncate or pad every candidate to exactly N characters")
+	fs.StringVar(&config.fitStrategy, "fit-strategy", "truncate", "how --fit-length fits: truncate, pad:X or pad-digits")
+	fs.IntVar(&config.maxBytes, "max-bytes", 0, "drop or truncate candidates longer than N bytes, e.g. 255 for hashcat")
+	fs.StringVar(&config.maxBytesAction, "max-bytes-action", "drop", "what --max-bytes does to longer candidates: drop or truncate")
+	fs.StringVar(&config.forHash, "for-hash", "", "shape candidates to what a hash can represent: ntlm, lm, descrypt, bcrypt or wpa2")
+	fs.Var(&lmModeFlag{&config.lmMode}, "lm-mode", "LM workflow: split candidates into uppercase halves, or with =`recombine` join cracked halves")
+	fs.BoolVar(&config.wifi, "wifi", false, "WPA/WPA2 preset: 8-63 printable ASCII, --ssid seeds first, output in input order")
+	fs.StringVar(&config.ssid, "ssid", "", "network names to derive seed words from, mangled first (comma-separated)")
+	fs.StringVar(&config.domains, "domains", "", "expand input names into mailbox addresses at these domains (comma-separated)")
+	fs.StringVar(&config.emailAs, "email-as", "output", "use --domains addresses as output (unmangled) or as seeds")
+	return fs
+}
 
-	fs.Parse(args)
-	return config
+// applyImplied switches on the options that other options imply. fs is the
+// flag set c was parsed with, to tell which flags were given; it may be nil.
+func (c *Config) applyImplied(fs *flag.FlagSet) {
+	punctMaxSet := false
+	if fs != nil {
+		fs.Visit(func(f *flag.Flag) { punctMaxSet = punctMaxSet || f.Name == "punct-max" })
+	}
+	// Any of the punctuation tuning flags implies --punctuation, an
+	// explicit --punct-max 1 included
+	if c.punctSet != "" || punctMaxSet || c.punctMax > 1 || c.punctPrefix {
+		c.punctuation = true
+	}
+	// --leet-positions limits --leet (or --full-leet) and implies it
+	if c.leetPositions != "" && !c.fullLeet {
+		c.leet = true
+	}
+	// --no-dedup is --dedup-scope none; any other scope is a conflict (validate)
+	if c.noDedup && c.dedupScope == "global" {
+		c.dedupScope = "none"
+	}
+	// --wifi fills in the WPA length limits and keeps the SSID seeds and the
+	// input's likelihood order at the front of the output
+	if c.wifi {
+		if c.minLength == 0 {
+			c.minLength = wpaMinLength
+		}
+		if c.maxLength == 0 {
+			c.maxLength = wpaMaxLength
+		}
+		if c.dedupOrder == "" || c.dedupOrder == "any" {
+			c.dedupOrder = "first"
+		}
+	}
+	// --ordered is --dedup-order first: jobs are committed in input order
+	if c.ordered {
+		c.dedupOrder = "first"
+	}
 }
 
-func showUsage() {
-	y := "\033[33m" // Yellow for parameters
-	b := "\033[1m"  // Bold for values
-	r := "\033[0m"  // Reset
-
-	fmt.Fprintf(os.Stderr, "passmut v%s - password mutation engine\n\n", version)
-	fmt.Fprintf(os.Stderr, "Basic usage:\n\tpassmut %s--file%s %swordlist.txt%s\n\n", y, r, b, r)
-	fmt.Fprintf(os.Stderr, "To pass the initial words in on standard in:\n\tcat wordlist.txt | passmut\n\n")
-	fmt.Fprintf(os.Stderr, "Usage: passmut [%sOPTION%s]\n", b, r)
-	// Always at top
-	fmt.Fprintf(os.Stderr, "\t%s-h%s, %s--help%s: show help (%s-hl%s: show long help)\n", y, r, y, r, y, r)
-	fmt.Fprintf(os.Stderr, "\t%s-f%s, %s--file%s %s<file>%s: input file(s), use commas for list\n", y, r, y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\t%s-o%s, %s--output%s %s<file>%s: the output file, use - for STDOUT\n", y, r, y, r, b, r)
-	// Alphabetically sorted by short param
-	fmt.Fprintf(os.Stderr, "\t%s-a%s, %s--analyze%s: analyze the input wordlist(s) and show statistics\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "\t%s-A%s, %s--acronym%s: create acronyms from input words\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "\t%s-ac%s, %s--all-cases%s: all case permutations (warning: huge output)\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "\t%s-c%s, %s--capital%s: capitalise the word\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "\t%s-C%s, %s--common%s %s[file]%s: add common words (%sbuilt-in%s)\n", y, r, y, r, b, r, b, r)
-	fmt.Fprintf(os.Stderr, "\t%s-cr%s, %s--crunch%s %s<mask>%s: crunch-style filter (%s...ket##&%s)\n", y, r, y, r, b, r, b, r)
-	fmt.Fprintf(os.Stderr, "\t%s-d%s, %s--double%s: double each word\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "\t%s-l%s, %s--lower%s: lowercase the word\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "\t%s-L%s, %s--level%s %s<0-2>%s: mutation complexity level\n", y, r, y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\t%s-m%s, %s--min%s %s<N>%s: minimum word length\n", y, r, y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\t%s-n%s, %s--threads%s %s<N>%s: number of goroutines\n", y, r, y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\t%s-p%s, %s--perms%s: permutate all the words\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "\t%s-pp%s, %s--passphrase%s %s<N>%s: generate passphrases\n", y, r, y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\t%s-pr%s, %s--prefix-range%s %s<R>%s: add range of numbers to the beginning [01-99]\n", y, r, y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\t%s-ps%s, %s--prefix-strings%s %s<S>%s: add strings to the start (comma-separated)\n", y, r, y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\t%s-r%s, %s--reverse%s: reverse the word\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "\t%s-s%s, %s--swap%s: swap the case of the word\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "\t%s-S%s, %s--sort%s %s<M>%s: sort mode: %s'a'%s for alpha, %s'e'%s for efficacy\n", y, r, y, r, b, r, b, r, b, r)
-	fmt.Fprintf(os.Stderr, "\t%s-sr%s, %s--suffix-range%s %s<R>%s: add range of numbers to the end [100-999]\n", y, r, y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\t%s-ss%s, %s--suffix-strings%s %s<S>%s: add strings to the end (comma-separated)\n", y, r, y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\t%s-t%s, %s--leet%s: l33t speak the word\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "\t%s-T%s, %s--full-leet%s: all possibilities l33t\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "\t%s--seed%s %s<words>%s: inject seed words (comma-separated)\n", y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\t%s--walks%s: add common keyboard walks\n", y, r)
-	fmt.Fprintf(os.Stderr, "\t%s--smart-affix%s: add smart affixes (years, 123, symbols)\n", y, r)
-	fmt.Fprintf(os.Stderr, "\t%s--toggle-variations%s: add toggle case permutations\n", y, r)
-	fmt.Fprintf(os.Stderr, "\t%s-u%s, %s--upper%s: uppercase the word\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "\t%s-v%s: show version\n", y, r)
-	fmt.Fprintf(os.Stderr, "\t%s-x%s, %s--max%s %s<N>%s: maximum word length\n", y, r, y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\t%s-y%s, %s--years%s: add range of years [1980-2020]\n", y, r, y, r)
-	// Long-only options
-	fmt.Fprintf(os.Stderr, "\t%s--rules%s %s<operators>%s: custom recipe (e.g. %s-r,-u,-t%s)\n", y, r, b, r, b, r)
-	fmt.Fprintf(os.Stderr, "\t%s--exclude-common%s %s<file>%s: blacklist file\n", y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\t%s--check-updates%s, %s--upgrade%s: maintenance engine\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "\t%s--punctuation%s: add common punctuation to the end\n", y, r)
-	fmt.Fprintf(os.Stderr, "\t%s--space%s: add spaces between words\n", y, r)
-	fmt.Fprintf(os.Stderr, "\t%s--sep%s %s<char>%s: separator for passphrases\n", y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\t%s--no-numbers%s: exclude words with numbers\n", y, r)
-	fmt.Fprintf(os.Stderr, "\t%s--no-symbols%s: exclude words with symbols\n", y, r)
-	fmt.Fprintf(os.Stderr, "\t%s--no-capitals%s: exclude words with capitals\n", y, r)
-	//fmt.Fprintf(os.Stderr, "\t%s  %s\n", renderTogglePill(false), renderTogglePill(true))
+// withOverrides returns a copy of c with per-file overrides applied, e.g.
+// "rules=capital,suffix-range=0-99". Keys are flag names. A segment without
+// '=' extends the previous value when that flag takes a value, so lists such
+// as rules=capital,reverse keep their commas; otherwise it must name a bool
+// flag, which is switched on.
+func (c *Config) withOverrides(spec string) (*Config, error) {
+	p := &Config{}
+	fs := newFlagSet(p, flag.ContinueOnError)
+	// Registering the flags reset p to defaults; start again from c
+	*p = *c
+	p.Rules = append([]string(nil), c.Rules...)
+
+	isBool := func(name string) bool {
+		f := fs.Lookup(name)
+		if f == nil {
+			return false
+		}
+		bf, ok := f.Value.(interface{ IsBoolFlag() bool })
+		return ok && bf.IsBoolFlag()
+	}
+	var keys, vals []string
+	for _, seg := range strings.Split(spec, ",") {
+		k, v, found := strings.Cut(seg, "=")
+		k = strings.TrimSpace(k)
+		switch {
+		case found:
+			keys, vals = append(keys, k), append(vals, v)
+		case len(keys) > 0 && !isBool(keys[len(keys)-1]):
+			vals[len(vals)-1] += "," + seg
+		case isBool(k):
+			keys, vals = append(keys, k), append(vals, "true")
+		default:
+			return nil, fmt.Errorf("invalid override %q", seg)
+		}
+	}
+	for i, k := range keys {
+		if fs.Lookup(k) == nil {
+			return nil, fmt.Errorf("unknown override %q", k)
+		}
+		if err := fs.Set(k, vals[i]); err != nil {
+			return nil, fmt.Errorf("override %s=%s: %w", k, vals[i], err)
+		}
+	}
+	p.applyImplied(fs)
+	if err := p.parseRepeatTo(); err != nil {
+		return nil, err
+	}
+	return p, nil
 }
 
-// renderTogglePill returns a pill-shaped toggle indicator
-// OFF: gray circle (◯), ON: green filled circle (●)
-// func renderTogglePill(isOn bool) string {
-// 	gray := "\033[90m"   // Bright black (gray)
-// 	green := "\033[32m"  // Green
-// 	reset := "\033[0m"   // Reset
-// 	if isOn {
-// 		return fmt.Sprintf("%s●%s", green, reset)
-// 	} else {
-// 		return fmt.Sprintf("%s◯%s", gray, reset)
-// 	}
-// }
+// inputSpec is one entry of --file: a path (or glob), optional per-file
+// overrides written as path[key=value,...] and an optional weight written
+// as path:weight=N
+type inputSpec struct {
+	path      string
+	overrides string
+	weight    string
+}
 
-func showLongUsage() {
-	y := "\033[33m"
-	b := "\033[1m"
-	r := "\033[0m"
+// parseInputSpecs splits a --file value on ',' or ';' outside brackets and
+// expands globs. An entry with ';' that names an existing file is kept
+// whole. A trailing [...] containing '=' is taken as overrides, so bracket
+// globs such as "list[0-9].txt" keep working.
+func parseInputSpecs(list string) []inputSpec {
+	var parts []string
+	for _, part := range splitOutsideBrackets(list, ',') {
+		if _, err := os.Stat(strings.TrimSpace(part)); err == nil {
+			parts = append(parts, part)
+			continue
+		}
+		parts = append(parts, splitOutsideBrackets(part, ';')...)
+	}
 
-	// Header
-	fmt.Fprintf(os.Stderr, "passmut v%s - password mutation engine (Extended Help)\n\n", version)
+	var specs []inputSpec
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		var weight, overrides string
+		if i := strings.LastIndex(part, ":weight="); i > 0 {
+			part, weight = part[:i], part[i+len(":weight="):]
+		}
+		if i := strings.LastIndex(part, "["); i > 0 && strings.HasSuffix(part, "]") && strings.Contains(part[i:], "=") {
+			part, overrides = part[:i], part[i+1:len(part)-1]
+		}
+		for _, p := range expandInputs([]string{part}) {
+			specs = append(specs, inputSpec{path: p, overrides: overrides, weight: weight})
+		}
+	}
+	return specs
+}
 
-	// CONFIG & IO
-	fmt.Fprintf(os.Stderr, "CONFIG & IO:\n")
-	fmt.Fprintf(os.Stderr, "  %s-f%s, %s--file%s %s<list>%s\n", y, r, y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\tInput wordlists. Supports comma-separated files and shell globs.\n")
-	fmt.Fprintf(os.Stderr, "\tExample: passmut %s-f%s %s\"common.txt,logs/*.txt,-\"%s (reads files and stdin)\n", y, r, b, r)
-	fmt.Fprintf(os.Stderr, "  %s-o%s, %s--output%s %s<file>%s\n", y, r, y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\tFile to save results. Defaults to stdout.\n")
-	fmt.Fprintf(os.Stderr, "\tExample: passmut %s-o%s %smangled.txt%s\n", y, r, b, r)
-	fmt.Fprintf(os.Stderr, "  %s-n%s, %s--threads%s %s<N>%s\n", y, r, y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\tNumber of concurrent worker goroutines. Default: CPU core count.\n")
-	fmt.Fprintf(os.Stderr, "\tUse higher values for massive lists on high-core systems.\n\n")
+// splitOutsideBrackets splits s on sep where it is not inside [...]
+func splitOutsideBrackets(s string, sep byte) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			depth++
+		case ']':
+			if depth > 0 {
+				depth--
+			}
+		case sep:
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
 
-	// STATISTICS & ANALYSIS
-	fmt.Fprintf(os.Stderr, "STATISTICS & ANALYSIS:\n")
-	fmt.Fprintf(os.Stderr, "  %s-a%s, %s--analyze%s\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "\tInstead of mangling, it prints a statistical report of the input wordlist(s).\n")
-	fmt.Fprintf(os.Stderr, "\tIncludes length distribution charts and character complexity percentages.\n")
-	fmt.Fprintf(os.Stderr, "\tExample: passmut %s-f%s %srockyou.txt%s %s-a%s\n\n", y, r, b, r, y, r)
+// noColor is --no-color. It is package state because usage can be shown
+// before the flags are parsed.
+var noColor bool
 
-	// CONSTRAINTS & EXCLUSIONS
-	fmt.Fprintf(os.Stderr, "CONSTRAINTS & EXCLUSIONS:\n")
-	fmt.Fprintf(os.Stderr, "  %s-m%s, %s--min%s %s<N>%s, %s-x%s, %s--max%s %s<N>%s\n", y, r, y, r, b, r, y, r, y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\tOnly output words within the specified length range.\n")
-	fmt.Fprintf(os.Stderr, "  %s-cr%s, %s--crunch%s %s<mask>%s\n", y, r, y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\tCrunch-style mask filtering. \n")
-	fmt.Fprintf(os.Stderr, "\t.=any, #=digit, ^=upper, %%=lower, &=special\n")
-	fmt.Fprintf(os.Stderr, "\tExample: %s-cr%s %s'....#'%s (only 5-char words ending in a digit)\n", y, r, b, r)
-	fmt.Fprintf(os.Stderr, "  %s-ms%s, %s--min-strength%s %s<0-4>%s\n", y, r, y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\tFilters output based on complexity score. 0=Weak, 4=Supreme.\n")
-	fmt.Fprintf(os.Stderr, "\tExample: %s-ms%s %s3%s\n", y, r, b, r)
-	fmt.Fprintf(os.Stderr, "  %s--exclude-common%s %s<file>%s\n", y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\tSupply a file of passwords to discard from final results.\n")
-	fmt.Fprintf(os.Stderr, "  %s--no-numbers%s, %s--no-symbols%s, %s--no-capitals%s\n", y, r, y, r, y, r)
-	fmt.Fprintf(os.Stderr, "\tExclude words containing numbers, symbols, or capital letters respectively.\n\n")
+// colorEnabled reports whether f is a terminal that renders ANSI colors.
+// --no-color, a non-empty NO_COLOR (no-color.org), TERM=dumb, a redirect to
+// a file or pipe and a console without VT support all turn them off.
+func colorEnabled(f *os.File) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	stat, err := f.Stat()
+	if err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	return consoleANSI(f)
+}
 
-	// SORTING & PRIORITIZATION
-	fmt.Fprintf(os.Stderr, "SORTING & PRIORITIZATION:\n")
-	fmt.Fprintf(os.Stderr, "  %s-S%s, %s--sort%s %s<a|e>%s\n", y, r, y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\t%s'a'%s: Alphabetical sort of the final list.\n", b, r)
-	fmt.Fprintf(os.Stderr, "\t%s'e'%s: Efficacy sort. Uses RockYou-derived weights to move common patterns to the top.\n", b, r)
-	fmt.Fprintf(os.Stderr, "\tExample: passmut %s-f%s %swords.txt%s %s-S%s %se%s\n\n", y, r, b, r, y, r, b, r)
+// usageColors returns the escapes for parameters, values and reset in help
+// text, or empty strings when stderr does not render colors
+func usageColors() (y, b, r string) {
+	if !colorEnabled(os.Stderr) {
+		return "", "", ""
+	}
+	return "\033[33m", "\033[1m", "\033[0m"
+}
 
-	// PASSPHRASE GENERATION
-	fmt.Fprintf(os.Stderr, "PASSPHRASE GENERATION:\n")
-	fmt.Fprintf(os.Stderr, "  %s-pp%s, %s--passphrase%s %s<N>%s\n", y, r, y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\tInstead of mangling, it generates random combinations of N words.\n")
-	fmt.Fprintf(os.Stderr, "  %s--sep%s %s<char>%s\n", y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\tThe separator to use between words (defaults to '-').\n")
-	fmt.Fprintf(os.Stderr, "\tExample: %s-pp%s %s3%s %s--sep%s %s_%s\n\n", y, r, b, r, y, r, b, r)
+//go:embed locales
+var localeFiles embed.FS
 
-	// TEXT MANIPULATION (SIMPLE)
-	fmt.Fprintf(os.Stderr, "TEXT MANIPULATION (SIMPLE):\n")
-	fmt.Fprintf(os.Stderr, "  %s-c%s, %s--capital%s       Capitalize first letter.\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "  %s-u%s, %s--upper%s         Convert to FULL UPPERCASE.\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "  %s-l%s, %s--lower%s         Convert to full lowercase.\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "  %s-s%s, %s--swap%s          Toggle casing (e.g. Apple -> aPPLE).\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "  %s-r%s, %s--reverse%s       Reverse the string (e.g. elppa).\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "  %s-t%s, %s--leet%s          Simple l33t replacement.\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "  %s-T%s, %s--full-leet%s     Generate all recursive l33t combinations.\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "  %s-ac%s, %s--all-cases%s    Generate all case permutations (warning: huge output).\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "  %s-d%s, %s--double%s        Append word to itself.\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "  %s-A%s, %s--acronym%s       Create acronyms from input words.\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "  %s--space%s             Add spaces between words (for permutations).\n", y, r)
-	fmt.Fprintf(os.Stderr, "  %s--seed%s %s<words>%s      Inject seed words (comma-separated).\n", y, r, b, r)
-	fmt.Fprintf(os.Stderr, "  %s--walks%s             Add common keyboard walks.\n", y, r)
-	fmt.Fprintf(os.Stderr, "  %s--toggle-variations%s Add toggle case permutations.\n\n", y, r)
+// catalog maps the English help and --analyze strings to their --lang
+// translation. Strings it lacks are printed in English.
+var catalog map[string]string
 
-	// TEXT MANIPULATION (APPEND/PREPEND)
-	fmt.Fprintf(os.Stderr, "TEXT MANIPULATION (APPEND/PREPEND):\n")
-	fmt.Fprintf(os.Stderr, "  %s-C%s, %s--common%s %s[file]%s\n", y, r, y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\tAdd common words (admin, sys, etc) or load from file.\n")
-	fmt.Fprintf(os.Stderr, "  %s--smart-affix%s\n", y, r)
-	fmt.Fprintf(os.Stderr, "\tAdd smart affixes (years, 123, symbols).\n")
-	fmt.Fprintf(os.Stderr, "  %s-ps%s, %s--prefix-strings%s %s<S>%s\n", y, r, y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\tAdd comma-separated strings to the start of each word.\n")
-	fmt.Fprintf(os.Stderr, "  %s-ss%s, %s--suffix-strings%s %s<S>%s\n", y, r, y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\tAdd comma-separated strings to the end of each word.\n")
-	fmt.Fprintf(os.Stderr, "  %s-pr%s, %s--prefix-range%s %s<R>%s\n", y, r, y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\tAdd a range of numbers to the start (e.g. 0-99).\n")
-	fmt.Fprintf(os.Stderr, "  %s-sr%s, %s--suffix-range%s %s<R>%s\n", y, r, y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\tAdd a range of numbers to the end (e.g. 0-99).\n")
-	fmt.Fprintf(os.Stderr, "  %s-y%s, %s--years%s\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "\tAdd year ranges (1980-current) to start and end.\n")
-	fmt.Fprintf(os.Stderr, "  %s--punctuation%s\n", y, r)
-	fmt.Fprintf(os.Stderr, "\tAppend common punctuation symbols (!@$%%^&*()).\n\n")
+// formatVerbRe matches the fmt verbs of a help or report string
+var formatVerbRe = regexp.MustCompile(`%[-+# 0-9.*]*[a-zA-Z%]`)
 
-	// RECIPE & TRANSFORMATIONS
-	fmt.Fprintf(os.Stderr, "RECIPE & TRANSFORMATIONS:\n")
-	fmt.Fprintf(os.Stderr, "  %s--rules%s %s<operators>%s\n", y, r, b, r)
-	fmt.Fprintf(os.Stderr, "\tAn ordered recipe of transformations. Accepts flag names as operators.\n")
-	fmt.Fprintf(os.Stderr, "\tExample: passmut %s--rules%s %s\"-r,--upper,-t\"%s\n\n", y, r, b, r)
+// formatVerbs returns the verbs of s that take an argument, in order
+func formatVerbs(s string) []string {
+	var verbs []string
+	for _, v := range formatVerbRe.FindAllString(s, -1) {
+		if v != "%%" {
+			verbs = append(verbs, v)
+		}
+	}
+	return verbs
+}
+
+// loadCatalog loads --lang: a built-in language (locales/<lang>.json) or
+// a translation file in the same format, a JSON object of English string
+// to translation. An entry whose format verbs differ from the English
+// string is skipped, so a slip shows English instead of garbled output.
+func loadCatalog(lang string) error {
+	var data []byte
+	var err error
+	switch {
+	case lang == "" || lang == "en":
+		catalog = nil
+		return nil
+	case strings.HasSuffix(lang, ".json"):
+		if data, err = os.ReadFile(lang); err != nil {
+			return fmt.Errorf("failed to read --lang file: %w", err)
+		}
+	default:
+		if data, err = localeFiles.ReadFile("locales/" + lang + ".json"); err != nil {
+			return fmt.Errorf("unknown --lang %q (use en, %s or a .json translation file)", lang, strings.Join(builtinLangs(), ", "))
+		}
+	}
+	var entries map[string]string
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("invalid --lang file %s: %w", lang, err)
+	}
+	catalog = make(map[string]string, len(entries))
+	skipped := 0
+	for en, t := range entries {
+		if t == "" {
+			continue
+		}
+		if !slices.Equal(formatVerbs(en), formatVerbs(t)) {
+			skipped++
+			continue
+		}
+		catalog[en] = t
+	}
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %s: skipped %d translation(s) whose format verbs differ from the English text\n", lang, skipped)
+	}
+	return nil
+}
+
+// builtinLangs lists the embedded translations
+func builtinLangs() []string {
+	files, _ := localeFiles.ReadDir("locales")
+	var langs []string
+	for _, f := range files {
+		if name, ok := strings.CutSuffix(f.Name(), ".json"); ok {
+			langs = append(langs, name)
+		}
+	}
+	return langs
+}
+
+// tr returns the --lang translation of an English help or report string
+func tr(s string) string {
+	if t, ok := catalog[s]; ok {
+		return t
+	}
+	return s
+}
+
+func showUsage() {
+	y, b, r := usageColors() // Yellow for parameters, bold for values
+
+	fmt.Fprintf(os.Stderr, tr("passmut v%s - password mutation engine\n\n"), version)
+	fmt.Fprintf(os.Stderr, tr("Basic usage:\n\tpassmut %s--file%s %swordlist.txt%s\n\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("To pass the initial words in on standard in:\n\tcat wordlist.txt | passmut\n\n"))
+	fmt.Fprintf(os.Stderr, tr("Subcommands:\n\tpassmut %smerge%s %s<files...>%s: merge and dedup wordlists (%s-o%s, %s-S a|e%s)\n"), y, r, b, r, y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\tpassmut %sfreq%s %s<files...>%s: count word frequencies (%s--top%s, %s--min-count%s)\n"), y, r, b, r, y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\tpassmut %srun%s %s<job.yaml>%s: run a pipeline declared in a YAML job file\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tpassmut %saudit%s %s--policy%s %s<policy.yaml>%s %s<files...>%s: report policy compliance\n"), y, r, y, r, b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tpassmut %sscore%s %s--against%s %s<cracked.txt>%s %s<lists...>%s: compare list coverage and efficiency\n"), y, r, y, r, b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tpassmut %sdelta%s %s--old%s %s<cracked.txt>%s: predict the next rotation of last engagement's passwords\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tpassmut %sdefaults%s %s--vendor%s %s<cisco,hp>%s: write known default user:password pairs\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tpassmut %scoverage%s %s--generated%s %s<list>%s %s--cracked%s %s<found.txt>%s: find the rule classes a list lacks\n"), y, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tpassmut %ssuggest%s %s--cracked%s %s<found.txt>%s %s--base%s %s<base.txt>%s: infer a ranked recipe file\n"), y, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tpassmut %sinfer-rule%s %s--from%s %s<word>%s %s--to%s %s<password>%s: print the rule chain between two words\n"), y, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tpassmut %sdocs%s %s--format%s %s<man|markdown>%s: write the option and recipe reference\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tpassmut %srecipe%s %s<export|import|validate|diff>%s: share, pin and compare generation configurations\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tpassmut %sverify%s %s--recipe%s %s<r.pmrecipe>%s %s--golden%s %s<expected.txt>%s %s--sample%s %s<words.txt>%s: golden-sample regression check\n"), y, r, y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tpassmut %sword%s %s<word>%s [%s--copy%s]: mangle one word given as an argument, top candidates to the clipboard\n"), y, r, b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\tpassmut %sselftest%s: check the transforms against built-in vectors\n\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("Usage: passmut [%sOPTION%s]\n"), b, r)
+	// Always at top
+	fmt.Fprintf(os.Stderr, tr("\t%s-h%s, %s--help%s: show help (%s-hl%s: show long help, %s--no-color%s: without colors)\n"), y, r, y, r, y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--lang%s %s<de|es|fr|file.json>%s: language of the help and %s-a%s reports\n"), y, r, b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-f%s, %s--file%s %s<file>%s: input file(s), use commas for list, file[key=value] for per-file options\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-o%s, %s--output%s %s<file>%s: the output file, use - for STDOUT\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--output-format%s %s<text|jsonl|parquet>%s: JSON records with source and rules, or Parquet with scores\n"), y, r, b, r)
+	// Alphabetically sorted by short param
+	fmt.Fprintf(os.Stderr, tr("\t%s-a%s, %s--analyze%s: analyze the input wordlist(s) and show statistics\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-A%s, %s--acronym%s: create acronyms from input words\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-ac%s, %s--all-cases%s: all case permutations (warning: huge output)\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-c%s, %s--capital%s: capitalise the word\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--capital-words%s: capitalise every word of joins, permutations and passphrases (%sBlueDog42%s)\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-C%s, %s--common%s %s[builtin:cat,...|file]%s: add common words (%sadmin-terms%s)\n"), y, r, y, r, b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-cr%s, %s--crunch%s %s<mask>%s: crunch-style filter (%s...ket##&%s)\n"), y, r, y, r, b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--crunch-prefix%s %s<mask>%s, %s--crunch-suffix%s %s<mask>%s: masks for the ends of any-length words (%s^^%s, %s##&%s)\n"), y, r, b, r, y, r, b, r, b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-d%s, %s--double%s: double each word\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--repeat-to%s %s<8..12>%s: repeat short words up to these lengths (abab, ab-ab, %s--repeat-sep%s)\n"), y, r, b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-l%s, %s--lower%s: lowercase the word\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-L%s, %s--level%s %s<0-4>%s: mutation complexity level (%s--chain-depth%s %s<N>%s: N passes)\n"), y, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--estimate%s: print the estimated keyspace and exit\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-m%s, %s--min%s %s<N>%s: minimum word length\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--seed-min%s %s<N>%s, %s--seed-max%s %s<N>%s: drop input words outside these lengths before mangling\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-n%s, %s--threads%s %s<N>%s: number of goroutines\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--dedup-scope%s %s<global|worker|word|none>%s: dedup under a global lock, per worker, per input word or not at all\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--no-dedup%s: skip deduplication for throughput (same as %s--dedup-scope none%s)\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--dedup-order%s %s<any|first>%s: %sfirst%s keeps the first instance in input order, independent of threads\n"), y, r, b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--deterministic%s: byte-identical output across runs and machines\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--ordered%s: write candidates in input word order while using every thread\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--mmap%s: memory-map input files (faster loading of huge lists)\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--plugin%s %s<cmd>%s: add candidates from an external transform (%s--plugin-format%s line|json)\n"), y, r, b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--wasm%s %s<file>%s: add candidates from a sandboxed WebAssembly rule module\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--dict%s %s<file>%s: extra dictionary words for strength scoring and analysis\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--freq-list%s %s<file>%s: weight efficacy by word frequency (e.g. %sbuiltin:en-freq%s)\n"), y, r, b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%sbuiltin:<name>%s in place of any wordlist path: %scommon%s, %seff-long%s, %seff-short%s, %sen-freq%s, %stop-passwords%s\n"), b, r, b, r, b, r, b, r, b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--clusters%s: with %s-a%s, cluster passwords by base word (%s--cluster-distance%s %s<n>%s)\n"), y, r, y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--sample-rate%s %s<0-1>%s: with %s-a%s, analyze a random fraction of huge inputs\n"), y, r, b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--charts%s %s<dir>%s: with %s-a%s, write length/strength/mask charts (%s--chart-format%s svg|png|both)\n"), y, r, b, r, y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--estimate-cracktime%s %s<hash@rate>%s: crack times for %s-a%s, %s--estimate%s and output\n"), y, r, b, r, y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--max-line-len%s %s<n>%s: skip input lines longer than n bytes (default 1MiB, 0 = no limit)\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--comment-prefix%s %s<str>%s: skip input lines starting with str (e.g. '#')\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--input-format%s %s<plain|csv|tsv|userpass|jsonl>%s: parse structured input\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--column%s %s<n>%s: 1-based column to extract (default 1, userpass 2)\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--line-mode%s %s<keep|split|both>%s: treat multi-word lines as a phrase, separate words or both\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--stopwords%s %s<en|file>%s: drop common function words (the, and, with...) from the input\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--field%s %s<path>%s: dotted field to extract from jsonl (default password)\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--pair-mode%s: mangle only the password of user:pass lines and emit user:mutation\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-p%s, %s--perms%s: permutate all the words\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-pp%s, %s--passphrase%s %s<N>%s: generate passphrases\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-pr%s, %s--prefix-range%s %s<R>%s: add range of numbers to the beginning [01-99]\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-ps%s, %s--prefix-strings%s %s<S>%s: add strings to the start (comma-separated)\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-r%s, %s--reverse%s: reverse the word\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--rot%s[=%sN%s]: rotate letters by N, default 13 (ROT13/Caesar)\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-s%s, %s--swap%s: swap the case of the word\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-S%s, %s--sort%s %s<M>%s: sort mode: %s'a'%s for alpha, %s'e'%s for efficacy, %s'source-then-efficacy'%s\n"), y, r, y, r, b, r, b, r, b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--window%s %s<N>%s: sort within a bounded window of N candidates (approximate order)\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--with-scores%s: write word<TAB>strength<TAB>efficacy for downstream thresholding\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--annotate%s: append a TAB and the input file each candidate came from\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--warm-start%s %s<topN>%s: write the top N leaked passwords before any mangled candidate\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-sr%s, %s--suffix-range%s %s<R>%s: add range of numbers to the end [100-999]\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-ss%s, %s--suffix-strings%s %s<S>%s: add strings to the end (comma-separated)\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--interleave%s %s<S>%s: zip strings into the word character by character (cat+123: c1a2t3)\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--interleave-words%s: zip every pair of input words\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-t%s, %s--leet%s: l33t speak the word\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-T%s, %s--full-leet%s: all possibilities l33t\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--leet-positions%s %s<first,last,vowels,N>%s: only l33t these positions (implies %s-t%s)\n"), y, r, b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--seed%s %s<words>%s: inject seed words (comma-separated)\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--walks%s: add common keyboard walks\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--kb-shift%s %s<left|right|up|down>%s: the word typed with the hands shifted one key (%s--kb-layout%s)\n"), y, r, b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--substitute%s %s<old=new,...>%s: replace tokens inside words, e.g. an old company name (%s--substitute-file%s)\n"), y, r, b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--smart-affix%s: add smart affixes (years, 123, symbols)\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--numeric-patterns%s: append repeats, ascending/descending runs and common PINs\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--season-cycle%s: replace season and month names with the others of their cycle (Winter24 -> Spring24)\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--year-bump%s: replace years in the word with last, this and next year (Giants2019! -> Giants2024!)\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--predict-rotation%s: guess the next password (Summer2023! -> Summer2024!, Autumn2023!, Summer2023!!)\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--phone-patterns%s %s<NANP:415,650>%s: add patterned phone numbers for these area codes\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--pattern-locks%s %s<4-9>%s: add Android unlock patterns as digit strings, likeliest first (%s--pattern-top%s %s<N>%s)\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--zipcodes%s %s<us:CA,94xxx>%s: add postal codes of regions or patterns to start and end (%s--zip-pack%s)\n"), y, r, b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--toggle-variations%s: add toggle case permutations\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--restore-case%s: also write each candidate with the input word's casing merged back\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-u%s, %s--upper%s: uppercase the word\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-v%s: show version\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-x%s, %s--max%s %s<N>%s: maximum word length\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--length-mode%s %s<runes|bytes>%s: how lengths are measured (default runes)\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--fit-length%s %s<N>%s: coerce candidates to exactly N characters (%s--fit-strategy%s %s<truncate|pad:X|pad-digits>%s)\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--max-bytes%s %s<N>%s: guard downstream tools, drop candidates over N bytes (%s--max-bytes-action%s %s<drop|truncate>%s)\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--for-hash%s %s<ntlm|lm|descrypt|bcrypt|wpa2>%s: only write what the hash can tell apart (LM: both halves)\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--lm-mode%s[%s=recombine%s]: write LM halves and the uppercase whole, or join cracked halves\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--wifi%s: WPA/WPA2 preset, 8-63 printable ASCII in input order; %s--ssid%s %s<names>%s seeds go first\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--domains%s %s<corp.com,...>%s: turn input names into first.last@, flast@... addresses (%s--email-as%s %s<output|seeds>%s)\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s-y%s, %s--years%s: add range of years [1980-2020]\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--ordinals%s %s<R>%s: add ordinals to start and end [1-31: 1st, 2nd, ...]\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--roman%s %s<R>%s: add roman numerals to start and end [1-20: I, II, ...]\n"), y, r, b, r)
+	// Long-only options
+	fmt.Fprintf(os.Stderr, tr("\t%s--rules%s %s<operators>%s: custom recipe (e.g. %s-r,-u,-t%s)\n"), y, r, b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--rules-file%s %s<file>%s: recipes one per line, each applied on its own\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--exclude-common%s %s<file>%s: blacklist file\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--check-updates%s, %s--upgrade%s: maintenance engine\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--punctuation%s: add common punctuation to the end\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--currency%s, %s--emoji%s: add currency symbols or emoji to start and end\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--detect-lang%s: add seasons and transliterations for each word's language (de, en, es, fr, it)\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--punct-set%s %s<chars>%s, %s--punct-max%s %s<N>%s, %s--punct-prefix%s: tune punctuation affixes\n"), y, r, b, r, y, r, b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--space%s: add spaces between words\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--sep%s %s<char>%s: separator for passphrases\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--component-len%s %s<N-M>%s: length of passphrase components (filters apply to phrases)\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--pp-weighting%s %s<uniform|efficacy>%s: pick random passphrase components by efficacy\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--pp-mutate%s: also write passphrases with capitals, leet and digit/symbol suffixes\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--pp-unique-words%s, %s--pp-sorted%s: no repeated components, one ordering per set\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--pp-exhaustive-max%s %s<N>%s: write every passphrase below N (default 10000), else sample\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--no-numbers%s: exclude words with numbers\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--no-symbols%s: exclude words with symbols\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--no-capitals%s: exclude words with capitals\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--min-digits%s/%s--max-digits%s %s<N>%s: digit count limits (also %s-upper%s, %s-lower%s, %s-symbols%s)\n"), y, r, y, r, b, r, y, r, y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--min-classes%s %s<1-4>%s: min character classes, %s--max-repeat%s %s<N>%s: max repeated chars\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--filter-only%s: apply the filters to the input without mutating it\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--sample%s %s<N>%s: keep a random sample of N candidates (e.g. %s1M%s)\n"), y, r, b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--shuffle%s: shuffle the output (disk-backed for large outputs)\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--random-seed%s %s<N>%s: seed the sample, shuffle and passphrases for repeatable draws\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--budget%s %s<N>%s: drop the least effective rules until the estimate fits N candidates\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--collapse-runs%s: write complete digit runs as hashcat hybrid wordlist + mask pairs (%s--collapse-min%s %s<N>%s)\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--assume-yes%s: write even if the estimated output exceeds free disk space\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--time-limit%s %s<2h>%s, %s--max-output%s %s<500M|2GB>%s: stop cleanly and write a checkpoint (%s--resume%s)\n"), y, r, b, r, y, r, b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--control%s %s<stdin|fd:N|socket>%s: pause, resume, status, set-rate and stop-after while running\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--session%s %s<name>%s: write %s<name>.manifest.json%s (options, input hashes, output stats) next to the output\n"), y, r, b, r, b, r)
+	//fmt.Fprintf(os.Stderr, "\t%s  %s\n", renderTogglePill(false), renderTogglePill(true))
+}
+
+// renderTogglePill returns a pill-shaped toggle indicator
+// OFF: gray circle (◯), ON: green filled circle (●)
+// func renderTogglePill(isOn bool) string {
+// 	gray := "\033[90m"   // Bright black (gray)
+// 	green := "\033[32m"  // Green
+// 	reset := "\033[0m"   // Reset
+// 	if isOn {
+// 		return fmt.Sprintf("%s●%s", green, reset)
+// 	} else {
+// 		return fmt.Sprintf("%s◯%s", gray, reset)
+// 	}
+// }
+
+func showLongUsage() {
+	y, b, r := usageColors()
+
+	// Header
+	fmt.Fprintf(os.Stderr, tr("passmut v%s - password mutation engine (Extended Help)\n\n"), version)
+
+	// CONFIG & IO
+	fmt.Fprintf(os.Stderr, tr("CONFIG & IO:\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s-f%s, %s--file%s %s<list>%s\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tInput wordlists. Supports comma-separated files and shell globs.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %s\"common.txt,logs/*.txt,-\"%s (reads files and stdin)\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tAppend %s[key=value,...]%s to a file to override mangling options for its\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\twords only; keys are flag names and bare bool flags mean true. Output\n"))
+	fmt.Fprintf(os.Stderr, tr("\tfilters stay global. Entries may also be separated with ';' (a file whose\n"))
+	fmt.Fprintf(os.Stderr, tr("\tname contains ';' is kept whole), and %s-f%s may be repeated.\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %s'names.txt[rules=capital,suffix-range=0-99];pets.txt[rules=lower]'%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tAppend %s:weight=N%s (after any overrides) to rank a file's words: %s--sort e%s\n"), b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\tmultiplies each candidate's efficacy by the weight of its source (default 1;\n"))
+	fmt.Fprintf(os.Stderr, tr("\tthe highest when several sources produce it), and %s--budget%s keeps every\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\trule for the heaviest files while their candidates fit, pruning only the\n"))
+	fmt.Fprintf(os.Stderr, tr("\tlighter ones.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %s'osint.txt:weight=5,generic.txt:weight=1'%s %s-L%s %s3%s %s--budget%s %s1e9%s\n"), y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s-o%s, %s--output%s %s<file>%s\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tFile to save results. Defaults to stdout.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-o%s %smangled.txt%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--output-format%s %s<text|jsonl|parquet>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%sjsonl%s writes one {\"candidate\", \"source\", \"rules\", \"score\"} object per line:\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\tthe input word, the shortest chain of rules that produced the candidate and\n"))
+	fmt.Fprintf(os.Stderr, tr("\tits 0-4 strength. --with-scores adds \"efficacy\", --pair-mode adds \"user\".\n"))
+	fmt.Fprintf(os.Stderr, tr("\tRecords are written as candidates are found, so it cannot be combined with\n"))
+	fmt.Fprintf(os.Stderr, tr("\t--sort, --sample, --shuffle, --dedup-scope worker or --passphrase.\n"))
+	fmt.Fprintf(os.Stderr, tr("\t%sparquet%s writes an uncompressed Parquet file with the columns word, length,\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\tstrength (0-4) and efficacy, for loading into Spark, DuckDB or pandas without\n"))
+	fmt.Fprintf(os.Stderr, tr("\tconverting text. Rows are written in groups of %d, so memory stays bounded.\n"), parquetRowGroupRows)
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %swords.txt%s %s--output-format%s %sparquet%s %s-o%s %scands.parquet%s\n"), y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--mmap%s\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tMemory-map input files and split lines without copying them. Cuts load time\n"))
+	fmt.Fprintf(os.Stderr, tr("\tand GC pressure for multi-gigabyte lists. Falls back to buffered reads for\n"))
+	fmt.Fprintf(os.Stderr, tr("\tstdin, .gz files and platforms without mmap. The files must not be\n"))
+	fmt.Fprintf(os.Stderr, tr("\ttruncated while passmut runs.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--max-line-len%s %s<n>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tSkip input lines longer than n bytes instead of aborting the whole file.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tSkipped lines are counted and reported on stderr. Default 1MiB, 0 = no limit.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--comment-prefix%s %s<str>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tSkip annotated lines such as SecLists '# Source: ...' headers. Off by default,\n"))
+	fmt.Fprintf(os.Stderr, tr("\tsince real passwords can start with '#'. UTF-8 BOMs are always stripped.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s--comment-prefix%s %s'#'%s %s-f%s %sseclists.txt%s\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--input-format%s %s<plain|csv|tsv|userpass>%s, %s--column%s %s<n>%s\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tExtract one column from delimited breach dumps instead of piping through cut.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tcsv honours quoted fields; userpass splits on the first ':' and defaults to\n"))
+	fmt.Fprintf(os.Stderr, tr("\tthe password (column 2). Lines without the column are counted and skipped.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s--input-format%s %scsv%s %s--column%s %s3%s %s-f%s %sdump.csv%s\n"), y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--input-format%s %sjsonl%s %s--field%s %s<path>%s\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tRead one JSON object per line and extract a field by dotted path; array\n"))
+	fmt.Fprintf(os.Stderr, tr("\telements are addressed by index. Numeric values are kept as written.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s--input-format%s %sjsonl%s %s--field%s %screds.password%s %s-f%s %sexport.jsonl%s\n"), y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--line-mode%s %s<keep|split|both>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tHow to seed from lines such as 'john smith': keep the phrase (default), split\n"))
+	fmt.Fprintf(os.Stderr, tr("\tit into one seed per whitespace-separated word, or both. Applied after column\n"))
+	fmt.Fprintf(os.Stderr, tr("\textraction; single-word lines are unaffected.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s--line-mode%s %sboth%s %s-f%s %snames.txt%s\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--stopwords%s %s<en|file>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tDrop stop words from the input, matched case-insensitively. %sen%s is a built-in\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\tEnglish list; a file holds one word per line ('#' comments allowed). Pairs\n"))
+	fmt.Fprintf(os.Stderr, tr("\twell with %s--line-mode split%s on text scraped from pages and documents.\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s--line-mode%s %ssplit%s %s--stopwords%s %sen%s %s-f%s %spage.txt%s\n"), y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--pair-mode%s\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tTreat input lines as user:pass, mangle only the password (split on the first\n"))
+	fmt.Fprintf(os.Stderr, tr("\t':') and emit user:mutation for every candidate. Filters apply to the password\n"))
+	fmt.Fprintf(os.Stderr, tr("\talone. Cannot be combined with --perms, --acronym, --common or --passphrase.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s--pair-mode%s %s-f%s %scombo.txt%s %s--level%s %s1%s\n"), y, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--season-cycle%s\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tFind season and month names inside the word, in any language with a locale\n"))
+	fmt.Fprintf(os.Stderr, tr("\tpack (de, en, es, fr, it), and write it with each replaced by every other\n"))
+	fmt.Fprintf(os.Stderr, tr("\tmember of the cycle in the same case: WinterXYZ -> SpringXYZ, SummerXYZ, ...,\n"))
+	fmt.Fprintf(os.Stderr, tr("\tMärz2024 -> Januar2024, ... With %s--year-bump%s it covers the usual rotations.\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %sbreach.txt%s %s--season-cycle%s %s--year-bump%s\n"), y, r, b, r, y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--year-bump%s\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tFind years anywhere in the word (1900-2099, or any 2-digit number on its own)\n"))
+	fmt.Fprintf(os.Stderr, tr("\tand write it with each replaced by last, this and next year in the same width,\n"))
+	fmt.Fprintf(os.Stderr, tr("\tkeeping the text around it: Giants2019! -> Giants2023!, Giants2024!, Giants2025!.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %sbreach.txt%s %s--year-bump%s\n"), y, r, b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--predict-rotation%s\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tPredict what users change an expiring password to: the last number plus one\n"))
+	fmt.Fprintf(os.Stderr, tr("\tand two (years and counters, zero padding kept), the next season or month in\n"))
+	fmt.Fprintf(os.Stderr, tr("\tthe same case (Winter2023 -> Spring2023, Spring2024) and one more trailing\n"))
+	fmt.Fprintf(os.Stderr, tr("\tsymbol or '!'. With %s--pair-mode%s, old user:pass dumps become next-password guesses.\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s--pair-mode%s %s-f%s %sold-creds.txt%s %s--predict-rotation%s\n"), y, r, y, r, b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--plugin%s %s<cmd>%s, %s--plugin-format%s %s<line|json>%s\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tRun an external transform: each worker starts the command, writes every seed\n"))
+	fmt.Fprintf(os.Stderr, tr("\tword to its stdin and filters and deduplicates the answer like built-in\n"))
+	fmt.Fprintf(os.Stderr, tr("\toutput. With the line protocol the command answers each word with any\n"))
+	fmt.Fprintf(os.Stderr, tr("\tnumber of candidate lines followed by an empty line; with json, one line\n"))
+	fmt.Fprintf(os.Stderr, tr("\tholding a JSON string or array. The command must flush after every answer\n"))
+	fmt.Fprintf(os.Stderr, tr("\tand is split on spaces, not run by a shell. An answer that takes longer\n"))
+	fmt.Fprintf(os.Stderr, tr("\tthan %s--plugin-timeout%s (default 30s, 0 for no limit) stops the run.\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %swords.txt%s %s--plugin%s %s'python3 -u myrule.py'%s\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--wasm%s %s<file>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tRun a portable, sandboxed rule module inside the worker pool. The module\n"))
+	fmt.Fprintf(os.Stderr, tr("\texports memory, alloc(size) -> ptr and mutate(ptr, len) -> ptr<<32|len\n"))
+	fmt.Fprintf(os.Stderr, tr("\twhose output is newline-separated candidates. See README for the ABI.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %swords.txt%s %s--wasm%s %sorg-rules.wasm%s\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s-n%s, %s--threads%s %s<N>%s\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tNumber of concurrent worker goroutines. Default: CPU core count.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tUse higher values for massive lists on high-core systems.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--dedup-scope%s %s<global|worker|word|none>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%sglobal%s (default): every candidate is checked against one shared set.\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%sworker%s: each worker dedups locally into a temporary file without locking,\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\tthen a final merge pass removes duplicates across workers. Faster on many\n"))
+	fmt.Fprintf(os.Stderr, tr("\tcores, at the cost of temporary disk space and per-worker memory.\n"))
+	fmt.Fprintf(os.Stderr, tr("\t%sword%s: only the variants of one input word are deduplicated; the same\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\tcandidate may come out again for another word. Memory no longer grows with\n"))
+	fmt.Fprintf(os.Stderr, tr("\tthe output.\n"))
+	fmt.Fprintf(os.Stderr, tr("\t%snone%s: no deduplication. For consumers that dedup themselves, e.g. hashcat.\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--no-dedup%s\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tShorthand for %s--dedup-scope none%s.\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %swords.txt%s %s-L%s %s3%s %s--no-dedup%s | hashcat -m 1000 hashes.txt\n"), y, r, b, r, y, r, b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--dedup-order%s %s<any|first>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%sany%s (default): with several workers, whichever finishes a word first writes\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\tits candidates, so a duplicate may be kept at a later position of the input.\n"))
+	fmt.Fprintf(os.Stderr, tr("\t%sfirst%s: workers still mangle in parallel, but each word's candidates are held\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\tuntil all earlier words are written. The first instance in pipeline order (input\n"))
+	fmt.Fprintf(os.Stderr, tr("\tword, then generation order) wins, as with a single worker, so probability-\n"))
+	fmt.Fprintf(os.Stderr, tr("\tordered wordlists keep their order. Not with %s--dedup-scope worker%s.\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %srockyou.txt%s %s-L%s %s2%s %s-n%s %s16%s %s--dedup-order%s %sfirst%s\n"), y, r, b, r, y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--deterministic%s\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tGolden-output mode for reproducible research: words committed in input\n"))
+	fmt.Fprintf(os.Stderr, tr("\torder on every worker, each word's variants written in sorted order, a fixed\n"))
+	fmt.Fprintf(os.Stderr, tr("\tseed for --sample, --shuffle, --sample-rate and passphrases, and %d as the\n"), deterministicYear)
+	fmt.Fprintf(os.Stderr, tr("\tcurrent year. With --dedup-scope worker it runs a single worker.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %swords.txt%s %s-L%s %s2%s %s--deterministic%s\n"), y, r, b, r, y, r, b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--ordered%s\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tKeep the output in input word order without giving up threads: workers tag\n"))
+	fmt.Fprintf(os.Stderr, tr("\teach word with its position and a reorder buffer writes finished words in\n"))
+	fmt.Fprintf(os.Stderr, tr("\tsequence. The buffer holds at most %d words per thread; when the oldest word\n"), reorderWindow)
+	fmt.Fprintf(os.Stderr, tr("\tis slow, reading stops until it is written. Implies --dedup-order first; not\n"))
+	fmt.Fprintf(os.Stderr, tr("\twith --dedup-scope worker, --sort or --shuffle.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %srockyou.txt%s %s-L%s %s2%s %s-n%s %s16%s %s--ordered%s\n\n"), y, r, b, r, y, r, b, r, y, r, b, r, y, r)
+
+	// STATISTICS & ANALYSIS
+	fmt.Fprintf(os.Stderr, tr("STATISTICS & ANALYSIS:\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s-a%s, %s--analyze%s\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\tInstead of mangling, it prints a statistical report of the input wordlist(s).\n"))
+	fmt.Fprintf(os.Stderr, tr("\tIncludes length and entropy distribution charts, entropy percentiles,\n"))
+	fmt.Fprintf(os.Stderr, tr("\tcharacter complexity percentages and duplicate/top repeated passwords.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tWith %s--pair-mode%s, user:pass input also lists users sharing a password.\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %srockyou.txt%s %s-a%s\n"), y, r, b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--clusters%s, %s--cluster-distance%s %s<n>%s\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tAdd a reuse report to --analyze: passwords are grouped by base word (letters\n"))
+	fmt.Fprintf(os.Stderr, tr("\tonly, lowercased, leet undone) and groups whose bases are within n edits\n"))
+	fmt.Fprintf(os.Stderr, tr("\t(default 2) are merged, so Spring2023! and Spring2024! land together.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %sad_dump.txt%s %s-a%s %s--clusters%s\n"), y, r, b, r, y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--sample-rate%s %s<0-1>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tStream the input and keep each word with the given probability, so huge\n"))
+	fmt.Fprintf(os.Stderr, tr("\tdumps can be characterised in bounded memory. The report states the sample\n"))
+	fmt.Fprintf(os.Stderr, tr("\tsize and the 95%% confidence margin of its percentages.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %sbreach.txt%s %s-a%s %s--sample-rate%s %s0.01%s\n"), y, r, b, r, y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--charts%s %s<dir>%s, %s--chart-format%s %s<svg|png|both>%s\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tRender the length, strength and top mask distributions of --analyze as\n"))
+	fmt.Fprintf(os.Stderr, tr("\tlength, strength and masks image files in dir, ready to embed in reports.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %sad_dump.txt%s %s-a%s %s--charts%s %sreport/%s\n"), y, r, b, r, y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--estimate-cracktime%s %s<hash@rate>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tTurn counts into attack time at the given guessing rate (K/M/G/T suffixes).\n"))
+	fmt.Fprintf(os.Stderr, tr("\tWith %s-a%s, reports the share of passwords whose mask is exhausted within a\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tminute, hour, day, month and year; with %s--estimate%s or when generating, the\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\ttime to run the whole list. A bare hash name (md5, ntlm, sha1, sha256,\n"))
+	fmt.Fprintf(os.Stderr, tr("\tsha512, netntlmv2, krb5tgs, wpa2, sha512crypt, bcrypt) uses one RTX 4090.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %sad_dump.txt%s %s-a%s %s--estimate-cracktime%s %sNTLM@300GH/s%s\n\n"), y, r, b, r, y, r, y, r, b, r)
+
+	// CONSTRAINTS & EXCLUSIONS
+	fmt.Fprintf(os.Stderr, tr("CONSTRAINTS & EXCLUSIONS:\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s-m%s, %s--min%s %s<N>%s, %s-x%s, %s--max%s %s<N>%s\n"), y, r, y, r, b, r, y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tOnly output words within the specified length range.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--seed-min%s %s<N>%s, %s--seed-max%s %s<N>%s\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tDrop input words outside this length range at load time, so single letters\n"))
+	fmt.Fprintf(os.Stderr, tr("\tand runaway lines from scraped sources never reach the mutation stages.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tUnlike --min/--max these bound the seeds, not the candidates.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--length-mode%s %s<runes|bytes>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tMeasure lengths in characters (%srunes%s, default) or UTF-8 %sbytes%s for --min/--max,\n"), b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t--crunch positions and strength scoring. 'größe' is 5 runes but 7 bytes.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--fit-length%s %s<N>%s, %s--fit-strategy%s %s<truncate|pad:X|pad-digits>%s\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tFor systems that only accept fixed-length secrets (voicemail PINs, mainframe\n"))
+	fmt.Fprintf(os.Stderr, tr("\tlogins, DES crypt): longer candidates are cut to N; shorter ones are dropped\n"))
+	fmt.Fprintf(os.Stderr, tr("\t(%struncate%s, default), padded with X repeated (%spad:!%s) or with 1234567890\n"), b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t(%spad-digits%s). Applied before the filters; lengths follow --length-mode.\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %swords.txt%s %s-L%s %s2%s %s--fit-length%s %s8%s %s--fit-strategy%s %spad-digits%s\n"), y, r, b, r, y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--max-bytes%s %s<N>%s, %s--max-bytes-action%s %s<drop|truncate>%s\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tA hard limit in UTF-8 bytes, whatever --length-mode says, for tools that\n"))
+	fmt.Fprintf(os.Stderr, tr("\tmangle or reject longer lines (hashcat: 255). Longer candidates are dropped\n"))
+	fmt.Fprintf(os.Stderr, tr("\t(default) or cut to N bytes on a character boundary (%struncate%s); how many\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\twere affected goes to stderr, so nothing is lost silently.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %swords.txt%s %s-L%s %s3%s %s--max-bytes%s %s255%s | hashcat -m 1000 hashes.txt\n"), y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--for-hash%s %s<format>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tShape candidates to what the target hash can represent, so no keyspace goes\n"))
+	fmt.Fprintf(os.Stderr, tr("\tto candidates it cannot tell apart: %sdescrypt%s reads 8 bytes of 7-bit ASCII,\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%sbcrypt%s 72 bytes, %sntlm%s at most 256 characters, %swpa2%s 8-63 ASCII characters.\n"), b, r, b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%slm%s uppercases, cuts at 14 and writes both 7-character halves, which LM hashes\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\tseparately. Longer candidates are cut, the rest dropped; duplicates are removed.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %swords.txt%s %s-L%s %s2%s %s--for-hash%s %sdescrypt%s\n"), y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--lm-mode%s[%s=split|recombine%s]\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tThe LM-then-NT workflow. %ssplit%s (the default): candidates are uppercased, cut\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\tto 14 and written whole and as their two 7-character halves, to crack the LM\n"))
+	fmt.Fprintf(os.Stderr, tr("\thalves. %srecombine%s: the input is the cracked halves; every half and every full\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\tfirst half followed by each half become the words, to be mangled with\n"))
+	fmt.Fprintf(os.Stderr, tr("\t--all-cases or --toggle-variations into candidates for the NT hashes.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %swords.txt%s %s-L%s %s2%s %s--lm-mode%s %s-o%s %slm.txt%s\n"), y, r, b, r, y, r, b, r, y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %scracked-halves.txt%s %s--lm-mode=recombine%s %s--all-cases%s %s-o%s %snt.txt%s\n"), y, r, b, r, y, r, y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--wifi%s, %s--ssid%s %s<names>%s\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tPreset for WPA/WPA2 handshakes: candidates must be 8-63 characters (unless\n"))
+	fmt.Fprintf(os.Stderr, tr("\t--min/--max narrow it) of printable ASCII, and are written in input order\n"))
+	fmt.Fprintf(os.Stderr, tr("\t(%s--dedup-order first%s), so a likelihood-sorted wordlist stays sorted. %s--ssid%s\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\tadds seed words from the network names ahead of the input: each name, without\n"))
+	fmt.Fprintf(os.Stderr, tr("\tband and extender suffixes (-5G, _EXT), its parts and the parts joined.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %srockyou.txt%s %s-L%s %s2%s %s--wifi%s %s--ssid%s %sSmith_Family-5G%s | hashcat -m 22000 cap.hc22000\n"), y, r, b, r, y, r, b, r, y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--domains%s %s<domains>%s, %s--email-as%s %s<output|seeds>%s\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tRead the input as full names (John Smith, or Smith, John) and expand each into\n"))
+	fmt.Fprintf(os.Stderr, tr("\tthe usual mailbox formats at every domain: first.last@, flast@, f.last@,\n"))
+	fmt.Fprintf(os.Stderr, tr("\tlast.first@, firstlast@, first_last@ and first@, in ASCII (José -> jose).\n"))
+	fmt.Fprintf(os.Stderr, tr("\t%soutput%s (the default) writes the addresses as they are, for spraying tools;\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%sseeds%s adds them to the words to mangle.\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %sstaff.txt%s %s--domains%s %scorp.com,corp.co.uk%s %s-o%s %susers.txt%s\n"), y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s-cr%s, %s--crunch%s %s<mask>%s\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tCrunch-style mask filtering. \n"))
+	fmt.Fprintf(os.Stderr, tr("\t.=any, #=digit, ^=upper, %%=lower, &=special, *=zero or more of any\n"))
+	fmt.Fprintf(os.Stderr, tr("\tSeparate multiple masks with commas, append :min-max to bound the length.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: %s-cr%s %s'....#'%s (only 5-char words ending in a digit)\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tExample: %s-cr%s %s'*##:8-10'%s (8-10 char words ending in two digits)\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--crunch-prefix%s %s<mask>%s, %s--crunch-suffix%s %s<mask>%s\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tConstrain only the start or end of a candidate, whatever its length. Same\n"))
+	fmt.Fprintf(os.Stderr, tr("\tmask characters as --crunch without '*'; commas separate alternatives.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: %s--crunch-prefix%s %s'^'%s %s--crunch-suffix%s %s'##&'%s (Summer24!, Autumn2024#)\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s-ms%s, %s--min-strength%s %s<0-4>%s\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tFilters output based on complexity score. 0=Weak, 4=Supreme.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tDictionary words with trivial decorations (Password123!) score at most 1.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: %s-ms%s %s3%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--dict%s %s<file>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tAdd base words (company, product, city names...) to the built-in dictionary\n"))
+	fmt.Fprintf(os.Stderr, tr("\tused by strength scoring and --analyze.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--freq-list%s %s<file>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tWords by descending frequency (an optional count column is ignored). Candidates\n"))
+	fmt.Fprintf(os.Stderr, tr("\twhose base word is listed get up to twice the efficacy, so --sort e and\n"))
+	fmt.Fprintf(os.Stderr, tr("\t--with-scores favour common words.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %sbuiltin:<name>%s\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\tEmbedded lists usable wherever a wordlist path is taken (-f, --dict,\n"))
+	fmt.Fprintf(os.Stderr, tr("\t--freq-list, --stopwords...): %scommon%s (the scoring dictionary), %seff-long%s and\n"), b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%seff-short%s (EFF diceware lists), %sen-freq%s (English by frequency) and\n"), b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%stop-passwords%s (the most common leaked passwords).\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %sbuiltin:eff-long%s %s--passphrase%s %s5%s\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--exclude-common%s %s<file>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tSupply a file of passwords to discard from final results.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--no-numbers%s, %s--no-symbols%s, %s--no-capitals%s\n"), y, r, y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\tExclude words containing numbers, symbols, or capital letters respectively.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--min-digits%s, %s--max-digits%s, %s--min-upper%s, %s--max-upper%s %s<N>%s\n"), y, r, y, r, y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--min-lower%s, %s--max-lower%s, %s--min-symbols%s, %s--max-symbols%s %s<N>%s\n"), y, r, y, r, y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tCount limits per character class. A max of 0 means no limit.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--min-classes%s %s<1-4>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tMinimum number of classes (lower, upper, digit, symbol) a word must use.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--max-repeat%s %s<N>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tMaximum run of the same character (e.g. 2 rejects 'paaass').\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: %s--min-digits%s %s1%s %s--max-digits%s %s4%s %s--min-classes%s %s3%s %s--max-repeat%s %s2%s\n"), y, r, b, r, y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--filter-only%s\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tSkip all mutations and only run the input through the filters above,\n"))
+	fmt.Fprintf(os.Stderr, tr("\tincluding deduplication and sorting. Useful for cleaning existing lists.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %sdump.txt%s %s--filter-only%s %s-m%s %s8%s %s-cr%s %s'*#'%s\n\n"), y, r, b, r, y, r, y, r, b, r, y, r, b, r)
+
+	// SORTING & PRIORITIZATION
+	fmt.Fprintf(os.Stderr, tr("SORTING & PRIORITIZATION:\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s-S%s, %s--sort%s %s<a|e|source-then-efficacy>%s\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s'a'%s: Alphabetical sort of the final list.\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s'e'%s: Efficacy sort. Uses RockYou-derived weights to move common patterns to the top.\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s'source-then-efficacy'%s: Candidates of the first %s-f%s file come first, then those of\n"), b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\tthe next, each by efficacy. A candidate several files produce counts for the one\n"))
+	fmt.Fprintf(os.Stderr, tr("\tit was first accepted from; with %s--dedup-order first%s that is the earliest file.\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %swords.txt%s %s-S%s %se%s\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--window%s %s<N>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tKeep only the best N candidates (K/M/G suffixes allowed) in memory for %s--sort%s\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tand write the best one as each new candidate arrives. The output is ordered\n"))
+	fmt.Fprintf(os.Stderr, tr("\tapproximately, but keyspaces larger than RAM can be sorted by efficacy.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %swords.txt%s %s-L%s %s3%s %s-S%s %se%s %s--window%s %s10M%s\n"), y, r, b, r, y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--with-scores%s\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tWrite each candidate as word<TAB>strength<TAB>efficacy: the 0-4 strength score\n"))
+	fmt.Fprintf(os.Stderr, tr("\tand the RockYou-derived weight %s--sort e%s orders by. Downstream tools can then\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tthreshold and reorder without recomputing. In --pair-mode the password is scored.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %swords.txt%s %s--with-scores%s | sort -t$'\\t' -k3,3gr\n"), y, r, b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--annotate%s\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tAppend a TAB and the input file each candidate came from (the earliest one when\n"))
+	fmt.Fprintf(os.Stderr, tr("\tseveral files produce it) as the last column. With --output-format jsonl the\n"))
+	fmt.Fprintf(os.Stderr, tr("\tfile is always recorded in the \"file\" field.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %starget.txt,generic.txt%s %s--annotate%s\n"), y, r, b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--warm-start%s %s<topN>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tWrite the N most common leaked passwords (K suffix allowed, up to top1k) that\n"))
+	fmt.Fprintf(os.Stderr, tr("\tpass the output filters before mangling starts, so the easy wins are cracked\n"))
+	fmt.Fprintf(os.Stderr, tr("\tfirst. They are not repeated later; the list is builtin:top-passwords.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %swords.txt%s %s-L%s %s2%s %s--min%s %s8%s %s--warm-start%s %stop1k%s\n"), y, r, b, r, y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--sample%s %s<N>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tReservoir-sample N candidates (K/M/G suffixes allowed) from the full output,\n"))
+	fmt.Fprintf(os.Stderr, tr("\tkeeping their original order. Memory use is bounded by N.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--shuffle%s\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tRandomly shuffle the output. Large outputs are shuffled via temporary files.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tBoth draw from the clock unless %s--random-seed%s %s<N>%s fixes the seed, which\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tan exported recipe keeps so every import draws the same candidates.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %swords.txt%s %s-y%s %s--sample%s %s1M%s %s--shuffle%s\n"), y, r, b, r, y, r, y, r, b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--time-limit%s %s<duration>%s, %s--max-output%s %s<N|size>%s\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tStop generating after a duration (30m, 2h) or once N candidates (500M) or\n"))
+	fmt.Fprintf(os.Stderr, tr("\tbytes (500MB, 2GB) are written. The output is flushed and progress saved to\n"))
+	fmt.Fprintf(os.Stderr, tr("\t%s--checkpoint%s %s<file>%s (default passmut.checkpoint); %s--resume%s %s<file>%s continues\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tafter the last fully mangled input word. Use the same flags and a new -o.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %swords.txt%s %s-L%s %s3%s %s--time-limit%s %s2h%s %s--max-output%s %s50GB%s\n"), y, r, b, r, y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--control%s %s<stdin|fd:N|path>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tAccept line commands while generating, from stdin (replies on stderr), an\n"))
+	fmt.Fprintf(os.Stderr, tr("\tinherited descriptor or a Unix socket at path. %spause%s and %sresume%s hold the\n"), b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tworkers, %sstatus%s replies with JSON progress, %sset-rate%s %s<N>%s caps candidates per\n"), b, r, b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tsecond (0 = unlimited) and %sstop-after%s %s<N|duration>%s stops cleanly after N more\n"), b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tcandidates (500M) or a duration (30m), writing a checkpoint as limits do.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %swords.txt%s %s-L%s %s3%s %s--control%s %s/tmp/pm.sock%s; echo status | nc -U /tmp/pm.sock\n"), y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--session%s %s<name>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tName the run and write %s<name>.manifest.json%s in the directory of -o (the working\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\tdirectory for stdout): the command line, version, a hash of the options that\n"))
+	fmt.Fprintf(os.Stderr, tr("\tshape the candidates, SHA-256 of each input file, start and end time, and the\n"))
+	fmt.Fprintf(os.Stderr, tr("\tcandidates, bytes and SHA-256 written. Also written when a limit stops the run.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %swords.txt%s %s-L%s %s2%s %s-o%s %sout/cands.txt%s %s--session%s %snightly%s\n"), y, r, b, r, y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--budget%s %s<N>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tFit the run to about N candidates (1e9, 500M) by pruning the configured rules\n"))
+	fmt.Fprintf(os.Stderr, tr("\tand affixes. Each step drops the rule, or lowers --level/--chain-depth, that\n"))
+	fmt.Fprintf(os.Stderr, tr("\tgives up the least efficacy per candidate saved; the dropped and kept rules\n"))
+	fmt.Fprintf(os.Stderr, tr("\tare printed. Combine with --estimate to preview, or --max-output to enforce.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %swords.txt%s %s-L%s %s3%s %s-y%s %s-t%s %s--budget%s %s1e9%s\n"), y, r, b, r, y, r, b, r, y, r, y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--collapse-runs%s, %s--collapse-min%s %s<N>%s\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tHold back candidates that end (or start) with up to 6 digits, and replace every\n"))
+	fmt.Fprintf(os.Stderr, tr("\tcomplete run of at least N (default 100) of them - one base with all values of\n"))
+	fmt.Fprintf(os.Stderr, tr("\tits last digits - by a hashcat hybrid job: the fixed part goes to\n"))
+	fmt.Fprintf(os.Stderr, tr("\t%s<output>.a6-dK.words%s and the K free digits to %s.hcmask%s (a7 for leading digits).\n"), b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tThe rest goes to -o as usual and the hashcat commands are printed. Requires -o.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tAt most about 4M candidates are held; beyond that the oldest runs are collapsed\n"))
+	fmt.Fprintf(os.Stderr, tr("\tearly, and a base that comes back later starts a new run.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %swords.txt%s %s--suffix-range%s %s0000-9999%s %s-o%s %scands.txt%s %s--collapse-runs%s\n"), y, r, b, r, y, r, b, r, y, r, b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--assume-yes%s\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tBefore writing to -o, the keyspace estimate and average candidate length\n"))
+	fmt.Fprintf(os.Stderr, tr("\tpredict the output size (capped by --sample and --max-output). If it exceeds\n"))
+	fmt.Fprintf(os.Stderr, tr("\tthe free space on the target filesystem passmut aborts; --assume-yes only warns.\n\n"))
+
+	// PASSPHRASE GENERATION
+	fmt.Fprintf(os.Stderr, tr("PASSPHRASE GENERATION:\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s-pp%s, %s--passphrase%s %s<N>%s\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tInstead of mangling, it generates random combinations of N words.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tLength, composition, crunch and strength filters apply to the joined phrases.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--sep%s %s<char>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tThe separator to use between words (defaults to '-').\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--component-len%s %s<N-M>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tOnly use mangled words of this length as passphrase components.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: %s-pp%s %s3%s %s--sep%s %s_%s %s--component-len%s %s3-8%s %s-m%s %s16%s\n"), y, r, b, r, y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--pp-weighting%s %s<uniform|efficacy>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tWhen the pool is too large to combine exhaustively, phrases are sampled. With\n"))
+	fmt.Fprintf(os.Stderr, tr("\t%sefficacy%s each component is drawn in proportion to its efficacy (and its\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\t--freq-list rank), so plausible phrases come first; %suniform%s is the default.\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\tExample: %s-f%s %sbuiltin:eff-long%s %s-pp%s %s4%s %s--pp-weighting%s %sefficacy%s %s--freq-list%s %sbuiltin:en-freq%s\n"), y, r, b, r, y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--pp-mutate%s\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tReal passphrases are usually decorated. Besides each phrase, also write it with\n"))
+	fmt.Fprintf(os.Stderr, tr("\tthe first or every word capitalised and in vowel leet, each with the suffixes\n"))
+	fmt.Fprintf(os.Stderr, tr("\t1, !, 123 and 1! (up to 20 candidates per phrase, filters apply to each).\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: %s-pp%s %s3%s %s--pp-mutate%s (correct-horse-battery, Correct-Horse-Battery1!, ...)\n"), y, r, b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--pp-unique-words%s, %s--pp-sorted%s\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\tBy default a component may repeat (cat-cat) and every ordering is written.\n"))
+	fmt.Fprintf(os.Stderr, tr("\t--pp-unique-words uses each component at most once per phrase; --pp-sorted\n"))
+	fmt.Fprintf(os.Stderr, tr("\ttreats phrases as combinations and writes only the pool-order arrangement.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--pp-exhaustive-max%s %s<N>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tWhen the pool allows fewer than N phrases (default 10000) all are written;\n"))
+	fmt.Fprintf(os.Stderr, tr("\totherwise 1000 are sampled. 1 always samples.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: %s-pp%s %s3%s %s--pp-unique-words%s %s--pp-sorted%s %s--pp-exhaustive-max%s %s1000000%s\n\n"), y, r, b, r, y, r, y, r, y, r, b, r)
+
+	// TEXT MANIPULATION (SIMPLE)
+	fmt.Fprintf(os.Stderr, tr("TEXT MANIPULATION (SIMPLE):\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s-c%s, %s--capital%s       Capitalize first letter.\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--capital-words%s     Capitalize every word: letter runs (blue_dog42 -> Blue_Dog42),\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("                      permutation joins (BlueDog) and passphrase components.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s-u%s, %s--upper%s         Convert to FULL UPPERCASE.\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s-l%s, %s--lower%s         Convert to full lowercase.\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s-s%s, %s--swap%s          Toggle casing (e.g. Apple -> aPPLE).\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s-r%s, %s--reverse%s       Reverse the string (e.g. elppa).\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--rot%s[=%sN%s]          Rotate letters by N, default 13 (e.g. apple -> nccyr).\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s-t%s, %s--leet%s          Simple l33t replacement.\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s-T%s, %s--full-leet%s     Generate all recursive l33t combinations.\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--leet-positions%s %s<P>%s Only substitute at these positions: first, last, vowels or\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("                      1-based indexes (comma-separated), each one on or off, e.g.\n"))
+	fmt.Fprintf(os.Stderr, tr("                      first,last: password -> |assword, passwor|, |asswor|.\n"))
+	fmt.Fprintf(os.Stderr, tr("                      Uses the first substitute per letter, or all with -T.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s-ac%s, %s--all-cases%s    Generate all case permutations (warning: huge output).\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s-d%s, %s--double%s        Append word to itself.\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--repeat-to%s %s<N..M>%s  Repeat the word while the result is N to M long, plain and\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("                      joined by each %s--repeat-sep%s character (default \"-_.\"), so\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("                      short seeds reach the minimum length (rex -> rexrexrex, rex-rex).\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s-A%s, %s--acronym%s       Create acronyms from input words.\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--space%s             Add spaces between words (for permutations).\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--seed%s %s<words>%s      Inject seed words (comma-separated).\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--walks%s             Add common keyboard walks.\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--kb-shift%s %s<dirs>%s   Type the word with the hands one key left, right, up or\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("                      down (comma-separated, e.g. password -> [sddeptf for right).\n"))
+	fmt.Fprintf(os.Stderr, tr("                      Keys without a neighbor stay as they are.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--kb-layout%s %s<L>%s     Layout for --kb-shift: qwerty (default), qwertz or azerty.\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--substitute%s %s<pairs>%s Replace each old token inside the word with new (comma-\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("                      separated old=new), in any case and keeping it: after a merger,\n"))
+	fmt.Fprintf(os.Stderr, tr("                      acme=globex turns Acme2023! into Globex2023!. A chained pass\n"))
+	fmt.Fprintf(os.Stderr, tr("                      mangles the result further.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--substitute-file%s %s<F>%s Read old=new pairs from F, one per line (# comments).\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--toggle-variations%s Add toggle case permutations.\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--restore-case%s      Also write every final candidate with the casing of the input\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("                      word it came from merged back, e.g. McDonald -> mcd0nald ->\n"))
+	fmt.Fprintf(os.Stderr, tr("                      McD0nald. The %srestore-case%s rules operator does the same mid-recipe.\n\n"), b, r)
+
+	// TEXT MANIPULATION (APPEND/PREPEND)
+	fmt.Fprintf(os.Stderr, tr("TEXT MANIPULATION (APPEND/PREPEND):\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s-C%s, %s--common%s %s[builtin:cat,...|file]%s\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tAdd common words to start and end. Without a value: the built-in admin-terms\n"))
+	fmt.Fprintf(os.Stderr, tr("\t(pw, admin, sys, root...). Built-in categories are %sadmin-terms%s, %sdevice-defaults%s,\n"), b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%sseasons%s and %ssports%s (or %sbuiltin:admin%s, the name up to its dash); files and\n"), b, r, b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tcategories combine, comma-separated.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %swords.txt%s %s-C%s %sbuiltin:admin,seasons,company.txt%s\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--smart-affix%s\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tAdd smart affixes (years, 123, symbols).\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--numeric-patterns%s\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tAppend numeric tails beyond simple ranges: repeated digits (77, 999999),\n"))
+	fmt.Fprintf(os.Stderr, tr("\tascending and descending runs (345, 87654) and common PINs (1212, 6969).\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--phone-patterns%s %s<PLAN:codes>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tAdd phone numbers as extra words, which are then mangled like the input.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tFor %sNANP%s each area code gives 7- and 10-digit numbers with every exchange\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\t(200-999) and a patterned line number (0000, 1234, 6969, ...).\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %snames.txt%s %s--phone-patterns%s %sNANP:415,650%s %s--numeric-patterns%s\n"), y, r, b, r, y, r, b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--pattern-locks%s %s<N-M>%s, %s--pattern-top%s %s<N>%s\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tAdd every Android 3x3 unlock pattern of N to M dots (4-9, 389112 in all) as\n"))
+	fmt.Fprintf(os.Stderr, tr("\textra words, numbering the dots 1-9 row by row (an L is %s1478%s). They are ranked\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\tby how people draw them: starting top left, short strokes, few turns, few\n"))
+	fmt.Fprintf(os.Stderr, tr("\tdots. %s--pattern-top%s keeps the N likeliest. Add %s--dedup-order first%s (or %s-n 1%s)\n"), y, r, y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\tto write them in that order.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s--pattern-locks%s %s4-6%s %s--pattern-top%s %s1000%s %s-n%s %s1%s %s-o%s %spatterns.txt%s\n"), y, r, b, r, y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--zipcodes%s %s<cc:regions,patterns>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tAdd the postal codes of the listed regions (from the built-in US state pack)\n"))
+	fmt.Fprintf(os.Stderr, tr("\tand of patterns where x is any digit to start and end, for geo-targeted\n"))
+	fmt.Fprintf(os.Stderr, tr("\tengagements. A whole state adds thousands of codes; patterns keep it small.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--zip-pack%s %s<file|URL>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tLoad more regions, one per line: %s<country> <region> <patterns...>%s. Regions\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\tin the pack replace built-in ones with the same name.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %swords.txt%s %s--zipcodes%s %sus:CA,10xxx%s %s--zip-pack%s %sde-plz.txt%s\n"), y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s-ps%s, %s--prefix-strings%s %s<S>%s\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tAdd comma-separated strings to the start of each word.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s-ss%s, %s--suffix-strings%s %s<S>%s\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tAdd comma-separated strings to the end of each word.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--interleave%s %s<S>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tZip each comma-separated string into the word, alternating characters and\n"))
+	fmt.Fprintf(os.Stderr, tr("\tstarting with either one (cat and 123 give c1a2t3 and 1c2a3t). The rest of\n"))
+	fmt.Fprintf(os.Stderr, tr("\tthe longer one is appended.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--interleave-words%s\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tAlso zip every ordered pair of input words (n² extra words, like %s--perms%s).\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %snames.txt%s %s--interleave%s %s123,2024%s %s--interleave-words%s\n"), y, r, b, r, y, r, b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s-pr%s, %s--prefix-range%s %s<R>%s\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tAdd a range of numbers to the start (e.g. 0-99).\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s-sr%s, %s--suffix-range%s %s<R>%s\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tAdd a range of numbers to the end (e.g. 0-99).\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s-y%s, %s--years%s\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\tAdd year ranges (1980-current) to start and end.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--ordinals%s %s<R>%s, %s--roman%s %s<R>%s\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tAdd ordinals (1st, 2nd, 3rd, ...) or roman numerals (I, II, III, ...) for\n"))
+	fmt.Fprintf(os.Stderr, tr("\tthe range to start and end, for jersey numbers and anniversaries.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: %s--ordinals%s %s1-31%s %s--roman%s %s1-20%s (adds 1stjohn, john21st, rockyIV, ...)\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--punctuation%s\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tAppend common punctuation symbols (!@$%%^&*()).\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--punct-set%s %s<chars>%s, %s--punct-max%s %s<N>%s, %s--punct-prefix%s\n"), y, r, b, r, y, r, b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\tCharacters to use, max affix length (1..N) and also prepend. Implies --punctuation.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: %s--punct-set%s %s'!?#.'%s %s--punct-max%s %s3%s (adds !, !!, !?#, ...)\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--currency%s, %s--emoji%s\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\tAdd currency symbols (%s) or common emoji (%s) to start and\n"), strings.Join(currencySymbols, ""), strings.Join(emojiSymbols, ""))
+	fmt.Fprintf(os.Stderr, tr("\tend. Output is UTF-8 and each emoji is a single code point, so it counts as\n"))
+	fmt.Fprintf(os.Stderr, tr("\tone character for --min/--max (3-4 with --length-mode bytes).\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--detect-lang%s\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tGuess the language of each input word from its letters and apply that\n"))
+	fmt.Fprintf(os.Stderr, tr("\tlanguage's pack: its season names to start and end, and a spelling without\n"))
+	fmt.Fprintf(os.Stderr, tr("\tdiacritics (größe -> groesse, café -> cafe). Words that cannot be placed are\n"))
+	fmt.Fprintf(os.Stderr, tr("\tleft alone. Packs: %s. --analyze always reports the language mix.\n\n"), strings.Join(localePackNames(), ", "))
+
+	// MUTATION DEPTH
+	fmt.Fprintf(os.Stderr, tr("MUTATION DEPTH:\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s-L%s, %s--level%s %s<0-4>%s\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tNumber of chained mangling passes and the rules each pass uses:\n"))
+	fmt.Fprintf(os.Stderr, tr("\t0-1: one pass, 2: two full passes, 3: two full passes plus case/affix,\n"))
+	fmt.Fprintf(os.Stderr, tr("\t4: three full passes. Each pass re-mangles the output of the previous one.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--chain-depth%s %s<N>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tRun N full passes, overriding --level.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--estimate%s\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tMangle a sample of the input and print the estimated output size, then exit.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %swords.txt%s %s-c -t -y%s %s-L%s %s3%s %s--estimate%s\n\n"), y, r, b, r, y, r, y, r, b, r, y, r)
+
+	// RECIPE & TRANSFORMATIONS
+	fmt.Fprintf(os.Stderr, tr("RECIPE & TRANSFORMATIONS:\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--rules%s %s<operators>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tAn ordered recipe of transformations. Accepts flag names as operators;\n"))
+	fmt.Fprintf(os.Stderr, tr("\t%srot%s shifts by 13 and %srotN%s (e.g. %srot3%s) by N. Typo operators take a 1-based\n"), b, r, b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tposition, negative from the end: %sadjswapN%s swaps the characters at N and N+1,\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%sdupN%s types the one at N twice and %sdelN%s deletes it (%sdel-1%s drops the last).\n"), b, r, b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%sstrip-digits%s, %sstrip-symbols%s and %sstrip-spaces%s (or %sstrip%s) remove that character\n"), b, r, b, r, b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tclass, to reduce breached passwords to their core before decorating them again.\n"))
+	fmt.Fprintf(os.Stderr, tr("\t%srestore-case%s puts the input word's casing back after lower or leet steps.\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%sinc-num%s[%s:N%s] and %sdec-num%s[%s:N%s] write the word with its last number moved by\n"), b, r, b, r, b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\teach of 1 to N (default 1), zero padding kept: Summer08 -> Summer09, Summer10.\n"))
+	fmt.Fprintf(os.Stderr, tr("\t%sleet=PAIRS%s replaces only the listed letters (%sleet=a@o0%s: P@ssw0rd), and\n"), b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%sappend=S%s / %sprepend=S%s add S as written (no commas) to the end or start.\n"), b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s--rules%s %s\"strip-digits,strip-symbols,-c,-t\"%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s--rules%s %s\"-r,--upper,-t\"%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--rules-file%s %s<file>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tApply each recipe of a file (one per line, # comments) to every word on its\n"))
+	fmt.Fprintf(os.Stderr, tr("\town, e.g. the output of %spassmut suggest%s.\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %s-f%s %sbase.txt%s %s--rules-file%s %ssuggested.pmr%s\n\n"), y, r, b, r, y, r, b, r)
+
+	// SUBCOMMANDS
+	fmt.Fprintf(os.Stderr, tr("SUBCOMMANDS:\n"))
+	fmt.Fprintf(os.Stderr, tr("  %smerge%s %s<file...>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tStream, deduplicate and sort several wordlists (.gz supported) with bounded\n"))
+	fmt.Fprintf(os.Stderr, tr("\tmemory, spilling sorted runs to disk. %s-S e%s orders by efficacy.\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %smerge%s %sa.txt b.txt c.gz%s %s-o%s %smerged.txt%s\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %sfreq%s %s<file...>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tCount occurrences like 'sort | uniq -c' with bounded memory and print\n"))
+	fmt.Fprintf(os.Stderr, tr("\tcount<TAB>word, most frequent first.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %sfreq%s %sdump.txt%s %s--top%s %s1000%s\n"), y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %srun%s %s<job.yaml>%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tRun a version-controllable pipeline: inputs (with per-file options), seeds,\n"))
+	fmt.Fprintf(os.Stderr, tr("\toptions, ordered stages (--rules), filters and one or more outputs, each\n"))
+	fmt.Fprintf(os.Stderr, tr("\twith its own extra filters. Keys are long flag names; see README.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %srun%s %sengagement.yaml%s\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %saudit%s %s--policy%s %s<policy.yaml>%s %s<files...>%s\n"), y, r, y, r, b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tCheck passwords against a policy and report per-rule compliance and the top\n"))
+	fmt.Fprintf(os.Stderr, tr("\tviolating masks. With %s--pair-mode%s, %s--csv%s writes user,violations per user.\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %saudit%s %s--policy%s %spolicy.yaml%s %s--input%s %sdump.txt%s %s--pair-mode%s %s--csv%s %sv.csv%s\n"), y, r, y, r, b, r, y, r, b, r, y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %sscore%s %s--against%s %s<cracked.txt>%s %s<lists...>%s\n"), y, r, y, r, b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tMeasure what share of a reference cracked set each list contains, against\n"))
+	fmt.Fprintf(os.Stderr, tr("\tits size. Hits/M (reference passwords per million guesses) ranks lists of\n"))
+	fmt.Fprintf(os.Stderr, tr("\tdifferent sizes on one scale.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %sscore%s %s--against%s %scracked.txt%s %sa.txt b.txt%s\n"), y, r, y, r, b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %sdelta%s %s--old%s %s<cracked.txt>%s [%s--rules%s %s<recipe|file>%s] [%s--seen%s %s<file>%s]\n"), y, r, y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tAge last engagement's cracked list: write only the predicted next passwords\n"))
+	fmt.Fprintf(os.Stderr, tr("\t(%s--predict-rotation%s and %s--year-bump%s, or each %s--rules%s recipe, one per line\n"), y, r, y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\tof a file) that are not in the old list. %s--seen%s keeps the candidates of\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tearlier runs: they are skipped, and the new ones are appended to it.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %sdelta%s %s--old%s %slast-year.txt%s %s--rules%s %srotation.pmr%s %s--seen%s %stried.txt%s\n"), y, r, y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %sdefaults%s [%s--vendor%s %s<vendors>%s] [%s--rules%s %s<recipe|file>%s]\n"), y, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tWrite the known default logins of the vendors' devices as a combo list\n"))
+	fmt.Fprintf(os.Stderr, tr("\t(user:password, or %s--format%s %susers%s/%spasswords%s), all vendors without\n"), y, r, b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\t%s--vendor%s. %s--rules%s also writes each password mangled by the recipes; %s--data%s\n"), y, r, y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\tadds an updated dataset in the same format; %s--list%s shows the vendors.\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %sdefaults%s %s--vendor%s %scisco,hp%s %s-o%s %scombo.txt%s\n"), y, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %scoverage%s %s--generated%s %s<list>%s %s--cracked%s %s<found.txt>%s [%s--missed%s %s<file>%s]\n"), y, r, y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tReport which cracked plaintexts the generated list missed. For each miss the\n"))
+	fmt.Fprintf(os.Stderr, tr("\tprefix, suffix, leet and casing changes are undone in every combination; the\n"))
+	fmt.Fprintf(os.Stderr, tr("\tsmallest set that leads back to a generated word is the rule class to add.\n"))
+	fmt.Fprintf(os.Stderr, tr("\t%s--missed%s writes each miss as plaintext<TAB>classes.\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %scoverage%s %s--generated%s %sout.txt%s %s--cracked%s %sfound.txt%s %s--missed%s %smissed.tsv%s\n"), y, r, y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %ssuggest%s %s--cracked%s %s<found.txt>%s %s--base%s %s<base.txt>%s [%s--min-count%s %s<N>%s] [%s--top%s %s<N>%s]\n"), y, r, y, r, b, r, y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tWork out the case, leet and affix steps that turn base words into the cracked\n"))
+	fmt.Fprintf(os.Stderr, tr("\tpasswords and write them as recipes for %s--rules-file%s, the ones reproducing\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tthe most passwords first (Summer2024! from summer: capital,append=2024!).\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %ssuggest%s %s--cracked%s %sfound.txt%s %s--base%s %sbase.txt%s %s-o%s %ssuggested.pmr%s\n"), y, r, y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %sinfer-rule%s %s--from%s %s<word>%s %s--to%s %s<password>%s\n"), y, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tPrint every chain of case, leet, affix, reverse and double steps that turns\n"))
+	fmt.Fprintf(os.Stderr, tr("\tthe word into the password, shortest first, as a %s--rules%s recipe and as a\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\thashcat rule: summer -> Summ3r2024! is capital,leet=e3,append=2024! (c se3 $2 $0 $2 $4 $!).\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %sinfer-rule%s %s--from%s %ssummer%s %s--to%s %s'Summ3r2024!'%s\n"), y, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %sdocs%s [%s--format%s %s<man|markdown>%s] [%s-o%s %s<file>%s]\n"), y, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tWrite the reference of every option (with shorthands and defaults), --rules\n"))
+	fmt.Fprintf(os.Stderr, tr("\tstep and subcommand, generated from the flag registry so it matches the\n"))
+	fmt.Fprintf(os.Stderr, tr("\tbuild, as a man page (default) or markdown.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %sdocs%s %s-o%s %spassmut.1%s && man ./passmut.1\n"), y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %srecipe%s %sexport%s [%sOPTION%s] %s-o%s %s<file.pmrecipe>%s | %simport%s %s<file.pmrecipe>%s [%s--print%s] [%sOPTION%s] | %svalidate%s %s<files...>%s\n"), y, r, b, r, b, r, y, r, b, r, b, r, b, r, y, r, b, r, b, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tShare and pin a whole generation configuration. %sexport%s writes the options\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\tgiven as a YAML .pmrecipe: rules, affixes and filters by long flag name, the\n"))
+	fmt.Fprintf(os.Stderr, tr("\tpassmut version constraint, the --detect-lang locale packs and the SHA-256 of\n"))
+	fmt.Fprintf(os.Stderr, tr("\tevery wordpack (--common, --freq-list, --rules-file...). %simport%s checks them all\n"), b, r)
+	fmt.Fprintf(os.Stderr, tr("\tand generates, with further options such as %s-f%s and %s-o%s on top; %s--print%s shows\n"), y, r, y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\tthe equivalent command. %svalidate%s only checks. %sdiff%s %s<a> <b>%s %s--sample%s %s<words>%s runs both\n"), b, r, b, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\trecipes on the sample and shows candidates unique to each and the estimated\n"))
+	fmt.Fprintf(os.Stderr, tr("\tkeyspace difference (%s--words%s %s<N>%s scales it to the real input size).\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %srecipe%s %simport%s %steam.pmrecipe%s %s-f%s %swords.txt%s %s-o%s %sout.txt%s\n"), y, r, b, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %sverify%s %s--recipe%s %s<r.pmrecipe>%s %s--golden%s %s<expected.txt>%s %s--sample%s %s<words.txt>%s [%s--update%s] [%s--show%s %s<N>%s]\n"), y, r, y, r, b, r, y, r, b, r, y, r, b, r, y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tRegenerate the recipe's candidates for a small fixed sample under\n"))
+	fmt.Fprintf(os.Stderr, tr("\t%s--deterministic%s and compare them byte for byte with a stored golden file;\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tit lists missing and new candidates and exits non-zero on any difference, so\n"))
+	fmt.Fprintf(os.Stderr, tr("\ta recipe edit or passmut upgrade cannot change the output unnoticed.\n"))
+	fmt.Fprintf(os.Stderr, tr("\t%s--update%s writes the golden file from the current output.\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %sverify%s %s--recipe%s %steam.pmrecipe%s %s--golden%s %steam.golden%s %s--sample%s %ssample.txt%s\n"), y, r, y, r, b, r, y, r, b, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("  %sword%s %s<word>%s [%sword...%s] [%sOPTION%s] [%s--copy%s [%s--top%s %s<N>%s]]\n"), y, r, b, r, b, r, b, r, y, r, y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("\tMangle the words given as arguments with the usual options, without a file\n"))
+	fmt.Fprintf(os.Stderr, tr("\tor standard input. %s--copy%s also puts the top %s--top%s candidates (default 20)\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\ton the clipboard, ranked by efficacy unless %s--sort%s is given; it uses pbcopy,\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("\tPowerShell or clip, or wl-copy, xclip, xsel or termux-clipboard-set.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %sword%s %s'companyname'%s %s-c%s %s-y%s %s2024-2025%s %s--copy%s\n"), y, r, b, r, y, r, y, r, b, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %sselftest%s [%s-q%s]\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("\tRun known-answer vectors for leet, case, reverse, rot, unicode, crunch and\n"))
+	fmt.Fprintf(os.Stderr, tr("\tstrength and print pass/fail; exits non-zero on any failure. Use after\n"))
+	fmt.Fprintf(os.Stderr, tr("\t--upgrade or on a new platform before a long run.\n"))
+	fmt.Fprintf(os.Stderr, tr("\tExample: passmut %sselftest%s\n\n"), y, r)
 
 	// OTHER
-	fmt.Fprintf(os.Stderr, "OTHER:\n")
-	fmt.Fprintf(os.Stderr, "  %s-h%s, %s--help%s          Show this help message.\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "  %s-v%s, %s--version%s       Show version information.\n", y, r, y, r)
-	fmt.Fprintf(os.Stderr, "  %s--check-updates%s     Check GitHub for a newer version.\n", y, r)
-	fmt.Fprintf(os.Stderr, "  %s--upgrade%s           Perform a self-upgrade.\n", y, r)
+	fmt.Fprintf(os.Stderr, tr("OTHER:\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s-h%s, %s--help%s          Show this help message.\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s-v%s, %s--version%s       Show version information.\n"), y, r, y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--no-color%s          Plain help and --analyze charts. Colors are also off when\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("                      NO_COLOR is set, TERM=dumb, output is redirected or the\n"))
+	fmt.Fprintf(os.Stderr, tr("                      Windows console has no ANSI support.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--lang%s %s<code|file>%s  Help and --analyze reports in de, es or fr, or from a JSON\n"), y, r, b, r)
+	fmt.Fprintf(os.Stderr, tr("                      translation file (see locales/README.md). Untranslated\n"))
+	fmt.Fprintf(os.Stderr, tr("                      text stays in English.\n"))
+	fmt.Fprintf(os.Stderr, tr("  %s--check-updates%s     Check GitHub for a newer version.\n"), y, r)
+	fmt.Fprintf(os.Stderr, tr("  %s--upgrade%s           Perform a self-upgrade.\n"), y, r)
 }
 
-func run(config *Config, inputPaths []string) error {
+func run(config *Config, inputs []inputSpec) error {
+	switch config.inputFormat {
+	case "", "plain", "csv", "tsv", "userpass":
+	case "jsonl":
+		if config.field == "" {
+			return fmt.Errorf("--input-format jsonl needs a --field")
+		}
+	default:
+		return fmt.Errorf("invalid --input-format %q (use plain, csv, tsv, userpass or jsonl)", config.inputFormat)
+	}
+	switch config.outputFormat {
+	case "", "text", "jsonl", "parquet":
+	default:
+		return fmt.Errorf("invalid --output-format %q (use text, jsonl or parquet)", config.outputFormat)
+	}
+	switch config.lineMode {
+	case "", "keep", "split", "both":
+	default:
+		return fmt.Errorf("invalid --line-mode %q (use keep, split or both)", config.lineMode)
+	}
+	crunchMasks, err := parseCrunchMasks(config.crunchFilter)
+	if err != nil {
+		return err
+	}
+	if config.seedMin < 0 || config.seedMax < 0 {
+		return fmt.Errorf("--seed-min and --seed-max must be 0 or greater")
+	}
+	var sess *session
+	if config.session != "" {
+		if strings.ContainsAny(config.session, `/\\`) || config.session == "." || config.session == ".." {
+			return fmt.Errorf("invalid --session %q (use a plain name, not a path)", config.session)
+		}
+		var err error
+		// Started before anything below adjusts config for the run
+		if sess, err = newSession(config, inputs); err != nil {
+			return fmt.Errorf("--session: %w", err)
+		}
+	}
+	if config.sampleRate != 0 {
+		if !config.analyze {
+			return fmt.Errorf("--sample-rate only applies to --analyze (use --sample for output)")
+		}
+		if config.sampleRate < 0 || config.sampleRate > 1 {
+			return fmt.Errorf("--sample-rate must be between 0 and 1")
+		}
+	}
+	if config.chartsDir != "" && !config.analyze {
+		return fmt.Errorf("--charts only applies to --analyze")
+	}
+	switch config.chartFormat {
+	case "", "svg", "png", "both":
+	default:
+		return fmt.Errorf("invalid --chart-format %q (use svg, png or both)", config.chartFormat)
+	}
+	var forHash *hashLimits
+	if config.forHash != "" {
+		limits, ok := hashFormats[strings.ToLower(config.forHash)]
+		if !ok {
+			return fmt.Errorf("invalid --for-hash %q (use ntlm, lm, descrypt, bcrypt or wpa2)", config.forHash)
+		}
+		forHash = &limits
+	}
+	if config.lmMode == "split" {
+		forHash = &hashLimits{significant: lmMaxLength, ascii: true, lm: true, whole: true}
+	}
+	var crackRate *hashRate
+	if config.crackTime != "" {
+		var err error
+		if crackRate, err = parseHashRate(config.crackTime); err != nil {
+			return fmt.Errorf("invalid --estimate-cracktime: %w", err)
+		}
+	}
+	if config.pairMode {
+		if config.inputFormat != "" && config.inputFormat != "plain" && config.inputFormat != "userpass" {
+			return fmt.Errorf("--pair-mode reads user:pass lines and cannot be combined with --input-format %s", config.inputFormat)
+		}
+		if config.perms || config.acronym || config.common != "" || config.passphraseCount > 0 {
+			return fmt.Errorf("--pair-mode cannot be combined with --perms, --acronym, --common or --passphrase")
+		}
+		if config.lineMode != "" && config.lineMode != "keep" {
+			return fmt.Errorf("--pair-mode keeps whole user:pass lines and cannot be combined with --line-mode %s", config.lineMode)
+		}
+		if config.seedMin > 0 || config.seedMax > 0 || config.stopwords != "" {
+			return fmt.Errorf("--pair-mode keeps whole user:pass lines and cannot be combined with --seed-min, --seed-max or --stopwords")
+		}
+		// Keep whole lines; the pair is split per job
+		config.inputFormat = "plain"
+	}
+
+	if config.rulesFile != "" {
+		if _, err := os.Stat(config.rulesFile); err != nil {
+			return fmt.Errorf("--rules-file: %w", err)
+		}
+		recipes, err := loadRecipes(config.rulesFile)
+		if err != nil {
+			return err
+		}
+		config.rulesList = strings.Join(recipes, "\n")
+	}
+	// Recipes from --rules-file and job stages were not seen by validate
+	if err := checkRuleSteps(config.rulesList); err != nil {
+		return err
+	}
+
 	var allWords []string
-	for _, p := range inputPaths {
+	var profiles map[string]*Config
+	loader := newWordLoader(config)
+	if config.stopwords != "" {
+		var err error
+		if loader.stopwords, err = loadStopwords(config.stopwords); err != nil {
+			return fmt.Errorf("failed to load stop words: %w", err)
+		}
+	}
+	var weights map[string]float64
+	var sources map[string]int
+	var sourceNames []string
+	if config.annotate || config.outputFormat == "jsonl" || config.sortMode == "source-then-efficacy" {
+		sources = make(map[string]int)
+	}
+	for i, in := range inputs {
+		p := in.path
+		if sources != nil {
+			name := p
+			if p == "-" {
+				name = "stdin"
+			}
+			sourceNames = append(sourceNames, name)
+		}
+		weight := 0.0
+		if in.weight != "" {
+			w, err := strconv.ParseFloat(in.weight, 64)
+			if err != nil || w <= 0 || math.IsInf(w, 0) {
+				return fmt.Errorf("%s: invalid weight %q (use a number above 0)", p, in.weight)
+			}
+			weight = w
+			if weights == nil {
+				weights = make(map[string]float64)
+			}
+		}
+		var profile *Config
+		if in.overrides != "" {
+			var err error
+			if profile, err = config.withOverrides(in.overrides); err != nil {
+				return fmt.Errorf("%s: %w", p, err)
+			}
+			if profile.mutationLevel < 0 || profile.mutationLevel >= len(chainLevels) {
+				return fmt.Errorf("%s: invalid level %d (use 0-%d)", p, profile.mutationLevel, len(chainLevels)-1)
+			}
+			if profiles == nil {
+				// Words loaded before the first profile keep the global config
+				profiles = make(map[string]*Config)
+				for _, w := range allWords {
+					profiles[w] = config
+				}
+			}
+		}
+		before := len(allWords)
 		var input io.Reader
 		if p == "-" {
 			stat, _ := os.Stdin.Stat()
@@ -723,7 +2523,25 @@ func run(config *Config, inputPaths []string) error {
 				continue
 			}
 			input = os.Stdin
+		} else if strings.HasPrefix(p, builtinPrefix) {
+			r, err := openBuiltinList(strings.TrimPrefix(p, builtinPrefix))
+			if err != nil {
+				return err
+			}
+			input = r
 		} else {
+			if config.mmapInput && !strings.HasSuffix(strings.ToLower(p), ".gz") {
+				words, release, err := loader.loadMmap(p)
+				if err == nil {
+					defer release()
+					allWords = append(allWords, words...)
+					assignProfile(profiles, allWords[before:], profile, config)
+					assignWeight(weights, allWords[before:], weight)
+					assignSource(sources, allWords[before:], i)
+					continue
+				}
+				fmt.Fprintf(os.Stderr, "Warning: mmap failed for %s, using buffered read: %v\n", p, err)
+			}
 			f, err := os.Open(p)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Warning: failed to open %s: %v\n", p, err)
@@ -732,11 +2550,45 @@ func run(config *Config, inputPaths []string) error {
 			defer f.Close()
 			input = f
 		}
-		words, err := loadWords(input)
-		if err == nil {
-			allWords = append(allWords, words...)
+		var words []string
+		var err error
+		if config.rawInput {
+			var data []byte
+			data, err = io.ReadAll(input)
+			words = rawLines(data)
+		} else {
+			words, err = loader.load(input)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: error reading %s: %v\n", p, err)
+		}
+		allWords = append(allWords, words...)
+		assignProfile(profiles, allWords[before:], profile, config)
+		assignWeight(weights, allWords[before:], weight)
+		assignSource(sources, allWords[before:], i)
+	}
+	if loader.longLines > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: skipped %d line(s) longer than %d bytes (see --max-line-len)\n", loader.longLines, config.maxLineLen)
+	}
+	if loader.shortLines > 0 {
+		if loader.format == "jsonl" {
+			fmt.Fprintf(os.Stderr, "Warning: skipped %d line(s) without a usable %q field\n", loader.shortLines, loader.field)
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: skipped %d line(s) without column %d (%s)\n", loader.shortLines, loader.column, loader.format)
 		}
 	}
+	if loader.seedDropped > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: dropped %d input word(s) by --seed-min/--seed-max or --stopwords\n", loader.seedDropped)
+	}
+
+	if config.lmMode == "recombine" {
+		allWords = lmRecombine(allWords)
+	}
+
+	if config.ssid != "" {
+		// Prepended, so the network's own words are mangled and written first
+		allWords = append(ssidWords(config.ssid), allWords...)
+	}
 
 	if config.seedWords != "" {
 		seeds := strings.Split(config.seedWords, ",")
@@ -752,12 +2604,85 @@ func run(config *Config, inputPaths []string) error {
 		allWords = append(allWords, getKeyboardWalks()...)
 	}
 
+	if config.phonePatterns != "" {
+		phones, err := phoneNumbers(config.phonePatterns)
+		if err != nil {
+			return err
+		}
+		allWords = append(allWords, phones...)
+	}
+
+	if config.patternLocks != "" {
+		patterns, err := patternLocks(config.patternLocks)
+		if err != nil {
+			return err
+		}
+		if config.patternTop < 0 {
+			return fmt.Errorf("--pattern-top must be 1 or greater")
+		}
+		if config.patternTop > 0 && config.patternTop < len(patterns) {
+			patterns = patterns[:config.patternTop]
+		}
+		allWords = append(allWords, patterns...)
+	}
+
 	if len(allWords) == 0 {
 		return fmt.Errorf("no words loaded from input")
 	}
 
+	if config.domains != "" {
+		addresses := emailAddresses(allWords, config.domains)
+		switch config.emailAs {
+		case "output":
+			out, err := createOutput(config.outputFile)
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+			return writeLines(out, addresses)
+		case "seeds":
+			allWords = append(allWords, addresses...)
+		default:
+			return fmt.Errorf("invalid --email-as %q (use output or seeds)", config.emailAs)
+		}
+	}
+
+	dict := defaultDictionary()
+	if config.dictFile != "" {
+		if dict, err = loadDictionary(config.dictFile); err != nil {
+			return fmt.Errorf("failed to load dictionary: %w", err)
+		}
+	}
+	if config.freqList != "" {
+		if err := loadFrequencyList(config.freqList); err != nil {
+			return fmt.Errorf("failed to load --freq-list: %w", err)
+		}
+	}
+
 	if config.analyze {
-		analyzeWordlist(allWords)
+		words, users := allWords, []string(nil)
+		if config.pairMode {
+			words, users = splitPairs(allWords)
+		}
+		var sample *sampleInfo
+		if config.sampleRate > 0 {
+			sample = &sampleInfo{rate: config.sampleRate, population: loader.sampled}
+		}
+		analyzeWordlist(words, sample, dict)
+		printReuseStats(words, users)
+		if config.clusters {
+			printClusters(words, config.clusterDistance)
+		}
+		if crackRate != nil {
+			printCrackTimes(words, crackRate, dict)
+		}
+		if config.chartsDir != "" {
+			files, err := writeCharts(config.chartsDir, config.chartFormat, analysisCharts(words, dict))
+			if err != nil {
+				return fmt.Errorf("failed to write charts: %w", err)
+			}
+			fmt.Printf(tr("\nCharts: %s\n"), strings.Join(files, ", "))
+		}
 		return nil
 	}
 
@@ -772,19 +2697,18 @@ func run(config *Config, inputPaths []string) error {
 
 	var commonSet []string
 	if config.common != "" {
-		if config.common == "BUILT_IN" {
-			commonSet = commonWords
-		} else {
-			f, err := os.Open(config.common)
-			if err != nil {
-				return fmt.Errorf("failed to load common words file: %w", err)
-			}
-			commonSet, _ = loadWords(f)
-			f.Close()
+		var err error
+		if commonSet, err = loadCommon(config.common); err != nil {
+			return fmt.Errorf("failed to load common words: %w", err)
 		}
 	}
 
 	var output io.Writer = os.Stdout
+	if config.outputFile != "-" && !config.estimate {
+		if err := checkDiskSpace(config, commonSet, allWords); err != nil {
+			return err
+		}
+	}
 	if config.outputFile != "-" {
 		f, err := os.Create(config.outputFile)
 		if err != nil {
@@ -793,891 +2717,10616 @@ func run(config *Config, inputPaths []string) error {
 		defer f.Close()
 		output = f
 	}
+	if sess != nil {
+		output = sess.track(output)
+	}
 
 	mangler := &Mangler{
 		config:           config,
 		output:           output,
-		seenCRCs:         make(map[uint32]struct{}),
+		seen:             newDedupSet(),
 		blacklistedWords: blacklist,
 		currentCommon:    commonSet,
 		bufWriter:        bufio.NewWriterSize(output, 64*1024),
+		crunchMasks:      crunchMasks,
+		dict:             dict,
+		rng:              newRand(config),
+		profiles:         profiles,
+		weights:          weights,
+		sources:          sources,
+		sourceNames:      sourceNames,
+		crackRate:        crackRate,
+		forHash:          forHash,
 	}
 
 	defer mangler.bufWriter.Flush()
-
-	if err := mangler.process(allWords); err != nil {
-		return err
+	if config.outputFormat == "parquet" {
+		mangler.parquet = newParquetWriter(mangler.bufWriter, config, dict)
 	}
-	return nil
-}
 
-func loadBlacklist(path string) (map[string]struct{}, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
+	if config.mutationLevel < 0 || config.mutationLevel >= len(chainLevels) {
+		return fmt.Errorf("invalid --level %d (use 0-%d)", config.mutationLevel, len(chainLevels)-1)
 	}
-	defer f.Close()
 
-	bl := make(map[string]struct{})
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		w := strings.TrimSpace(scanner.Text())
-		if w != "" {
-			bl[w] = struct{}{}
+	if config.kbShift != "" {
+		if _, ok := keyboardLayouts[config.kbLayout]; !ok {
+			return fmt.Errorf("invalid --kb-layout %q (use qwerty, qwertz or azerty)", config.kbLayout)
 		}
-	}
-	return bl, scanner.Err()
-}
-
-func loadWords(r io.Reader) ([]string, error) {
-	var words []string
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		w := strings.TrimSpace(scanner.Text())
-		if w != "" {
-			words = append(words, w)
+		for _, dir := range strings.Split(config.kbShift, ",") {
+			if kbShiftMaps[config.kbLayout+":"+strings.TrimSpace(dir)] == nil {
+				return fmt.Errorf("invalid --kb-shift direction %q (use left, right, up or down)", dir)
+			}
 		}
 	}
-	return words, scanner.Err()
-}
 
-func (m *Mangler) process(words []string) error {
-	// If common words enabled, add them to the base words list so they become components
-	if m.config.common != "" {
-		tempMap := make(map[string]struct{})
-		for _, w := range words {
-			tempMap[w] = struct{}{}
-		}
-		for _, cw := range m.currentCommon {
-			if _, exists := tempMap[cw]; !exists {
-				words = append(words, cw)
-				tempMap[cw] = struct{}{}
-			}
+	if config.substitute != "" || config.substituteFile != "" {
+		subs, err := loadSubstitutions(config.substitute, config.substituteFile)
+		if err != nil {
+			return err
 		}
+		config.substitutions = subs
 	}
 
-	var wordlist []string
-
-	// Generate primary permutations or use words as-is
-	if m.config.perms {
-		wordlist = m.generatePermutations(words)
-	} else {
-		wordlist = words
+	if config.lengthMode != "" && config.lengthMode != "runes" && config.lengthMode != "bytes" {
+		return fmt.Errorf("invalid --length-mode %q (use runes or bytes)", config.lengthMode)
+	}
+	if config.fitLength < 0 {
+		return fmt.Errorf("--fit-length must be 1 or greater")
+	}
+	if config.maxBytes < 0 {
+		return fmt.Errorf("--max-bytes must be 1 or greater")
+	}
+	if config.maxBytesAction != "drop" && config.maxBytesAction != "truncate" {
+		return fmt.Errorf("invalid --max-bytes-action %q (use drop or truncate)", config.maxBytesAction)
+	}
+	switch filler, isPad := strings.CutPrefix(config.fitStrategy, "pad:"); {
+	case config.fitStrategy == "" || config.fitStrategy == "truncate":
+	case config.fitStrategy == "pad-digits":
+		config.fitPad = fitDigits
+	case isPad && filler != "":
+		config.fitPad = filler
+	default:
+		return fmt.Errorf("invalid --fit-strategy %q (use truncate, pad:X or pad-digits)", config.fitStrategy)
 	}
 
-	if m.config.acronym {
-		acro := generateAcronym(words)
-		m.writeWord(acro) // This might be a component or a result
-		wordlist = append(wordlist, acro)
+	switch config.dedupScope {
+	case "", "global", "worker", "word", "none":
+	default:
+		return fmt.Errorf("invalid --dedup-scope %q (use global, worker, word or none)", config.dedupScope)
+	}
+	switch config.dedupOrder {
+	case "", "any", "first":
+	default:
+		return fmt.Errorf("invalid --dedup-order %q (use any or first)", config.dedupOrder)
 	}
 
-	// Prepare for mangling
-	// If Passphrase Mode is active, we collect ALL mangled variations into a pool first
-	isPP := m.config.passphraseCount > 0
-	originalSort := m.config.sortMode
-	if isPP {
-		m.config.sortMode = "INTERNAL_POOL" // Temporal mode to bypass filters in writeWord
+	for _, o := range []struct{ name, value string }{{"--ordinals", config.ordinals}, {"--roman", config.roman}} {
+		if o.value != "" && numeralAffixes(o.value, strconv.Itoa) == nil {
+			return fmt.Errorf("invalid %s %q (use N or N-M within 1-%d)", o.name, o.value, maxNumeralAffix)
+		}
 	}
 
-	// Multithreaded worker loop
-	jobs := make(chan string, 100)
-	var wg sync.WaitGroup
+	if config.leetPositions != "" && leetPositionSet(config.leetPositions, []rune("x")) == nil {
+		return fmt.Errorf("invalid --leet-positions %q (use first, last, vowels or 1-based indexes)", config.leetPositions)
+	}
 
-	worker := func() {
-		defer wg.Done()
-		for word := range jobs {
-			if m.config.mutationLevel >= 2 {
-				m.chainMangle(word)
-			} else {
-				m.mangleWord(word)
+	if config.zipcodes != "" {
+		pack, err := parseZipPack(strings.NewReader(embeddedZipcodes))
+		if err != nil {
+			return fmt.Errorf("built-in postal codes: %w", err)
+		}
+		if config.zipPack != "" {
+			if err := pack.load(config.zipPack); err != nil {
+				return fmt.Errorf("failed to load --zip-pack: %w", err)
 			}
 		}
+		if mangler.zipcodes, err = pack.expand(config.zipcodes); err != nil {
+			return err
+		}
 	}
 
-	// Start workers
-	threadCount := m.config.threads
-	if threadCount < 1 {
-		threadCount = 1
+	if config.componentLen != "" {
+		lo, hi, ok := parseLengthRange(config.componentLen)
+		if !ok {
+			return fmt.Errorf("invalid --component-len %q (use N, N-M, N- or -M)", config.componentLen)
+		}
+		if config.passphraseCount == 0 {
+			return fmt.Errorf("--component-len only applies to --passphrase")
+		}
+		mangler.componentMin, mangler.componentMax = lo, hi
 	}
-
-	for i := 0; i < threadCount; i++ {
-		wg.Add(1)
-		go worker()
+	switch config.ppWeighting {
+	case "", "uniform":
+	case "efficacy":
+		if config.passphraseCount == 0 {
+			return fmt.Errorf("--pp-weighting only applies to --passphrase")
+		}
+	default:
+		return fmt.Errorf("invalid --pp-weighting %q (use uniform or efficacy)", config.ppWeighting)
+	}
+	for _, anchor := range []struct{ flag, spec string }{{"--crunch-prefix", config.crunchPrefix}, {"--crunch-suffix", config.crunchSuffix}} {
+		if strings.Contains(anchor.spec, "*") {
+			return fmt.Errorf("invalid %s %q: anchors match fixed positions, drop the '*' (or use --crunch)", anchor.flag, anchor.spec)
+		}
+	}
+	if config.ppExhaustiveMax < 0 {
+		return fmt.Errorf("--pp-exhaustive-max must be 1 or greater (1 always samples)")
 	}
 
-	// Feed words
-	for _, word := range wordlist {
-		jobs <- word
+	if config.pluginFormat != "" && config.pluginFormat != "line" && config.pluginFormat != "json" {
+		return fmt.Errorf("invalid --plugin-format %q (use line or json)", config.pluginFormat)
+	}
+	if config.pluginTimeout < 0 {
+		return fmt.Errorf("invalid --plugin-timeout %s (use 0 for no limit)", config.pluginTimeout)
 	}
-	close(jobs)
-	wg.Wait()
 
-	// Now we have a pool of mangled components in m.collectedResults (if isPP)
-	if isPP {
-		pool := m.collectedResults
-		m.collectedResults = nil
-		m.config.sortMode = originalSort // Restore filtering/sorting
-		return m.generateCombinedPassphrases(pool)
-	}
-
-	// Sorting and Final Writing (for non-passphrase mode)
-	if m.config.sortMode != "" {
-		if m.config.sortMode == "a" {
-			sort.Strings(m.collectedResults)
-		} else if m.config.sortMode == "e" {
-			sort.Slice(m.collectedResults, func(i, j int) bool {
-				si := getWordEfficacy(m.collectedResults[i])
-				sj := getWordEfficacy(m.collectedResults[j])
-				if si == sj {
-					return m.collectedResults[i] < m.collectedResults[j]
-				}
-				return si > sj
-			})
+	if config.sample != "" {
+		n, err := parseCount(config.sample)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid --sample value %q", config.sample)
 		}
-		for _, w := range m.collectedResults {
-			m.bufWriter.WriteString(w + "\n")
+		mangler.sampler = newReservoirSampler(int(n), mangler.rng)
+	}
+	if config.shuffle {
+		mangler.shuffler = newDiskShuffler(mangler.rng)
+		defer mangler.shuffler.cleanup()
+	}
+	if config.collapseRuns {
+		if config.collapseMin < 1 {
+			return fmt.Errorf("--collapse-min must be 1 or greater")
 		}
+		mangler.collapser = newRunCollapser(config.collapseMin)
 	}
-	return nil
-}
-
-func (m *Mangler) generateCombinedPassphrases(pool []string) error {
-	if len(pool) == 0 {
-		return fmt.Errorf("component pool is empty, cannot generate passphrases")
+	if config.maxOutput != "" {
+		count, bytes, err := parseOutputLimit(config.maxOutput)
+		if err != nil || count+bytes < 1 {
+			return fmt.Errorf("invalid --max-output value %q", config.maxOutput)
+		}
+		mangler.limits.maxCount, mangler.limits.maxBytes = count, bytes
 	}
-
-	// Exhaustive Mode: If the pool is small enough, generate every possible permutation
-	// Threshold: pool^count < 5000
-	expected := math.Pow(float64(len(pool)), float64(m.config.passphraseCount))
-
-	if expected < 10000 {
-		// Use a helper to generate all permutations of the pool
-		m.exhaustivePP(pool, m.config.passphraseCount, []string{})
-	} else {
-		// Random Sampling Mode
-		count := 1000
-		for i := 0; i < count; i++ {
-			indices := make([]int, m.config.passphraseCount)
-			for j := 0; j < m.config.passphraseCount; j++ {
-				indices[j] = int(uint64(time.Now().UnixNano()) % uint64(len(pool)))
-				time.Sleep(1 * time.Nanosecond)
-			}
-			var parts []string
-			for _, idx := range indices {
-				parts = append(parts, pool[idx])
-			}
-			m.writeWord(strings.Join(parts, m.config.passphraseSep))
+	if config.budget != "" {
+		n, err := parseCount(config.budget)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid --budget value %q", config.budget)
 		}
+		if mangler.profiles != nil {
+			return fmt.Errorf("--budget cannot prune per-file options; drop the [key=value] overrides")
+		}
+		mangler.budget = n
 	}
-	return nil
-}
-
-func (m *Mangler) exhaustivePP(pool []string, rem int, cur []string) {
-	if rem == 0 {
-		m.writeWord(strings.Join(cur, m.config.passphraseSep))
-		return
-	}
-	for i := 0; i < len(pool); i++ {
-		m.exhaustivePP(pool, rem-1, append(cur, pool[i]))
+	if config.window != "" {
+		n, err := parseCount(config.window)
+		if err != nil || n < 1 || n > math.MaxInt32 {
+			return fmt.Errorf("invalid --window value %q", config.window)
+		}
+		mangler.window = int(n)
 	}
-}
-
-func (m *Mangler) chainMangle(word string) {
-	oldSort := m.config.sortMode
-	m.config.sortMode = "INTERNAL_POOL" // Consistent with final collection bypass
-	m.mangleWord(word)
-	tmp := make([]string, len(m.collectedResults))
-	copy(tmp, m.collectedResults)
-	m.collectedResults = nil
-	m.config.sortMode = oldSort
-	for _, w := range tmp {
-		m.mangleWord(w)
+	if config.resumeFile != "" {
+		if config.passphraseCount > 0 {
+			return fmt.Errorf("--resume cannot continue a --passphrase run")
+		}
+		cp, err := loadCheckpoint(config.resumeFile)
+		if err != nil {
+			return fmt.Errorf("failed to load checkpoint: %w", err)
+		}
+		mangler.skip, mangler.limits.doneUpTo = cp.WordsDone, cp.WordsDone
+		fmt.Fprintf(os.Stderr, "Resuming after %d of %d input words\n", cp.WordsDone, cp.WordsTotal)
+	}
+	if config.timeLimit > 0 {
+		timer := time.AfterFunc(config.timeLimit, func() {
+			mangler.limits.stop(fmt.Sprintf("--time-limit of %s reached", config.timeLimit))
+		})
+		defer timer.Stop()
+	}
+	if config.control != "" {
+		if config.control == "stdin" || config.control == "-" {
+			for _, in := range inputs {
+				if in.path == "-" {
+					return fmt.Errorf("--control stdin needs the wordlist from --file, not stdin")
+				}
+			}
+		}
+		mangler.control = &controller{m: mangler, total: len(allWords), started: time.Now()}
+		stop, err := mangler.control.listen(config.control)
+		if err != nil {
+			return fmt.Errorf("--control: %w", err)
+		}
+		defer stop()
 	}
-}
 
-func (m *Mangler) mangleWord(word string) {
-	if m.config.rulesList != "" {
-		m.applySequence(word)
-		return
+	if config.warmStart != "" {
+		n, err := parseCount(strings.TrimPrefix(config.warmStart, "top"))
+		if err != nil || n < 1 || !strings.HasPrefix(config.warmStart, "top") {
+			return fmt.Errorf("invalid --warm-start value %q (use topN, e.g. top1k)", config.warmStart)
+		}
+		// A resumed run wrote them already
+		if mangler.skip == 0 {
+			if err := mangler.warmStart(int(min(n, math.MaxInt32))); err != nil {
+				return err
+			}
+		}
 	}
 
-	res := make(map[string]struct{})
-	res[word] = struct{}{}
-	if m.config.double {
-		res[word+word] = struct{}{}
-	}
-	if m.config.reverse {
-		res[reverseString(word)] = struct{}{}
-	}
-	if m.config.capital {
-		res[capitalize(word)] = struct{}{}
-	}
-	if m.config.lower {
-		res[strings.ToLower(word)] = struct{}{}
-	}
-	if m.config.upper {
-		res[strings.ToUpper(word)] = struct{}{}
+	if err := mangler.process(allWords); err != nil {
+		return err
 	}
-	if m.config.swap {
-		res[swapCase(word)] = struct{}{}
+	if err := mangler.finish(); err != nil {
+		return err
 	}
-	if m.config.prefixStrings != "" {
-		for _, s := range strings.Split(m.config.prefixStrings, ",") {
-			res[strings.TrimSpace(s)+word] = struct{}{}
+	if n := mangler.overBytes.Load(); n > 0 {
+		verb := "dropped"
+		if config.maxBytesAction == "truncate" {
+			verb = "truncated"
 		}
+		fmt.Fprintf(os.Stderr, "Warning: %s %d candidate(s) longer than --max-bytes %d\n", verb, n, config.maxBytes)
 	}
-	if m.config.suffixStrings != "" {
-		for _, s := range strings.Split(m.config.suffixStrings, ",") {
-			res[word+strings.TrimSpace(s)] = struct{}{}
+	if mangler.parquet != nil {
+		// Written on early stops too, so the partial output stays readable
+		if err := mangler.parquet.close(); err != nil {
+			return err
 		}
 	}
-	if m.config.common != "" {
-		for _, c := range m.currentCommon {
-			res[c+word] = struct{}{}
-			res[word+c] = struct{}{}
+	if mangler.limits.stopped.Load() {
+		if err := mangler.bufWriter.Flush(); err != nil {
+			return err
 		}
-	}
-	if m.config.fullLeet {
-		for _, v := range generateFullLeetVariations(word) {
-			res[v] = struct{}{}
+		cp := &checkpoint{
+			WordsDone:  mangler.limits.doneUpTo,
+			WordsTotal: mangler.limits.total,
+			Candidates: mangler.emitted.Load(),
+			Reason:     mangler.limits.reason,
 		}
-	} else if m.config.leet {
-		allSwapped := word
-		for char, reps := range leetMap {
-			if len(reps) > 0 {
-				rep := string(reps[0])
-				res[strings.ReplaceAll(word, string(char), rep)] = struct{}{}
-				allSwapped = strings.ReplaceAll(allSwapped, string(char), rep)
-			}
+		if err := cp.save(config.checkpointFile); err != nil {
+			return fmt.Errorf("failed to write checkpoint: %w", err)
 		}
-		res[allSwapped] = struct{}{}
+		fmt.Fprintf(os.Stderr, "Stopped: %s after %d of %d input words (%s candidates written)\n",
+			cp.Reason, cp.WordsDone, cp.WordsTotal, humanCount(float64(cp.Candidates)))
+		fmt.Fprintf(os.Stderr, "Checkpoint written to %s; continue with --resume %s and a new -o\n", config.checkpointFile, config.checkpointFile)
 	}
-	if m.config.allCases {
-		for _, v := range generateAllCasePermutations(word) {
-			res[v] = struct{}{}
+	if sess != nil {
+		if err := mangler.bufWriter.Flush(); err != nil {
+			return err
 		}
-	}
-	if m.config.punctuation {
-		for _, p := range "!@$%^&*()" {
-			res[word+string(p)] = struct{}{}
+		path, err := sess.finish(config, mangler)
+		if err != nil {
+			return fmt.Errorf("failed to write session manifest: %w", err)
 		}
+		fmt.Fprintf(os.Stderr, "Session manifest written to %s\n", path)
 	}
-	if m.config.smartAffix {
-		m.addSmartAffixes(word, res)
+	if crackRate != nil && !config.estimate {
+		fmt.Fprintf(os.Stderr, "Exhausting %s candidates at %s takes %s\n",
+			humanCount(float64(mangler.emitted.Load())), crackRate, humanDuration(crackRate.seconds(float64(mangler.emitted.Load()))))
 	}
-	if m.config.toggleVariations {
-		for _, v := range generateToggleVariations(word) {
-			res[v] = struct{}{}
-		}
+	return nil
+}
+
+// checkDiskSpace predicts the output size from the keyspace estimate and
+// compares it with the free space where -o will be written. Too little space
+// is an error unless --assume-yes turns it into a warning.
+func checkDiskSpace(config *Config, common, words []string) error {
+	dir := filepath.Dir(config.outputFile)
+	free, ok := freeDiskSpace(dir)
+	if !ok {
+		return nil
 	}
-	if m.config.yearsCount != "" {
-		m.addNumberRange(word, m.config.yearsCount, true, res)
-		m.addNumberRange(word, m.config.yearsCount, false, res)
+	// The file being replaced frees its space
+	if st, err := os.Stat(config.outputFile); err == nil {
+		free += uint64(st.Size())
 	}
-	if m.config.prefixRange != "" {
-		m.addNumberRange(word, m.config.prefixRange, true, res)
+
+	est := (&Mangler{config: config, currentCommon: common}).estimateKeyspace(words)
+	count := est.total
+	if n, err := parseCount(config.sample); err == nil && float64(n) < count {
+		count = float64(n)
 	}
-	if m.config.suffixRange != "" {
-		m.addNumberRange(word, m.config.suffixRange, false, res)
+	if n, err := parseCount(config.budget); err == nil && n > 0 && float64(n) < count {
+		count = float64(n)
 	}
-
-	for w := range res {
-		m.writeWord(w)
+	maxCount, maxBytes, _ := parseOutputLimit(config.maxOutput)
+	if maxCount > 0 && float64(maxCount) < count {
+		count = float64(maxCount)
 	}
-}
-
-func (m *Mangler) applySequence(word string) {
-	rules := strings.Split(m.config.rulesList, ",")
-	current := []string{word}
-
-	for _, rule := range rules {
-		rule = strings.TrimSpace(strings.ToLower(rule))
-		var nextSet []string
-		for _, w := range current {
-			switch rule {
-			case "strip":
-				nextSet = append(nextSet, strings.Join(strings.Fields(w), ""))
-			case "-r", "--reverse", "reverse":
-				nextSet = append(nextSet, reverseString(w))
-			case "-u", "--upper", "--uppercase", "upper", "uppercase":
-				nextSet = append(nextSet, strings.ToUpper(w))
-			case "-l", "--lower", "--lowercase", "lower", "lowercase":
-				nextSet = append(nextSet, strings.ToLower(w))
-			case "-s", "--swap", "--swapcase", "swap", "swapcase":
-				nextSet = append(nextSet, swapCase(w))
-			case "-c", "--capital", "--capitalize", "capital", "capitalize":
-				nextSet = append(nextSet, capitalize(w))
-			case "-d", "--double", "double":
-				nextSet = append(nextSet, w+w)
-			case "-t", "--leet", "leet":
-				swapped := w
-				for char, reps := range leetMap {
-					if len(reps) > 0 {
-						swapped = strings.ReplaceAll(swapped, string(char), string(reps[0]))
-					}
-				}
-				nextSet = append(nextSet, swapped)
-			default:
-				nextSet = append(nextSet, w)
-			}
-		}
-		current = nextSet
+	need := count * (est.avgLen + 1)
+	if maxBytes > 0 && float64(maxBytes) < need {
+		need = float64(maxBytes)
+	}
+	if need <= float64(free) {
+		return nil
 	}
 
-	for _, w := range current {
-		m.writeWord(w)
+	msg := fmt.Sprintf("estimated output of ~%sB exceeds the %sB free in %s", humanCount(need), humanCount(float64(free)), dir)
+	if config.assumeYes {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", msg)
+		return nil
 	}
+	return fmt.Errorf("%s (cap it with --max-output, or use --assume-yes to write anyway)", msg)
 }
 
-func (m *Mangler) writeWord(word string) {
-	if m.config.minLength > 0 && len(word) < m.config.minLength {
+// assignProfile records the config each newly loaded word is mangled with.
+// A word listed in several files keeps the profile of the first one.
+func assignProfile(profiles map[string]*Config, words []string, profile, global *Config) {
+	if profiles == nil {
 		return
 	}
-	if m.config.maxLength > 0 && len(word) > m.config.maxLength {
-		return
+	if profile == nil {
+		profile = global
 	}
-
-	// Exclusion Filters
-	if m.config.noNumbers || m.config.noSymbols || m.config.noCapitals {
-		for _, r := range word {
-			if m.config.noNumbers && r >= '0' && r <= '9' {
-				return
-			}
-			if m.config.noCapitals && r >= 'A' && r <= 'Z' {
-				return
-			}
-			if m.config.noSymbols && !((r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')) {
-				return
-			}
+	for _, w := range words {
+		if _, ok := profiles[w]; !ok {
+			profiles[w] = profile
 		}
 	}
+}
 
-	if m.config.crunchFilter != "" && !m.matchesCrunch(word) {
+// assignWeight records the --file weight of newly loaded words. A word
+// listed in several files keeps the highest weight.
+func assignWeight(weights map[string]float64, words []string, weight float64) {
+	if weight == 0 {
 		return
 	}
-
-	// Blacklist Check
-	if m.blacklistedWords != nil {
-		if _, exists := m.blacklistedWords[word]; exists {
-			return
+	for _, w := range words {
+		if weight > weights[w] {
+			weights[w] = weight
 		}
 	}
+}
 
-	// Strength Filter
-	if m.config.minStrength > 0 {
-		if calculateStrength(word) < m.config.minStrength {
-			return
-		}
+// weightOf returns the --file weight of an input word, 1 when it has none
+func (m *Mangler) weightOf(word string) float64 {
+	if w, ok := m.weights[word]; ok {
+		return w
 	}
+	return 1
+}
 
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// origin is where an accepted candidate came from: the weight and input
+// index of its source word, for --sort e, --sort source-then-efficacy and
+// --annotate. It travels with the candidate to the output; a duplicate
+// keeps the origin of the instance accepted first.
+type origin struct {
+	weight float64 // 1 when unweighted
+	source int     // Input index, -1 when unknown
+}
 
-	// If we are building an internal pool, we bypass all final filters
-	if strings.HasPrefix(m.config.sortMode, "INTERNAL") {
-		m.collectedResults = append(m.collectedResults, word)
-		return
-	}
+// noOrigin is the origin of candidates that come from no input word
+var noOrigin = origin{weight: 1, source: -1}
 
-	crc := crc32.ChecksumIEEE([]byte(word))
-	if _, exists := m.seenCRCs[crc]; exists {
+// sinkWord is a candidate held by a pipeline stage, with its origin
+type sinkWord struct {
+	word string
+	from origin
+}
+
+// assignSource records the input index of newly loaded words. A word found
+// in several inputs keeps the first.
+func assignSource(sources map[string]int, words []string, index int) {
+	if sources == nil {
 		return
 	}
-	m.seenCRCs[crc] = struct{}{}
-	if m.config.sortMode != "" {
-		m.collectedResults = append(m.collectedResults, word)
-		return
+	for _, w := range words {
+		if _, ok := sources[w]; !ok {
+			sources[w] = index
+		}
 	}
-	m.bufWriter.WriteString(word + "\n")
 }
 
-func calculateStrength(s string) int {
-	if len(s) == 0 {
-		return 0
+// sourceOf returns the input index of an input word, -1 when unknown
+func (m *Mangler) sourceOf(word string) int {
+	if i, ok := m.sources[word]; ok {
+		return i
 	}
-	score := 0
+	return -1
+}
 
-	// Criteria based on common complexity standards
-	hasLower := false
-	hasUpper := false
-	hasNumber := false
-	hasSpec := false
+// sourceName returns the file name of an input index, "" when unknown
+func (m *Mangler) sourceName(index int) string {
+	if index < 0 || index >= len(m.sourceNames) {
+		return ""
+	}
+	return m.sourceNames[index]
+}
 
-	for _, r := range s {
-		if r >= 'a' && r <= 'z' {
-			hasLower = true
-		}
-		if r >= 'A' && r <= 'Z' {
-			hasUpper = true
-		}
-		if r >= '0' && r <= '9' {
-			hasNumber = true
-		}
-		if !((r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')) {
-			hasSpec = true
+// sourceLess orders candidates by the input they came from, in command
+// line order, and by weighted efficacy within an input. Candidates of
+// unknown origin sort last.
+func (m *Mangler) sourceLess(a, b sinkWord) bool {
+	rank := func(i int) int {
+		if i < 0 {
+			return len(m.sourceNames)
 		}
+		return i
+	}
+	if sa, sb := rank(a.from.source), rank(b.from.source); sa != sb {
+		return sa < sb
 	}
+	return weightedEfficacyLess(a, b)
+}
 
-	if hasLower {
-		score++
+// weightedEfficacyLess is efficacyLess with each efficacy multiplied by the
+// weight of the candidate's source
+func weightedEfficacyLess(a, b sinkWord) bool {
+	ea, eb := getWordEfficacy(a.word)*a.from.weight, getWordEfficacy(b.word)*b.from.weight
+	if ea == eb {
+		return a.word < b.word
 	}
-	if hasUpper {
-		score++
+	return ea > eb
+}
+
+// emit writes a final candidate, routing it through --sample/--shuffle
+// and --collapse-runs
+func (m *Mangler) emit(word string, from origin) {
+	switch {
+	case m.sampler != nil:
+		m.sampler.add(word, from)
+	case m.shuffler != nil:
+		m.shuffler.add(word, from)
+	case m.collapser != nil && m.collapser.add(word, func(w string) { m.emitRecord(w, "", nil, noOrigin) }):
+	default:
+		m.emitRecord(word, "", nil, from)
 	}
-	if hasNumber {
-		score++
+}
+
+// emitRecord writes a candidate in the output format. source and rules are
+// its provenance for --output-format jsonl, when known; from names its input
+// file.
+func (m *Mangler) emitRecord(word, source string, rules []string, from origin) {
+	line := word
+	switch {
+	case m.config.outputFormat == "jsonl":
+		line = jsonRecord(word, source, m.sourceName(from.source), rules, m.config, m.dict)
+	case m.config.withScores:
+		line = scoredLine(m.dict, word, m.config.pairMode)
+	}
+	if m.config.annotate {
+		line += "\t" + m.sourceName(from.source)
+	}
+	if !m.limits.allow(m.emitted.Load(), len(line)+1) {
+		return
 	}
-	if hasSpec {
-		score++
+	if m.parquet != nil {
+		m.parquet.add(word)
+	} else {
+		m.bufWriter.WriteString(line + "\n")
 	}
+	m.emitted.Add(1)
+}
 
-	// Length bonus
-	if len(s) < 8 {
-		if score > 2 {
-			score = 2 // Cap weak short passwords
-		} else {
-			score--
+// candidateRecord is one line of --output-format jsonl
+type candidateRecord struct {
+	Candidate string   `json:"candidate"`
+	User      string   `json:"user,omitempty"` // --pair-mode
+	Source    string   `json:"source"`
+	File      string   `json:"file,omitempty"` // Input file of the source word
+	Rules     []string `json:"rules"`
+	Score     int      `json:"score"`
+	Efficacy  *float64 `json:"efficacy,omitempty"` // --with-scores
+}
+
+// jsonRecord formats a candidate for --output-format jsonl. A --rules recipe
+// is recorded as its individual steps.
+func jsonRecord(word, source, file string, rules []string, cfg *Config, dict *wordDict) string {
+	rec := candidateRecord{Candidate: word, Source: source, File: file, Rules: []string{}}
+	if cfg.pairMode {
+		rec.User, rec.Candidate, _ = strings.Cut(word, ":")
+	}
+	for _, r := range rules {
+		for _, step := range strings.Split(r, ",") {
+			rec.Rules = append(rec.Rules, strings.TrimSpace(step))
 		}
 	}
-	if len(s) >= 12 {
-		score++
+	var efficacy float64
+	rec.Score, efficacy = wordScores(dict, word, cfg.pairMode)
+	if cfg.withScores {
+		rec.Efficacy = &efficacy
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(rec)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// wordScores returns the strength and efficacy of a candidate. In pair mode
+// only the password after the first ':' is scored.
+func wordScores(dict *wordDict, word string, pairMode bool) (int, float64) {
+	if pairMode {
+		_, word, _ = strings.Cut(word, ":")
 	}
+	return dict.strength(word, utf8.RuneCountInString(word)), getWordEfficacy(word)
+}
 
-	if score < 0 {
-		score = 0
+// scoredLine formats a candidate for --with-scores
+func scoredLine(dict *wordDict, word string, pairMode bool) string {
+	strength, efficacy := wordScores(dict, word, pairMode)
+	return word + "\t" + strconv.Itoa(strength) + "\t" + strconv.FormatFloat(efficacy, 'g', 6, 64)
+}
+
+// finish drains the sampling, shuffling and collapsing stages into the
+// output
+func (m *Mangler) finish() error {
+	if m.sampler != nil {
+		words := m.sampler.words()
+		m.sampler = nil
+		for _, w := range words {
+			m.emit(w.word, w.from)
+		}
 	}
-	if score > 4 {
-		score = 4
+	if m.shuffler != nil {
+		sh := m.shuffler
+		m.shuffler = nil
+		return sh.drain(m.emit)
 	}
-	return score
+	if m.collapser != nil {
+		c := m.collapser
+		m.collapser = nil
+		return c.write(m)
+	}
+	return nil
 }
 
-func (m *Mangler) matchesCrunch(s string) bool {
-	f := m.config.crunchFilter
-	if len(s) != len(f) {
+// outputLimits stops generation once --max-output or --time-limit is hit
+// and tracks which input words were fully mangled for the checkpoint
+type outputLimits struct {
+	maxCount int64
+	maxBytes int64
+	bytes    int64
+	stopped  atomic.Bool
+	once     sync.Once
+	reason   string // Set before stopped
+	byCount  string // Stop reason when maxCount was set by --control
+	mu       sync.Mutex
+	total    int              // Words to mangle
+	done     map[int]struct{} // Finished words beyond doneUpTo
+	doneUpTo int              // Words [0, doneUpTo) are finished
+}
+
+// stop ends generation; the first reason wins
+func (l *outputLimits) stop(reason string) {
+	l.once.Do(func() {
+		l.reason = reason
+		l.stopped.Store(true)
+	})
+}
+
+// allow reports whether another candidate of n bytes may be written after
+// emitted candidates, stopping generation when it may not
+func (l *outputLimits) allow(emitted int64, n int) bool {
+	if l.maxCount > 0 && emitted >= l.maxCount {
+		if l.byCount != "" {
+			l.stop(l.byCount)
+		} else {
+			l.stop(fmt.Sprintf("--max-output of %d candidates reached", l.maxCount))
+		}
 		return false
 	}
-	for i := 0; i < len(s); i++ {
-		c := s[i]
-		switch f[i] {
-		case '.':
-			continue
-		case '#':
-			if c < '0' || c > '9' {
-				return false
-			}
-		case '^':
-			if c < 'A' || c > 'Z' {
-				return false
-			}
-		case '%':
-			if c < 'a' || c > 'z' {
-				return false
-			}
-		case '&':
-			if (c >= '0' && c <= '9') || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') {
-				return false
-			}
-		default:
-			if c != f[i] {
-				return false
-			}
-		}
+	if l.maxBytes > 0 && l.bytes+int64(n) > l.maxBytes {
+		l.stop(fmt.Sprintf("--max-output of %d bytes reached", l.maxBytes))
+		return false
 	}
+	l.bytes += int64(n)
 	return true
 }
 
-func (m *Mangler) addNumberRange(word string, r string, prefix bool, res map[string]struct{}) {
-	parts := strings.Split(r, "-")
-	if len(parts) != 2 {
+// jobDone records that word i was fully mangled before any limit was hit
+func (l *outputLimits) jobDone(i int) {
+	if l.stopped.Load() {
 		return
 	}
-	cur := time.Now().Year()
-	parse := func(s string) int {
-		if strings.ToLower(strings.TrimSpace(s)) == "current" {
-			return cur
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if i != l.doneUpTo {
+		if l.done == nil {
+			l.done = make(map[int]struct{})
 		}
-		var v int
-		fmt.Sscanf(s, "%d", &v)
-		return v
-	}
-	sVal, eVal := parse(parts[0]), parse(parts[1])
-	pad := len(strings.TrimSpace(parts[0]))
-	fmtStr := "%d"
-	if strings.HasPrefix(strings.TrimSpace(parts[0]), "0") || (pad > 1 && sVal < 10) {
-		fmtStr = fmt.Sprintf("%%0%dd", pad)
+		l.done[i] = struct{}{}
+		return
 	}
-	for i := sVal; i <= eVal; i++ {
-		ns := fmt.Sprintf(fmtStr, i)
-		if prefix {
-			res[ns+word] = struct{}{}
-		} else {
-			res[word+ns] = struct{}{}
+	l.doneUpTo++
+	for {
+		if _, ok := l.done[l.doneUpTo]; !ok {
+			break
 		}
+		delete(l.done, l.doneUpTo)
+		l.doneUpTo++
 	}
 }
 
-func (m *Mangler) generatePermutations(words []string) []string {
-	var res []string
-	sep := ""
-	if m.config.space {
-		sep = " "
-	}
-	for l := 1; l <= len(words); l++ {
-		m.permuteHelper(words, l, []string{}, &res, sep)
+// parseOutputLimit parses --max-output: a candidate count ("500M", "1e9")
+// or, with a B after the unit, a size in bytes ("500MB", "2GB")
+func parseOutputLimit(s string) (count, bytes int64, err error) {
+	u := strings.ToUpper(strings.TrimSpace(s))
+	if len(u) > 2 && strings.HasSuffix(u, "B") && strings.ContainsAny(u[len(u)-2:len(u)-1], "KMGT") {
+		bytes, err = parseCount(u[:len(u)-1])
+		return 0, bytes, err
 	}
-	return res
+	count, err = parseCount(u)
+	return count, 0, err
 }
 
-func (m *Mangler) permuteHelper(words []string, l int, cur []string, res *[]string, sep string) {
-	if len(cur) == l {
-		p := strings.Join(cur, sep)
-		*res = append(*res, p)
-		m.writeWord(p)
-		return
+// checkpoint records how far a run stopped by a limit got, so --resume can
+// continue after the last fully mangled input word
+type checkpoint struct {
+	WordsDone  int    `json:"words_done"`
+	WordsTotal int    `json:"words_total"`
+	Candidates int64  `json:"candidates"`
+	Reason     string `json:"reason"`
+}
+
+func loadCheckpoint(path string) (*checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
 	}
-	for i := 0; i < len(words); i++ {
-		used := false
-		for _, w := range cur {
-			if w == words[i] {
-				used = true
-				break
-			}
-		}
-		if !used {
-			m.permuteHelper(words, l, append(cur, words[i]), res, sep)
-		}
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
 	}
+	return &cp, nil
 }
 
-func generateAcronym(words []string) string {
-	var b strings.Builder
-	for _, w := range words {
-		if len(w) > 0 {
-			b.WriteByte(w[0])
-		}
+func (cp *checkpoint) save(path string) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
 	}
-	return b.String()
+	return os.WriteFile(path, append(data, '\n'), 0644)
 }
 
-func reverseString(s string) string {
-	r := []rune(s)
-	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
-		r[i], r[j] = r[j], r[i]
-	}
-	return string(r)
+// sessionManifest is what --session writes next to the output: enough to
+// tell later which inputs and options produced a wordlist
+type sessionManifest struct {
+	Session      string         `json:"session"`
+	Version      string         `json:"version"`
+	Command      []string       `json:"command"`
+	ConfigHash   string         `json:"config_hash"`
+	Options      []string       `json:"options"`
+	Inputs       []sessionInput `json:"inputs"`
+	Output       string         `json:"output"`
+	OutputSHA256 string         `json:"output_sha256"`
+	Started      time.Time      `json:"started"`
+	Finished     time.Time      `json:"finished"`
+	Candidates   int64          `json:"candidates"`
+	Bytes        int64          `json:"bytes"`
+	Stopped      string         `json:"stopped,omitempty"` // Limit or control command that ended the run early
 }
 
-func capitalize(s string) string {
-	if len(s) == 0 {
-		return s
-	}
-	r := []rune(s)
-	r[0] = []rune(strings.ToUpper(string(r[0])))[0]
-	return string(r)
+type sessionInput struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256,omitempty"` // Empty for stdin, which cannot be read twice
+	Bytes  int64  `json:"bytes"`
 }
 
-func swapCase(s string) string {
-	var b strings.Builder
-	for _, r := range s {
-		if r >= 'a' && r <= 'z' {
-			b.WriteRune(r - 32)
-		} else if r >= 'A' && r <= 'Z' {
-			b.WriteRune(r + 32)
-		} else {
-			b.WriteRune(r)
+// session collects the manifest while the run writes through track
+type session struct {
+	manifest sessionManifest
+	sum      hash.Hash
+	written  int64
+}
+
+// sessionSkipOptions do not change which candidates are produced, so they
+// are left out of the config hash
+var sessionSkipOptions = map[string]bool{
+	"session": true, "output": true, "checkpoint": true, "control": true, "assume-yes": true,
+}
+
+func newSession(config *Config, inputs []inputSpec) (*session, error) {
+	s := &session{sum: sha256.New()}
+	s.manifest = sessionManifest{
+		Session: config.session,
+		Version: version,
+		Command: os.Args,
+		Output:  config.outputFile,
+		Started: time.Now().UTC(),
+		Inputs:  []sessionInput{},
+	}
+	s.manifest.Options = configOptions(config)
+	h := sha256.Sum256([]byte(strings.Join(s.manifest.Options, "\n")))
+	s.manifest.ConfigHash = hex.EncodeToString(h[:])
+	for _, in := range inputs {
+		rec := sessionInput{Path: in.path}
+		if in.path != "-" {
+			var f io.ReadCloser
+			var err error
+			if strings.HasPrefix(in.path, builtinPrefix) {
+				f, err = openInput(in.path)
+			} else {
+				f, err = os.Open(in.path)
+			}
+			if err != nil {
+				return nil, err
+			}
+			fh := sha256.New()
+			rec.Bytes, err = io.Copy(fh, f)
+			f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", in.path, err)
+			}
+			rec.SHA256 = hex.EncodeToString(fh.Sum(nil))
 		}
+		s.manifest.Inputs = append(s.manifest.Inputs, rec)
 	}
-	return b.String()
+	return s, nil
 }
 
-func generateFullLeetVariations(word string) []string {
-	lw := strings.ToLower(word)
-	var sbs []substitution
-	for i, r := range lw {
-		if rps, ok := leetMap[r]; ok {
-			sbs = append(sbs, substitution{i, rps})
+// configOptions lists the options that differ from their defaults as sorted
+// "name=value" pairs. Shorthands share their long form's value and are
+// reported once, under the longer name.
+func configOptions(config *Config) []string {
+	defaults := &Config{}
+	fs := newFlagSet(defaults, flag.ContinueOnError)
+	*defaults = *config
+	names := make(map[flag.Value]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Value.String() == f.DefValue {
+			return
+		}
+		if prev, ok := names[f.Value]; !ok || len(f.Name) > len(prev) {
+			names[f.Value] = f.Name
+		}
+	})
+	var opts []string
+	for v, name := range names {
+		if !sessionSkipOptions[name] {
+			opts = append(opts, name+"="+v.String())
 		}
 	}
-	if len(sbs) == 0 {
-		return []string{word}
-	}
-	var res []string
-	generateLeetCombinations([]rune(word), sbs, 0, &res)
-	return res
+	sort.Strings(opts)
+	return opts
 }
 
-func generateLeetCombinations(w []rune, sbs []substitution, idx int, res *[]string) {
-	if idx == len(sbs) {
-		*res = append(*res, string(w))
-		return
+// track returns w wrapped so the bytes written and their checksum end up
+// in the manifest
+func (s *session) track(w io.Writer) io.Writer {
+	return io.MultiWriter(w, s)
+}
+
+func (s *session) Write(p []byte) (int, error) {
+	s.written += int64(len(p))
+	return s.sum.Write(p)
+}
+
+// finish completes the manifest and writes it as <session>.manifest.json in
+// the output's directory (the working directory for stdout)
+func (s *session) finish(config *Config, m *Mangler) (string, error) {
+	s.manifest.Finished = time.Now().UTC()
+	s.manifest.Candidates = m.emitted.Load()
+	s.manifest.Bytes = s.written
+	s.manifest.OutputSHA256 = hex.EncodeToString(s.sum.Sum(nil))
+	if m.limits.stopped.Load() {
+		s.manifest.Stopped = m.limits.reason
+	}
+	dir := "."
+	if config.outputFile != "-" {
+		dir = filepath.Dir(config.outputFile)
 	}
-	sb := sbs[idx]
-	orig := w[sb.pos]
-	generateLeetCombinations(w, sbs, idx+1, res)
-	for _, r := range sb.chars {
-		w[sb.pos] = r
-		generateLeetCombinations(w, sbs, idx+1, res)
+	path := filepath.Join(dir, config.session+".manifest.json")
+	data, err := json.MarshalIndent(&s.manifest, "", "  ")
+	if err != nil {
+		return "", err
 	}
-	w[sb.pos] = orig
+	return path, os.WriteFile(path, append(data, '\n'), 0644)
 }
 
-func generateAllCasePermutations(word string) []string {
-	var results []string
-	n := len(word)
-	max := 1 << n
-
-	// Pre-calculate lower and upper runes to avoid repeated calls
-	runes := []rune(word)
-	lowers := make([]rune, n)
-	uppers := make([]rune, n)
+// controller serves --control: an orchestrator sends one command per line
+// and gets one reply line back ("ok ...", "error: ..." or a JSON status)
+type controller struct {
+	m       *Mangler
+	total   int // Input words
+	started time.Time
+	mu      sync.Mutex
+	paused  bool
+	rate    float64   // Candidates per second, 0 = unlimited
+	next    time.Time // When the next candidate may be written under rate
+}
 
-	for i, r := range runes {
-		lowers[i] = []rune(strings.ToLower(string(r)))[0]
-		uppers[i] = []rune(strings.ToUpper(string(r)))[0]
-	}
+// controlPoll is how often paused workers check whether to go on
+const controlPoll = 50 * time.Millisecond
 
-	for i := 0; i < max; i++ {
-		current := make([]rune, n)
-		for j := 0; j < n; j++ {
-			if (i>>j)&1 == 1 {
-				current[j] = uppers[j]
-			} else {
-				current[j] = lowers[j]
-			}
-		}
-		results = append(results, string(current))
+// hold blocks while generation is paused. It polls rather than waiting on a
+// condition so that --time-limit and other stops release paused workers.
+func (c *controller) hold() {
+	c.mu.Lock()
+	for c.paused && !c.m.limits.stopped.Load() {
+		c.mu.Unlock()
+		time.Sleep(controlPoll)
+		c.mu.Lock()
 	}
-	return results
+	c.mu.Unlock()
 }
 
-func getWordEfficacy(s string) float64 {
-	w := 1.0
-	l := len(s)
-	if v, ok := lengthChances[l]; ok {
-		w *= v
-	} else if l > 24 {
-		w *= 0.0001
+// pace is hold plus the set-rate limit, called once per candidate
+func (c *controller) pace() {
+	c.hold()
+	c.mu.Lock()
+	if c.rate <= 0 {
+		c.mu.Unlock()
+		return
 	}
+	now := time.Now()
+	if c.next.Before(now) {
+		c.next = now
+	}
+	delay := c.next.Sub(now)
+	c.next = c.next.Add(time.Duration(float64(time.Second) / c.rate))
+	c.mu.Unlock()
+	time.Sleep(delay)
+}
 
-	combo := 0
-	hasLower, hasUpper, hasNumber, hasSpec := false, false, false, false
-	allLower, allUpper, onlyNumbers := true, true, true
-	firstUpper := false
+// controlStatus is the reply to the status command
+type controlStatus struct {
+	State      string  `json:"state"` // "running", "paused" or "stopped"
+	WordsDone  int     `json:"words_done"`
+	WordsTotal int     `json:"words_total"`
+	Candidates int64   `json:"candidates"`
+	Rate       float64 `json:"rate"` // Candidates per second limit, 0 = unlimited
+	Elapsed    string  `json:"elapsed"`
+}
 
-	for i, r := range s {
-		isLower := r >= 'a' && r <= 'z'
-		isUpper := r >= 'A' && r <= 'Z'
-		isNum := r >= '0' && r <= '9'
-		isSpec := !isLower && !isUpper && !isNum
+func (c *controller) status() string {
+	st := controlStatus{State: "running", WordsTotal: c.total, Elapsed: time.Since(c.started).Round(time.Second).String()}
+	c.mu.Lock()
+	if c.paused {
+		st.State = "paused"
+	}
+	st.Rate = c.rate
+	c.mu.Unlock()
+	if c.m.limits.stopped.Load() {
+		st.State = "stopped"
+	}
+	c.m.limits.mu.Lock()
+	st.WordsDone = c.m.limits.doneUpTo
+	c.m.limits.mu.Unlock()
+	st.Candidates = c.m.emitted.Load()
+	b, _ := json.Marshal(st)
+	return string(b)
+}
 
-		if isLower {
-			hasLower = true
-			allUpper = false
-			onlyNumbers = false
+// handle runs one control command and returns its reply
+func (c *controller) handle(line string) string {
+	cmd, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+	arg = strings.TrimSpace(arg)
+	switch strings.ToLower(cmd) {
+	case "pause":
+		c.mu.Lock()
+		c.paused = true
+		c.mu.Unlock()
+		return "ok paused"
+	case "resume":
+		c.mu.Lock()
+		c.paused = false
+		c.mu.Unlock()
+		return "ok running"
+	case "status":
+		return c.status()
+	case "set-rate":
+		n, err := parseCount(arg)
+		if err != nil || n < 0 {
+			return "error: set-rate needs candidates per second (0 = unlimited)"
 		}
-		if isUpper {
-			hasUpper = true
-			allLower = false
-			onlyNumbers = false
-			if i == 0 {
-				firstUpper = true
-			}
+		c.mu.Lock()
+		c.rate, c.next = float64(n), time.Time{}
+		c.mu.Unlock()
+		return fmt.Sprintf("ok rate %d/s", n)
+	case "stop-after":
+		// Durations need a unit (30s, 10m, 2h); counts take K/M/G (500M)
+		if d, err := time.ParseDuration(arg); err == nil && d >= 0 {
+			time.AfterFunc(d, func() {
+				c.m.limits.stop(fmt.Sprintf("--control stop-after %s reached", arg))
+			})
+			return fmt.Sprintf("ok stopping in %s", d)
 		}
-		if isNum {
-			hasNumber = true
-			allLower = false
-			allUpper = false
+		n, err := parseCount(arg)
+		if err != nil || n < 0 {
+			return "error: stop-after needs a candidate count (500M) or a duration (30m)"
 		}
-		if isSpec {
-			hasSpec = true
-			allLower = false
-			allUpper = false
-			onlyNumbers = false
+		if n == 0 {
+			c.m.limits.stop("--control stop-after 0")
+			return "ok stopping"
 		}
+		c.m.mu.Lock()
+		limit := c.m.emitted.Load() + n
+		if c.m.limits.maxCount == 0 || limit < c.m.limits.maxCount {
+			c.m.limits.maxCount = limit
+			c.m.limits.byCount = fmt.Sprintf("--control stop-after %d reached", n)
+		}
+		c.m.mu.Unlock()
+		return fmt.Sprintf("ok stopping after %d more candidates", n)
+	default:
+		return fmt.Sprintf("error: unknown command %q (use pause, resume, status, set-rate or stop-after)", cmd)
 	}
+}
 
-	if hasLower && allLower {
-		combo |= MaskAllLower
+// serve answers the commands read from r on w until r ends
+func (c *controller) serve(r io.Reader, w io.Writer) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if strings.TrimSpace(sc.Text()) != "" {
+			fmt.Fprintln(w, c.handle(sc.Text()))
+		}
 	}
-	if hasUpper && allUpper {
-		combo |= MaskAllUpper
+}
+
+// listen starts serving the --control channel: stdin (replies on stderr),
+// an inherited file descriptor "fd:N" (replies on the same descriptor) or a
+// Unix socket path that orchestrators connect to. The returned func closes it.
+func (c *controller) listen(spec string) (func(), error) {
+	switch {
+	case spec == "stdin" || spec == "-":
+		go c.serve(os.Stdin, os.Stderr)
+		return func() {}, nil
+	case strings.HasPrefix(spec, "fd:"):
+		n, err := strconv.Atoi(spec[3:])
+		if err != nil || n < 3 {
+			return nil, fmt.Errorf("invalid descriptor %q (use fd:3 or higher)", spec)
+		}
+		f := os.NewFile(uintptr(n), spec)
+		if f == nil {
+			return nil, fmt.Errorf("%s is not open", spec)
+		}
+		go c.serve(f, f)
+		return func() { f.Close() }, nil
+	default:
+		ln, err := net.Listen("unix", spec)
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer conn.Close()
+					c.serve(conn, conn)
+				}()
+			}
+		}()
+		return func() { ln.Close() }, nil
 	}
-	if hasLower {
-		combo |= MaskHasLower
+}
+
+// countSuffixes are the unit suffixes parseCount accepts, in either case
+var countSuffixes = map[byte]int64{'K': 1e3, 'M': 1e6, 'G': 1e9, 'B': 1e9, 'T': 1e12}
+
+// parseCount parses a count with an optional K/M/G/T suffix, a decimal
+// fraction or in scientific notation (e.g. "500", "10M", "1.5T", "1e9").
+// Anything after the number other than one suffix is an error.
+func parseCount(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty count")
 	}
-	if hasUpper {
-		combo |= MaskHasUpper
+	num, mult := s, int64(1)
+	if m, ok := countSuffixes[strings.ToUpper(s[len(s)-1:])[0]]; ok {
+		num, mult = s[:len(s)-1], m
 	}
-	if hasNumber {
-		combo |= MaskHasNumber
+	if num == "" || num[0] < '0' || num[0] > '9' {
+		return 0, fmt.Errorf("invalid count %q", s)
 	}
-	if hasSpec {
-		combo |= MaskHasSpec
+	if n, err := strconv.ParseInt(num, 10, 64); err == nil {
+		if n > math.MaxInt64/mult {
+			return 0, fmt.Errorf("count %q is too large", s)
+		}
+		return n * mult, nil
 	}
-	if onlyNumbers && hasNumber {
-		combo |= MaskOnlyNumbers
+	if strings.Trim(num, "0123456789.eE") != "" {
+		return 0, fmt.Errorf("invalid count %q", s)
 	}
-	if firstUpper && len(s) > 1 {
-		// Check second char is not upper
-		r2 := []rune(s)[1]
-		if !(r2 >= 'A' && r2 <= 'Z') {
-			combo |= MaskFirstUpper
-		}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid count %q", s)
 	}
-
-	// Suffix checks
-	if len(s) > 0 {
-		last := s[len(s)-1]
-		if last >= '0' && last <= '9' {
-			combo |= MaskEndsInNumber
-		}
-		if !((last >= 'a' && last <= 'z') || (last >= 'A' && last <= 'Z') || (last >= '0' && last <= '9')) {
-			combo |= MaskEndsInSpec
-		}
+	if v*float64(mult) >= math.MaxInt64 {
+		return 0, fmt.Errorf("count %q is too large", s)
 	}
+	return int64(v * float64(mult)), nil
+}
 
-	// Leet check (very simplified: contains digit/spec and then a letter)
-	if (hasNumber || hasSpec) && (hasLower || hasUpper) {
-		combo |= MaskLeet
-	}
+// reservoirSampler keeps a uniform random sample of a stream (Algorithm R)
+// and returns it in stream order
+type reservoirSampler struct {
+	size  int
+	seen  int64
+	items []sampledWord
+	rng   *rand.Rand
+}
 
-	if v, ok := comboChances[combo]; ok {
-		w *= v
-	} else {
-		w *= 0.0001
-	}
-	return w
+type sampledWord struct {
+	idx int64
+	sinkWord
 }
-func analyzeWordlist(words []string) {
-	total := len(words)
-	var n, sp, u, l int
-	lens := make(map[int]int)
-	strengths := make(map[int]int)
-	var totalScore int
 
-	rn, rs, ru, rl := regexp.MustCompile(`[0-9]`), regexp.MustCompile(`[^A-Za-z0-9]`), regexp.MustCompile(`[A-Z]`), regexp.MustCompile(`[a-z]`)
-	for _, w := range words {
-		if rn.MatchString(w) {
-			n++
-		}
-		if rs.MatchString(w) {
-			sp++
-		}
-		if ru.MatchString(w) {
-			u++
-		}
-		if rl.MatchString(w) {
-			l++
-		}
-		lens[len(w)]++
+func newReservoirSampler(size int, rng *rand.Rand) *reservoirSampler {
+	return &reservoirSampler{size: size, rng: rng}
+}
 
-		s := calculateStrength(w)
-		strengths[s]++
-		totalScore += s
+func (r *reservoirSampler) add(word string, from origin) {
+	if len(r.items) < r.size {
+		r.items = append(r.items, sampledWord{r.seen, sinkWord{word, from}})
+	} else if j := r.rng.Int63n(r.seen + 1); j < int64(r.size) {
+		r.items[j] = sampledWord{r.seen, sinkWord{word, from}}
 	}
-	fmt.Printf("\npassmut v%s Analysis Report\n====================================\nTotal words: %d\n", version, total)
-	fmt.Printf("Contains lowercase: %d (%.1f%%)\nContains uppercase: %d (%.1f%%)\nContains numbers:   %d (%.1f%%)\nContains specials:  %d (%.1f%%)\n", l, float64(l)/float64(total)*100, u, float64(u)/float64(total)*100, n, float64(n)/float64(total)*100, sp, float64(sp)/float64(total)*100)
+	r.seen++
+}
 
-	fmt.Printf("\nStrength Distribution (0-4):\n")
-	for i := 0; i <= 4; i++ {
-		count := strengths[i]
-		fmt.Printf("  Score %d: %6d (%5.1f%%)\n", i, count, float64(count)/float64(total)*100)
+func (r *reservoirSampler) words() []sinkWord {
+	sort.Slice(r.items, func(i, j int) bool { return r.items[i].idx < r.items[j].idx })
+	res := make([]sinkWord, len(r.items))
+	for i, it := range r.items {
+		res[i] = it.sinkWord
 	}
-	fmt.Printf("Avg Strength: %.2f / 4.00\n", float64(totalScore)/float64(total))
+	return res
+}
 
-	fmt.Println("\nLength Distribution Chart:")
-	printASCIIChart(lens, total)
+// shuffleMemLimit is the number of words shuffled in memory before the
+// shuffler starts scattering them across temporary bucket files
+const shuffleMemLimit = 1000000
+
+// shuffleBuckets is the number of bucket files words are first scattered
+// into, and shuffleBucketBytes the most of one bucket drain reads at once: a
+// bucket that grew past it is scattered again into as many buckets as its
+// size needs
+const (
+	shuffleBuckets     = 64
+	shuffleBucketBytes = 64 << 20
+)
+
+// diskShuffler shuffles an unbounded stream by scattering words into random
+// temporary buckets and shuffling each bucket in memory on drain. Spilled
+// words keep the input index of their origin, for --annotate; the weight
+// only matters for sorting, which comes before.
+type diskShuffler struct {
+	rng         *rand.Rand
+	mem         []sinkWord
+	files       []*os.File
+	writers     []*bufio.Writer
+	sizes       []int64 // Bytes written to each bucket
+	bucketBytes int64   // shuffleBucketBytes, lowered by tests
+	err         error   // First error writing a bucket, returned by drain
 }
 
-func printASCIIChart(lens map[int]int, total int) {
-	if total == 0 {
-		return
-	}
-	ks := make([]int, 0, len(lens))
-	for k := range lens {
+func newDiskShuffler(rng *rand.Rand) *diskShuffler {
+	return &diskShuffler{rng: rng, bucketBytes: shuffleBucketBytes}
+}
+
+func (d *diskShuffler) add(word string, from origin) {
+	if d.files == nil {
+		d.mem = append(d.mem, sinkWord{word, from})
+		if len(d.mem) < shuffleMemLimit {
+			return
+		}
+		if err := d.openBuckets(shuffleBuckets); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: shuffle falling back to memory: %v\n", err)
+			return
+		}
+		for _, w := range d.mem {
+			d.scatter(w)
+		}
+		d.mem = nil
+		return
+	}
+	d.scatter(sinkWord{word, from})
+}
+
+func (d *diskShuffler) openBuckets(n int) error {
+	for i := 0; i < n; i++ {
+		f, err := os.CreateTemp("", "passmut-shuffle-*")
+		if err != nil {
+			d.cleanup()
+			return err
+		}
+		d.files = append(d.files, f)
+		d.writers = append(d.writers, bufio.NewWriterSize(f, 64*1024))
+		d.sizes = append(d.sizes, 0)
+	}
+	return nil
+}
+
+// scatter spills a word to a random bucket as "<source index>\t<word>"
+func (d *diskShuffler) scatter(sw sinkWord) {
+	if d.err != nil {
+		return
+	}
+	d.spill(strconv.Itoa(sw.from.source) + "\t" + sw.word + "\n")
+}
+
+// spill writes one bucket line to a random bucket
+func (d *diskShuffler) spill(line string) {
+	i := d.rng.Intn(len(d.writers))
+	n, err := d.writers[i].WriteString(line)
+	d.sizes[i] += int64(n)
+	if err != nil {
+		d.err = err
+	}
+}
+
+func (d *diskShuffler) drain(fn func(string, origin)) error {
+	if d.files == nil {
+		d.rng.Shuffle(len(d.mem), func(i, j int) { d.mem[i], d.mem[j] = d.mem[j], d.mem[i] })
+		for _, w := range d.mem {
+			fn(w.word, w.from)
+		}
+		d.mem = nil
+		return nil
+	}
+	return d.drainBuckets(math.MaxInt64, fn)
+}
+
+// drainBuckets shuffles the buckets one after the other. A bucket larger
+// than bucketBytes is split into a fresh set of buckets first, unless it is
+// no smaller than the bucket it came from (parent bytes): then its lines
+// cannot be spread any further.
+func (d *diskShuffler) drainBuckets(parent int64, fn func(string, origin)) error {
+	if d.err != nil {
+		return d.err
+	}
+	for i, f := range d.files {
+		if err := d.writers[i].Flush(); err != nil {
+			return err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if size := d.sizes[i]; size > d.bucketBytes && size < parent {
+			if err := d.split(f, size, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		// Spilled candidates come back byte for byte, one per line
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		bucket := rawLines(data)
+		d.rng.Shuffle(len(bucket), func(i, j int) { bucket[i], bucket[j] = bucket[j], bucket[i] })
+		for _, line := range bucket {
+			index, word, _ := strings.Cut(line, "\t")
+			source, _ := strconv.Atoi(index)
+			fn(word, origin{weight: 1, source: source})
+		}
+	}
+	return nil
+}
+
+// split scatters an oversized bucket into twice the buckets its size needs,
+// so that each is expected to hold half of bucketBytes, and drains them
+func (d *diskShuffler) split(f *os.File, size int64, fn func(string, origin)) error {
+	sub := &diskShuffler{rng: d.rng, bucketBytes: d.bucketBytes}
+	defer sub.cleanup()
+	if err := sub.openBuckets(int(2 * ((size + d.bucketBytes - 1) / d.bucketBytes))); err != nil {
+		return err
+	}
+	r := bufio.NewReaderSize(f, 64*1024)
+	for {
+		line, err := r.ReadString('\n')
+		if line != "" {
+			sub.spill(line)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return sub.drainBuckets(size, fn)
+}
+
+// cleanup removes the temporary bucket files
+func (d *diskShuffler) cleanup() {
+	for _, f := range d.files {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	d.files = nil
+	d.writers = nil
+	d.sizes = nil
+}
+
+// collapseMaxDigits is the longest digit run --collapse-runs buffers, and
+// collapseMaxHeld the number of held candidates that makes it flush the
+// oldest runs
+const (
+	collapseMaxDigits = 6
+	collapseMaxHeld   = 1 << 22
+)
+
+// runCollapser is --collapse-runs. Candidates that are a base plus a run of
+// digits are held back; every complete block of at least min of them (one
+// base with all 10^n values in its last n digits) becomes a hashcat hybrid
+// job, with the fixed part in a wordlist and the free digits as ?d. The
+// rest is written as usual when its run is flushed: once more than limit
+// candidates are held, the runs opened first are flushed until half of
+// them remain, and the others at the end.
+type runCollapser struct {
+	min     int
+	limit   int
+	held    int
+	runs    map[digitRun][]uint32
+	order   []digitRun // Held runs, in the order they were opened
+	jobs    map[hybridJob][]string
+	covered int64 // Candidates the jobs cover
+}
+
+// digitRun groups candidates that differ only in a run of digits. For
+// prefix runs the digits are stored reversed, so the free positions of a
+// block are always the low digits.
+type digitRun struct {
+	base   string
+	digits int
+	prefix bool // Digits before the base (hashcat -a 7) instead of after (-a 6)
+}
+
+// hybridJob is one wordlist + mask file pair of --collapse-runs
+type hybridJob struct {
+	prefix bool
+	digits int // ?d positions in the mask
+}
+
+func newRunCollapser(min int) *runCollapser {
+	return &runCollapser{min: min, limit: collapseMaxHeld, runs: make(map[digitRun][]uint32), jobs: make(map[hybridJob][]string)}
+}
+
+// add holds back a word that ends, or else starts, with 1 to
+// collapseMaxDigits digits next to a non-empty base, and reports whether it
+// did. Candidates of runs flushed to make room go to rest.
+func (c *runCollapser) add(word string, rest func(string)) bool {
+	t := len(word)
+	for t > 0 && word[t-1] >= '0' && word[t-1] <= '9' {
+		t--
+	}
+	key, digits := digitRun{base: word[:t], digits: len(word) - t}, word[t:]
+	if t == len(word) {
+		l := 0
+		for l < len(word) && word[l] >= '0' && word[l] <= '9' {
+			l++
+		}
+		key, digits = digitRun{base: word[l:], digits: l, prefix: true}, reverseString(word[:l])
+	}
+	if key.base == "" || key.digits == 0 || key.digits > collapseMaxDigits {
+		return false
+	}
+	v, _ := strconv.Atoi(digits)
+	if _, open := c.runs[key]; !open {
+		c.order = append(c.order, key)
+	}
+	c.runs[key] = append(c.runs[key], uint32(v))
+	if c.held++; c.held > c.limit {
+		for c.held > c.limit/2 && len(c.order) > 0 {
+			c.flush(c.order[0], rest)
+			c.order = c.order[1:]
+		}
+	}
+	return true
+}
+
+// flush splits a held run into the fixed parts of hybrid jobs and the
+// leftovers, which go to rest
+func (c *runCollapser) flush(k digitRun, rest func(string)) {
+	vals := c.runs[k]
+	delete(c.runs, k)
+	c.held -= len(vals)
+	slices.Sort(vals)
+	vals = slices.Compact(vals)
+	c.split(k, vals, 0, k.digits, func(lo uint32, free int) {
+		size := int(math.Pow10(free))
+		job := hybridJob{k.prefix, free}
+		c.jobs[job] = append(c.jobs[job], k.word(lo/uint32(size), k.digits-free))
+		c.covered += int64(size)
+	}, func(v uint32) {
+		rest(k.word(v, k.digits))
+	})
+}
+
+// flushAll flushes the runs still held, ordered by base
+func (c *runCollapser) flushAll(rest func(string)) {
+	keys := make([]digitRun, 0, len(c.runs))
+	for k := range c.runs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.prefix != b.prefix {
+			return !a.prefix
+		}
+		if a.base != b.base {
+			return a.base < b.base
+		}
+		return a.digits < b.digits
+	})
+	for _, k := range keys {
+		c.flush(k, rest)
+	}
+	c.order = nil
+}
+
+// split walks the block of 10^free values starting at lo, calling block for
+// every complete sub-block of at least c.min values and single for the
+// values outside them. vals holds the block's values in order.
+func (c *runCollapser) split(k digitRun, vals []uint32, lo uint32, free int, block func(uint32, int), single func(uint32)) {
+	if len(vals) < c.min || free == 0 {
+		for _, v := range vals {
+			single(v)
+		}
+		return
+	}
+	size := int(math.Pow10(free))
+	if len(vals) == size {
+		block(lo, free)
+		return
+	}
+	step := uint32(size / 10)
+	for d := uint32(0); d < 10 && len(vals) > 0; d++ {
+		end := lo + (d+1)*step
+		n := sort.Search(len(vals), func(i int) bool { return vals[i] >= end })
+		c.split(k, vals[:n], lo+d*step, free-1, block, single)
+		vals = vals[n:]
+	}
+}
+
+// word rebuilds a candidate, or the fixed part of a hybrid job, from the
+// first n of the run's digits with value v
+func (k digitRun) word(v uint32, n int) string {
+	digits := ""
+	if n > 0 {
+		digits = fmt.Sprintf("%0*d", n, v)
+	}
+	if k.prefix {
+		return reverseString(digits) + k.base
+	}
+	return k.base + digits
+}
+
+// write emits the leftover candidates and writes each hybrid job as
+// <output>.a6-dN.words and .hcmask (a7 for prefix runs), printing the
+// hashcat commands
+func (c *runCollapser) write(m *Mangler) error {
+	c.flushAll(func(w string) { m.emitRecord(w, "", nil, noOrigin) })
+	jobs, covered := c.jobs, c.covered
+	if len(jobs) == 0 {
+		fmt.Fprintf(os.Stderr, "--collapse-runs: no complete run of %d or more candidates\n", c.min)
+		return nil
+	}
+	keys := make([]hybridJob, 0, len(jobs))
+	words := 0
+	for j, w := range jobs {
+		keys = append(keys, j)
+		words += len(w)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].prefix != keys[j].prefix {
+			return !keys[i].prefix
+		}
+		return keys[i].digits < keys[j].digits
+	})
+	stem := strings.TrimSuffix(m.config.outputFile, filepath.Ext(m.config.outputFile))
+	fmt.Fprintf(os.Stderr, "Collapsed %d candidates into %d hybrid words:\n", covered, words)
+	for _, j := range keys {
+		mode := 6
+		if j.prefix {
+			mode = 7
+		}
+		name := fmt.Sprintf("%s.a%d-d%d", stem, mode, j.digits)
+		if err := os.WriteFile(name+".words", []byte(strings.Join(jobs[j], "\n")+"\n"), 0644); err != nil {
+			return err
+		}
+		if err := os.WriteFile(name+".hcmask", []byte(strings.Repeat("?d", j.digits)+"\n"), 0644); err != nil {
+			return err
+		}
+		if j.prefix {
+			fmt.Fprintf(os.Stderr, "\thashcat -a 7 <hashes> %s.hcmask %s.words\n", name, name)
+		} else {
+			fmt.Fprintf(os.Stderr, "\thashcat -a 6 <hashes> %s.words %s.hcmask\n", name, name)
+		}
+	}
+	return nil
+}
+
+func loadBlacklist(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	bl := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, defaultMaxLineLen)
+	for scanner.Scan() {
+		w := strings.TrimSpace(scanner.Text())
+		if w != "" {
+			bl[w] = struct{}{}
+		}
+	}
+	return bl, scanner.Err()
+}
+
+// defaultMaxLineLen bounds input lines; anything longer is almost certainly
+// a binary blob or a concatenated dump rather than a candidate
+const defaultMaxLineLen = 1 << 20
+
+// wordLoader turns wordlist lines into seed words and counts the lines it
+// had to drop along the way
+type wordLoader struct {
+	maxLineLen    int                 // Lines longer than this many bytes are skipped (0 = no limit)
+	commentPrefix string              // Lines starting with this are skipped ("" = none)
+	format        string              // "plain", "csv", "tsv", "userpass" or "jsonl"
+	column        int                 // 1-based column to extract for delimited formats
+	field         string              // Dotted field path to extract for jsonl
+	lineMode      string              // "keep", "split" or "both" for multi-word lines
+	seedMin       int                 // Words shorter than this are dropped (0 = off)
+	seedMax       int                 // Words longer than this are dropped (0 = off)
+	byteLen       bool                // Measure seedMin/seedMax in bytes rather than runes
+	stopwords     map[string]struct{} // Lowercase words dropped from the input
+	sampleRate    float64             // Keep each word with this probability (0 = keep all)
+	rng           *rand.Rand          // Source for sampleRate
+	longLines     int                 // Lines skipped for exceeding maxLineLen
+	shortLines    int                 // Lines skipped for lacking the requested column
+	sampled       int                 // Words considered for sampling
+	seedDropped   int                 // Words dropped by seedMin/seedMax or stopwords
+}
+
+func newWordLoader(cfg *Config) *wordLoader {
+	l := &wordLoader{
+		maxLineLen:    cfg.maxLineLen,
+		commentPrefix: cfg.commentPrefix,
+		format:        cfg.inputFormat,
+		column:        cfg.column,
+		field:         cfg.field,
+		lineMode:      cfg.lineMode,
+		seedMin:       cfg.seedMin,
+		seedMax:       cfg.seedMax,
+		byteLen:       cfg.lengthMode == "bytes",
+		sampleRate:    cfg.sampleRate,
+	}
+	if l.sampleRate > 0 {
+		l.rng = newRand(cfg)
+	}
+	if l.column == 0 {
+		// user:pass dumps are almost always mined for the password
+		l.column = 1
+		if l.format == "userpass" {
+			l.column = 2
+		}
+	}
+	return l
+}
+
+// tooLong reports whether a line of n bytes exceeds the configured limit
+func (l *wordLoader) tooLong(n int) bool {
+	return l.maxLineLen > 0 && n > l.maxLineLen
+}
+
+// appendLine appends the words of a raw line to words, if it has any
+func (l *wordLoader) appendLine(words []string, line string) []string {
+	if w, ok := l.word(line); ok {
+		l.split(w, func(s string) { words = append(words, s) })
+	}
+	return words
+}
+
+// split hands a line's word to fn according to the line mode: as a whole
+// phrase ("keep"), as its whitespace-separated parts ("split"), or both.
+// Single-word lines are passed through once in every mode.
+func (l *wordLoader) split(w string, fn func(string)) {
+	if l.lineMode == "" || l.lineMode == "keep" || !strings.ContainsAny(w, " \t") {
+		l.emit(w, fn)
+		return
+	}
+	if l.lineMode == "both" {
+		l.emit(w, fn)
+	}
+	for _, f := range strings.Fields(w) {
+		l.emit(f, fn)
+	}
+}
+
+// emit passes w to fn unless it falls outside the seed length bounds or is
+// a stop word, which keeps junk tokens out of the mutation stages altogether
+func (l *wordLoader) emit(w string, fn func(string)) {
+	if l.seedMin > 0 || l.seedMax > 0 {
+		n := len(w)
+		if !l.byteLen {
+			n = utf8.RuneCountInString(w)
+		}
+		if n < l.seedMin || (l.seedMax > 0 && n > l.seedMax) {
+			l.seedDropped++
+			return
+		}
+	}
+	if l.stopwords != nil {
+		if _, ok := l.stopwords[strings.ToLower(w)]; ok {
+			l.seedDropped++
+			return
+		}
+	}
+	fn(w)
+}
+
+// englishStopwords is the built-in --stopwords en list: function words that
+// dominate text scraped from pages and documents but make poor seeds
+const englishStopwords = `a about above after again against all am an and any are as at be because
+been before being below between both but by can could did do does doing down during each few for
+from further had has have having he her here hers herself him himself his how i if in into is it
+its itself just me more most my myself no nor not now of off on once only or other our ours
+ourselves out over own same she should so some such than that the their theirs them themselves
+then there these they this those through to too under until up very was we were what when where
+which while who whom why will with would you your yours yourself yourselves`
+
+// loadStopwords returns the lowercase stop word set for a --stopwords spec:
+// "en" for the built-in English list, otherwise a file with one word per line
+func loadStopwords(spec string) (map[string]struct{}, error) {
+	var words []string
+	if spec == "en" {
+		words = strings.Fields(englishStopwords)
+	} else {
+		f, err := openInput(spec)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		l := &wordLoader{maxLineLen: defaultMaxLineLen, commentPrefix: "#"}
+		if words, err = l.load(f); err != nil {
+			return nil, fmt.Errorf("%s: %w", spec, err)
+		}
+	}
+	set := make(map[string]struct{}, len(words))
+	for _, w := range words {
+		set[strings.ToLower(w)] = struct{}{}
+	}
+	return set, nil
+}
+
+// word trims a raw line and returns its word unless it is blank, a comment,
+// lacks the requested field or is dropped by sampling. A UTF-8 byte order
+// mark is dropped wherever it appears, since concatenated files carry one at
+// the start of each part.
+func (l *wordLoader) word(line string) (string, bool) {
+	w := strings.TrimSpace(strings.TrimPrefix(line, "\uFEFF"))
+	if w == "" || (l.commentPrefix != "" && strings.HasPrefix(w, l.commentPrefix)) {
+		return "", false
+	}
+	if l.format != "" && l.format != "plain" {
+		var field string
+		var ok bool
+		if l.format == "jsonl" {
+			field, ok = jsonField(w, l.field)
+		} else {
+			field, ok = extractField(w, l.format, l.column)
+		}
+		if !ok {
+			l.shortLines++
+			return "", false
+		}
+		if w = strings.TrimSpace(field); w == "" {
+			return "", false
+		}
+	}
+	if l.sampleRate > 0 {
+		l.sampled++
+		if l.rng.Float64() >= l.sampleRate {
+			return "", false
+		}
+	}
+	return w, true
+}
+
+// extractField returns the 1-based column col of a delimited line; ok is
+// false when the line has fewer columns. userpass splits on the first ':'
+// only, since passwords may contain colons themselves.
+func extractField(line, format string, col int) (string, bool) {
+	switch format {
+	case "userpass":
+		user, pass, found := strings.Cut(line, ":")
+		if !found || col > 2 {
+			return "", false
+		}
+		if col == 1 {
+			return user, true
+		}
+		return pass, true
+	case "tsv":
+		for i := 1; i < col; i++ {
+			var found bool
+			if _, line, found = strings.Cut(line, "\t"); !found {
+				return "", false
+			}
+		}
+		field, _, _ := strings.Cut(line, "\t")
+		return field, true
+	case "csv":
+		return csvField(line, col)
+	}
+	return line, true
+}
+
+// jsonField extracts a value from one JSON object by dotted path, e.g.
+// "creds.password" or "hashes.0". Numbers and booleans are returned in their
+// JSON spelling so numeric passwords survive; objects, arrays and null do not
+// count as a value.
+func jsonField(line, path string) (string, bool) {
+	dec := json.NewDecoder(strings.NewReader(line))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return "", false
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]any:
+			var found bool
+			if v, found = node[key]; !found {
+				return "", false
+			}
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", false
+			}
+			v = node[i]
+		default:
+			return "", false
+		}
+	}
+	switch val := v.(type) {
+	case string:
+		return val, true
+	case json.Number:
+		return val.String(), true
+	case bool:
+		return strconv.FormatBool(val), true
+	}
+	return "", false
+}
+
+// csvField extracts one field from a single CSV line, honouring RFC 4180
+// quoting ("" inside a quoted field is a literal quote)
+func csvField(line string, col int) (string, bool) {
+	for i := 1; ; i++ {
+		var field string
+		var found bool
+		if strings.HasPrefix(line, "\"") {
+			var sb strings.Builder
+			j := 1
+			for j < len(line) {
+				if line[j] == '"' {
+					if j+1 < len(line) && line[j+1] == '"' {
+						sb.WriteByte('"')
+						j += 2
+						continue
+					}
+					j++
+					break
+				}
+				sb.WriteByte(line[j])
+				j++
+			}
+			field = sb.String()
+			_, line, found = strings.Cut(line[j:], ",")
+		} else {
+			field, line, found = strings.Cut(line, ",")
+		}
+		if i == col {
+			return field, true
+		}
+		if !found {
+			return "", false
+		}
+	}
+}
+
+// load reads a wordlist line by line. Unlike bufio.Scanner it never gives up
+// on an oversized line: the line is skipped and counted, and reading carries
+// on with the next one.
+func (l *wordLoader) load(r io.Reader) ([]string, error) {
+	var words []string
+	err := l.each(r, func(w string) {
+		words = append(words, w)
+	})
+	return words, err
+}
+
+// each streams the words of a wordlist to fn without holding them in memory
+func (l *wordLoader) each(r io.Reader, fn func(string)) error {
+	var line []byte
+	skip := false
+	br := bufio.NewReaderSize(r, 64*1024)
+	for {
+		chunk, isPrefix, err := br.ReadLine()
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return err
+		}
+		if !skip {
+			line = append(line, chunk...)
+			// A CR ending the line does not count, as in loadMmap
+			skip = l.tooLong(len(bytes.TrimSuffix(line, []byte{'\r'})))
+		}
+		if isPrefix {
+			continue
+		}
+		if skip {
+			l.longLines++
+		} else if w, ok := l.word(string(line)); ok {
+			l.split(w, fn)
+		}
+		line, skip = line[:0], false
+	}
+}
+
+// loadMmap loads a wordlist through a read-only memory mapping. Lines are
+// split in place and returned as strings pointing into the mapping, so no
+// per-line copies are made; release must only be called once the words are
+// no longer in use. The file must not be truncated while it is mapped.
+func (l *wordLoader) loadMmap(path string) ([]string, func() error, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The mapping stays valid after the file is closed
+	defer f.Close()
+
+	data, release, err := mmapFile(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	words := make([]string, 0, bytes.Count(data, []byte{'\n'})+1)
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			data = nil
+		}
+		if len(line) == 0 {
+			continue
+		}
+		if l.tooLong(len(bytes.TrimSuffix(line, []byte{'\r'}))) {
+			l.longLines++
+			continue
+		}
+		words = l.appendLine(words, unsafe.String(&line[0], len(line)))
+	}
+	return words, release, nil
+}
+
+// rawLines splits candidates written one per line on '\n' only, keeping
+// every other byte of each
+func rawLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// loadWords reads a wordlist with the default line limit
+func loadWords(r io.Reader) ([]string, error) {
+	l := &wordLoader{maxLineLen: defaultMaxLineLen}
+	return l.load(r)
+}
+
+// openInput opens a wordlist for reading; "-" is stdin, builtin:<name> an
+// embedded list and ".gz" files are transparently decompressed
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	if strings.HasPrefix(path, builtinPrefix) {
+		r, err := openBuiltinList(strings.TrimPrefix(path, builtinPrefix))
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(r), nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(strings.ToLower(path), ".gz") {
+		return f, nil
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, f}, nil
+}
+
+// expandInputs expands shell globs in a list of input paths. A glob that
+// matches nothing is reported and dropped.
+func expandInputs(paths []string) []string {
+	var inputs []string
+	for _, p := range paths {
+		if strings.ContainsAny(p, "*?[]") {
+			matches, err := filepath.Glob(p)
+			switch {
+			case err != nil:
+				fmt.Fprintf(os.Stderr, "Warning: skipping input %q: %v\n", p, err)
+			case len(matches) == 0:
+				fmt.Fprintf(os.Stderr, "Warning: no files match %q\n", p)
+			}
+			inputs = append(inputs, matches...)
+		} else {
+			inputs = append(inputs, p)
+		}
+	}
+	return inputs
+}
+
+// parseInterspersed parses flags that may appear before, between or after
+// positional arguments and returns the positional arguments
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// createOutput returns a writer for path ("-" or "" is stdout)
+func createOutput(path string) (io.WriteCloser, error) {
+	if path == "" || path == "-" {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	return os.Create(path)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// efficacyLess orders words by descending efficacy, then alphabetically
+func efficacyLess(a, b string) bool {
+	ea, eb := getWordEfficacy(a), getWordEfficacy(b)
+	if ea == eb {
+		return a < b
+	}
+	return ea > eb
+}
+
+// extSorter sorts an unbounded stream of lines with bounded memory by
+// spilling sorted runs to temporary files and k-way merging them
+type extSorter struct {
+	less    func(a, b string) bool
+	limit   int
+	dedup   bool // Drop lines already present in the in-memory chunk
+	buf     []string
+	inBuf   map[string]struct{}
+	runs    []string
+	tempDir string
+}
+
+func newExtSorter(limit int, less func(a, b string) bool, dedup bool) *extSorter {
+	if limit < 1 {
+		limit = 1
+	}
+	e := &extSorter{less: less, limit: limit, dedup: dedup}
+	if dedup {
+		e.inBuf = make(map[string]struct{})
+	}
+	return e
+}
+
+func (e *extSorter) add(line string) error {
+	if e.dedup {
+		if _, exists := e.inBuf[line]; exists {
+			return nil
+		}
+		e.inBuf[line] = struct{}{}
+	}
+	e.buf = append(e.buf, line)
+	if len(e.buf) >= e.limit {
+		return e.spill()
+	}
+	return nil
+}
+
+func (e *extSorter) sortBuf() {
+	sort.Slice(e.buf, func(i, j int) bool { return e.less(e.buf[i], e.buf[j]) })
+}
+
+func (e *extSorter) spill() error {
+	if len(e.buf) == 0 {
+		return nil
+	}
+	e.sortBuf()
+	f, err := os.CreateTemp(e.tempDir, "passmut-run-*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriterSize(f, 256*1024)
+	for _, l := range e.buf {
+		w.WriteString(l)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	f.Close()
+	e.runs = append(e.runs, f.Name())
+	e.buf = e.buf[:0]
+	if e.dedup {
+		e.inBuf = make(map[string]struct{})
+	}
+	return nil
+}
+
+// each calls fn for every line in sorted order. Equal lines from different
+// runs are adjacent, so callers can dedup or aggregate them.
+func (e *extSorter) each(fn func(line string) error) error {
+	if len(e.runs) == 0 {
+		e.sortBuf()
+		for _, l := range e.buf {
+			if err := fn(l); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := e.spill(); err != nil {
+		return err
+	}
+
+	h := &runHeap{less: e.less}
+	for _, path := range e.runs {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r := bufio.NewReaderSize(f, 256*1024)
+		if line, ok := readRunLine(r); ok {
+			h.items = append(h.items, runItem{line, r})
+		}
+	}
+	heap.Init(h)
+	for h.Len() > 0 {
+		top := h.items[0]
+		if err := fn(top.line); err != nil {
+			return err
+		}
+		if line, ok := readRunLine(top.r); ok {
+			h.items[0].line = line
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	return nil
+}
+
+// cleanup removes the temporary run files
+func (e *extSorter) cleanup() {
+	for _, path := range e.runs {
+		os.Remove(path)
+	}
+	e.runs = nil
+}
+
+func readRunLine(r *bufio.Reader) (string, bool) {
+	line, err := r.ReadString('\n')
+	if err != nil && line == "" {
+		return "", false
+	}
+	return strings.TrimSuffix(line, "\n"), true
+}
+
+type runItem struct {
+	line string
+	r    *bufio.Reader
+}
+
+type runHeap struct {
+	items []runItem
+	less  func(a, b string) bool
+}
+
+func (h *runHeap) Len() int           { return len(h.items) }
+func (h *runHeap) Less(i, j int) bool { return h.less(h.items[i].line, h.items[j].line) }
+func (h *runHeap) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *runHeap) Push(x interface{}) { h.items = append(h.items, x.(runItem)) }
+func (h *runHeap) Pop() interface{} {
+	old := h.items
+	it := old[len(old)-1]
+	h.items = old[:len(old)-1]
+	return it
+}
+
+// runMerge implements "passmut merge": stream several wordlists, dedup them
+// with bounded memory and write a single sorted list
+func runMerge(args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	var outputFile, sortMode string
+	var chunk int
+	fs.StringVar(&outputFile, "output", "-", "output file")
+	fs.StringVar(&outputFile, "o", "-", "output file (shorthand)")
+	fs.StringVar(&sortMode, "sort", "a", "sort mode")
+	fs.StringVar(&sortMode, "S", "a", "sort mode (shorthand)")
+	fs.IntVar(&chunk, "chunk", 5000000, "max words held in memory before spilling to disk")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: passmut merge [OPTION] <file> [file...]\n")
+		fmt.Fprintf(os.Stderr, "\tMerge and deduplicate wordlists (.gz supported, - for stdin).\n")
+		fmt.Fprintf(os.Stderr, "\t-o, --output <file>: output file, use - for STDOUT\n")
+		fmt.Fprintf(os.Stderr, "\t-S, --sort <M>: 'a' for alpha (default), 'e' for efficacy\n")
+		fmt.Fprintf(os.Stderr, "\t--chunk <N>: words held in memory before spilling to disk (default 5000000)\n")
+	}
+	files, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	files = expandInputs(files)
+	if len(files) == 0 {
+		fs.Usage()
+		return fmt.Errorf("no input files given")
+	}
+
+	less := func(a, b string) bool { return a < b }
+	switch sortMode {
+	case "a":
+	case "e":
+		less = efficacyLess
+	default:
+		return fmt.Errorf("unknown sort mode %q", sortMode)
+	}
+
+	sorter := newExtSorter(chunk, less, true)
+	defer sorter.cleanup()
+	for _, p := range files {
+		in, err := openInput(p)
+		if err != nil {
+			// A list left out would make the merge silently incomplete
+			return fmt.Errorf("failed to open %s: %w", p, err)
+		}
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(nil, defaultMaxLineLen)
+		for scanner.Scan() {
+			w := strings.TrimSpace(scanner.Text())
+			if w == "" {
+				continue
+			}
+			if err := sorter.add(w); err != nil {
+				in.Close()
+				return err
+			}
+		}
+		in.Close()
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("error reading %s: %w", p, err)
+		}
+	}
+
+	out, err := createOutput(outputFile)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriterSize(out, 64*1024)
+
+	var prev string
+	first := true
+	err = sorter.each(func(line string) error {
+		if !first && line == prev {
+			return nil
+		}
+		first = false
+		prev = line
+		_, err := bw.WriteString(line + "\n")
+		return err
+	})
+	if ferr := bw.Flush(); err == nil {
+		err = ferr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// splitCountLine splits a "word<TAB>count" spill line at its last tab
+func splitCountLine(line string) (string, int) {
+	idx := strings.LastIndex(line, "\t")
+	if idx < 0 {
+		return line, 0
+	}
+	// Only passmut writes these lines, so the count always parses
+	n, _ := strconv.Atoi(line[idx+1:])
+	return line[:idx], n
+}
+
+// runFreq implements "passmut freq": count occurrences of every word with
+// bounded memory and print "count<TAB>word" sorted by descending count
+func runFreq(args []string) error {
+	fs := flag.NewFlagSet("freq", flag.ExitOnError)
+	var outputFile string
+	var chunk, top, minCount int
+	fs.StringVar(&outputFile, "output", "-", "output file")
+	fs.StringVar(&outputFile, "o", "-", "output file (shorthand)")
+	fs.IntVar(&top, "top", 0, "only print the N most frequent words")
+	fs.IntVar(&minCount, "min-count", 1, "only print words seen at least N times")
+	fs.IntVar(&chunk, "chunk", 5000000, "max distinct words held in memory before spilling to disk")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: passmut freq [OPTION] <file> [file...]\n")
+		fmt.Fprintf(os.Stderr, "\tCount word occurrences and print count<TAB>word, most frequent first.\n")
+		fmt.Fprintf(os.Stderr, "\t-o, --output <file>: output file, use - for STDOUT\n")
+		fmt.Fprintf(os.Stderr, "\t--top <N>: only print the N most frequent words\n")
+		fmt.Fprintf(os.Stderr, "\t--min-count <N>: only print words seen at least N times\n")
+		fmt.Fprintf(os.Stderr, "\t--chunk <N>: distinct words held in memory before spilling to disk (default 5000000)\n")
+	}
+	files, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	files = expandInputs(files)
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	// Pass 1: partial counts per chunk, spilled and merged by word
+	byWord := newExtSorter(chunk, func(a, b string) bool {
+		wa, _ := splitCountLine(a)
+		wb, _ := splitCountLine(b)
+		return wa < wb
+	}, false)
+	defer byWord.cleanup()
+
+	counts := make(map[string]int)
+	flushCounts := func() error {
+		for w, c := range counts {
+			if err := byWord.add(fmt.Sprintf("%s\t%d", w, c)); err != nil {
+				return err
+			}
+		}
+		counts = make(map[string]int)
+		return nil
+	}
+	for _, p := range files {
+		in, err := openInput(p)
+		if err != nil {
+			// Counts missing a list would be silently wrong
+			return fmt.Errorf("failed to open %s: %w", p, err)
+		}
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(nil, defaultMaxLineLen)
+		for scanner.Scan() {
+			w := strings.TrimSpace(scanner.Text())
+			if w == "" {
+				continue
+			}
+			counts[w]++
+			if len(counts) >= chunk {
+				if err := flushCounts(); err != nil {
+					in.Close()
+					return err
+				}
+			}
+		}
+		in.Close()
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("error reading %s: %w", p, err)
+		}
+	}
+	if err := flushCounts(); err != nil {
+		return err
+	}
+
+	// Pass 2: order the aggregated counts descending
+	byCount := newExtSorter(chunk, func(a, b string) bool {
+		wa, ca := splitCountLine(a)
+		wb, cb := splitCountLine(b)
+		if ca == cb {
+			return wa < wb
+		}
+		return ca > cb
+	}, false)
+	defer byCount.cleanup()
+
+	var cur string
+	var curCount int
+	have := false
+	emit := func() error {
+		if have && curCount >= minCount {
+			return byCount.add(fmt.Sprintf("%s\t%d", cur, curCount))
+		}
+		return nil
+	}
+	err = byWord.each(func(line string) error {
+		w, c := splitCountLine(line)
+		if have && w == cur {
+			curCount += c
+			return nil
+		}
+		if err := emit(); err != nil {
+			return err
+		}
+		cur, curCount, have = w, c, true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := emit(); err != nil {
+		return err
+	}
+	byWord.cleanup()
+
+	out, err := createOutput(outputFile)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriterSize(out, 64*1024)
+
+	written := 0
+	errStop := fmt.Errorf("top reached")
+	err = byCount.each(func(line string) error {
+		if top > 0 && written >= top {
+			return errStop
+		}
+		w, c := splitCountLine(line)
+		written++
+		_, err := fmt.Fprintf(bw, "%d\t%s\n", c, w)
+		return err
+	})
+	if err == errStop {
+		err = nil
+	}
+	if ferr := bw.Flush(); err == nil {
+		err = ferr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// jobFile is a "passmut run" pipeline definition. Options, stages and
+// filters use the long flag names, so anything the command line can do a job
+// can declare.
+type jobFile struct {
+	Inputs  []jobInput     `yaml:"inputs"`
+	Seeds   []string       `yaml:"seeds"`
+	Options map[string]any `yaml:"options"`
+	Stages  []string       `yaml:"stages"`
+	Filters map[string]any `yaml:"filters"`
+	Outputs []jobOutput    `yaml:"outputs"`
+}
+
+// jobInput is an input file or glob, written either as a plain string or as
+// a mapping with per-file option overrides
+type jobInput struct {
+	Path    string         `yaml:"path"`
+	Options map[string]any `yaml:"options"`
+	Weight  float64        `yaml:"weight"`
+}
+
+func (in *jobInput) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		in.Path = node.Value
+		return nil
+	}
+	type plain jobInput
+	return node.Decode((*plain)(in))
+}
+
+// jobOutput is one destination; its filters are applied on top of the
+// job-wide filters
+type jobOutput struct {
+	Path    string         `yaml:"path"`
+	Filters map[string]any `yaml:"filters"`
+}
+
+// filterFlags are the options allowed under "filters"
+var filterFlags = map[string]bool{
+	"min": true, "max": true, "ms": true, "length-mode": true, "crunch": true,
+	"no-numbers": true, "no-symbols": true, "no-capitals": true, "exclude-common": true,
+	"min-digits": true, "max-digits": true, "min-upper": true, "max-upper": true,
+	"min-lower": true, "max-lower": true, "min-symbols": true, "max-symbols": true,
+	"min-classes": true, "max-repeat": true,
+}
+
+// loadJob reads and validates a job file
+func loadJob(path string) (*jobFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	job := &jobFile{}
+	if err := dec.Decode(job); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(job.Inputs) == 0 && len(job.Seeds) == 0 {
+		return nil, fmt.Errorf("%s: no inputs or seeds", path)
+	}
+	if err := checkFilterKeys(job.Filters); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, out := range job.Outputs {
+		if out.Path == "" {
+			return nil, fmt.Errorf("%s: output without a path", path)
+		}
+		if err := checkFilterKeys(out.Filters); err != nil {
+			return nil, fmt.Errorf("%s: output %s: %w", path, out.Path, err)
+		}
+	}
+	return job, nil
+}
+
+func checkFilterKeys(filters map[string]any) error {
+	for k := range filters {
+		if !filterFlags[k] {
+			return fmt.Errorf("%q is not a filter option", k)
+		}
+	}
+	return nil
+}
+
+// jobValue formats a YAML value the way it would be written on the command
+// line; lists become comma separated
+func jobValue(v any) string {
+	if list, ok := v.([]any); ok {
+		parts := make([]string, len(list))
+		for i, e := range list {
+			parts[i] = fmt.Sprint(e)
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprint(v)
+}
+
+// applyJobOptions sets options by flag name in sorted key order
+func applyJobOptions(fs *flag.FlagSet, opts map[string]any) error {
+	keys := make([]string, 0, len(opts))
+	for k := range opts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if fs.Lookup(k) == nil {
+			return fmt.Errorf("unknown option %q", k)
+		}
+		if err := fs.Set(k, jobValue(opts[k])); err != nil {
+			return fmt.Errorf("option %s: %w", k, err)
+		}
+	}
+	return nil
+}
+
+// config builds the run configuration and input list of a job. Relative
+// paths are resolved against dir, the directory holding the job file.
+func (j *jobFile) config(dir string) (*Config, []inputSpec, error) {
+	config := &Config{}
+	fs := newFlagSet(config, flag.ContinueOnError)
+	if err := applyJobOptions(fs, j.Options); err != nil {
+		return nil, nil, err
+	}
+	if err := applyJobOptions(fs, j.Filters); err != nil {
+		return nil, nil, err
+	}
+	if len(j.Stages) > 0 {
+		config.rulesList = strings.Join(j.Stages, ",")
+	}
+	if len(j.Seeds) > 0 {
+		config.seedWords = strings.Join(j.Seeds, ",")
+	}
+	config.applyImplied(fs)
+
+	var inputs []inputSpec
+	for _, in := range j.Inputs {
+		p := in.Path
+		if p != "-" && !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		for _, m := range expandInputs([]string{p}) {
+			spec := inputSpec{path: m, overrides: overrideSpec(in.Options)}
+			if in.Weight != 0 {
+				spec.weight = strconv.FormatFloat(in.Weight, 'g', -1, 64)
+			}
+			inputs = append(inputs, spec)
+		}
+	}
+	if len(j.Inputs) > 0 && len(inputs) == 0 {
+		return nil, nil, fmt.Errorf("no input files matched")
+	}
+	return config, inputs, nil
+}
+
+// runJob implements "passmut run": execute a YAML job file. With several
+// outputs the candidates are generated once to a temporary file and each
+// output is then produced from it with --filter-only and its own filters.
+func runJob(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: passmut run <job.yaml>\n")
+		fmt.Fprintf(os.Stderr, "\tRun a generation pipeline declared in a YAML job file.\n")
+	}
+	files, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected exactly one job file")
+	}
+	job, err := loadJob(files[0])
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(files[0])
+	config, inputs, err := job.config(dir)
+	if err != nil {
+		return fmt.Errorf("%s: %w", files[0], err)
+	}
+	resolve := func(p string) string {
+		if p == "-" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(dir, p)
+	}
+
+	if len(job.Outputs) <= 1 {
+		config.outputFile = "-"
+		if len(job.Outputs) == 1 {
+			out := job.Outputs[0]
+			if len(out.Filters) > 0 {
+				if config, err = config.withOverrides(overrideSpec(out.Filters)); err != nil {
+					return fmt.Errorf("output %s: %w", out.Path, err)
+				}
+			}
+			config.outputFile = resolve(out.Path)
+		}
+		return run(config, inputs)
+	}
+
+	tmp, err := os.CreateTemp("", "passmut-job-*")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	config.outputFile = tmp.Name()
+	if err := run(config, inputs); err != nil {
+		return err
+	}
+
+	for _, out := range job.Outputs {
+		oc := &Config{}
+		ofs := newFlagSet(oc, flag.ContinueOnError)
+		if err := applyJobOptions(ofs, job.Filters); err != nil {
+			return err
+		}
+		if err := applyJobOptions(ofs, out.Filters); err != nil {
+			return fmt.Errorf("output %s: %w", out.Path, err)
+		}
+		oc.filterOnly = true
+		oc.outputFile = resolve(out.Path)
+		if err := runFiltered(oc, tmp.Name()); err != nil {
+			return fmt.Errorf("output %s: %w", out.Path, err)
+		}
+	}
+	return nil
+}
+
+// overrideSpec renders job options in withOverrides syntax
+func overrideSpec(opts map[string]any) string {
+	keys := make([]string, 0, len(opts))
+	for k := range opts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + jobValue(opts[k])
+	}
+	return strings.Join(parts, ",")
+}
+
+// runFiltered writes the candidates in path that pass config's filters. The
+// candidates are read back exactly as written: no trimming, BOM or comment
+// handling. An empty candidate file yields an empty output rather than an
+// error.
+func runFiltered(config *Config, path string) error {
+	config.rawInput = true
+	if st, err := os.Stat(path); err == nil && st.Size() == 0 {
+		f, err := createOutput(config.outputFile)
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	}
+	return run(config, []inputSpec{{path: path}})
+}
+
+// recipeFormat is the .pmrecipe format version this build reads and writes
+const recipeFormat = 1
+
+// recipeFile is a portable .pmrecipe: a whole generation configuration that
+// teams can exchange and pin. Options use the long flag names, as in job
+// files; the lists they read are pinned by SHA-256.
+type recipeFile struct {
+	Format      int              `yaml:"pmrecipe"`
+	Passmut     string           `yaml:"passmut,omitempty"` // Version constraint, e.g. ">=0.0.2,<0.1"
+	Description string           `yaml:"description,omitempty"`
+	Rules       map[string]any   `yaml:"rules,omitempty"`
+	Affixes     map[string]any   `yaml:"affixes,omitempty"`
+	Filters     map[string]any   `yaml:"filters,omitempty"`
+	Locales     []string         `yaml:"locales,omitempty"` // Locale packs --detect-lang applies
+	Wordpacks   []recipeWordpack `yaml:"wordpacks,omitempty"`
+}
+
+// recipeWordpack is a list an option reads. Built-in sets that are not
+// lists (--stopwords en, --common categories) carry no checksum.
+type recipeWordpack struct {
+	Option string `yaml:"option"`
+	Path   string `yaml:"path"`
+	SHA256 string `yaml:"sha256,omitempty"`
+}
+
+// affixFlags are the options exported under "affixes"
+var affixFlags = map[string]bool{
+	"prefix-strings": true, "suffix-strings": true, "interleave": true, "interleave-words": true,
+	"punctuation": true, "punct-set": true, "punct-max": true, "punct-prefix": true,
+	"currency": true, "emoji": true, "years": true, "ordinals": true, "roman": true,
+	"prefix-range": true, "suffix-range": true, "smart-affix": true,
+}
+
+// wordpackFlags are the options whose lists a recipe pins
+var wordpackFlags = map[string]bool{
+	"common": true, "stopwords": true, "freq-list": true, "rules-file": true,
+	"substitute-file": true, "dict": true, "wasm": true, "zip-pack": true,
+}
+
+// recipeSkipOptions are left out of a recipe: the inputs (files and --seed
+// words) and output belong to the run, the rest does not change which
+// candidates are produced
+var recipeSkipOptions = map[string]bool{
+	"file": true, "seed": true, "output": true, "threads": true, "lang": true, "no-color": true,
+	"session": true, "checkpoint": true, "resume": true, "control": true, "assume-yes": true,
+	"check-updates": true, "upgrade": true, "long-help": true,
+}
+
+// exportRecipe captures config as a recipe. Wordpack paths are rewritten
+// relative to dir, the directory the recipe is written to, so the recipe
+// and its lists can be shared as one directory.
+func exportRecipe(config *Config, dir string) (*recipeFile, error) {
+	rec := &recipeFile{Format: recipeFormat, Passmut: ">=" + version}
+	fs := newFlagSet(&Config{}, flag.ContinueOnError)
+	set := func(section *map[string]any, name, value string) {
+		if *section == nil {
+			*section = make(map[string]any)
+		}
+		(*section)[name] = recipeValue(fs.Lookup(name), value)
+	}
+	for _, opt := range configOptions(config) {
+		name, value, _ := strings.Cut(opt, "=")
+		switch {
+		case recipeSkipOptions[name]:
+		case name == "random-seed" && !config.draws():
+		case wordpackFlags[name]:
+			packs, err := exportWordpacks(name, value, dir)
+			if err != nil {
+				return nil, err
+			}
+			rec.Wordpacks = append(rec.Wordpacks, packs...)
+		case filterFlags[name]:
+			set(&rec.Filters, name, value)
+		case affixFlags[name]:
+			set(&rec.Affixes, name, value)
+		default:
+			set(&rec.Rules, name, value)
+		}
+	}
+	if config.detectLang {
+		rec.Locales = localePackNames()
+	}
+	// Pin a seed so every import samples and shuffles the same way
+	if config.draws() && config.randomSeed == 0 && !config.deterministic {
+		set(&rec.Rules, "random-seed", strconv.FormatInt(time.Now().UnixNano(), 10))
+	}
+	return rec, nil
+}
+
+// recipeValue types an option value for YAML: booleans and integers stay
+// unquoted
+func recipeValue(f *flag.Flag, value string) any {
+	if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+		if v, err := strconv.ParseBool(value); err == nil {
+			return v
+		}
+	}
+	if n, err := strconv.Atoi(value); err == nil {
+		return n
+	}
+	return value
+}
+
+// exportWordpacks pins the lists of a wordpack option, one entry per
+// comma-separated --common item
+func exportWordpacks(option, value, dir string) ([]recipeWordpack, error) {
+	items := []string{value}
+	if option == "common" {
+		if value == "BUILT_IN" {
+			value = builtinPrefix + "admin-terms"
+		}
+		items = strings.Split(value, ",")
+	}
+	named := wordpackNames(option, items)
+	var packs []recipeWordpack
+	for i, item := range items {
+		pack := recipeWordpack{Option: option, Path: item}
+		if !named[i] {
+			if strings.Contains(item, "://") {
+				return nil, fmt.Errorf("--%s %s: a URL cannot be pinned; download it and give the file", option, item)
+			}
+			sum, err := wordpackSum(item)
+			if err != nil {
+				return nil, fmt.Errorf("--%s: %w", option, err)
+			}
+			pack.SHA256 = sum
+			if !strings.HasPrefix(item, builtinPrefix) {
+				if abs, err := filepath.Abs(item); err == nil {
+					if rel, err := filepath.Rel(dir, abs); err == nil {
+						pack.Path = filepath.ToSlash(rel)
+					}
+				}
+			}
+		}
+		packs = append(packs, pack)
+	}
+	return packs, nil
+}
+
+// wordpackNames reports which items of a wordpack option name built-in sets
+// rather than lists: --stopwords en and the --common categories (bare
+// names count after a builtin: category, as in loadCommon)
+func wordpackNames(option string, items []string) []bool {
+	named := make([]bool, len(items))
+	categories := false
+	for i, item := range items {
+		switch option {
+		case "stopwords":
+			named[i] = item == "en"
+		case "common":
+			name, builtin := strings.CutPrefix(item, builtinPrefix)
+			if _, ok := commonCategory(name); item == "BUILT_IN" || ok && (builtin || categories) {
+				named[i], categories = true, true
+			}
+		}
+	}
+	return named
+}
+
+// wordpackSum is the SHA-256 of a list as stored: the file's bytes, or the
+// words of a builtin: list
+func wordpackSum(path string) (string, error) {
+	var r io.Reader
+	if name, ok := strings.CutPrefix(path, builtinPrefix); ok {
+		var err error
+		if r, err = openBuiltinList(name); err != nil {
+			return "", err
+		}
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		r = f
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// loadRecipe reads a recipe and checks what can be checked without its
+// wordpacks: format, passmut version, option sections and locale packs
+func loadRecipe(path string) (*recipeFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	rec := &recipeFile{}
+	if err := dec.Decode(rec); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if rec.Format != recipeFormat {
+		return nil, fmt.Errorf("%s: unsupported pmrecipe format %d (this build reads %d)", path, rec.Format, recipeFormat)
+	}
+	if rec.Passmut != "" {
+		ok, err := versionSatisfies(version, rec.Passmut)
+		if err != nil {
+			return nil, fmt.Errorf("%s: passmut: %w", path, err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s: needs passmut %s, this is %s", path, rec.Passmut, version)
+		}
+	}
+	if err := checkFilterKeys(rec.Filters); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for k := range rec.Affixes {
+		if !affixFlags[k] {
+			return nil, fmt.Errorf("%s: %q is not an affix option", path, k)
+		}
+	}
+	for k := range rec.Rules {
+		if recipeSkipOptions[k] || wordpackFlags[k] {
+			return nil, fmt.Errorf("%s: %q does not belong under rules", path, k)
+		}
+	}
+	for _, lang := range rec.Locales {
+		if _, ok := localePacks[lang]; !ok {
+			return nil, fmt.Errorf("%s: locale pack %q is not in this build (packs: %s)", path, lang, strings.Join(localePackNames(), ", "))
+		}
+	}
+	items := make(map[string][]string)
+	for _, p := range rec.Wordpacks {
+		if !wordpackFlags[p.Option] {
+			return nil, fmt.Errorf("%s: %q is not a wordpack option", path, p.Option)
+		}
+		if p.Path == "" {
+			return nil, fmt.Errorf("%s: %s wordpack without a path", path, p.Option)
+		}
+		items[p.Option] = append(items[p.Option], p.Path)
+	}
+	i := make(map[string]int)
+	for _, p := range rec.Wordpacks {
+		named := wordpackNames(p.Option, items[p.Option])[i[p.Option]]
+		i[p.Option]++
+		if named != (p.SHA256 == "") {
+			if named {
+				return nil, fmt.Errorf("%s: %s %s is built in and takes no sha256", path, p.Option, p.Path)
+			}
+			return nil, fmt.Errorf("%s: %s %s is not pinned (no sha256)", path, p.Option, p.Path)
+		}
+	}
+	return rec, nil
+}
+
+// apply sets the recipe's options on fs after checking each pinned
+// wordpack; relative paths are resolved against dir, the directory holding
+// the recipe
+func (rec *recipeFile) apply(fs *flag.FlagSet, dir string) error {
+	for _, section := range []map[string]any{rec.Rules, rec.Affixes, rec.Filters} {
+		if err := applyJobOptions(fs, section); err != nil {
+			return err
+		}
+	}
+	var options []string
+	values := make(map[string][]string)
+	for _, p := range rec.Wordpacks {
+		path := p.Path
+		if p.SHA256 != "" {
+			if !strings.HasPrefix(path, builtinPrefix) && !filepath.IsAbs(path) {
+				path = filepath.Join(dir, filepath.FromSlash(path))
+			}
+			sum, err := wordpackSum(path)
+			if err != nil {
+				return fmt.Errorf("wordpack %s: %w", p.Path, err)
+			}
+			if !strings.EqualFold(sum, p.SHA256) {
+				return fmt.Errorf("wordpack %s: SHA-256 is %s, the recipe pins %s", p.Path, sum, p.SHA256)
+			}
+		}
+		if _, ok := values[p.Option]; !ok {
+			options = append(options, p.Option)
+		}
+		values[p.Option] = append(values[p.Option], path)
+	}
+	for _, name := range options {
+		if err := fs.Set(name, strings.Join(values[name], ",")); err != nil {
+			return fmt.Errorf("option %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// extraLocales lists this build's locale packs that the recipe was not
+// exported with; --detect-lang would apply them too
+func (rec *recipeFile) extraLocales() []string {
+	if len(rec.Locales) == 0 {
+		return nil
+	}
+	var extra []string
+	for _, name := range localePackNames() {
+		if !slices.Contains(rec.Locales, name) {
+			extra = append(extra, name)
+		}
+	}
+	return extra
+}
+
+// versionSatisfies checks v against comma-separated constraints such as
+// ">=0.0.2,<0.1"; a bare version must match exactly
+func versionSatisfies(v, constraint string) (bool, error) {
+	for _, c := range strings.Split(constraint, ",") {
+		c = strings.TrimSpace(c)
+		op := strings.TrimRight(c[:len(c)-len(strings.TrimLeft(c, "<>=!"))], " ")
+		want := strings.TrimSpace(c[len(op):])
+		cmp, err := compareVersions(v, want)
+		if err != nil {
+			return false, err
+		}
+		var ok bool
+		switch op {
+		case ">=":
+			ok = cmp >= 0
+		case ">":
+			ok = cmp > 0
+		case "<=":
+			ok = cmp <= 0
+		case "<":
+			ok = cmp < 0
+		case "", "=", "==":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		default:
+			return false, fmt.Errorf("invalid constraint %q", c)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// compareVersions compares dotted versions numerically; missing parts
+// count as 0 and a leading "v" is ignored
+func compareVersions(a, b string) (int, error) {
+	parse := func(s string) ([]int, error) {
+		var parts []int
+		for _, p := range strings.Split(strings.TrimPrefix(s, "v"), ".") {
+			n, err := strconv.Atoi(p)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid version %q", s)
+			}
+			parts = append(parts, n)
+		}
+		return parts, nil
+	}
+	pa, err := parse(a)
+	if err != nil {
+		return 0, err
+	}
+	pb, err := parse(b)
+	if err != nil {
+		return 0, err
+	}
+	for len(pa) < len(pb) {
+		pa = append(pa, 0)
+	}
+	for len(pb) < len(pa) {
+		pb = append(pb, 0)
+	}
+	return slices.Compare(pa, pb), nil
+}
+
+// shellArg quotes s for a POSIX shell when it needs it
+func shellArg(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_./:,=@%+-") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// runRecipe implements "passmut recipe": export the options given into a
+// .pmrecipe, run one, or check recipes and their wordpacks
+func runRecipe(args []string) error {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage: passmut recipe export [OPTION] -o <file.pmrecipe>\n")
+		fmt.Fprintf(os.Stderr, "       passmut recipe import <file.pmrecipe> [--print] [OPTION]\n")
+		fmt.Fprintf(os.Stderr, "       passmut recipe validate <files...>\n")
+		fmt.Fprintf(os.Stderr, "       passmut recipe diff <a.pmrecipe> <b.pmrecipe> --sample <words.txt>\n")
+		fmt.Fprintf(os.Stderr, "\tShare a generation configuration: export writes the options given as a\n")
+		fmt.Fprintf(os.Stderr, "\trecipe with its version constraint, locale packs and the SHA-256 of every\n")
+		fmt.Fprintf(os.Stderr, "\tlist it reads; import checks all of them and generates with the recipe\n")
+		fmt.Fprintf(os.Stderr, "\t(further options such as -f and -o apply on top); validate only checks.\n")
+		fmt.Fprintf(os.Stderr, "\tdiff runs two recipes on sample words and reports the candidates unique\n")
+		fmt.Fprintf(os.Stderr, "\tto each and their estimated keyspaces.\n")
+		fmt.Fprintf(os.Stderr, "\t--print: print the equivalent passmut command instead of running it\n")
+		fmt.Fprintf(os.Stderr, "\t--sample <file>: diff: words both recipes are run on\n")
+		fmt.Fprintf(os.Stderr, "\t--words <N>: diff: input size to scale the keyspace to (default the sample;\n")
+		fmt.Fprintf(os.Stderr, "\t  not with recipes that use --perms or --interleave-words)\n")
+		fmt.Fprintf(os.Stderr, "\t--show <N>: diff: unique candidates listed per recipe (default 10)\n")
+		fmt.Fprintf(os.Stderr, "\t-o, --output <file>: export: recipe file; diff: report file\n")
+	}
+	if len(args) == 0 {
+		usage()
+		return fmt.Errorf("expected export, import, validate or diff")
+	}
+	switch args[0] {
+	case "export":
+		config := &Config{}
+		fs := newFlagSet(config, flag.ExitOnError)
+		fs.Usage = usage
+		rest := optionalValues(args[1:])
+		if err := fs.Parse(rest); err != nil {
+			return err
+		}
+		if fs.NArg() > 0 {
+			return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+		}
+		if err := checkDuplicateFlags(fs, rest); err != nil {
+			return err
+		}
+		config.applyImplied(fs)
+		if err := config.validate(); err != nil {
+			return err
+		}
+		dir := "."
+		if config.outputFile != "-" {
+			dir = filepath.Dir(config.outputFile)
+		}
+		dir, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		rec, err := exportRecipe(config, dir)
+		if err != nil {
+			return err
+		}
+		out, err := createOutput(config.outputFile)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "# passmut recipe; run with: passmut recipe import <this file> -f <words>\n")
+		enc := yaml.NewEncoder(out)
+		enc.SetIndent(2)
+		if err := enc.Encode(rec); err != nil {
+			out.Close()
+			return err
+		}
+		if err := enc.Close(); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+
+	case "import":
+		if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+			usage()
+			return fmt.Errorf("expected a recipe file")
+		}
+		rec, err := loadRecipe(args[1])
+		if err != nil {
+			return err
+		}
+		config := &Config{}
+		fs := newFlagSet(config, flag.ExitOnError)
+		fs.Usage = usage
+		printCmd := fs.Bool("print", false, "print the equivalent command")
+		if err := rec.apply(fs, filepath.Dir(args[1])); err != nil {
+			return fmt.Errorf("%s: %w", args[1], err)
+		}
+		files, err := parseInterspersed(fs, optionalValues(args[2:]))
+		if err != nil {
+			return err
+		}
+		if len(files) > 0 {
+			return fmt.Errorf("unexpected argument %q (give inputs with -f)", files[0])
+		}
+		config.applyImplied(fs)
+		if err := config.validate(); err != nil {
+			return err
+		}
+		if extra := rec.extraLocales(); len(extra) > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: --detect-lang also applies locale packs the recipe was not exported with: %s\n", strings.Join(extra, ", "))
+		}
+		if *printCmd {
+			cmd := []string{"passmut"}
+			for _, opt := range configOptions(config) {
+				name, value, _ := strings.Cut(opt, "=")
+				if name == "file" {
+					continue
+				}
+				if value == "true" {
+					if b, ok := fs.Lookup(name).Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+						cmd = append(cmd, "--"+name)
+						continue
+					}
+				}
+				cmd = append(cmd, shellArg("--"+name+"="+value))
+			}
+			if config.inputFile != "" {
+				cmd = append(cmd, "-f", shellArg(config.inputFile))
+			}
+			if config.outputFile != "-" {
+				cmd = append(cmd, "-o", shellArg(config.outputFile))
+			}
+			fmt.Println(strings.Join(cmd, " "))
+			return nil
+		}
+		inputs := []inputSpec{{path: "-"}}
+		if config.inputFile != "" && config.inputFile != "-" {
+			inputs = parseInputSpecs(config.inputFile)
+		}
+		return run(config, inputs)
+
+	case "diff":
+		return runRecipeDiff(args[1:], usage)
+
+	case "validate":
+		if len(args) < 2 {
+			usage()
+			return fmt.Errorf("expected recipe files")
+		}
+		failed := 0
+		for _, path := range args[1:] {
+			if err := validateRecipe(path); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				failed++
+				continue
+			}
+			fmt.Printf("%s: ok\n", path)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d recipes failed validation", failed, len(args)-1)
+		}
+		return nil
+	}
+	usage()
+	return fmt.Errorf("unknown recipe command %q (use export, import, validate or diff)", args[0])
+}
+
+// validateRecipe checks a recipe the way import would, without generating
+func validateRecipe(path string) error {
+	rec, err := loadRecipe(path)
+	if err != nil {
+		return err
+	}
+	config := &Config{}
+	fs := newFlagSet(config, flag.ContinueOnError)
+	if err := rec.apply(fs, filepath.Dir(path)); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	config.applyImplied(fs)
+	if err := config.validate(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// recipeTrial is one side of "passmut recipe diff": the candidates a recipe
+// makes from the sample words and its keyspace estimate for them
+type recipeTrial struct {
+	cands map[string]struct{}
+	est   keyspaceEstimate
+}
+
+// recipeOutput runs a recipe on the sample words through a temporary file,
+// optionally under --deterministic, and returns the output and the config
+// it ran with
+func recipeOutput(path string, sample []string, deterministic bool) ([]byte, *Config, error) {
+	rec, err := loadRecipe(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	config := &Config{}
+	fs := newFlagSet(config, flag.ContinueOnError)
+	if err := rec.apply(fs, filepath.Dir(path)); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	config.deterministic = config.deterministic || deterministic
+	config.applyImplied(fs)
+	if err := config.validate(); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	words, err := os.CreateTemp("", "passmut-sample-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.Remove(words.Name())
+	_, err = io.WriteString(words, strings.Join(sample, "\n")+"\n")
+	if cerr := words.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	out, err := os.CreateTemp("", "passmut-sample-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	out.Close()
+	defer os.Remove(out.Name())
+	config.outputFile = out.Name()
+	if err := run(config, []inputSpec{{path: words.Name()}}); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	data, err := os.ReadFile(out.Name())
+	return data, config, err
+}
+
+// tryRecipe generates the recipe's candidates for the sample and estimates
+// its keyspace
+func tryRecipe(path string, sample []string) (*recipeTrial, error) {
+	data, config, err := recipeOutput(path, sample, false)
+	if err != nil {
+		return nil, err
+	}
+	trial := &recipeTrial{cands: make(map[string]struct{})}
+	for _, c := range rawLines(data) {
+		trial.cands[c] = struct{}{}
+	}
+	var common []string
+	if config.common != "" {
+		if common, err = loadCommon(config.common); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	trial.est = (&Mangler{config: config, currentCommon: common}).estimateKeyspace(sample)
+	return trial, nil
+}
+
+// onlyIn returns the candidates of a that b lacks, sorted
+func (a *recipeTrial) onlyIn(b *recipeTrial) []string {
+	var res []string
+	for c := range a.cands {
+		if _, ok := b.cands[c]; !ok {
+			res = append(res, c)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// runRecipeDiff implements "passmut recipe diff": run two recipes on the
+// same sample words and report what each adds and how their keyspaces
+// compare, before either is let loose on a full list
+func runRecipeDiff(args []string, usage func()) error {
+	fs := flag.NewFlagSet("recipe diff", flag.ExitOnError)
+	var samplePath, outputFile string
+	var words, show int
+	fs.StringVar(&samplePath, "sample", "", "sample words both recipes are run on")
+	fs.IntVar(&words, "words", 0, "input size to scale the keyspace estimate to (0 = the sample)")
+	fs.IntVar(&show, "show", 10, "sample candidates listed for each side")
+	fs.StringVar(&outputFile, "output", "-", "report file")
+	fs.StringVar(&outputFile, "o", "-", "report file (shorthand)")
+	fs.Usage = usage
+	files, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) != 2 || samplePath == "" {
+		usage()
+		return fmt.Errorf("expected two recipes and --sample")
+	}
+	sample, err := loadSample(samplePath)
+	if err != nil {
+		return err
+	}
+
+	var trials [2]*recipeTrial
+	for i, path := range files {
+		if trials[i], err = tryRecipe(path, sample); err != nil {
+			return err
+		}
+	}
+	// The estimate is linear in the input size unless --perms or
+	// --interleave-words pair the words up, so scale the per-word fanout
+	keyspace := func(t *recipeTrial) float64 { return t.est.perWord * float64(words) }
+	for i, t := range trials {
+		if t.est.inputs == float64(len(sample)) {
+			continue
+		}
+		if words > 0 && words != len(sample) {
+			return fmt.Errorf("--words %d: %s pairs words up with --perms or --interleave-words, so its keyspace does not scale linearly and is only estimated for the sample; leave --words out", words, files[i])
+		}
+		keyspace = func(t *recipeTrial) float64 { return t.est.total }
+	}
+	if words <= 0 {
+		words = len(sample)
+	}
+
+	out, err := createOutput(outputFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	bw := bufio.NewWriter(out)
+	onlyA, onlyB := trials[0].onlyIn(trials[1]), trials[1].onlyIn(trials[0])
+	fmt.Fprintf(bw, "A: %s\nB: %s\nSample: %s (%d words)\n\n", files[0], files[1], samplePath, len(sample))
+	fmt.Fprintf(bw, "%-22s %16s %16s\n", "", "A", "B")
+	fmt.Fprintf(bw, "%-22s %16d %16d\n", "Sample candidates", len(trials[0].cands), len(trials[1].cands))
+	fmt.Fprintf(bw, "%-22s %16d %16d\n", "Unique", len(onlyA), len(onlyB))
+	fmt.Fprintf(bw, "%-22s %16.1f %16.1f\n", "Candidates/word", trials[0].est.perWord, trials[1].est.perWord)
+	ka, kb := keyspace(trials[0]), keyspace(trials[1])
+	fmt.Fprintf(bw, "%-22s %16s %16s\n", fmt.Sprintf("Keyspace (%s words)", humanCount(float64(words))), "~"+humanCount(ka), "~"+humanCount(kb))
+	fmt.Fprintf(bw, "\nShared: %d. ", len(trials[0].cands)-len(onlyA))
+	switch {
+	case ka == 0 && kb == 0:
+		fmt.Fprintf(bw, "Both keyspaces are empty.\n")
+	case ka == 0:
+		fmt.Fprintf(bw, "Keyspace difference: +%s (before filters and dedup).\n", humanCount(kb))
+	default:
+		sign := "+"
+		if kb < ka {
+			sign = "-"
+		}
+		fmt.Fprintf(bw, "Keyspace difference: %s%s, x%.2f (before filters and dedup).\n", sign, humanCount(math.Abs(kb-ka)), kb/ka)
+	}
+	for i, only := range [][]string{onlyA, onlyB} {
+		fmt.Fprintf(bw, "\nOnly in %c (%d):\n", 'A'+i, len(only))
+		for _, c := range sampleEvenly(only, show) {
+			fmt.Fprintf(bw, "  %s\n", c)
+		}
+	}
+	return bw.Flush()
+}
+
+// loadSample reads the sample words of recipe diff and verify
+func loadSample(path string) ([]string, error) {
+	f, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	sample, err := loadWords(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(sample) == 0 {
+		return nil, fmt.Errorf("%s: no sample words", path)
+	}
+	return sample, nil
+}
+
+// goldenDiff compares generated output with a golden file line by line:
+// the candidates only one side has, and for the same candidates in another
+// order the first line that differs
+type goldenDiff struct {
+	missing, added []string
+	firstMismatch  int // 1-based line, 0 when the lines are the same
+}
+
+func diffGolden(golden, got []byte) goldenDiff {
+	split := func(data []byte) []string {
+		s := strings.TrimSuffix(string(data), "\n")
+		if s == "" {
+			return nil
+		}
+		return strings.Split(s, "\n")
+	}
+	want, have := split(golden), split(got)
+	var d goldenDiff
+	for i := 0; i < len(want) || i < len(have); i++ {
+		if i >= len(want) || i >= len(have) || want[i] != have[i] {
+			d.firstMismatch = i + 1
+			break
+		}
+	}
+	wantSet := make(map[string]struct{}, len(want))
+	for _, w := range want {
+		wantSet[w] = struct{}{}
+	}
+	haveSet := make(map[string]struct{}, len(have))
+	for _, h := range have {
+		haveSet[h] = struct{}{}
+		if _, ok := wantSet[h]; !ok {
+			d.added = append(d.added, h)
+		}
+	}
+	for _, w := range want {
+		if _, ok := haveSet[w]; !ok {
+			d.missing = append(d.missing, w)
+		}
+	}
+	return d
+}
+
+// runVerify implements "passmut verify": regenerate a recipe's candidates
+// for a small fixed sample under --deterministic and compare them with a
+// stored golden file, so an upgrade or recipe edit cannot change the output
+// unnoticed
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	var recipePath, goldenPath, samplePath string
+	var update bool
+	var show int
+	fs.StringVar(&recipePath, "recipe", "", "recipe to check")
+	fs.StringVar(&goldenPath, "golden", "", "expected candidates")
+	fs.StringVar(&samplePath, "sample", "", "fixed sample words")
+	fs.BoolVar(&update, "update", false, "write the golden file instead of comparing")
+	fs.IntVar(&show, "show", 10, "differing candidates listed for each side")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: passmut verify --recipe <r.pmrecipe> --golden <expected.txt> --sample <words.txt> [OPTION]\n")
+		fmt.Fprintf(os.Stderr, "\tRegenerate the recipe's candidates for the sample under --deterministic\n")
+		fmt.Fprintf(os.Stderr, "\tand compare them byte for byte with the golden file; exits non-zero on\n")
+		fmt.Fprintf(os.Stderr, "\tany difference.\n")
+		fmt.Fprintf(os.Stderr, "\t--update: write the golden file from the current output\n")
+		fmt.Fprintf(os.Stderr, "\t--show <N>: missing and new candidates listed (default 10)\n")
+	}
+	if files, err := parseInterspersed(fs, args); err != nil {
+		return err
+	} else if len(files) > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %q", files[0])
+	}
+	if recipePath == "" || goldenPath == "" || samplePath == "" {
+		fs.Usage()
+		return fmt.Errorf("--recipe, --golden and --sample are required")
+	}
+	sample, err := loadSample(samplePath)
+	if err != nil {
+		return err
+	}
+	got, _, err := recipeOutput(recipePath, sample, true)
+	if err != nil {
+		return err
+	}
+	lines := bytes.Count(got, []byte{'\n'})
+	if update {
+		if err := os.WriteFile(goldenPath, got, 0644); err != nil {
+			return err
+		}
+		fmt.Printf("%s: wrote %d candidates\n", goldenPath, lines)
+		return nil
+	}
+	golden, err := os.ReadFile(goldenPath)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(golden, got) {
+		fmt.Printf("%s: ok, %d candidates match\n", goldenPath, lines)
+		return nil
+	}
+
+	d := diffGolden(golden, got)
+	fmt.Printf("%s: output differs from line %d\n", goldenPath, d.firstMismatch)
+	if len(d.missing) == 0 && len(d.added) == 0 {
+		fmt.Printf("Same candidates in a different order\n")
+	}
+	for _, side := range []struct {
+		label string
+		mark  byte
+		cands []string
+	}{{"Missing", '-', d.missing}, {"New", '+', d.added}} {
+		if len(side.cands) == 0 {
+			continue
+		}
+		fmt.Printf("%s (%d):\n", side.label, len(side.cands))
+		for _, c := range side.cands[:min(show, len(side.cands))] {
+			fmt.Printf("%c %s\n", side.mark, c)
+		}
+	}
+	return fmt.Errorf("%s does not match %s; rerun with --update if the change is intended", recipePath, goldenPath)
+}
+
+// copyToClipboard puts text on the clipboard with the first of
+// clipboardCommands that is installed and succeeds
+func copyToClipboard(text string) error {
+	var tried []string
+	for _, args := range clipboardCommands {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		if err := cmd.Run(); err != nil {
+			tried = append(tried, fmt.Sprintf("%s: %v", args[0], err))
+			continue
+		}
+		return nil
+	}
+	if len(tried) > 0 {
+		return fmt.Errorf("copying to the clipboard failed (%s)", strings.Join(tried, "; "))
+	}
+	names := make([]string, len(clipboardCommands))
+	for i, args := range clipboardCommands {
+		names[i] = args[0]
+	}
+	return fmt.Errorf("no clipboard tool found (install one of %s)", strings.Join(names, ", "))
+}
+
+// runWord implements "passmut word": mangle the words given as arguments
+// with the usual options, without an input file. --copy puts the top
+// candidates on the clipboard, ranked by efficacy unless --sort is given.
+func runWord(args []string) error {
+	config := &Config{}
+	fs := newFlagSet(config, flag.ExitOnError)
+	copyTop := fs.Bool("copy", false, "put the top candidates on the clipboard")
+	top := fs.Int("top", 20, "candidates --copy puts on the clipboard")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: passmut word <word> [word...] [OPTION]\n")
+		fmt.Fprintf(os.Stderr, "\tMangle the words given as arguments with the usual options (passmut -h),\n")
+		fmt.Fprintf(os.Stderr, "\twithout an input file or standard input.\n")
+		fmt.Fprintf(os.Stderr, "\t--copy: also put the top candidates on the clipboard, ranked by efficacy\n")
+		fmt.Fprintf(os.Stderr, "\tunless --sort is given\n")
+		fmt.Fprintf(os.Stderr, "\t--top <N>: candidates --copy takes (default 20)\n")
+	}
+	rest := optionalValues(args)
+	words, err := parseInterspersed(fs, rest)
+	if err != nil {
+		return err
+	}
+	if len(words) == 0 {
+		fs.Usage()
+		return fmt.Errorf("expected a word")
+	}
+	if config.inputFile != "" {
+		return fmt.Errorf("word takes its words as arguments; use passmut -f for files")
+	}
+	if err := checkDuplicateFlags(fs, rest); err != nil {
+		return err
+	}
+	if *copyTop && config.sortMode == "" {
+		config.sortMode = "e"
+	}
+	if *top < 1 {
+		return fmt.Errorf("invalid --top %d", *top)
+	}
+	noColor = noColor || config.noColor
+	if err := loadCatalog(config.lang); err != nil {
+		return err
+	}
+	config.applyImplied(fs)
+	if err := config.validate(); err != nil {
+		return err
+	}
+
+	in, err := os.CreateTemp("", "passmut-word-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(in.Name())
+	_, err = io.WriteString(in, strings.Join(words, "\n")+"\n")
+	if cerr := in.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if !*copyTop {
+		return run(config, []inputSpec{{path: in.Name()}})
+	}
+
+	// The candidates go through a temporary file so the top ones can be
+	// copied once the output is complete and sorted
+	tmp, err := os.CreateTemp("", "passmut-word-*")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	outputFile := config.outputFile
+	config.outputFile = tmp.Name()
+	if err := run(config, []inputSpec{{path: in.Name()}}); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return err
+	}
+	out, err := createOutput(outputFile)
+	if err != nil {
+		return err
+	}
+	if _, err := out.Write(data); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if n := len(lines); n > 0 && lines[n-1] == "" {
+		lines = lines[:n-1]
+	}
+	lines = lines[:min(*top, len(lines))]
+	if err := copyToClipboard(strings.Join(lines, "")); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Copied %d candidate(s) to the clipboard\n", len(lines))
+	return nil
+}
+
+// auditPolicy is a password policy for "passmut audit". Zero values disable
+// a rule.
+type auditPolicy struct {
+	MinLength    int      `yaml:"min-length"`
+	MaxLength    int      `yaml:"max-length"`
+	MinClasses   int      `yaml:"min-classes"`
+	Require      []string `yaml:"require"` // Any of upper, lower, digit, symbol
+	MaxRepeat    int      `yaml:"max-repeat"`
+	MinStrength  int      `yaml:"min-strength"`
+	MinEntropy   float64  `yaml:"min-entropy"`
+	NoDictionary bool     `yaml:"no-dictionary"`
+	NoUsername   bool     `yaml:"no-username"` // Needs user:pass input
+	Blocklist    string   `yaml:"blocklist"`
+}
+
+// policyRule is one check of a policy; pass reports compliance
+type policyRule struct {
+	name string
+	pass func(user, pw string) bool
+}
+
+// loadPolicy reads a policy file; a relative blocklist path is resolved
+// against the policy's directory
+func loadPolicy(path string) (*auditPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	p := &auditPolicy{}
+	if err := dec.Decode(p); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if p.Blocklist != "" && !filepath.IsAbs(p.Blocklist) {
+		p.Blocklist = filepath.Join(filepath.Dir(path), p.Blocklist)
+	}
+	return p, nil
+}
+
+// rules expands the policy into checks, in a stable report order
+func (p *auditPolicy) rules() ([]policyRule, error) {
+	var rules []policyRule
+	add := func(name string, pass func(user, pw string) bool) {
+		rules = append(rules, policyRule{name, pass})
+	}
+	if p.MinLength > 0 {
+		add(fmt.Sprintf("min-length %d", p.MinLength), func(_, pw string) bool {
+			return utf8.RuneCountInString(pw) >= p.MinLength
+		})
+	}
+	if p.MaxLength > 0 {
+		add(fmt.Sprintf("max-length %d", p.MaxLength), func(_, pw string) bool {
+			return utf8.RuneCountInString(pw) <= p.MaxLength
+		})
+	}
+	if p.MinClasses > 0 {
+		add(fmt.Sprintf("min-classes %d", p.MinClasses), func(_, pw string) bool {
+			return countCharClasses(pw).classes() >= p.MinClasses
+		})
+	}
+	for _, class := range p.Require {
+		var count func(charClassCounts) int
+		switch class {
+		case "upper":
+			count = func(c charClassCounts) int { return c.upper }
+		case "lower":
+			count = func(c charClassCounts) int { return c.lower }
+		case "digit":
+			count = func(c charClassCounts) int { return c.digits }
+		case "symbol":
+			count = func(c charClassCounts) int { return c.symbols }
+		default:
+			return nil, fmt.Errorf("unknown required class %q (use upper, lower, digit or symbol)", class)
+		}
+		add("require "+class, func(_, pw string) bool { return count(countCharClasses(pw)) > 0 })
+	}
+	if p.MaxRepeat > 0 {
+		add(fmt.Sprintf("max-repeat %d", p.MaxRepeat), func(_, pw string) bool {
+			return countCharClasses(pw).maxRun <= p.MaxRepeat
+		})
+	}
+	if p.MinStrength > 0 {
+		add(fmt.Sprintf("min-strength %d", p.MinStrength), func(_, pw string) bool {
+			return calculateStrength(pw) >= p.MinStrength
+		})
+	}
+	if p.MinEntropy > 0 {
+		add(fmt.Sprintf("min-entropy %g", p.MinEntropy), func(_, pw string) bool {
+			return estimateEntropy(pw) >= p.MinEntropy
+		})
+	}
+	if p.NoDictionary {
+		add("no-dictionary", func(_, pw string) bool {
+			_, ok := dictionaryBase(pw)
+			return !ok
+		})
+	}
+	if p.NoUsername {
+		add("no-username", func(user, pw string) bool {
+			return user == "" || !strings.Contains(strings.ToLower(pw), strings.ToLower(user))
+		})
+	}
+	if p.Blocklist != "" {
+		blocked, err := loadBlacklist(p.Blocklist)
+		if err != nil {
+			return nil, fmt.Errorf("blocklist: %w", err)
+		}
+		add("blocklist", func(_, pw string) bool {
+			_, hit := blocked[pw]
+			return !hit
+		})
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("policy defines no rules")
+	}
+	return rules, nil
+}
+
+// passwordMask describes a password in crunch mask notation: ^ upper,
+// % lower, # digit, & anything else
+func passwordMask(pw string) string {
+	var sb strings.Builder
+	for _, c := range pw {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			sb.WriteByte('^')
+		case c >= 'a' && c <= 'z':
+			sb.WriteByte('%')
+		case c >= '0' && c <= '9':
+			sb.WriteByte('#')
+		default:
+			sb.WriteByte('&')
+		}
+	}
+	return sb.String()
+}
+
+// auditResult accumulates compliance counts while streaming passwords
+type auditResult struct {
+	rules     []policyRule
+	total     int
+	compliant int
+	failures  []int          // Per rule
+	masks     map[string]int // Masks of non-compliant passwords
+}
+
+func newAuditResult(rules []policyRule) *auditResult {
+	return &auditResult{rules: rules, failures: make([]int, len(rules)), masks: make(map[string]int)}
+}
+
+// check records one password and returns the names of the rules it breaks
+func (a *auditResult) check(user, pw string) []string {
+	a.total++
+	var failed []string
+	for i, r := range a.rules {
+		if !r.pass(user, pw) {
+			a.failures[i]++
+			failed = append(failed, r.name)
+		}
+	}
+	if failed == nil {
+		a.compliant++
+	} else {
+		a.masks[passwordMask(pw)]++
+	}
+	return failed
+}
+
+func (a *auditResult) print(w io.Writer, policyPath string) {
+	pct := func(n int) float64 {
+		if a.total == 0 {
+			return 0
+		}
+		return float64(n) / float64(a.total) * 100
+	}
+	fmt.Fprintf(w, "\npassmut v%s Policy Audit: %s\n====================================\n", version, policyPath)
+	fmt.Fprintf(w, "Passwords:        %d\n", a.total)
+	fmt.Fprintf(w, "Fully compliant:  %d (%.1f%%)\n\n", a.compliant, pct(a.compliant))
+	fmt.Fprintf(w, "%-20s %10s %10s %11s\n", "Rule", "Pass", "Fail", "Compliance")
+	for i, r := range a.rules {
+		fmt.Fprintf(w, "%-20s %10d %10d %10.1f%%\n", r.name, a.total-a.failures[i], a.failures[i], pct(a.total-a.failures[i]))
+	}
+
+	masks := make([]string, 0, len(a.masks))
+	for m := range a.masks {
+		masks = append(masks, m)
+	}
+	sort.Slice(masks, func(i, j int) bool {
+		if a.masks[masks[i]] != a.masks[masks[j]] {
+			return a.masks[masks[i]] > a.masks[masks[j]]
+		}
+		return masks[i] < masks[j]
+	})
+	if len(masks) > 10 {
+		masks = masks[:10]
+	}
+	if len(masks) > 0 {
+		fmt.Fprintf(w, "\nTop violating patterns (^ upper, %% lower, # digit, & other):\n")
+		for _, m := range masks {
+			fmt.Fprintf(w, "  [%6d] %s\n", a.masks[m], m)
+		}
+	}
+}
+
+// runAudit implements "passmut audit": check passwords against a policy file
+// and report per-rule compliance. In pair mode a per-user violations CSV can
+// be written; it never contains the passwords themselves.
+func runAudit(args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	var policyPath, inputList, outputFile, csvPath string
+	var pairMode bool
+	fs.StringVar(&policyPath, "policy", "", "policy YAML file")
+	fs.StringVar(&inputList, "input", "", "input file(s), comma separated")
+	fs.StringVar(&inputList, "i", "", "input file(s) (shorthand)")
+	fs.StringVar(&outputFile, "output", "-", "report file")
+	fs.StringVar(&outputFile, "o", "-", "report file (shorthand)")
+	fs.StringVar(&csvPath, "csv", "", "write per-user violations as CSV (needs --pair-mode)")
+	fs.BoolVar(&pairMode, "pair-mode", false, "input lines are user:pass")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: passmut audit --policy <policy.yaml> [OPTION] [file...]\n")
+		fmt.Fprintf(os.Stderr, "\tReport per-rule password policy compliance (.gz supported, - for stdin).\n")
+		fmt.Fprintf(os.Stderr, "\t-i, --input <files>: input file(s), comma separated (or positional)\n")
+		fmt.Fprintf(os.Stderr, "\t-o, --output <file>: report file, use - for STDOUT\n")
+		fmt.Fprintf(os.Stderr, "\t--pair-mode: input lines are user:pass\n")
+		fmt.Fprintf(os.Stderr, "\t--csv <file>: per-user violations CSV (user,violations), needs --pair-mode\n")
+	}
+	files, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if inputList != "" {
+		files = append(strings.Split(inputList, ","), files...)
+	}
+	files = expandInputs(files)
+	if policyPath == "" || len(files) == 0 {
+		fs.Usage()
+		return fmt.Errorf("--policy and at least one input are required")
+	}
+	if csvPath != "" && !pairMode {
+		return fmt.Errorf("--csv needs --pair-mode to know the users")
+	}
+
+	policy, err := loadPolicy(policyPath)
+	if err != nil {
+		return err
+	}
+	rules, err := policy.rules()
+	if err != nil {
+		return fmt.Errorf("%s: %w", policyPath, err)
+	}
+
+	var csvw *csv.Writer
+	if csvPath != "" {
+		f, err := createOutput(csvPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		csvw = csv.NewWriter(f)
+		csvw.Write([]string{"user", "violations"})
+	}
+
+	result := newAuditResult(rules)
+	loader := &wordLoader{maxLineLen: defaultMaxLineLen}
+	unpaired := 0
+	for _, p := range files {
+		in, err := openInput(p)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to open %s: %v\n", p, err)
+			continue
+		}
+		err = loader.each(in, func(line string) {
+			user, pw := "", line
+			if pairMode {
+				var found bool
+				if user, pw, found = strings.Cut(line, ":"); !found {
+					unpaired++
+					return
+				}
+			}
+			if failed := result.check(user, pw); failed != nil && csvw != nil {
+				csvw.Write([]string{user, strings.Join(failed, ";")})
+			}
+		})
+		in.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: error reading %s: %v\n", p, err)
+		}
+	}
+	if unpaired > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: skipped %d line(s) that are not user:pass pairs\n", unpaired)
+	}
+	if csvw != nil {
+		csvw.Flush()
+		if err := csvw.Error(); err != nil {
+			return err
+		}
+	}
+
+	out, err := createOutput(outputFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	result.print(out, policyPath)
+	return nil
+}
+
+// listScore is how well one candidate list covers a reference set
+type listScore struct {
+	path     string
+	size     int64 // Candidate lines, i.e. guesses spent
+	hits     int   // Distinct reference passwords found
+	weighted int   // Reference occurrences covered by the hits
+}
+
+// scoreList streams a candidate list and counts the reference passwords it
+// contains. ref maps each reference password to its number of occurrences.
+func scoreList(r io.Reader, ref map[string]int, loader *wordLoader) (listScore, error) {
+	var s listScore
+	found := make(map[string]struct{})
+	err := loader.each(r, func(w string) {
+		s.size++
+		if c, ok := ref[w]; ok {
+			if _, dup := found[w]; !dup {
+				found[w] = struct{}{}
+				s.hits++
+				s.weighted += c
+			}
+		}
+	})
+	return s, err
+}
+
+// hitsPerMillion is the efficiency metric of a list: reference passwords
+// cracked per million guesses
+func (s listScore) hitsPerMillion() float64 {
+	if s.size == 0 {
+		return 0
+	}
+	return float64(s.hits) / float64(s.size) * 1e6
+}
+
+func runScore(args []string) error {
+	fs := flag.NewFlagSet("score", flag.ExitOnError)
+	var against, outputFile string
+	fs.StringVar(&against, "against", "", "reference set of cracked passwords")
+	fs.StringVar(&outputFile, "output", "-", "report file")
+	fs.StringVar(&outputFile, "o", "-", "report file (shorthand)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: passmut score --against <cracked.txt> [OPTION] <list> [list...]\n")
+		fmt.Fprintf(os.Stderr, "\tScore candidate lists by how much of a reference cracked set they contain.\n")
+		fmt.Fprintf(os.Stderr, "\tHits/M (reference passwords per million guesses) compares lists of any size.\n")
+		fmt.Fprintf(os.Stderr, "\t--against <file>: reference passwords, repeats weight the Weighted column\n")
+		fmt.Fprintf(os.Stderr, "\t-o, --output <file>: report file, use - for STDOUT\n")
+	}
+	files, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	files = expandInputs(files)
+	if against == "" || len(files) == 0 {
+		fs.Usage()
+		return fmt.Errorf("--against and at least one list are required")
+	}
+
+	loader := &wordLoader{maxLineLen: defaultMaxLineLen}
+	in, err := openInput(against)
+	if err != nil {
+		return err
+	}
+	ref := make(map[string]int)
+	refTotal := 0
+	err = loader.each(in, func(w string) {
+		ref[w]++
+		refTotal++
+	})
+	in.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", against, err)
+	}
+	if len(ref) == 0 {
+		return fmt.Errorf("reference set %s is empty", against)
+	}
+
+	var scores []listScore
+	for _, p := range files {
+		in, err := openInput(p)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to open %s: %v\n", p, err)
+			continue
+		}
+		s, err := scoreList(in, ref, loader)
+		in.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: error reading %s: %v\n", p, err)
+		}
+		s.path = p
+		scores = append(scores, s)
+	}
+
+	out, err := createOutput(outputFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	fmt.Fprintf(out, "Reference: %s (%d distinct, %d total)\n\n", against, len(ref), refTotal)
+	fmt.Fprintf(out, "%-30s %10s %10s %9s %9s %10s\n", "List", "Size", "Hits", "Coverage", "Weighted", "Hits/M")
+	for _, s := range scores {
+		fmt.Fprintf(out, "%-30s %10s %10d %8.1f%% %8.1f%% %10.1f\n", s.path, humanCount(float64(s.size)), s.hits,
+			float64(s.hits)/float64(len(ref))*100, float64(s.weighted)/float64(refTotal)*100, s.hitsPerMillion())
+	}
+	return nil
+}
+
+func runDelta(args []string) error {
+	fs := flag.NewFlagSet("delta", flag.ExitOnError)
+	var oldFile, rules, seenFile, outputFile string
+	fs.StringVar(&oldFile, "old", "", "last engagement's cracked passwords")
+	fs.StringVar(&rules, "rules", "", "recipe, or file of recipes one per line (default: rotation prediction)")
+	fs.StringVar(&seenFile, "seen", "", "candidates of earlier runs: skipped, and new ones appended")
+	fs.StringVar(&outputFile, "output", "-", "output file")
+	fs.StringVar(&outputFile, "o", "-", "output file (shorthand)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: passmut delta --old <cracked.txt> [OPTION] [old list...]\n")
+		fmt.Fprintf(os.Stderr, "\tWrite the predicted next passwords of an old cracked list that it does not\n")
+		fmt.Fprintf(os.Stderr, "\talready contain.\n")
+		fmt.Fprintf(os.Stderr, "\t--old <file>: last engagement's cracked passwords (.gz supported)\n")
+		fmt.Fprintf(os.Stderr, "\t--rules <recipe|file>: --rules recipe, or a file of recipes one per line\n")
+		fmt.Fprintf(os.Stderr, "\t                       (default: --predict-rotation and --year-bump)\n")
+		fmt.Fprintf(os.Stderr, "\t--seen <file>: skip candidates of earlier runs and append the new ones\n")
+		fmt.Fprintf(os.Stderr, "\t-o, --output <file>: output file, use - for STDOUT\n")
+	}
+	files, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if oldFile != "" {
+		files = append([]string{oldFile}, files...)
+	}
+	files = expandInputs(files)
+	if len(files) == 0 {
+		fs.Usage()
+		return fmt.Errorf("--old is required")
+	}
+
+	recipes, err := loadRecipes(rules)
+	if err != nil {
+		return err
+	}
+	loader := &wordLoader{maxLineLen: defaultMaxLineLen}
+	var old []string
+	for _, p := range files {
+		in, err := openInput(p)
+		if err != nil {
+			return err
+		}
+		words, err := loader.load(in)
+		in.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", p, err)
+		}
+		old = append(old, words...)
+	}
+	seen := make(map[string]struct{}, len(old))
+	for _, w := range old {
+		seen[w] = struct{}{}
+	}
+	if seenFile != "" {
+		in, err := os.Open(seenFile)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return err
+		default:
+			err = loader.each(in, func(w string) { seen[w] = struct{}{} })
+			in.Close()
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", seenFile, err)
+			}
+		}
+	}
+
+	fresh := deltaCandidates(old, recipes, time.Now().Year(), seen)
+	out, err := createOutput(outputFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if err := writeLines(out, fresh); err != nil {
+		return err
+	}
+	if seenFile != "" {
+		db, err := os.OpenFile(seenFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		if err := writeLines(db, fresh); err != nil {
+			db.Close()
+			return err
+		}
+		if err := db.Close(); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "delta: %d new candidate(s) from %d old password(s)\n", len(fresh), len(old))
+	return nil
+}
+
+// loadRecipes returns the --rules recipes of 'passmut delta': those of a
+// file, one per line with # comments, or spec itself. None means rotation
+// prediction. A spec that looks like a path but names no file is an error
+// rather than a recipe that changes nothing.
+func loadRecipes(spec string) ([]string, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(spec); err != nil {
+		pathLike := strings.ContainsAny(spec, `/\`) && !strings.Contains(spec, "=")
+		ext := strings.ToLower(filepath.Ext(spec))
+		if pathLike || slices.Contains([]string{".rule", ".rules", ".txt", ".pmr"}, ext) {
+			return nil, err
+		}
+		return []string{spec}, nil
+	}
+	f, err := os.Open(spec)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	l := &wordLoader{maxLineLen: defaultMaxLineLen, commentPrefix: "#"}
+	recipes, err := l.load(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", spec, err)
+	}
+	if len(recipes) == 0 {
+		return nil, fmt.Errorf("%s: no recipes", spec)
+	}
+	return recipes, nil
+}
+
+// deltaCandidates derives the next passwords of every old one, by each
+// recipe or, without recipes, by rotation prediction and year bumps to
+// cur. It returns them in the order of old, leaving out those in seen,
+// which it adds them to.
+func deltaCandidates(old, recipes []string, cur int, seen map[string]struct{}) []string {
+	var fresh []string
+	for _, w := range old {
+		var next []string
+		if recipes == nil {
+			next = append(predictRotations(w), bumpYears(w, cur)...)
+		}
+		for _, recipe := range recipes {
+			next = append(next, sequenceVariants(recipe, w, w)...)
+		}
+		for _, c := range next {
+			if _, dup := seen[c]; !dup {
+				seen[c] = struct{}{}
+				fresh = append(fresh, c)
+			}
+		}
+	}
+	return fresh
+}
+
+//go:embed defaults.txt
+var embeddedDefaults string
+
+// defaultCred is one known default login of a vendor's devices
+type defaultCred struct {
+	vendor, user, pass string
+}
+
+// parseDefaults reads "<vendor> <user> <password>" lines, where <blank>
+// stands for an empty field; blank lines and lines starting with '#' are
+// skipped
+func parseDefaults(r io.Reader) ([]defaultCred, error) {
+	var creds []defaultCred
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Fields(line)
+		if len(f) != 3 {
+			return nil, fmt.Errorf("line %d: want <vendor> <user> <password>", n)
+		}
+		for i := 1; i < 3; i++ {
+			if f[i] == "<blank>" {
+				f[i] = ""
+			}
+		}
+		creds = append(creds, defaultCred{strings.ToLower(f[0]), f[1], f[2]})
+	}
+	return creds, sc.Err()
+}
+
+func runDefaults(args []string) error {
+	fs := flag.NewFlagSet("defaults", flag.ExitOnError)
+	var vendors, dataFile, rules, format, sep, outputFile string
+	var list bool
+	fs.StringVar(&vendors, "vendor", "", "comma-separated vendors (default: all)")
+	fs.StringVar(&dataFile, "data", "", "extra or updated credentials in the built-in format")
+	fs.StringVar(&rules, "rules", "", "also write passwords mangled by a recipe, or a file of recipes")
+	fs.StringVar(&format, "format", "combo", "combo (user:password), users or passwords")
+	fs.StringVar(&sep, "sep", ":", "separator between user and password")
+	fs.BoolVar(&list, "list", false, "list the vendors and their number of credentials")
+	fs.StringVar(&outputFile, "output", "-", "output file")
+	fs.StringVar(&outputFile, "o", "-", "output file (shorthand)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: passmut defaults [OPTION]\n")
+		fmt.Fprintf(os.Stderr, "\tWrite known default credentials as a combo list for device assessments.\n")
+		fmt.Fprintf(os.Stderr, "\t--vendor <list>: comma-separated vendors (default: all; see --list)\n")
+		fmt.Fprintf(os.Stderr, "\t--data <file>: extra or updated credentials, <vendor> <user> <password> per line\n")
+		fmt.Fprintf(os.Stderr, "\t--rules <recipe|file>: also write each password mangled by the recipes\n")
+		fmt.Fprintf(os.Stderr, "\t--format <F>: combo (default, user:password), users or passwords\n")
+		fmt.Fprintf(os.Stderr, "\t--sep <S>: separator between user and password (default :)\n")
+		fmt.Fprintf(os.Stderr, "\t--list: list the vendors and their number of credentials\n")
+		fmt.Fprintf(os.Stderr, "\t-o, --output <file>: output file, use - for STDOUT\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	switch format {
+	case "combo", "users", "passwords":
+	default:
+		return fmt.Errorf("invalid --format %q (use combo, users or passwords)", format)
+	}
+
+	creds, err := parseDefaults(strings.NewReader(embeddedDefaults))
+	if err != nil {
+		return fmt.Errorf("built-in credentials: %w", err)
+	}
+	if dataFile != "" {
+		f, err := openInput(dataFile)
+		if err != nil {
+			return err
+		}
+		extra, err := parseDefaults(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", dataFile, err)
+		}
+		// Updated entries go first, so they are tried before the built-in ones
+		creds = append(extra, creds...)
+	}
+	counts := make(map[string]int)
+	for _, c := range creds {
+		counts[c.vendor]++
+	}
+	known := make([]string, 0, len(counts))
+	for v := range counts {
+		known = append(known, v)
+	}
+	sort.Strings(known)
+
+	out, err := createOutput(outputFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if list {
+		for _, v := range known {
+			fmt.Fprintf(out, "%-12s %d\n", v, counts[v])
+		}
+		return nil
+	}
+
+	want := make(map[string]bool)
+	if vendors != "" {
+		for _, v := range strings.Split(vendors, ",") {
+			v = strings.ToLower(strings.TrimSpace(v))
+			if counts[v] == 0 {
+				return fmt.Errorf("unknown vendor %q (known: %s)", v, strings.Join(known, ", "))
+			}
+			want[v] = true
+		}
+	}
+	recipes, err := loadRecipes(rules)
+	if err != nil {
+		return err
+	}
+	var lines []string
+	seen := make(map[string]struct{})
+	for _, c := range creds {
+		if len(want) > 0 && !want[c.vendor] {
+			continue
+		}
+		passes := []string{c.pass}
+		for _, recipe := range recipes {
+			passes = append(passes, sequenceVariants(recipe, c.pass, c.pass)...)
+		}
+		for _, p := range passes {
+			var line string
+			switch format {
+			case "users":
+				line = c.user
+			case "passwords":
+				line = p
+			default:
+				line = c.user + sep + p
+			}
+			if _, dup := seen[line]; !dup {
+				seen[line] = struct{}{}
+				lines = append(lines, line)
+			}
+		}
+	}
+	return writeLines(out, lines)
+}
+
+// coverageClass is a rule class 'passmut coverage' can infer. undo strips
+// what the class adds to a word, so the rest can be looked up in the
+// generated list; it returns nothing when the class changes nothing.
+type coverageClass struct {
+	name string
+	hint string // Options that add the class
+	undo func(string) []string
+}
+
+var coverageClasses = []coverageClass{
+	{"prefix", "--prefix-range, --prefix-strings, --years", func(s string) []string {
+		return changed(s, strings.TrimLeftFunc(s, func(r rune) bool { return !unicode.IsLetter(r) }))
+	}},
+	{"suffix", "--suffix-range, --suffix-strings, --years, --punctuation", func(s string) []string {
+		return changed(s, strings.TrimRightFunc(s, func(r rune) bool { return !unicode.IsLetter(r) }))
+	}},
+	{"leet", "--leet", func(s string) []string {
+		return changed(s, unleetI.Replace(s), unleetL.Replace(s))
+	}},
+	{"casing", "-c, --upper, --toggle-variations", func(s string) []string {
+		return changed(s, strings.ToLower(s))
+	}},
+}
+
+// changed returns the distinct forms that are not empty and differ from s
+func changed(s string, forms ...string) []string {
+	var out []string
+	for _, f := range forms {
+		if f != "" && f != s && !slices.Contains(out, f) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// coverageCheck compares cracked plaintexts with a generated list. Besides
+// exact hits it looks up what is left of each plaintext after undoing every
+// combination of coverageClasses, so a miss can be put down to the smallest
+// set of classes that would have produced it from a generated word.
+type coverageCheck struct {
+	cracked []string
+	index   map[string]int            // Plaintext -> position in cracked
+	forms   map[string][]coverageForm // Undone form -> plaintexts it explains
+	hit     []bool
+	caught  []int // Smallest class set (bit per coverageClasses entry) per plaintext, 0 = none
+}
+
+type coverageForm struct {
+	index   int
+	classes int
+}
+
+func newCoverageCheck(cracked []string) *coverageCheck {
+	c := &coverageCheck{index: make(map[string]int), forms: make(map[string][]coverageForm)}
+	for _, p := range cracked {
+		if _, dup := c.index[p]; dup {
+			continue
+		}
+		c.index[p] = len(c.cracked)
+		c.cracked = append(c.cracked, p)
+	}
+	c.hit = make([]bool, len(c.cracked))
+	c.caught = make([]int, len(c.cracked))
+	for i, p := range c.cracked {
+		for set := 1; set < 1<<len(coverageClasses); set++ {
+			for _, f := range undoClasses(p, set) {
+				c.forms[f] = append(c.forms[f], coverageForm{i, set})
+			}
+		}
+	}
+	return c
+}
+
+// undoClasses undoes the classes of set from p, affixes first. A class that
+// changes nothing drops the whole set, which a smaller set already covers.
+func undoClasses(p string, set int) []string {
+	forms := []string{p}
+	for bit, class := range coverageClasses {
+		if set&(1<<bit) == 0 {
+			continue
+		}
+		var next []string
+		for _, f := range forms {
+			for _, u := range class.undo(f) {
+				if !slices.Contains(next, u) {
+					next = append(next, u)
+				}
+			}
+		}
+		if len(next) == 0 {
+			return nil
+		}
+		forms = next
+	}
+	return forms
+}
+
+// see records one generated candidate
+func (c *coverageCheck) see(word string) {
+	if i, ok := c.index[word]; ok {
+		c.hit[i] = true
+	}
+	for _, f := range c.forms[word] {
+		cur := c.caught[f.index]
+		if cur == 0 || bits.OnesCount(uint(f.classes)) < bits.OnesCount(uint(cur)) {
+			c.caught[f.index] = f.classes
+		}
+	}
+}
+
+// classNames names a class set, e.g. "suffix+leet"
+func classNames(set int) string {
+	var names []string
+	for bit, class := range coverageClasses {
+		if set&(1<<bit) != 0 {
+			names = append(names, class.name)
+		}
+	}
+	return strings.Join(names, "+")
+}
+
+// missed returns the plaintexts the generated list lacks, each with the
+// classes that would have caught it ("" when none would)
+func (c *coverageCheck) missed() [][2]string {
+	var out [][2]string
+	for i, p := range c.cracked {
+		if c.hit[i] {
+			continue
+		}
+		classes := ""
+		if c.caught[i] != 0 {
+			classes = classNames(c.caught[i])
+		}
+		out = append(out, [2]string{p, classes})
+	}
+	return out
+}
+
+// print writes the coverage summary and, per class set, how many misses it
+// would have caught
+func (c *coverageCheck) print(w io.Writer, generated int64) {
+	missed := c.missed()
+	found := len(c.cracked) - len(missed)
+	fmt.Fprintf(w, "Generated: %s candidates\n", humanCount(float64(generated)))
+	fmt.Fprintf(w, "Covered:   %d of %d cracked plaintexts (%.1f%%)\n", found, len(c.cracked), float64(found)/float64(max(len(c.cracked), 1))*100)
+	if len(missed) == 0 {
+		return
+	}
+	counts := make(map[string]int)
+	for _, m := range missed {
+		counts[m[1]]++
+	}
+	var sets []string
+	for s := range counts {
+		if s != "" {
+			sets = append(sets, s)
+		}
+	}
+	sort.Slice(sets, func(i, j int) bool {
+		if counts[sets[i]] != counts[sets[j]] {
+			return counts[sets[i]] > counts[sets[j]]
+		}
+		return sets[i] < sets[j]
+	})
+	fmt.Fprintf(w, "\nMissed %d; rule classes that would have caught them from a generated word:\n", len(missed))
+	for _, s := range sets {
+		fmt.Fprintf(w, "  %-28s %8d\n", s, counts[s])
+	}
+	fmt.Fprintf(w, "  %-28s %8d\n", "(base word not generated)", counts[""])
+	if len(sets) > 0 {
+		fmt.Fprintf(w, "\nOptions per class:\n")
+		for _, class := range coverageClasses {
+			fmt.Fprintf(w, "  %-8s %s\n", class.name, class.hint)
+		}
+	}
+}
+
+func runCoverage(args []string) error {
+	fs := flag.NewFlagSet("coverage", flag.ExitOnError)
+	var generatedFile, crackedFile, missedFile, outputFile string
+	fs.StringVar(&generatedFile, "generated", "", "generated candidate list")
+	fs.StringVar(&crackedFile, "cracked", "", "plaintexts cracked on the target")
+	fs.StringVar(&missedFile, "missed", "", "write missed plaintexts with the classes that would catch them")
+	fs.StringVar(&outputFile, "output", "-", "report file")
+	fs.StringVar(&outputFile, "o", "-", "report file (shorthand)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: passmut coverage --generated <list> --cracked <found.txt> [OPTION]\n")
+		fmt.Fprintf(os.Stderr, "\tReport which cracked plaintexts a generated list missed, and which rule\n")
+		fmt.Fprintf(os.Stderr, "\tclasses (prefix, suffix, leet, casing) would have caught them.\n")
+		fmt.Fprintf(os.Stderr, "\t--generated <file>: the generated candidates (.gz supported)\n")
+		fmt.Fprintf(os.Stderr, "\t--cracked <file>: plaintexts cracked on the target (.gz supported)\n")
+		fmt.Fprintf(os.Stderr, "\t--missed <file>: write each missed plaintext<TAB>classes\n")
+		fmt.Fprintf(os.Stderr, "\t-o, --output <file>: report file, use - for STDOUT\n")
+	}
+	if _, err := parseInterspersed(fs, args); err != nil {
+		return err
+	}
+	if generatedFile == "" || crackedFile == "" {
+		fs.Usage()
+		return fmt.Errorf("--generated and --cracked are required")
+	}
+
+	loader := &wordLoader{maxLineLen: defaultMaxLineLen}
+	in, err := openInput(crackedFile)
+	if err != nil {
+		return err
+	}
+	cracked, err := loader.load(in)
+	in.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", crackedFile, err)
+	}
+	if len(cracked) == 0 {
+		return fmt.Errorf("cracked set %s is empty", crackedFile)
+	}
+	check := newCoverageCheck(cracked)
+
+	in, err = openInput(generatedFile)
+	if err != nil {
+		return err
+	}
+	var generated int64
+	err = loader.each(in, func(w string) {
+		generated++
+		check.see(w)
+	})
+	in.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", generatedFile, err)
+	}
+
+	if missedFile != "" {
+		f, err := createOutput(missedFile)
+		if err != nil {
+			return err
+		}
+		var lines []string
+		for _, m := range check.missed() {
+			lines = append(lines, m[0]+"\t"+m[1])
+		}
+		err = writeLines(f, lines)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	out, err := createOutput(outputFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	check.print(out, generated)
+	return nil
+}
+
+// suggestRecipe returns the shortest --rules recipe that turns a base word
+// into the cracked password p, and that base word. Affixes are the
+// non-letters around p (possibly not all of them, for leet at the edges);
+// the core between them must be a base word after undoing simple leet, in
+// lower case, capitalized or upper case. An empty recipe means p is a base
+// word as is; ok is false when no base word and steps reproduce p.
+func suggestRecipe(p string, bases map[string][]string) (recipe, base string, ok bool) {
+	best := -1
+	eachRecipe(p, bases, func(steps []string, b string) {
+		if best < 0 || len(steps) < best {
+			best, recipe, base, ok = len(steps), strings.Join(steps, ","), b, true
+		}
+	})
+	return recipe, base, ok
+}
+
+// eachRecipe calls fn with every recipe suggestRecipe considers for p, from
+// the longest core (shortest affixes) down
+func eachRecipe(p string, bases map[string][]string, fn func(steps []string, base string)) {
+	r := []rune(p)
+	first := slices.IndexFunc(r, unicode.IsLetter)
+	if first < 0 {
+		return
+	}
+	last := len(r)
+	for !unicode.IsLetter(r[last-1]) {
+		last--
+	}
+	for i := 0; i <= first; i++ {
+		for j := len(r); j >= last; j-- {
+			pre, core, suf := string(r[:i]), string(r[i:j]), string(r[j:])
+			if strings.Contains(pre+suf, ",") {
+				continue
+			}
+			lower := strings.ToLower(core)
+			var tried []string
+			for _, form := range []string{lower, unleetI.Replace(lower), unleetL.Replace(lower)} {
+				if slices.Contains(tried, form) {
+					continue
+				}
+				tried = append(tried, form)
+				for _, b := range bases[form] {
+					if steps, found := recipeFor(p, b, core, pre, suf); found {
+						fn(steps, b)
+					}
+				}
+			}
+		}
+	}
+}
+
+// recipeFor returns the steps that turn base into pre+core+suf, trying each
+// case step with the leet substitutions the core needs
+func recipeFor(p, base, core, pre, suf string) ([]string, bool) {
+	var pairs []string
+	from, to := []rune(strings.ToLower(base)), []rune(strings.ToLower(core))
+	if len(from) != len(to) {
+		return nil, false
+	}
+	subs := make(map[rune]rune)
+	for k := range from {
+		if from[k] == to[k] {
+			continue
+		}
+		if s, seen := subs[from[k]]; seen && s != to[k] {
+			return nil, false
+		}
+		if _, seen := subs[from[k]]; !seen {
+			subs[from[k]] = to[k]
+			pairs = append(pairs, string(from[k])+string(to[k]))
+		}
+	}
+	slices.Sort(pairs)
+	for _, caseStep := range []string{"", "lower", "capital", "upper"} {
+		var steps []string
+		if caseStep != "" {
+			steps = append(steps, caseStep)
+		}
+		if len(pairs) > 0 {
+			steps = append(steps, "leet="+strings.Join(pairs, ""))
+		}
+		if pre != "" {
+			steps = append(steps, "prepend="+pre)
+		}
+		if suf != "" {
+			steps = append(steps, "append="+suf)
+		}
+		if got := sequenceVariants(strings.Join(steps, ","), base, base); len(got) == 1 && got[0] == p {
+			return steps, true
+		}
+	}
+	return nil, false
+}
+
+// suggestion is one recipe of 'passmut suggest' with the cracked passwords
+// it reproduces
+type suggestion struct {
+	recipe  string
+	count   int
+	example string
+}
+
+// suggestRecipes ranks the recipes that reproduce the distinct cracked
+// passwords from base words, most passwords first. It also returns how many
+// passwords are base words as is and how many no recipe explains.
+func suggestRecipes(cracked []string, bases map[string][]string) (ranked []suggestion, unchanged, unexplained int) {
+	byRecipe := make(map[string]*suggestion)
+	seen := make(map[string]struct{})
+	for _, p := range cracked {
+		if _, dup := seen[p]; dup {
+			continue
+		}
+		seen[p] = struct{}{}
+		recipe, _, ok := suggestRecipe(p, bases)
+		switch {
+		case !ok:
+			unexplained++
+		case recipe == "":
+			unchanged++
+		case byRecipe[recipe] == nil:
+			byRecipe[recipe] = &suggestion{recipe: recipe, count: 1, example: p}
+		default:
+			byRecipe[recipe].count++
+		}
+	}
+	for _, s := range byRecipe {
+		ranked = append(ranked, *s)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].count != ranked[j].count {
+			return ranked[i].count > ranked[j].count
+		}
+		return ranked[i].recipe < ranked[j].recipe
+	})
+	return ranked, unchanged, unexplained
+}
+
+// inferRules returns the recipes that turn from into to, shortest first:
+// the case, leet and affix steps of suggestRecipe, optionally after
+// reversing or doubling the word. An identical pair gives one empty recipe.
+func inferRules(from, to string) []string {
+	if from == to {
+		return []string{""}
+	}
+	var recipes []string
+	for _, whole := range []string{"", "reverse", "double"} {
+		base := from
+		if whole != "" {
+			base = sequenceVariants(whole, from, from)[0]
+		}
+		eachRecipe(to, map[string][]string{strings.ToLower(base): {base}}, func(steps []string, _ string) {
+			if whole != "" {
+				steps = append([]string{whole}, steps...)
+			}
+			recipe := strings.Join(steps, ",")
+			if got := sequenceVariants(recipe, from, from); len(got) == 1 && got[0] == to && !slices.Contains(recipes, recipe) {
+				recipes = append(recipes, recipe)
+			}
+		})
+	}
+	sort.SliceStable(recipes, func(i, j int) bool {
+		return strings.Count(recipes[i], ",") < strings.Count(recipes[j], ",")
+	})
+	return recipes
+}
+
+// hashcatRule writes a recipe of inferRules in hashcat rule syntax. leet=
+// pairs cover both cases in passmut, so each case present in the word at
+// that point gets its own substitution.
+func hashcatRule(recipe, from string) string {
+	var ops []string
+	word := from
+	for _, step := range strings.Split(recipe, ",") {
+		if affix, prepend, ok := affixStep(step); ok {
+			r := []rune(affix)
+			for i := range r {
+				if prepend {
+					ops = append(ops, "^"+string(r[len(r)-1-i]))
+				} else {
+					ops = append(ops, "$"+string(r[i]))
+				}
+			}
+		} else if pairs, ok := ruleArg(step, "leet"); ok && pairs != "" {
+			p := []rune(pairs)
+			for i := 0; i+1 < len(p); i += 2 {
+				up := unicode.ToUpper(p[i])
+				hasUp := up != p[i] && strings.ContainsRune(word, up)
+				if strings.ContainsRune(word, p[i]) || !hasUp {
+					ops = append(ops, "s"+string(p[i])+string(p[i+1]))
+				}
+				if hasUp {
+					ops = append(ops, "s"+string(up)+string(p[i+1]))
+				}
+			}
+		} else {
+			ops = append(ops, map[string]string{"lower": "l", "capital": "c", "upper": "u", "reverse": "r", "double": "d"}[step])
+		}
+		word = sequenceVariants(step, from, word)[0]
+	}
+	return strings.Join(ops, " ")
+}
+
+func runInferRule(args []string) error {
+	fs := flag.NewFlagSet("infer-rule", flag.ExitOnError)
+	var from, to string
+	fs.StringVar(&from, "from", "", "base word")
+	fs.StringVar(&to, "to", "", "password observed for it")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: passmut infer-rule --from <word> --to <password>\n")
+		fmt.Fprintf(os.Stderr, "\tPrint the rule chains that turn the word into the password, shortest\n")
+		fmt.Fprintf(os.Stderr, "\tfirst, as a passmut --rules recipe and as a hashcat rule.\n")
+		fmt.Fprintf(os.Stderr, "\t--from <word>: the base word\n")
+		fmt.Fprintf(os.Stderr, "\t--to <password>: the password observed for it\n")
+	}
+	if _, err := parseInterspersed(fs, args); err != nil {
+		return err
+	}
+	if from == "" || to == "" {
+		fs.Usage()
+		return fmt.Errorf("--from and --to are required")
+	}
+	recipes := inferRules(from, to)
+	if len(recipes) == 0 {
+		return fmt.Errorf("no chain of case, leet, affix, reverse or double steps turns %q into %q", from, to)
+	}
+	for i, recipe := range recipes {
+		if i > 0 {
+			fmt.Println()
+		}
+		if recipe == "" {
+			fmt.Println("passmut: (none, the words are identical)")
+			fmt.Println("hashcat: :")
+			continue
+		}
+		fmt.Printf("passmut: %s\n", recipe)
+		fmt.Printf("hashcat: %s\n", hashcatRule(recipe, from))
+	}
+	return nil
+}
+
+func runSuggest(args []string) error {
+	fs := flag.NewFlagSet("suggest", flag.ExitOnError)
+	var crackedFile, baseFile, outputFile string
+	var minCount, top int
+	fs.StringVar(&crackedFile, "cracked", "", "cracked passwords")
+	fs.StringVar(&baseFile, "base", "", "base words the passwords were made from")
+	fs.IntVar(&minCount, "min-count", 1, "leave out recipes reproducing fewer passwords")
+	fs.IntVar(&top, "top", 0, "write only the N best recipes (0 = all)")
+	fs.StringVar(&outputFile, "output", "-", "recipe file")
+	fs.StringVar(&outputFile, "o", "-", "recipe file (shorthand)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: passmut suggest --cracked <found.txt> --base <base.txt> [OPTION]\n")
+		fmt.Fprintf(os.Stderr, "\tInfer the case, leet and affix steps between base words and cracked\n")
+		fmt.Fprintf(os.Stderr, "\tpasswords and write the recipes, most passwords first, for --rules-file.\n")
+		fmt.Fprintf(os.Stderr, "\t--cracked <file>: cracked passwords (.gz supported)\n")
+		fmt.Fprintf(os.Stderr, "\t--base <file>: base words, e.g. the seed list (.gz supported)\n")
+		fmt.Fprintf(os.Stderr, "\t--min-count <N>: leave out recipes reproducing fewer than N passwords\n")
+		fmt.Fprintf(os.Stderr, "\t--top <N>: write only the N best recipes\n")
+		fmt.Fprintf(os.Stderr, "\t-o, --output <file>: recipe file, use - for STDOUT\n")
+	}
+	if _, err := parseInterspersed(fs, args); err != nil {
+		return err
+	}
+	if crackedFile == "" || baseFile == "" {
+		fs.Usage()
+		return fmt.Errorf("--cracked and --base are required")
+	}
+
+	loader := &wordLoader{maxLineLen: defaultMaxLineLen}
+	lists := make(map[string][]string)
+	for _, p := range []string{crackedFile, baseFile} {
+		in, err := openInput(p)
+		if err != nil {
+			return err
+		}
+		words, err := loader.load(in)
+		in.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", p, err)
+		}
+		lists[p] = words
+	}
+	bases := make(map[string][]string)
+	for _, b := range lists[baseFile] {
+		key := strings.ToLower(b)
+		if !slices.Contains(bases[key], b) {
+			bases[key] = append(bases[key], b)
+		}
+	}
+	if len(bases) == 0 {
+		return fmt.Errorf("base list %s is empty", baseFile)
+	}
+
+	ranked, unchanged, unexplained := suggestRecipes(lists[crackedFile], bases)
+	total := unchanged + unexplained
+	for _, s := range ranked {
+		total += s.count
+	}
+	out, err := createOutput(outputFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	bw := bufio.NewWriter(out)
+	fmt.Fprintf(bw, "# passmut suggest: %d of %d cracked passwords reproduced by %d recipe(s)\n", total-unchanged-unexplained, total, len(ranked))
+	fmt.Fprintf(bw, "# %d are base words as is, %d matched no base word and steps\n", unchanged, unexplained)
+	fmt.Fprintf(bw, "# Use: passmut -f %s --rules-file <this file>\n", baseFile)
+	for i, s := range ranked {
+		if s.count < minCount || (top > 0 && i >= top) {
+			break
+		}
+		fmt.Fprintf(bw, "# %d (%.1f%%), e.g. %s\n%s\n", s.count, float64(s.count)/float64(total)*100, s.example, s.recipe)
+	}
+	return bw.Flush()
+}
+
+// writeLines writes words to w one per line
+func writeLines(w io.Writer, words []string) error {
+	bw := bufio.NewWriter(w)
+	for _, word := range words {
+		bw.WriteString(word)
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// recipeStep documents one step of a --rules recipe for 'passmut docs'.
+// Applying recipe to in writes out first, which TestDocs checks, so the
+// reference cannot drift from what the steps do.
+type recipeStep struct {
+	names           string
+	desc            string
+	recipe, in, out string
+}
+
+var recipeSteps = []recipeStep{
+	{"-r, --reverse, reverse", "reverse the word", "reverse", "password", "drowssap"},
+	{"-u, --upper, --uppercase, upper, uppercase", "uppercase the word", "upper", "password", "PASSWORD"},
+	{"-l, --lower, --lowercase, lower, lowercase", "lowercase the word", "lower", "PassWord", "password"},
+	{"-s, --swap, --swapcase, swap, swapcase", "swap the case of each letter", "swap", "PassWord", "pASSwORD"},
+	{"-c, --capital, --capitalize, capital, capitalize", "capitalize the word", "capital", "password", "Password"},
+	{"-d, --double, double", "write the word twice", "double", "pass", "passpass"},
+	{"-t, --leet, leet", "replace each letter with its first l33t substitute", "leet", "secret", "53(237"},
+	{"leet=PAIRS", "replace only the listed letters, each followed by its substitute", "leet=a@o0", "Password", "P@ssw0rd"},
+	{"rot, rotN", "rotate letters by 13, or by N (1-25)", "rot3", "abc", "def"},
+	{"adjswapN", "swap the characters at N and N+1 (1-based, negative from the end)", "adjswap1", "password", "apssword"},
+	{"dupN", "type the character at N twice", "dup-1", "password", "passwordd"},
+	{"delN", "delete the character at N", "del-1", "password1", "password"},
+	{"strip, strip-spaces", "remove whitespace", "strip", "pass word", "password"},
+	{"strip-digits", "remove digits", "strip-digits", "pass2024word", "password"},
+	{"strip-symbols", "remove symbols and punctuation", "strip-symbols", "pass!word#", "password"},
+	{"restore-case, --restore-case", "put the input word's casing back after lower or leet steps", "lower,leet=a@,restore-case", "PASSWORD", "P@SSWORD"},
+	{"inc-num[:N], dec-num[:N]", "move the last number by 1 to N (default 1), keeping zero padding", "inc-num", "Summer08", "Summer09"},
+	{"append=S", "add S to the end as written (no commas)", "append=!1", "password", "password!1"},
+	{"prepend=S", "add S to the start as written (no commas)", "prepend=Acme", "password", "Acmepassword"},
+}
+
+// docOption is one option of the main command in 'passmut docs', with its
+// shorthands folded in
+type docOption struct {
+	name  string   // Longest name, without dashes
+	names []string // Every spelling with its dashes, shortest first
+	arg   string   // Value placeholder with its separator, "" for switches
+	def   string   // Default value, "" when it is the zero value
+	usage string
+}
+
+// docOptions reads the options from the flag registry (newFlagSet). Names
+// bound to the same variable are one option, described by its longest name.
+func docOptions() []docOption {
+	fs := newFlagSet(&Config{}, flag.ContinueOnError)
+	byTarget := make(map[string]*docOption)
+	fs.VisitAll(func(f *flag.Flag) {
+		target := fmt.Sprintf("%p", f.Value)
+		o := byTarget[target]
+		if o == nil {
+			o = &docOption{}
+			byTarget[target] = o
+		}
+		dash := "--"
+		if len(f.Name) <= 2 {
+			dash = "-"
+		}
+		o.names = append(o.names, dash+f.Name)
+		if len(f.Name) < len(o.name) {
+			return
+		}
+		arg, usage := flag.UnquoteUsage(f)
+		o.name, o.usage, o.def = f.Name, strings.TrimSuffix(usage, " (shorthand)"), ""
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() && arg != "" {
+			arg = "[=" + arg + "]"
+		} else if arg != "" {
+			arg = " <" + arg + ">"
+		}
+		o.arg = arg
+		switch {
+		case f.Name == "threads":
+			o.def = "number of CPUs"
+		case f.DefValue != "" && f.DefValue != "0" && f.DefValue != "false":
+			o.def = f.DefValue
+		}
+	})
+	// -h is handled by the flag package itself
+	byTarget["help"] = &docOption{name: "help", names: []string{"-h", "--help"}, usage: "show the help"}
+	opts := make([]docOption, 0, len(byTarget))
+	for _, o := range byTarget {
+		sort.SliceStable(o.names, func(i, j int) bool { return len(o.names[i]) < len(o.names[j]) })
+		opts = append(opts, *o)
+	}
+	sort.Slice(opts, func(i, j int) bool {
+		return strings.ToLower(opts[i].name) < strings.ToLower(opts[j].name)
+	})
+	return opts
+}
+
+// docsDescription opens the DESCRIPTION of 'passmut docs'
+const docsDescription = "passmut reads base words from files or standard input and writes password candidates built from them: case, l33t, affix, year, keyboard and passphrase mutations, filtered and deduplicated, for hashcat, John the Ripper or any tool that takes a wordlist. The options below come from the same registry the parser uses; passmut -hl has the long help with examples."
+
+// subcommandNames lists the documented subcommands in alphabetical order.
+// It reads subcommandSummaries, as subcommands itself leads back to runDocs.
+func subcommandNames() []string {
+	names := make([]string, 0, len(subcommandSummaries))
+	for name := range subcommandSummaries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// roffEscape makes text safe for a man page line
+func roffEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\e`)
+	s = strings.ReplaceAll(s, "-", `\-`)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
+
+// writeManPage writes the reference as a section 1 man page
+func writeManPage(w io.Writer) {
+	fmt.Fprintf(w, ".TH PASSMUT 1 \"\" \"passmut v%s\" \"User Commands\"\n", version)
+	fmt.Fprintf(w, ".SH NAME\npassmut \\- password mutation engine\n")
+	fmt.Fprintf(w, ".SH SYNOPSIS\n.B passmut\n[\\fIOPTION\\fR]... [\\fB\\-f\\fR \\fIFILE\\fR]\n.br\n")
+	fmt.Fprintf(w, ".B passmut\n\\fISUBCOMMAND\\fR [\\fIOPTION\\fR]...\n")
+	fmt.Fprintf(w, ".SH DESCRIPTION\n%s\n", roffEscape(docsDescription))
+	fmt.Fprintf(w, ".SH OPTIONS\n")
+	for _, o := range docOptions() {
+		names := make([]string, len(o.names))
+		for i, n := range o.names {
+			names[i] = `\fB` + roffEscape(n) + `\fR`
+		}
+		fmt.Fprintf(w, ".TP\n%s", strings.Join(names, ", "))
+		if o.arg != "" {
+			fmt.Fprintf(w, "\\fI%s\\fR", roffEscape(o.arg))
+		}
+		fmt.Fprintf(w, "\n%s", roffEscape(o.usage))
+		if o.def != "" {
+			fmt.Fprintf(w, " (default: %s)", roffEscape(o.def))
+		}
+		fmt.Fprintf(w, "\n")
+	}
+	fmt.Fprintf(w, ".SH RECIPE STEPS\nSteps of a \\fB\\-\\-rules\\fR recipe, applied left to right and separated by commas; \\fB\\-\\-rules\\-file\\fR takes one recipe per line.\n")
+	for _, s := range recipeSteps {
+		fmt.Fprintf(w, ".TP\n\\fB%s\\fR\n%s, e.g. %s: %s \\(-> %s\n", roffEscape(s.names), roffEscape(s.desc), roffEscape(s.recipe), roffEscape(s.in), roffEscape(s.out))
+	}
+	fmt.Fprintf(w, ".SH SUBCOMMANDS\nEach subcommand prints its own options with \\fB\\-h\\fR.\n")
+	for _, name := range subcommandNames() {
+		fmt.Fprintf(w, ".TP\n\\fB%s\\fR\n%s\n", roffEscape(name), roffEscape(subcommandSummaries[name]))
+	}
+	fmt.Fprintf(w, ".SH ENVIRONMENT\n.TP\n\\fBNO_COLOR\\fR\nWhen set and not empty, help and reports are written without colors, as with \\fB\\-\\-no\\-color\\fR.\n")
+	fmt.Fprintf(w, ".SH SEE ALSO\n\\fBhashcat\\fR(1), \\fBjohn\\fR(8), \\fBcrunch\\fR(1)\n")
+}
+
+// markdownCell escapes the characters that would break a table cell
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// writeMarkdownReference writes the reference as markdown
+func writeMarkdownReference(w io.Writer) {
+	fmt.Fprintf(w, "# passmut v%s reference\n\n", version)
+	fmt.Fprintf(w, "Generated by `passmut docs --format markdown`.\n\n%s\n\n", docsDescription)
+	fmt.Fprintf(w, "## Synopsis\n\n```\npassmut [OPTION]... [-f FILE]\npassmut SUBCOMMAND [OPTION]...\n```\n\n")
+	fmt.Fprintf(w, "## Options\n\n| Option | Default | Description |\n|--------|---------|-------------|\n")
+	for _, o := range docOptions() {
+		names := slices.Clone(o.names)
+		if o.arg != "" {
+			names[len(names)-1] += o.arg
+		}
+		def := ""
+		if o.def != "" {
+			def = "`" + o.def + "`"
+		}
+		fmt.Fprintf(w, "| `%s` | %s | %s |\n", strings.Join(names, "`, `"), def, markdownCell(o.usage))
+	}
+	fmt.Fprintf(w, "\n## Recipe steps\n\nSteps of a `--rules` recipe, applied left to right and separated by commas; `--rules-file` takes one recipe per line.\n\n")
+	fmt.Fprintf(w, "| Step | Description | Example |\n|------|-------------|---------|\n")
+	for _, s := range recipeSteps {
+		fmt.Fprintf(w, "| `%s` | %s | `%s`: `%s` → `%s` |\n", s.names, markdownCell(s.desc), s.recipe, s.in, s.out)
+	}
+	fmt.Fprintf(w, "\n## Subcommands\n\nEach subcommand prints its own options with `-h`.\n\n| Subcommand | Description |\n|------------|-------------|\n")
+	for _, name := range subcommandNames() {
+		fmt.Fprintf(w, "| `%s` | %s |\n", name, markdownCell(subcommandSummaries[name]))
+	}
+	fmt.Fprintf(w, "\n## Environment\n\n`NO_COLOR`: when set and not empty, help and reports are written without colors, as with `--no-color`.\n")
+}
+
+func runDocs(args []string) error {
+	fs := flag.NewFlagSet("docs", flag.ExitOnError)
+	var format, outputFile string
+	fs.StringVar(&format, "format", "man", "man or markdown")
+	fs.StringVar(&outputFile, "output", "-", "output file")
+	fs.StringVar(&outputFile, "o", "-", "output file (shorthand)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: passmut docs [--format man|markdown] [-o <file>]\n")
+		fmt.Fprintf(os.Stderr, "\tWrite the reference of every option, recipe step and subcommand, read\n")
+		fmt.Fprintf(os.Stderr, "\tfrom the flag registry, as a man page or markdown.\n")
+		fmt.Fprintf(os.Stderr, "\t--format <man|markdown>: output format (default man)\n")
+		fmt.Fprintf(os.Stderr, "\t-o, --output <file>: output file, use - for STDOUT\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	write := map[string]func(io.Writer){"man": writeManPage, "markdown": writeMarkdownReference}[format]
+	if write == nil {
+		fs.Usage()
+		return fmt.Errorf("invalid --format %q (use man or markdown)", format)
+	}
+	out, err := createOutput(outputFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	bw := bufio.NewWriter(out)
+	write(bw)
+	return bw.Flush()
+}
+
+// selfTestVector is one built-in check run by 'passmut selftest'
+type selfTestVector struct {
+	group string
+	name  string
+	got   func() string
+	want  string
+}
+
+// selfTestVectors exercise the core transforms with known answers, so a
+// fresh build or upgrade can be verified before a long run
+var selfTestVectors = []selfTestVector{
+	{"leet", `full variations of "ab"`, func() string { return strconv.Itoa(len(generateFullLeetVariations("ab"))) }, "12"},
+	{"leet", `"ab" includes 48`, func() string { return strconv.FormatBool(slices.Contains(generateFullLeetVariations("ab"), "48")) }, "true"},
+	{"leet", "unleet for dictionary lookup", func() string { b, _ := dictionaryBase("P@ssw0rd"); return b }, "password"},
+	{"case", "capitalize", func() string { return capitalize("hello") }, "Hello"},
+	{"case", "swap case", func() string { return swapCase("HeLLo1") }, "hEllO1"},
+	{"case", `all cases of "ab"`, func() string { return strings.Join(generateAllCasePermutations("ab"), ",") }, "ab,Ab,aB,AB"},
+	{"reverse", "ascii", func() string { return reverseString("abc123") }, "321cba"},
+	{"reverse", "multi-byte runes", func() string { return reverseString("héllo") }, "olléh"},
+	{"rot", "rot13", func() string { return rotate("Hello, World1", 13) }, "Uryyb, Jbeyq1"},
+	{"rot", "caesar 3 wraps", func() string { return rotate("xyzXYZ", 3) }, "abcABC"},
+	{"unicode", "capitalize non-ascii", func() string { return capitalize("élan") }, "Élan"},
+	{"unicode", "rune length", func() string { return strconv.Itoa((&Config{}).wordLen("日本語")) }, "3"},
+	{"unicode", "byte length", func() string { return strconv.Itoa((&Config{lengthMode: "bytes"}).wordLen("日本語")) }, "9"},
+	{"crunch", "^%%## matches Abc12", func() string { return crunchVector("^%%##", "Abc12") }, "true"},
+	{"crunch", "^%%## rejects abc12", func() string { return crunchVector("^%%##", "abc12") }, "false"},
+	{"crunch", "wildcard with length range", func() string { return crunchVector("*#:6-8", "summer1") }, "true"},
+	{"crunch", "& matches a symbol", func() string { return crunchVector("%&", "a!") }, "true"},
+	{"strength", "abc", func() string { return strconv.Itoa(calculateStrength("abc")) }, "0"},
+	{"strength", "Password123!", func() string { return strconv.Itoa(calculateStrength("Password123!")) }, "1"},
+	{"strength", "xK9#mP2$vL7q", func() string { return strconv.Itoa(calculateStrength("xK9#mP2$vL7q")) }, "4"},
+}
+
+// crunchVector reports whether the first mask of spec matches s
+func crunchVector(spec, s string) string {
+	masks, err := parseCrunchMasks(spec)
+	if err != nil {
+		return err.Error()
+	}
+	return strconv.FormatBool(masks[0].matches(s, false))
+}
+
+func runSelfTest(args []string) error {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	var quiet bool
+	fs.BoolVar(&quiet, "q", false, "only print failures")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: passmut selftest [-q]\n")
+		fmt.Fprintf(os.Stderr, "\tRun the built-in transform vectors (leet, case, reverse, rot, unicode,\n")
+		fmt.Fprintf(os.Stderr, "\tcrunch, strength) and exit non-zero if any fail.\n")
+		fmt.Fprintf(os.Stderr, "\t-q: only print failures\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	fmt.Printf("passmut v%s self-test (%s/%s, %s)\n", version, runtime.GOOS, runtime.GOARCH, runtime.Version())
+	failed := 0
+	for _, v := range selfTestVectors {
+		got := v.got()
+		if got == v.want {
+			if !quiet {
+				fmt.Printf("  PASS  %-8s %s\n", v.group, v.name)
+			}
+			continue
+		}
+		failed++
+		fmt.Printf("  FAIL  %-8s %s: got %q, want %q\n", v.group, v.name, got, v.want)
+	}
+	fmt.Printf("%d/%d vectors passed\n", len(selfTestVectors)-failed, len(selfTestVectors))
+	if failed > 0 {
+		return fmt.Errorf("%d self-test vector(s) failed", failed)
+	}
+	return nil
+}
+
+func (m *Mangler) process(words []string) error {
+	// Filter-only mode: run the input through writeWord untouched
+	if m.config.filterOnly {
+		m.limits.total = len(words)
+		for i := m.skip; i < len(words) && !m.limits.stopped.Load(); i++ {
+			m.writeWord(words[i])
+			m.limits.jobDone(i)
+		}
+		m.outputSink().close()
+		return nil
+	}
+
+	// If common words enabled, add them to the base words list so they become components
+	if m.config.common != "" {
+		tempMap := make(map[string]struct{})
+		for _, w := range words {
+			tempMap[w] = struct{}{}
+		}
+		for _, cw := range m.currentCommon {
+			if _, exists := tempMap[cw]; !exists {
+				words = append(words, cw)
+				tempMap[cw] = struct{}{}
+			}
+		}
+	}
+
+	if m.budget > 0 {
+		m.fitBudget(words)
+	}
+	if m.config.estimate {
+		m.printEstimate(words)
+		return nil
+	}
+
+	// Permutations and the acronym become jobs like any input word, so the
+	// workers write them (and their variants) through the usual filters,
+	// dedup and passphrase pool
+	wordlist := words
+	if m.config.perms {
+		wordlist = m.generatePermutations(words)
+	}
+	if m.config.interleaveWords {
+		wordlist = append(wordlist[:len(wordlist):len(wordlist)], interleavePairs(words)...)
+	}
+	if m.config.acronym {
+		wordlist = append(wordlist[:len(wordlist):len(wordlist)], generateAcronym(words))
+	}
+
+	// In passphrase mode every mangled variation goes into a component pool
+	// first; the joined phrases are written to the output afterwards
+	out := m.outputSink()
+	var pool *poolSink
+	stage := out
+	if m.config.passphraseCount > 0 {
+		pool = &poolSink{min: m.componentMin, max: m.componentMax, cfg: m.config}
+		stage = pool
+	}
+
+	// Multithreaded worker loop
+	jobs := make(chan mangleJob, 100)
+	var wg sync.WaitGroup
+
+	// Candidates are filtered on their own, so in pair mode the username
+	// never counts towards length or composition limits
+	var wasmErr error
+	var wasmOnce sync.Once
+	var ordered *orderedCommit
+	// Ordered batches outlive their job; with --mmap the input word, and any
+	// candidate equal to it, points into the mapping
+	retain := func(s string) string { return s }
+	if m.config.mmapInput {
+		retain = strings.Clone
+	}
+	worker := func(stage sink, add func(string, origin), wasm *wasmInstance, plugin *pluginProcess) {
+		defer wg.Done()
+		for job := range jobs {
+			// --dedup-scope word: only this job's candidates are compared
+			var local map[string]struct{}
+			if m.config.dedupScope == "word" {
+				local = make(map[string]struct{})
+			}
+			var batch []orderedCandidate
+			put := func(s string, rules []string) {
+				if local != nil {
+					if _, dup := local[s]; dup {
+						return
+					}
+					local[s] = struct{}{}
+				}
+				if !stage.keep(s) {
+					return
+				}
+				if m.control != nil {
+					m.control.pace()
+				}
+				from := origin{weight: job.weight, source: job.source}
+				switch {
+				case ordered != nil:
+					batch = append(batch, orderedCandidate{word: retain(job.prefix + s), source: retain(job.word), rules: slices.Clone(rules), from: from})
+				case m.config.outputFormat == "jsonl":
+					m.acceptRecord(job.prefix+s, job.word, rules, from)
+				default:
+					add(job.prefix+s, from)
+				}
+			}
+			write := put
+			if m.shapes() {
+				write = func(s string, rules []string) {
+					m.shape(s, func(s string) { put(s, rules) })
+				}
+			}
+			done := m.mangleOne(job, write, wasm, plugin, func(err error) {
+				wasmOnce.Do(func() { wasmErr = err })
+			})
+			// A job counts as done for the checkpoint only once its
+			// candidates are written, which under ordered commit can be
+			// after later jobs finished
+			switch {
+			case ordered != nil && done:
+				index := job.index
+				ordered.commit(job.seq, batch, func() { m.limits.jobDone(index) })
+			case ordered != nil:
+				ordered.commit(job.seq, batch, nil)
+			case done:
+				m.limits.jobDone(job.index)
+			}
+		}
+	}
+
+	// Start workers. Under --deterministic they commit in input order, as
+	// with --dedup-order first, except that --dedup-scope worker replays
+	// each worker's candidates and needs a single one.
+	threadCount := m.config.threads
+	if threadCount < 1 || (m.config.deterministic && m.config.dedupScope == "worker") {
+		threadCount = 1
+	}
+	if (m.config.dedupOrder == "first" || m.config.deterministic) && threadCount > 1 {
+		ordered = newOrderedCommit(threadCount*reorderWindow, func(c orderedCandidate) {
+			if m.config.outputFormat == "jsonl" {
+				m.acceptRecord(c.word, c.source, c.rules, c.from)
+			} else {
+				m.acceptInto(stage, c.word, c.from)
+			}
+		})
+	}
+
+	var rule *wasmRule
+	if m.config.wasmRule != "" {
+		var err error
+		if rule, err = loadWasmRule(m.config.wasmRule); err != nil {
+			close(jobs)
+			return err
+		}
+		defer rule.close()
+	}
+
+	var plugins []*pluginProcess
+	stopPlugins := func() error {
+		var first error
+		bad := 0
+		for _, p := range plugins {
+			if err := p.close(); err != nil && first == nil {
+				first = err
+			}
+			bad += p.bad
+		}
+		plugins = nil
+		if bad > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: plugin printed %d line(s) that are not JSON strings or arrays\n", bad)
+		}
+		return first
+	}
+	var locals []*workerDedup
+	for i := 0; i < threadCount; i++ {
+		var wasm *wasmInstance
+		if rule != nil {
+			var err error
+			if wasm, err = rule.instance(); err != nil {
+				close(jobs)
+				wg.Wait()
+				stopPlugins()
+				return err
+			}
+		}
+		var plugin *pluginProcess
+		if m.config.plugin != "" {
+			var err error
+			if plugin, err = startPlugin(m.config.plugin, m.config.pluginFormat, m.config.pluginTimeout); err != nil {
+				close(jobs)
+				wg.Wait()
+				stopPlugins()
+				return err
+			}
+			plugins = append(plugins, plugin)
+		}
+		add := func(word string, from origin) { m.acceptInto(stage, word, from) }
+		if m.config.dedupScope == "worker" {
+			d, err := newWorkerDedup()
+			if err != nil {
+				close(jobs)
+				wg.Wait()
+				stopPlugins()
+				return err
+			}
+			defer d.cleanup()
+			locals = append(locals, d)
+			add = d.add
+		}
+		wg.Add(1)
+		go worker(stage, add, wasm, plugin)
+	}
+
+	// Feed words, all sharing one read-only snapshot of the config
+	m.limits.total = len(wordlist)
+	snapshot := *m.config
+	unpaired, seq := 0, 0
+	for i := m.skip; i < len(wordlist) && !m.limits.stopped.Load(); i++ {
+		word := wordlist[i]
+		job := mangleJob{word: word, cfg: &snapshot, index: i, seq: seq, weight: 1, source: m.sourceOf(word)}
+		if p := m.profiles[word]; p != nil && p != m.config {
+			job.cfg = p
+		}
+		if m.weights != nil {
+			job.weight = m.weightOf(word)
+		}
+		if m.control != nil {
+			m.control.hold()
+		}
+		if m.config.pairMode {
+			user, pass, found := strings.Cut(word, ":")
+			if !found || pass == "" {
+				unpaired++
+				m.limits.jobDone(i)
+				continue
+			}
+			job.word, job.prefix = pass, user+":"
+		}
+		if ordered != nil {
+			ordered.reserve()
+		}
+		jobs <- job
+		seq++
+	}
+	close(jobs)
+	wg.Wait()
+	if err := stopPlugins(); err != nil && wasmErr == nil {
+		wasmErr = err
+	}
+	if wasmErr != nil {
+		return wasmErr
+	}
+	if unpaired > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: skipped %d line(s) that are not user:pass pairs\n", unpaired)
+	}
+
+	// Remove duplicates across workers, also after a limit: the words the
+	// workers finished are recorded as done
+	if locals != nil {
+		if err := m.mergeWorkers(stage, locals); err != nil {
+			return err
+		}
+	}
+
+	// A limit cut generation short: write what was collected and stop. A
+	// partial passphrase pool is dropped.
+	if m.limits.stopped.Load() {
+		out.close()
+		return nil
+	}
+
+	if pool != nil {
+		if err := m.generateCombinedPassphrases(pool.words); err != nil {
+			return err
+		}
+	}
+	out.close()
+	return nil
+}
+
+// mangleOne writes every candidate of one job, including those of a --wasm
+// rule and a --plugin, and reports whether the job is complete. A failing
+// wasm rule or plugin is reported through fail and leaves the job undone.
+func (m *Mangler) mangleOne(job mangleJob, write func(string, []string), wasm *wasmInstance, plugin *pluginProcess, fail func(error)) bool {
+	if m.limits.stopped.Load() {
+		return false
+	}
+	m.chainMangle(job, write)
+	if wasm != nil {
+		cands, err := wasm.mutateWord(job.word)
+		if err != nil {
+			fail(fmt.Errorf("wasm rule on %q: %w", job.word, err))
+			return false
+		}
+		for _, c := range cands {
+			write(c, []string{"wasm"})
+		}
+	}
+	if plugin != nil {
+		cands, err := plugin.mutate(job.word)
+		if err != nil {
+			fail(fmt.Errorf("plugin on %q: %w", job.word, err))
+			return false
+		}
+		for _, c := range cands {
+			write(c, []string{"plugin"})
+		}
+	}
+	return true
+}
+
+// pluginProcess is one worker's running --plugin command. Each word goes to
+// its stdin on a line of its own. With the line protocol the answer is any
+// number of candidate lines ended by an empty line; with the json protocol it
+// is one line holding a JSON string or array of strings. The command must
+// flush its output after every answer, since the worker waits for it before
+// the next word.
+type pluginProcess struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	w       *bufio.Writer
+	lines   chan string // Output lines, closed when the plugin's stdout ends
+	readErr error       // Set before lines is closed
+	timeout time.Duration
+	json    bool
+	bad     int // Answers that were not JSON strings or arrays
+}
+
+func startPlugin(command, format string, timeout time.Duration) (*pluginProcess, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty --plugin command")
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("plugin: %w", err)
+	}
+	p := &pluginProcess{cmd: cmd, stdin: stdin, w: bufio.NewWriter(stdin), lines: make(chan string), timeout: timeout, json: format == "json"}
+	// Read on a goroutine of its own so that mutate can give up on a plugin
+	// that stops answering
+	go func() {
+		out := bufio.NewScanner(stdout)
+		out.Buffer(nil, defaultMaxLineLen)
+		for out.Scan() {
+			p.lines <- out.Text()
+		}
+		p.readErr = out.Err()
+		close(p.lines)
+	}()
+	return p, nil
+}
+
+// readLine waits for the plugin's next output line
+func (p *pluginProcess) readLine() (string, error) {
+	var expired <-chan time.Time
+	if p.timeout > 0 {
+		timer := time.NewTimer(p.timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case line, ok := <-p.lines:
+		if !ok {
+			if p.readErr != nil {
+				return "", p.readErr
+			}
+			return "", fmt.Errorf("plugin exited before answering")
+		}
+		return line, nil
+	case <-expired:
+		// Kill it so that close does not wait on a plugin that hangs
+		p.cmd.Process.Kill()
+		return "", fmt.Errorf("no answer within --plugin-timeout %s (the line protocol ends each answer with an empty line; flush after it)", p.timeout)
+	}
+}
+
+// mutate sends one word to the plugin and returns the candidates it answers
+func (p *pluginProcess) mutate(word string) ([]string, error) {
+	if p.json {
+		b, _ := json.Marshal(word)
+		p.w.Write(b)
+	} else {
+		p.w.WriteString(word)
+	}
+	p.w.WriteByte('\n')
+	if err := p.w.Flush(); err != nil {
+		return nil, err
+	}
+	if !p.json {
+		var cands []string
+		for {
+			line, err := p.readLine()
+			if err != nil {
+				return nil, err
+			}
+			if line == "" {
+				return cands, nil
+			}
+			cands = append(cands, line)
+		}
+	}
+	line, err := p.readLine()
+	if err != nil {
+		return nil, err
+	}
+	var list []string
+	if err := json.Unmarshal([]byte(line), &list); err != nil {
+		var one string
+		if json.Unmarshal([]byte(line), &one) != nil {
+			p.bad++
+			return nil, nil
+		}
+		list = []string{one}
+	}
+	cands := list[:0]
+	for _, c := range list {
+		if c != "" {
+			cands = append(cands, c)
+		}
+	}
+	return cands, nil
+}
+
+// close ends the plugin's input and waits for it to exit
+func (p *pluginProcess) close() error {
+	p.stdin.Close()
+	// Drain so the plugin never blocks on a full pipe before exiting
+	for range p.lines {
+	}
+	if err := p.cmd.Wait(); err != nil {
+		return fmt.Errorf("plugin: %w", err)
+	}
+	return nil
+}
+
+// wasmRule is a compiled --wasm rule module. A module exports its linear
+// memory as "memory", alloc(size i32) i32 returning a buffer for the input
+// word, and mutate(ptr, len i32) i64 returning the output location packed as
+// ptr<<32|len; the output holds newline-separated candidates. WASI is
+// available without filesystem, environment or clock access.
+type wasmRule struct {
+	rt       wazero.Runtime
+	compiled wazero.CompiledModule
+}
+
+func loadWasmRule(path string) (*wasmRule, error) {
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	rt := wazero.NewRuntime(ctx)
+	wasi_snapshot_preview1.MustInstantiate(ctx, rt)
+	compiled, err := rt.CompileModule(ctx, code)
+	if err != nil {
+		rt.Close(ctx)
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, name := range []string{"alloc", "mutate"} {
+		if _, ok := compiled.ExportedFunctions()[name]; !ok {
+			rt.Close(ctx)
+			return nil, fmt.Errorf("%s: missing export %q", path, name)
+		}
+	}
+	return &wasmRule{rt: rt, compiled: compiled}, nil
+}
+
+// instance creates a private module instance; instances are not safe for
+// concurrent use, so every worker gets its own
+func (r *wasmRule) instance() (*wasmInstance, error) {
+	ctx := context.Background()
+	cfg := wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize")
+	mod, err := r.rt.InstantiateModule(ctx, r.compiled, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if mod.Memory() == nil {
+		mod.Close(ctx)
+		return nil, fmt.Errorf("wasm module does not export its memory")
+	}
+	return &wasmInstance{
+		mod:    mod,
+		alloc:  mod.ExportedFunction("alloc"),
+		mutate: mod.ExportedFunction("mutate"),
+	}, nil
+}
+
+func (r *wasmRule) close() {
+	r.rt.Close(context.Background())
+}
+
+type wasmInstance struct {
+	mod    api.Module
+	alloc  api.Function
+	mutate api.Function
+}
+
+// mutateWord calls the module's mutate export for one word
+func (w *wasmInstance) mutateWord(word string) ([]string, error) {
+	ctx := context.Background()
+	res, err := w.alloc.Call(ctx, uint64(len(word)))
+	if err != nil {
+		return nil, err
+	}
+	ptr := uint32(res[0])
+	if !w.mod.Memory().WriteString(ptr, word) {
+		return nil, fmt.Errorf("alloc returned an out of range buffer")
+	}
+	res, err = w.mutate.Call(ctx, uint64(ptr), uint64(len(word)))
+	if err != nil {
+		return nil, err
+	}
+	out, ok := w.mod.Memory().Read(uint32(res[0]>>32), uint32(res[0]))
+	if !ok {
+		return nil, fmt.Errorf("mutate returned an out of range buffer")
+	}
+	var cands []string
+	for _, c := range strings.Split(string(out), "\n") {
+		if c != "" {
+			cands = append(cands, c)
+		}
+	}
+	return cands, nil
+}
+
+// estimateSampleSize is the number of words mangled to estimate fanout
+const estimateSampleSize = 100
+
+// keyspaceEstimate is a sampled estimate of the number of candidates
+type keyspaceEstimate struct {
+	inputs   float64 // Words fed to the mangler (after permutations)
+	perWord  float64 // Average candidates per input word
+	total    float64
+	avgLen   float64 // Average candidate length
+	efficacy float64 // Average candidate efficacy
+}
+
+// estimateKeyspace mangles a sample of the input through every configured
+// pass and extrapolates the average fanout to the whole input
+func (m *Mangler) estimateKeyspace(words []string) keyspaceEstimate {
+	est := keyspaceEstimate{inputs: float64(len(words))}
+	if m.config.perms {
+		// Sum of n!/(n-l)! for l = 1..n
+		est.inputs = 0
+		n := float64(len(words))
+		p := 1.0
+		for l := 0; l < len(words); l++ {
+			p *= n - float64(l)
+			est.inputs += p
+		}
+	}
+	if m.config.interleaveWords {
+		n := float64(len(words))
+		est.inputs += n * (n - 1)
+	}
+
+	sample := sampleEvenly(words, estimateSampleSize)
+	est.perWord = 1
+	for _, fam := range m.config.chainPasses() {
+		if len(sample) == 0 {
+			break
+		}
+		var produced []string
+		count := 0
+		for _, w := range sample {
+			for v := range m.variants(m.config, w, w, fam) {
+				count++
+				produced = append(produced, v)
+			}
+		}
+		est.perWord *= float64(count) / float64(len(sample))
+		// Sorted so the sample, and so the estimate, is the same every run
+		slices.Sort(produced)
+		sample = sampleEvenly(produced, estimateSampleSize)
+	}
+	if len(sample) > 0 {
+		total, efficacy := 0, 0.0
+		for _, w := range sample {
+			total += m.config.wordLen(w)
+			efficacy += getWordEfficacy(w)
+		}
+		est.avgLen = float64(total) / float64(len(sample))
+		est.efficacy = efficacy / float64(len(sample))
+	}
+	est.total = est.inputs * est.perWord
+	return est
+}
+
+// budgetRule is a mangling option --budget may turn off or, for --level
+// and --chain-depth, step down
+type budgetRule struct {
+	name string
+	on   func(*Config) bool
+	off  func(*Config)
+}
+
+func boolRule(name string, field func(*Config) *bool) budgetRule {
+	return budgetRule{name, func(c *Config) bool { return *field(c) }, func(c *Config) { *field(c) = false }}
+}
+
+func stringRule(name string, field func(*Config) *string) budgetRule {
+	return budgetRule{name, func(c *Config) bool { return *field(c) != "" }, func(c *Config) { *field(c) = "" }}
+}
+
+var budgetRules = []budgetRule{
+	{"--level", func(c *Config) bool { return c.chainDepth == 0 && c.mutationLevel > 0 }, func(c *Config) { c.mutationLevel-- }},
+	{"--chain-depth", func(c *Config) bool { return c.chainDepth > 1 }, func(c *Config) { c.chainDepth-- }},
+	boolRule("--double", func(c *Config) *bool { return &c.double }),
+	boolRule("--reverse", func(c *Config) *bool { return &c.reverse }),
+	stringRule("--repeat-to", func(c *Config) *string { return &c.repeatTo }),
+	{"--rot", func(c *Config) bool { return c.rot != 0 }, func(c *Config) { c.rot = 0 }},
+	stringRule("--kb-shift", func(c *Config) *string { return &c.kbShift }),
+	{"--substitute", func(c *Config) bool { return len(c.substitutions) > 0 }, func(c *Config) { c.substitutions = nil }},
+	boolRule("--capital", func(c *Config) *bool { return &c.capital }),
+	boolRule("--capital-words", func(c *Config) *bool { return &c.capitalWords }),
+	boolRule("--lower", func(c *Config) *bool { return &c.lower }),
+	boolRule("--upper", func(c *Config) *bool { return &c.upper }),
+	boolRule("--swap", func(c *Config) *bool { return &c.swap }),
+	boolRule("--all-cases", func(c *Config) *bool { return &c.allCases }),
+	boolRule("--toggle-variations", func(c *Config) *bool { return &c.toggleVariations }),
+	stringRule("--leet-positions", func(c *Config) *string { return &c.leetPositions }),
+	boolRule("--full-leet", func(c *Config) *bool { return &c.fullLeet }),
+	boolRule("--leet", func(c *Config) *bool { return &c.leet }),
+	stringRule("--prefix-strings", func(c *Config) *string { return &c.prefixStrings }),
+	stringRule("--suffix-strings", func(c *Config) *string { return &c.suffixStrings }),
+	stringRule("--interleave", func(c *Config) *string { return &c.interleave }),
+	stringRule("--common", func(c *Config) *string { return &c.common }),
+	boolRule("--punctuation", func(c *Config) *bool { return &c.punctuation }),
+	boolRule("--currency", func(c *Config) *bool { return &c.currency }),
+	boolRule("--emoji", func(c *Config) *bool { return &c.emoji }),
+	stringRule("--zipcodes", func(c *Config) *string { return &c.zipcodes }),
+	boolRule("--detect-lang", func(c *Config) *bool { return &c.detectLang }),
+	boolRule("--numeric-patterns", func(c *Config) *bool { return &c.numericPatterns }),
+	boolRule("--smart-affix", func(c *Config) *bool { return &c.smartAffix }),
+	boolRule("--season-cycle", func(c *Config) *bool { return &c.seasonCycle }),
+	boolRule("--year-bump", func(c *Config) *bool { return &c.yearBump }),
+	boolRule("--predict-rotation", func(c *Config) *bool { return &c.predictRotation }),
+	stringRule("--years", func(c *Config) *string { return &c.yearsCount }),
+	stringRule("--ordinals", func(c *Config) *string { return &c.ordinals }),
+	stringRule("--roman", func(c *Config) *string { return &c.roman }),
+	stringRule("--prefix-range", func(c *Config) *string { return &c.prefixRange }),
+	stringRule("--suffix-range", func(c *Config) *string { return &c.suffixRange }),
+}
+
+// describe names the rule as it stands in c, with the level or depth for
+// the stepped options
+func (r budgetRule) describe(c *Config) string {
+	switch r.name {
+	case "--level":
+		return fmt.Sprintf("--level %d", c.mutationLevel)
+	case "--chain-depth":
+		return fmt.Sprintf("--chain-depth %d", c.chainDepth)
+	}
+	return r.name
+}
+
+// fitBudget prunes the configured rules until the keyspace estimate fits
+// --budget. Each step drops the rule (or lowers the level) that gives up
+// the least efficacy per candidate saved, so the candidates that remain are
+// the likeliest per unit of budget. Once a single drop is enough, the
+// one keeping the most efficacy is taken instead, to not undershoot the
+// budget by more than needed. What was kept goes to stderr.
+func (m *Mangler) fitBudget(words []string) {
+	budget := float64(m.budget)
+	if m.weights != nil {
+		words, budget = m.protectWeighted(words, budget)
+	}
+	est := m.estimateKeyspace(words)
+	start := est.total
+	var dropped []string
+	for est.total > budget {
+		orig := *m.config
+		best, bestCost, fits := -1, math.Inf(1), false
+		var bestEst keyspaceEstimate
+		for i, r := range budgetRules {
+			if !r.on(&orig) {
+				continue
+			}
+			r.off(m.config)
+			e := m.estimateKeyspace(words)
+			*m.config = orig
+			if e.total >= est.total {
+				continue
+			}
+			cost := (est.total*est.efficacy - e.total*e.efficacy) / (est.total - e.total)
+			if e.total <= budget {
+				// Lowest cost here means most efficacy kept
+				cost = -e.total * e.efficacy
+				if !fits {
+					fits, bestCost = true, math.Inf(1)
+				}
+			} else if fits {
+				continue
+			}
+			if cost < bestCost {
+				best, bestCost, bestEst = i, cost, e
+			}
+		}
+		if best < 0 {
+			break
+		}
+		r := budgetRules[best]
+		was := r.describe(m.config)
+		r.off(m.config)
+		if now := r.describe(m.config); now != r.name {
+			was += " -> " + strings.TrimPrefix(now, r.name+" ")
+		}
+		dropped = append(dropped, was)
+		est = bestEst
+	}
+
+	var kept []string
+	for _, r := range budgetRules {
+		if r.on(m.config) {
+			kept = append(kept, r.describe(m.config))
+		}
+	}
+	if len(dropped) == 0 && est.total <= budget {
+		fmt.Fprintf(os.Stderr, "Budget %s: ~%s candidates fit, keeping every rule\n", humanCount(budget), humanCount(est.total))
+		return
+	}
+	if len(kept) == 0 {
+		kept = []string{"none"}
+	}
+	fmt.Fprintf(os.Stderr, "Budget %s: ~%s candidates pruned to ~%s\n", humanCount(budget), humanCount(start), humanCount(est.total))
+	if len(dropped) > 0 {
+		fmt.Fprintf(os.Stderr, "  dropped: %s\n", strings.Join(dropped, ", "))
+	}
+	fmt.Fprintf(os.Stderr, "  kept:    %s\n", strings.Join(kept, ", "))
+	if est.total > budget {
+		fmt.Fprintf(os.Stderr, "Warning: --budget %s cannot be met by pruning rules; cap the output with --max-output\n", humanCount(budget))
+	}
+}
+
+// protectWeighted lets --budget prefer the heaviest --file weights: the
+// words of the highest weights keep every rule, through a profile with the
+// unpruned config, as long as their candidates fit the budget together.
+// It returns the words left to prune and the budget left for them.
+func (m *Mangler) protectWeighted(words []string, budget float64) ([]string, float64) {
+	tiers := make(map[float64][]string)
+	for _, w := range words {
+		tiers[m.weightOf(w)] = append(tiers[m.weightOf(w)], w)
+	}
+	order := make([]float64, 0, len(tiers))
+	for weight := range tiers {
+		order = append(order, weight)
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(order)))
+
+	protected, kept := 0.0, 0
+	for _, weight := range order[:len(order)-1] {
+		est := m.estimateKeyspace(tiers[weight]).total
+		if protected+est > budget {
+			break
+		}
+		protected += est
+		kept++
+	}
+	if kept == 0 {
+		return words, budget
+	}
+	full := *m.config
+	m.profiles = make(map[string]*Config)
+	var rest []string
+	for i, weight := range order {
+		if i < kept {
+			for _, w := range tiers[weight] {
+				m.profiles[w] = &full
+			}
+		} else {
+			rest = append(rest, tiers[weight]...)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Budget %s: every rule kept for words of weight %g and above (~%s candidates); the rest get ~%s\n",
+		humanCount(budget), order[kept-1], humanCount(protected), humanCount(budget-protected))
+	return rest, budget - protected
+}
+
+// sampleEvenly returns up to n evenly spaced elements of words
+func sampleEvenly(words []string, n int) []string {
+	if len(words) <= n {
+		return words
+	}
+	res := make([]string, 0, n)
+	step := float64(len(words)) / float64(n)
+	for i := 0; i < n; i++ {
+		res = append(res, words[int(float64(i)*step)])
+	}
+	return res
+}
+
+// humanCount formats a large count as e.g. 1.5K, 20.3M, 4.1G
+func humanCount(v float64) string {
+	units := []string{"", "K", "M", "G", "T", "P"}
+	i := 0
+	for v >= 1000 && i < len(units)-1 {
+		v /= 1000
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprintf("%.1f%s", v, units[i])
+}
+
+func (m *Mangler) printEstimate(words []string) {
+	est := m.estimateKeyspace(words)
+	fmt.Printf("Input words:       %s\n", humanCount(est.inputs))
+	fmt.Printf("Mangling passes:   %d\n", len(m.config.chainPasses()))
+	fmt.Printf("Candidates/word:   %.1f\n", est.perWord)
+	fmt.Printf("Avg length:        %.1f\n", est.avgLen)
+	fmt.Printf("Estimated output:  ~%s candidates (~%s bytes, before filters and dedup)\n",
+		humanCount(est.total), humanCount(est.total*(est.avgLen+1)))
+	if m.crackRate != nil {
+		fmt.Printf("Exhaust time:      %s at %s\n", humanDuration(m.crackRate.seconds(est.total)), m.crackRate)
+	}
+}
+
+func (m *Mangler) generateCombinedPassphrases(pool []string) error {
+	if len(pool) == 0 {
+		return fmt.Errorf("component pool is empty, cannot generate passphrases")
+	}
+
+	k := m.config.passphraseCount
+	if m.config.ppUniqueWords && len(pool) < k {
+		return fmt.Errorf("--pp-unique-words needs at least %d components, the pool has %d", k, len(pool))
+	}
+
+	// Exhaustive Mode: If the pool is small enough, generate every possible phrase
+	// Threshold: --pp-exhaustive-max, 10000 when unset
+	expected := phraseSpace(len(pool), k, m.config.ppUniqueWords, m.config.ppSorted)
+	threshold := m.config.ppExhaustiveMax
+	if threshold == 0 {
+		threshold = 10000
+	}
+
+	if expected < float64(threshold) {
+		// Use a helper to generate all phrases of the pool
+		m.exhaustivePP(pool, k, 0, nil)
+	} else {
+		// Random Sampling Mode
+		pick := func() int { return m.rng.Intn(len(pool)) }
+		if m.config.ppWeighting == "efficacy" {
+			pick = weightedPicker(pool, m.rng)
+		}
+		count := 1000
+		for i := 0; i < count && !m.limits.stopped.Load(); i++ {
+			indices := make([]int, k)
+			for j := 0; j < k; j++ {
+				indices[j] = pick()
+				// Redraw repeats; a heavily weighted pool falls back to the
+				// first unused component
+				for tries := 0; m.config.ppUniqueWords && slices.Contains(indices[:j], indices[j]); tries++ {
+					if tries < 100 {
+						indices[j] = pick()
+					} else {
+						indices[j] = (indices[j] + 1) % len(pool)
+					}
+				}
+			}
+			if m.config.ppSorted {
+				sort.Ints(indices)
+			}
+			var parts []string
+			for _, idx := range indices {
+				parts = append(parts, pool[idx])
+			}
+			m.writePhrase(parts)
+		}
+	}
+	return nil
+}
+
+// weightedPicker returns a function drawing pool indices with probability
+// proportional to each component's efficacy (raised by --freq-list), so the
+// sampled phrases favour the most plausible words
+func weightedPicker(pool []string, rng *rand.Rand) func() int {
+	cum := make([]float64, len(pool))
+	total := 0.0
+	for i, w := range pool {
+		total += getWordEfficacy(w)
+		cum[i] = total
+	}
+	if total == 0 {
+		return func() int { return rng.Intn(len(pool)) }
+	}
+	return func() int {
+		i := sort.SearchFloat64s(cum, rng.Float64()*total)
+		if i == len(cum) {
+			i--
+		}
+		return i
+	}
+}
+
+// writePhrase writes a passphrase and, with --pp-mutate, its decorated forms
+func (m *Mangler) writePhrase(parts []string) {
+	if m.config.capitalWords {
+		m.writeWord(joinCapitalized(parts, m.config.passphraseSep))
+	}
+	if !m.config.ppMutate {
+		m.writeWord(strings.Join(parts, m.config.passphraseSep))
+		return
+	}
+	for _, p := range phraseMutations(parts, m.config.passphraseSep) {
+		m.writeWord(p)
+	}
+}
+
+// phraseSuffixes are the endings humans most often bolt onto a passphrase
+// to satisfy digit and symbol rules
+var phraseSuffixes = []string{"1", "!", "123", "1!"}
+
+// phraseLeet keeps to the vowel and s swaps people actually use in phrases;
+// the full leetMap would make them unreadable
+var phraseLeet = strings.NewReplacer("a", "4", "e", "3", "i", "1", "o", "0", "s", "5")
+
+// phraseMutations is the limited mangling pass of --pp-mutate: the phrase
+// as is, with its first or every word capitalised and in simple leet, each
+// also with the common digit/symbol suffixes
+func phraseMutations(parts []string, sep string) []string {
+	plain := strings.Join(parts, sep)
+	leet := phraseLeet.Replace(plain)
+	var res []string
+	seen := make(map[string]struct{})
+	suffixes := append([]string{""}, phraseSuffixes...)
+	for _, form := range []string{plain, capitalize(plain), joinCapitalized(parts, sep), leet} {
+		for _, suffix := range suffixes {
+			if _, dup := seen[form+suffix]; !dup {
+				seen[form+suffix] = struct{}{}
+				res = append(res, form+suffix)
+			}
+		}
+	}
+	return res
+}
+
+// phraseSpace counts the passphrases of k components from a pool of n:
+// n^k orderings with repeats, fewer with --pp-unique-words and, with
+// --pp-sorted, one per multiset (or set) of components
+func phraseSpace(n, k int, unique, sorted bool) float64 {
+	choose := func(n, k int) float64 {
+		c := 1.0
+		for i := 0; i < k; i++ {
+			c = c * float64(n-i) / float64(i+1)
+		}
+		return c
+	}
+	switch {
+	case unique && sorted:
+		return choose(n, k)
+	case sorted:
+		return choose(n+k-1, k)
+	case unique:
+		p := 1.0
+		for i := 0; i < k; i++ {
+			p *= float64(n - i)
+		}
+		return p
+	}
+	return math.Pow(float64(n), float64(k))
+}
+
+// exhaustivePP writes every phrase of rem more components. With --pp-sorted
+// components are taken in pool order starting at from; with
+// --pp-unique-words none is used twice.
+func (m *Mangler) exhaustivePP(pool []string, rem, from int, cur []int) {
+	if m.limits.stopped.Load() {
+		return
+	}
+	if rem == 0 {
+		parts := make([]string, len(cur))
+		for i, idx := range cur {
+			parts[i] = pool[idx]
+		}
+		m.writePhrase(parts)
+		return
+	}
+	if !m.config.ppSorted {
+		from = 0
+	}
+	for i := from; i < len(pool); i++ {
+		if m.config.ppUniqueWords && slices.Contains(cur, i) {
+			continue
+		}
+		next := i
+		if m.config.ppUniqueWords {
+			next = i + 1
+		}
+		m.exhaustivePP(pool, rem-1, next, append(cur, i))
+	}
+}
+
+// mangleJob is a single input word queued for the worker pool. It carries
+// the config snapshot it is mangled with so workers share no mutable state.
+type mangleJob struct {
+	word   string
+	prefix string // Prepended to every accepted candidate, e.g. "user:" in --pair-mode
+	cfg    *Config
+	index  int     // Position in the wordlist, for checkpoints
+	seq    int     // Position among the jobs sent to workers, for --dedup-order first
+	weight float64 // --file weight of the word, for --sort e
+	source int     // Input index of the word, -1 when not tracked
+}
+
+// orderedCommit is --dedup-order first (and --ordered): workers mangle jobs
+// concurrently, but each job's candidates are held until every earlier job
+// is accepted. The first instance of a candidate in pipeline order (job,
+// then the order it was generated in) is the one written, whichever worker
+// finishes first. The feeder reserves a slot per job, so a slow job holds
+// back at most a window of later ones instead of the rest of the input.
+type orderedCommit struct {
+	mu      sync.Mutex
+	next    int
+	pending map[int]orderedBatch
+	accept  func(orderedCandidate)
+	slots   chan struct{} // One per job sent and not yet accepted
+}
+
+// reorderWindow is how many jobs per worker orderedCommit lets run ahead of
+// the oldest unfinished one
+const reorderWindow = 16
+
+type orderedCandidate struct {
+	word, source string
+	rules        []string
+	from         origin
+}
+
+// orderedBatch is one job's candidates and what to run once they are
+// accepted
+type orderedBatch struct {
+	cands []orderedCandidate
+	done  func()
+}
+
+func newOrderedCommit(window int, accept func(orderedCandidate)) *orderedCommit {
+	return &orderedCommit{pending: make(map[int]orderedBatch), accept: accept, slots: make(chan struct{}, window)}
+}
+
+// reserve blocks until the window has room for another job
+func (o *orderedCommit) reserve() {
+	o.slots <- struct{}{}
+}
+
+// commit records job seq's candidates and accepts every batch that is now
+// next in line. done, if not nil, runs after the batch's candidates are
+// accepted.
+func (o *orderedCommit) commit(seq int, batch []orderedCandidate, done func()) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.pending[seq] = orderedBatch{batch, done}
+	for {
+		b, ok := o.pending[o.next]
+		if !ok {
+			return
+		}
+		delete(o.pending, o.next)
+		o.next++
+		for _, c := range b.cands {
+			o.accept(c)
+		}
+		if b.done != nil {
+			b.done()
+		}
+		<-o.slots
+	}
+}
+
+// chainMangle runs the mangling passes configured by --level/--chain-depth,
+// feeding every pass the variants produced by the previous one. The
+// intermediate pool is local to the job; only the final set is filtered.
+// For --output-format jsonl the shortest rule path to each candidate is
+// tracked and passed to write; otherwise rules is nil.
+func (m *Mangler) chainMangle(job mangleJob, write func(w string, rules []string)) {
+	cur := map[string]struct{}{job.word: {}}
+	var paths map[string][]string
+	if job.cfg.outputFormat == "jsonl" {
+		paths = map[string][]string{job.word: nil}
+	}
+	for _, fam := range job.cfg.chainPasses() {
+		if m.limits.stopped.Load() {
+			return
+		}
+		next := make(map[string]struct{}, len(cur))
+		var nextPaths map[string][]string
+		if paths != nil {
+			nextPaths = make(map[string][]string, len(cur))
+		}
+		for w := range cur {
+			for v, rule := range m.variants(job.cfg, job.word, w, fam) {
+				next[v] = struct{}{}
+				if paths != nil {
+					extendPath(nextPaths, v, paths[w], rule)
+				}
+			}
+		}
+		cur, paths = next, nextPaths
+	}
+	if job.cfg.restoreCase {
+		restored := make([]string, 0, len(cur))
+		for w := range cur {
+			restored = append(restored, restoreCase(w, job.word))
+			if paths != nil {
+				extendPath(paths, restored[len(restored)-1], paths[w], "restore-case")
+			}
+		}
+		for _, w := range restored {
+			cur[w] = struct{}{}
+		}
+	}
+	if job.cfg.deterministic {
+		sorted := make([]string, 0, len(cur))
+		for w := range cur {
+			sorted = append(sorted, w)
+		}
+		sort.Strings(sorted)
+		for _, w := range sorted {
+			write(w, paths[w])
+		}
+		return
+	}
+	for w := range cur {
+		write(w, paths[w])
+	}
+}
+
+// extendPath records base plus rule as the path to v unless v already has
+// a shorter one. Paths of equal length are ordered by their rule names, so
+// the record does not depend on map iteration order. The word itself (rule
+// "") keeps base.
+func extendPath(paths map[string][]string, v string, base []string, rule string) {
+	if rule != "" {
+		base = append(base[:len(base):len(base)], rule)
+	}
+	if old, ok := paths[v]; ok && (len(old) < len(base) || len(old) == len(base) && slices.Compare(old, base) <= 0) {
+		return
+	}
+	paths[v] = base
+}
+
+func (m *Mangler) mangleWord(word string) {
+	m.chainMangle(mangleJob{word: word, cfg: m.config}, func(w string, _ []string) { m.writeWord(w) })
+}
+
+// workerDedup is the per-worker state for --dedup-scope worker: filtered
+// candidates are deduplicated locally and spilled to a temporary file
+// without taking any shared lock, then merged once all workers are done.
+// Each line is "<source>\t<weight>\t<candidate>"; a duplicate is spilled
+// again only when it raises the weight.
+type workerDedup struct {
+	seen map[uint32]float64
+	file *os.File
+	buf  *bufio.Writer
+	line []byte
+	err  error // First failed write to the file
+}
+
+func newWorkerDedup() (*workerDedup, error) {
+	f, err := os.CreateTemp("", "passmut-worker-*")
+	if err != nil {
+		return nil, err
+	}
+	return &workerDedup{
+		seen: make(map[uint32]float64),
+		file: f,
+		buf:  bufio.NewWriterSize(f, 256*1024),
+	}, nil
+}
+
+func (d *workerDedup) add(word string, from origin) {
+	crc := crc32.ChecksumIEEE([]byte(word))
+	if w, exists := d.seen[crc]; exists && from.weight <= w {
+		return
+	}
+	d.seen[crc] = from.weight
+	b := strconv.AppendInt(d.line[:0], int64(from.source), 10)
+	b = append(b, '\t')
+	b = strconv.AppendFloat(b, from.weight, 'g', -1, 64)
+	b = append(b, '\t')
+	b = append(b, word...)
+	d.line = append(b, '\n')
+	if _, err := d.buf.Write(d.line); err != nil && d.err == nil {
+		d.err = err
+	}
+}
+
+// replay passes the worker's candidates to fn in the order they were added
+func (d *workerDedup) replay(fn func(string, origin)) error {
+	d.seen = nil
+	if d.err != nil {
+		return d.err
+	}
+	if err := d.buf.Flush(); err != nil {
+		return err
+	}
+	if _, err := d.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReaderSize(d.file, 256*1024)
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		index, rest, _ := strings.Cut(line[:len(line)-1], "\t")
+		weight, word, _ := strings.Cut(rest, "\t")
+		source, _ := strconv.Atoi(index)
+		w, _ := strconv.ParseFloat(weight, 64)
+		fn(word, origin{weight: w, source: source})
+	}
+}
+
+func (d *workerDedup) cleanup() {
+	d.file.Close()
+	os.Remove(d.file.Name())
+}
+
+// mergeWorkers writes the candidates the workers spilled to the sink,
+// keeping only the first instance of one that several workers produced.
+// It runs once the workers are done, so the lock it takes is uncontended,
+// and the global set, idle until then, can keep the highest weights.
+func (m *Mangler) mergeWorkers(to sink, locals []*workerDedup) error {
+	put := func(to sink, word string, from origin) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		to.add(word, from)
+	}
+	merged := make(map[uint32]struct{})
+	for _, d := range locals {
+		err := d.replay(func(word string, from origin) {
+			if m.keepsMaxWeight() {
+				m.dedupWeighted(to, word, from, put)
+				return
+			}
+			crc := crc32.ChecksumIEEE([]byte(word))
+			if _, exists := merged[crc]; exists {
+				return
+			}
+			merged[crc] = struct{}{}
+			put(to, word, from)
+		})
+		if err != nil {
+			return fmt.Errorf("--dedup-scope worker: %w", err)
+		}
+	}
+	return nil
+}
+
+// variantSet maps each variant to the rule that first produced it; the word
+// itself maps to ""
+type variantSet map[string]string
+
+func (v variantSet) add(word, rule string) {
+	if _, ok := v[word]; !ok {
+		v[word] = rule
+	}
+}
+
+// variants returns the word plus every variant produced by the enabled
+// rules that belong to one of the given families. source is the input word
+// the chain started from, for restore-case and --detect-lang.
+func (m *Mangler) variants(cfg *Config, source, word string, fam ruleFamily) variantSet {
+	if cfg.rulesList != "" {
+		// --rules-file recipes are one per line, each applied on its own
+		res := make(variantSet)
+		for _, recipe := range strings.Split(cfg.rulesList, "\n") {
+			for _, w := range sequenceVariants(recipe, source, word) {
+				res.add(w, recipe)
+			}
+		}
+		return res
+	}
+
+	shape := fam&familyShape != 0
+	cases := fam&familyCase != 0
+	leet := fam&familyLeet != 0
+	affix := fam&familyAffix != 0
+
+	res := variantSet{word: ""}
+	if shape && cfg.double {
+		res.add(word+word, "double")
+	}
+	if shape && cfg.reverse {
+		res.add(reverseString(word), "reverse")
+	}
+	if shape && cfg.repeatTo != "" {
+		addRepeats(cfg, word, res)
+	}
+	if shape && cfg.rot != 0 {
+		res.add(rotate(word, cfg.rot), "rot")
+	}
+	if shape && cfg.kbShift != "" {
+		for _, dir := range strings.Split(cfg.kbShift, ",") {
+			if shift := kbShiftMaps[cfg.kbLayout+":"+strings.TrimSpace(dir)]; shift != nil {
+				res.add(kbShiftWord(word, shift), "kb-shift")
+			}
+		}
+	}
+	if shape {
+		for _, sub := range cfg.substitutions {
+			res.add(substituteToken(word, sub), "substitute")
+		}
+	}
+	if cases && cfg.capital {
+		res.add(capitalize(word), "capital")
+	}
+	if cases && cfg.capitalWords {
+		res.add(capitalizeTokens(word), "capital-words")
+	}
+	if cases && cfg.lower {
+		res.add(strings.ToLower(word), "lower")
+	}
+	if cases && cfg.upper {
+		res.add(strings.ToUpper(word), "upper")
+	}
+	if cases && cfg.swap {
+		res.add(swapCase(word), "swap")
+	}
+	if affix && cfg.prefixStrings != "" {
+		for _, s := range strings.Split(cfg.prefixStrings, ",") {
+			res.add(strings.TrimSpace(s)+word, "prefix-strings")
+		}
+	}
+	if affix && cfg.suffixStrings != "" {
+		for _, s := range strings.Split(cfg.suffixStrings, ",") {
+			res.add(word+strings.TrimSpace(s), "suffix-strings")
+		}
+	}
+	if affix && cfg.interleave != "" {
+		for _, s := range strings.Split(cfg.interleave, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				res.add(interleave(word, s), "interleave")
+				res.add(interleave(s, word), "interleave")
+			}
+		}
+	}
+	if affix && cfg.common != "" {
+		for _, c := range m.currentCommon {
+			res.add(c+word, "common")
+			res.add(word+c, "common")
+		}
+	}
+	if leet && cfg.leetPositions != "" {
+		for _, v := range positionalLeet(word, cfg.leetPositions, cfg.fullLeet) {
+			res.add(v, "leet-positions")
+		}
+	} else if leet && cfg.fullLeet {
+		for _, v := range generateFullLeetVariations(word) {
+			res.add(v, "full-leet")
+		}
+	} else if leet && cfg.leet {
+		allSwapped := word
+		for _, char := range leetKeys {
+			if reps := leetMap[char]; len(reps) > 0 {
+				rep := string(reps[0])
+				res.add(strings.ReplaceAll(word, string(char), rep), "leet")
+				allSwapped = strings.ReplaceAll(allSwapped, string(char), rep)
+			}
+		}
+		res.add(allSwapped, "leet")
+	}
+	if cases && cfg.allCases {
+		for _, v := range generateAllCasePermutations(word) {
+			res.add(v, "all-cases")
+		}
+	}
+	if affix && cfg.punctuation {
+		for _, p := range punctuationAffixes(cfg.punctSet, cfg.punctMax) {
+			res.add(word+p, "punctuation")
+			if cfg.punctPrefix {
+				res.add(p+word, "punctuation")
+			}
+		}
+	}
+	if affix && cfg.currency {
+		addAffixes(word, currencySymbols, "currency", res)
+	}
+	if affix && cfg.emoji {
+		addAffixes(word, emojiSymbols, "emoji", res)
+	}
+	if affix && cfg.zipcodes != "" {
+		addAffixes(word, m.zipcodes, "zipcodes", res)
+	}
+	if (shape || affix) && cfg.detectLang {
+		if pack, ok := localePacks[detectLanguage(source)]; ok {
+			if shape && pack.translit != nil {
+				res.add(transliterate(word, pack.translit), "detect-lang")
+			}
+			if affix {
+				addAffixes(word, pack.seasons, "detect-lang", res)
+			}
+		}
+	}
+	if affix && cfg.numericPatterns {
+		for _, p := range numericPatterns {
+			res.add(word+p, "numeric-patterns")
+		}
+	}
+	if affix && cfg.smartAffix {
+		m.addSmartAffixes(word, res)
+	}
+	if affix && cfg.seasonCycle {
+		for _, w := range cycleNames(word) {
+			res.add(w, "season-cycle")
+		}
+	}
+	if affix && cfg.yearBump {
+		for _, w := range bumpYears(word, cfg.currentYear()) {
+			res.add(w, "year-bump")
+		}
+	}
+	if affix && cfg.predictRotation {
+		for _, w := range predictRotations(word) {
+			res.add(w, "predict-rotation")
+		}
+	}
+	if cases && cfg.toggleVariations {
+		for _, v := range generateToggleVariations(word) {
+			res.add(v, "toggle-variations")
+		}
+	}
+	if affix && cfg.yearsCount != "" {
+		m.addNumberRange(word, cfg.yearsCount, true, "years", res)
+		m.addNumberRange(word, cfg.yearsCount, false, "years", res)
+	}
+	if affix && cfg.ordinals != "" {
+		addAffixes(word, numeralAffixes(cfg.ordinals, ordinal), "ordinals", res)
+	}
+	if affix && cfg.roman != "" {
+		addAffixes(word, numeralAffixes(cfg.roman, romanNumeral), "roman", res)
+	}
+	if affix && cfg.prefixRange != "" {
+		m.addNumberRange(word, cfg.prefixRange, true, "prefix-range", res)
+	}
+	if affix && cfg.suffixRange != "" {
+		m.addNumberRange(word, cfg.suffixRange, false, "suffix-range", res)
+	}
+
+	return res
+}
+
+func (m *Mangler) applySequence(word string) {
+	for _, w := range sequenceVariants(m.config.rulesList, word, word) {
+		m.writeWord(w)
+	}
+}
+
+// sequenceVariants applies a --rules recipe to a word derived from the input
+// word source
+func sequenceVariants(rulesList, source, word string) []string {
+	rules := strings.Split(rulesList, ",")
+	current := []string{word}
+
+	for _, rule := range rules {
+		if affix, prepend, ok := affixStep(strings.TrimSpace(rule)); ok {
+			for i, w := range current {
+				if prepend {
+					current[i] = affix + w
+				} else {
+					current[i] = w + affix
+				}
+			}
+			continue
+		}
+		rule = strings.TrimSpace(strings.ToLower(rule))
+		op := ruleOperator(rule)
+		steps, stepping := numberStepRule(rule)
+		var nextSet []string
+		for _, w := range current {
+			if op != nil {
+				nextSet = append(nextSet, op(w))
+				continue
+			}
+			if stepping {
+				nextSet = append(nextSet, stepNumber(w, steps)...)
+				continue
+			}
+			switch rule {
+			case "restore-case", "--restore-case":
+				nextSet = append(nextSet, restoreCase(w, source))
+			case "strip", "strip-spaces":
+				nextSet = append(nextSet, strings.Join(strings.Fields(w), ""))
+			case "strip-digits":
+				nextSet = append(nextSet, strings.Map(dropIf(unicode.IsDigit), w))
+			case "strip-symbols":
+				nextSet = append(nextSet, strings.Map(dropIf(isSymbol), w))
+			case "-r", "--reverse", "reverse":
+				nextSet = append(nextSet, reverseString(w))
+			case "-u", "--upper", "--uppercase", "upper", "uppercase":
+				nextSet = append(nextSet, strings.ToUpper(w))
+			case "-l", "--lower", "--lowercase", "lower", "lowercase":
+				nextSet = append(nextSet, strings.ToLower(w))
+			case "-s", "--swap", "--swapcase", "swap", "swapcase":
+				nextSet = append(nextSet, swapCase(w))
+			case "-c", "--capital", "--capitalize", "capital", "capitalize":
+				nextSet = append(nextSet, capitalize(w))
+			case "-d", "--double", "double":
+				nextSet = append(nextSet, w+w)
+			case "-t", "--leet", "leet":
+				swapped := w
+				for _, char := range leetKeys {
+					if reps := leetMap[char]; len(reps) > 0 {
+						swapped = strings.ReplaceAll(swapped, string(char), string(reps[0]))
+					}
+				}
+				nextSet = append(nextSet, swapped)
+			default:
+				nextSet = append(nextSet, w)
+			}
+		}
+		current = nextSet
+	}
+	return current
+}
+
+// wordLen measures a word according to --length-mode
+func (c *Config) wordLen(s string) int {
+	if c.lengthMode == "bytes" {
+		return len(s)
+	}
+	return utf8.RuneCountInString(s)
+}
+
+// fitDigits is the filler of --fit-strategy pad-digits: the ascending run
+// people type to stretch a password to the required length
+const fitDigits = "1234567890"
+
+// fitToLength coerces a candidate to exactly --fit-length characters:
+// longer ones are cut, shorter ones padded with the --fit-strategy filler
+// (repeated as needed). It reports false when the candidate cannot fit,
+// i.e. it is too short under truncate.
+func (c *Config) fitToLength(word string) (string, bool) {
+	byteLen := c.lengthMode == "bytes"
+	word = cutToLength(word, c.fitLength, byteLen)
+	if need := c.fitLength - c.wordLen(word); need > 0 {
+		if c.fitPad == "" {
+			return "", false
+		}
+		word += cutToLength(strings.Repeat(c.fitPad, need), need, byteLen)
+	}
+	return word, c.wordLen(word) == c.fitLength
+}
+
+// cutToLength returns the longest prefix of s of at most n runes (or bytes,
+// without splitting a rune)
+func cutToLength(s string, n int, byteLen bool) string {
+	count := 0
+	for i := range s {
+		size := 1
+		if byteLen {
+			_, size = utf8.DecodeRuneInString(s[i:])
+		}
+		if count+size > n {
+			return s[:i]
+		}
+		count += size
+	}
+	return s
+}
+
+// hashLimits describes which candidates a hash format can tell apart
+type hashLimits struct {
+	significant int  // Bytes the hash reads; longer candidates are cut (0 = all)
+	minLen      int  // Shorter candidates cannot be the secret
+	maxLen      int  // Longer candidates cannot be hashed (0 = no limit)
+	ascii       bool // Only 7-bit ASCII survives hashing
+	lm          bool // Uppercased and hashed as two 7-character halves
+	whole       bool // LM: also write the halves recombined (--lm-mode)
+}
+
+// lmMaxLength is the longest password LM hashes; it does so in two halves
+// of lmHalf characters
+const (
+	lmMaxLength = 14
+	lmHalf      = 7
+)
+
+// hashFormats are the --for-hash formats
+var hashFormats = map[string]hashLimits{
+	"ntlm":     {maxLen: 256},
+	"lm":       {significant: lmMaxLength, ascii: true, lm: true},
+	"descrypt": {significant: 8, ascii: true},
+	"bcrypt":   {significant: 72},
+	"wpa2":     {minLen: wpaMinLength, maxLen: wpaMaxLength, ascii: true},
+}
+
+// lmRecombine turns cracked LM halves into the uppercase passwords they
+// can form: every half on its own (passwords of up to 7 characters) and
+// every full 7-character first half followed by each half. Mangling the
+// result with --all-cases or --toggle-variations gives NT candidates.
+func lmRecombine(words []string) []string {
+	var halves, firsts []string
+	seen := make(map[string]struct{})
+	for _, w := range words {
+		w = strings.ToUpper(w)
+		if _, dup := seen[w]; dup || len(w) > lmHalf || !isPrintableASCII(w) {
+			continue
+		}
+		seen[w] = struct{}{}
+		halves = append(halves, w)
+		if len(w) == lmHalf {
+			firsts = append(firsts, w)
+		}
+	}
+	res := halves
+	for _, first := range firsts {
+		for _, second := range halves {
+			res = append(res, first+second)
+		}
+	}
+	return res
+}
+
+// shapes reports whether shape changes candidates
+func (m *Mangler) shapes() bool {
+	return m.forHash != nil || m.config.fitLength > 0 || m.config.maxBytes > 0
+}
+
+// shape applies --for-hash, --fit-length and --max-bytes to a candidate
+// and passes on what is left of it: nothing, one candidate or, for LM, both
+// halves.
+// Candidates that only differ beyond what the hash reads come out the same
+// and are deduplicated downstream.
+func (m *Mangler) shape(word string, fn func(string)) {
+	if h := m.forHash; h != nil {
+		if h.ascii {
+			for i := 0; i < len(word); i++ {
+				if word[i] >= utf8.RuneSelf {
+					return
+				}
+			}
+		}
+		if h.lm {
+			word = strings.ToUpper(word)
+		}
+		if h.significant > 0 {
+			word = cutToLength(word, h.significant, true)
+		}
+		if n := utf8.RuneCountInString(word); n < h.minLen || (h.maxLen > 0 && n > h.maxLen) {
+			return
+		}
+		if h.lm && len(word) > lmHalf {
+			if h.whole {
+				m.fit(word, fn)
+			}
+			m.fit(word[:lmHalf], fn)
+			word = word[lmHalf:]
+		}
+	}
+	m.fit(word, fn)
+}
+
+// fit applies --fit-length and then --max-bytes, if set
+func (m *Mangler) fit(word string, fn func(string)) {
+	if m.config.fitLength > 0 {
+		var ok bool
+		if word, ok = m.config.fitToLength(word); !ok {
+			return
+		}
+	}
+	if max := m.config.maxBytes; max > 0 && len(word) > max {
+		m.overBytes.Add(1)
+		if m.config.maxBytesAction != "truncate" {
+			return
+		}
+		word = cutToLength(word, max, true)
+	}
+	fn(word)
+}
+
+func (m *Mangler) writeWord(word string) {
+	if m.shapes() {
+		m.shape(word, m.writeShaped)
+		return
+	}
+	m.writeShaped(word)
+}
+
+func (m *Mangler) writeShaped(word string) {
+	if m.outputSink().keep(word) {
+		if m.control != nil {
+			m.control.pace()
+		}
+		m.accept(word)
+	}
+}
+
+// sink receives the candidates of one pipeline stage. keep is the stage's
+// filter, called concurrently by the workers; add is called with Mangler.mu
+// held, for candidates that passed the global dedup; close writes anything
+// the sink held back.
+type sink interface {
+	keep(word string) bool
+	add(word string, from origin)
+	close()
+}
+
+// outputSink returns the output sink, creating it for --sort and --window
+// on first use. process hands the workers the sink of the current stage;
+// this one never changes once created.
+func (m *Mangler) outputSink() sink {
+	if m.sink == nil {
+		var less func(a, b sinkWord) bool
+		switch m.config.sortMode {
+		case "e":
+			less = weightedEfficacyLess
+		case "a":
+			less = func(a, b sinkWord) bool { return a.word < b.word }
+		case "source-then-efficacy":
+			less = m.sourceLess
+		}
+		switch {
+		case m.config.sortMode == "":
+			m.sink = &writerSink{m: m}
+		case m.window > 0 && less != nil:
+			m.sink = &windowSink{m: m, less: less, size: m.window}
+		default:
+			m.sink = &collectSink{m: m, less: less}
+		}
+	}
+	return m.sink
+}
+
+// writerSink deduplicates candidates and streams them to the output
+type writerSink struct {
+	m *Mangler
+}
+
+func (s *writerSink) keep(word string) bool { return s.m.passesFilters(word) }
+
+func (s *writerSink) add(word string, from origin) { s.m.emit(word, from) }
+
+func (s *writerSink) close() {}
+
+// collectSink holds candidates until close, which sorts them for --sort
+// and writes them out
+type collectSink struct {
+	m     *Mangler
+	less  func(a, b sinkWord) bool // nil keeps the generation order
+	words []sinkWord
+}
+
+func (s *collectSink) keep(word string) bool { return s.m.passesFilters(word) }
+
+func (s *collectSink) add(word string, from origin) { s.words = append(s.words, sinkWord{word, from}) }
+
+func (s *collectSink) close() {
+	if s.m.keepsMaxWeight() {
+		for i, w := range s.words {
+			s.words[i].from = s.m.maxWeight(w.word, w.from)
+		}
+	}
+	if s.less != nil {
+		sort.Slice(s.words, func(i, j int) bool { return s.less(s.words[i], s.words[j]) })
+	}
+	for _, w := range s.words {
+		s.m.emit(w.word, w.from)
+	}
+	s.words = nil
+}
+
+// windowSink keeps the best --window candidates in a heap and writes the
+// best one whenever a new candidate overflows it. The output is only ordered
+// within the window, but memory stays bounded on any keyspace.
+type windowSink struct {
+	m     *Mangler
+	less  func(a, b sinkWord) bool
+	size  int
+	words []sinkWord
+	pos   map[string]int // Heap index of each word, when weights can rise
+}
+
+func (s *windowSink) Len() int           { return len(s.words) }
+func (s *windowSink) Less(i, j int) bool { return s.less(s.words[i], s.words[j]) }
+func (s *windowSink) Swap(i, j int) {
+	s.words[i], s.words[j] = s.words[j], s.words[i]
+	if s.pos != nil {
+		s.pos[s.words[i].word], s.pos[s.words[j].word] = i, j
+	}
+}
+func (s *windowSink) Push(x any) {
+	w := x.(sinkWord)
+	if s.pos != nil {
+		s.pos[w.word] = len(s.words)
+	}
+	s.words = append(s.words, w)
+}
+func (s *windowSink) Pop() any {
+	w := s.words[len(s.words)-1]
+	s.words = s.words[:len(s.words)-1]
+	delete(s.pos, w.word)
+	return w
+}
+
+func (s *windowSink) keep(word string) bool { return s.m.passesFilters(word) }
+
+func (s *windowSink) add(word string, from origin) {
+	if s.m.keepsMaxWeight() {
+		if s.pos == nil {
+			s.pos = make(map[string]int)
+		}
+		from = s.m.maxWeight(word, from)
+	}
+	heap.Push(s, sinkWord{word, from})
+	if len(s.words) > s.size {
+		w := heap.Pop(s).(sinkWord)
+		s.m.emit(w.word, w.from)
+	}
+}
+
+// raise moves a held candidate up for the higher weight of a duplicate
+func (s *windowSink) raise(word string, weight float64) {
+	if i, ok := s.pos[word]; ok && weight > s.words[i].from.weight {
+		s.words[i].from.weight = weight
+		heap.Fix(s, i)
+	}
+}
+
+func (s *windowSink) close() {
+	for len(s.words) > 0 {
+		w := heap.Pop(s).(sinkWord)
+		s.m.emit(w.word, w.from)
+	}
+}
+
+// poolSink gathers passphrase components. Only --component-len applies to
+// them; the output filters check the joined phrases.
+type poolSink struct {
+	min, max int // 0 = open
+	cfg      *Config
+	words    []string
+}
+
+func (s *poolSink) keep(word string) bool {
+	n := s.cfg.wordLen(word)
+	return n > 0 && (s.min == 0 || n >= s.min) && (s.max == 0 || n <= s.max)
+}
+
+func (s *poolSink) add(word string, _ origin) { s.words = append(s.words, word) }
+
+func (s *poolSink) close() {}
+
+// passesFilters applies the length, exclusion, composition, crunch,
+// blacklist and strength filters
+func (m *Mangler) passesFilters(word string) bool {
+	wordLen := m.config.wordLen(word)
+	if m.config.minLength > 0 && wordLen < m.config.minLength {
+		return false
+	}
+	if m.config.maxLength > 0 && wordLen > m.config.maxLength {
+		return false
+	}
+
+	if m.config.wifi && !isPrintableASCII(word) {
+		return false
+	}
+
+	// Exclusion Filters
+	if m.config.noNumbers || m.config.noSymbols || m.config.noCapitals {
+		for _, r := range word {
+			if m.config.noNumbers && r >= '0' && r <= '9' {
+				return false
+			}
+			if m.config.noCapitals && r >= 'A' && r <= 'Z' {
+				return false
+			}
+			if m.config.noSymbols && !((r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')) {
+				return false
+			}
+		}
+	}
+
+	if m.config.hasCompositionFilters() && !m.config.passesComposition(word) {
+		return false
+	}
+
+	if m.config.crunchFilter != "" && !m.matchesCrunch(word) {
+		return false
+	}
+	if (m.config.crunchPrefix != "" || m.config.crunchSuffix != "") && !m.config.matchesCrunchAnchors(word) {
+		return false
+	}
+
+	// Blacklist Check
+	if m.blacklistedWords != nil {
+		if _, exists := m.blacklistedWords[word]; exists {
+			return false
+		}
+	}
+
+	// Strength Filter
+	if m.config.minStrength > 0 {
+		if m.dict.strength(word, wordLen) < m.config.minStrength {
+			return false
+		}
+	}
+
+	return true
+}
+
+// warmStart writes the first n builtin:top-passwords, shaped like any other
+// candidate and if they pass the output filters, ahead of the sorting,
+// sampling and shuffling stages. They are marked seen so the mangled
+// candidates do not repeat them.
+func (m *Mangler) warmStart(n int) error {
+	r, err := openBuiltinList("top-passwords")
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("warm start: %w", err)
+	}
+	words := strings.Fields(string(data))
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, w := range words[:min(n, len(words))] {
+		m.shape(w, func(w string) {
+			if m.passesFilters(w) && m.firstSeen(w) {
+				m.emitRecord(w, "", []string{"warm-start"}, noOrigin)
+			}
+		})
+	}
+	return nil
+}
+
+// accept hands a filtered candidate to the output sink
+func (m *Mangler) accept(word string) {
+	m.acceptInto(m.outputSink(), word, noOrigin)
+}
+
+// acceptInto hands a filtered candidate to the given stage's sink.
+// Duplicates are rejected before taking m.mu, so they never wait on the
+// output.
+func (m *Mangler) acceptInto(to sink, word string, from origin) {
+	if m.limits.stopped.Load() {
+		return
+	}
+	if m.keepsMaxWeight() {
+		m.dedupWeighted(to, word, from, m.write)
+		return
+	}
+	if m.firstSeen(word) {
+		m.write(to, word, from)
+	}
+}
+
+// keepsMaxWeight reports whether a candidate sorts by the highest --file
+// weight of all the inputs it came from: --sort e on weighted inputs, with
+// a shared dedup set
+func (m *Mangler) keepsMaxWeight() bool {
+	return m.weights != nil && m.config.sortMode == "e" && (m.config.dedupScope == "global" || m.config.dedupScope == "worker")
+}
+
+// maxWeighter is a sink that can move a candidate it holds when a
+// duplicate raises the candidate's weight
+type maxWeighter interface {
+	raise(word string, weight float64)
+}
+
+// dedupWeighted passes a new candidate to write and, for a duplicate that
+// came with a higher weight, raises the weight the sink holds. The sinks
+// also read the recorded weight back, in case the raise wins the race
+// with the write.
+func (m *Mangler) dedupWeighted(to sink, word string, from origin, write func(sink, string, origin)) {
+	added, raised := m.seen.addFrom(crc32.ChecksumIEEE([]byte(word)), from.weight)
+	switch {
+	case added:
+		write(to, word, from)
+	case raised:
+		if r, ok := to.(maxWeighter); ok {
+			m.mu.Lock()
+			r.raise(word, from.weight)
+			m.mu.Unlock()
+		}
+	}
+}
+
+// maxWeight returns from with the highest weight recorded for word
+func (m *Mangler) maxWeight(word string, from origin) origin {
+	if m.keepsMaxWeight() {
+		if w, ok := m.seen.weight(crc32.ChecksumIEEE([]byte(word))); ok && w > from.weight {
+			from.weight = w
+		}
+	}
+	return from
+}
+
+// write hands an accepted candidate to a sink
+func (m *Mangler) write(to sink, word string, from origin) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.limits.stopped.Load() {
+		return
+	}
+	to.add(word, from)
+}
+
+// acceptRecord is accept for --output-format jsonl, which only streams:
+// the candidate is deduplicated and written along with its provenance
+func (m *Mangler) acceptRecord(word, source string, rules []string, from origin) {
+	if m.limits.stopped.Load() || !m.firstSeen(word) {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.limits.stopped.Load() {
+		return
+	}
+	m.emitRecord(word, source, rules, from)
+}
+
+// firstSeen reports whether word has not been accepted before. It is safe
+// for concurrent use. Without global dedup every candidate counts as new.
+func (m *Mangler) firstSeen(word string) bool {
+	if m.config.dedupScope == "worker" || m.config.dedupScope == "word" || m.config.dedupScope == "none" {
+		return true
+	}
+	return m.seen.add(crc32.ChecksumIEEE([]byte(word)))
+}
+
+// dedupShards is the number of independently locked parts of a dedupSet
+const dedupShards = 64
+
+// dedupSet is the global set of accepted candidate CRCs. It is split into
+// shards with a lock each, so workers checking candidates contend neither
+// with each other nor with the output, which Mangler.mu guards.
+type dedupSet struct {
+	shards [dedupShards]struct {
+		mu      sync.Mutex
+		crcs    map[uint32]struct{}
+		weights map[uint32]float64 // Used instead of crcs by addFrom
+	}
+}
+
+func newDedupSet() *dedupSet {
+	d := &dedupSet{}
+	for i := range d.shards {
+		d.shards[i].crcs = make(map[uint32]struct{})
+	}
+	return d
+}
+
+// add records crc and reports whether it is new
+func (d *dedupSet) add(crc uint32) bool {
+	s := &d.shards[crc%dedupShards]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.crcs[crc]; exists {
+		return false
+	}
+	s.crcs[crc] = struct{}{}
+	return true
+}
+
+// addFrom records crc with the highest weight it has come with. It reports
+// whether crc is new and, if not, whether weight raised the recorded one.
+func (d *dedupSet) addFrom(crc uint32, weight float64) (added, raised bool) {
+	s := &d.shards[crc%dedupShards]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.weights == nil {
+		s.weights = make(map[uint32]float64)
+	}
+	w, exists := s.weights[crc]
+	if !exists || weight > w {
+		s.weights[crc] = weight
+	}
+	return !exists, exists && weight > w
+}
+
+// weight returns the highest weight addFrom recorded for crc
+func (d *dedupSet) weight(crc uint32) (float64, bool) {
+	s := &d.shards[crc%dedupShards]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := s.weights[crc]
+	return w, ok
+}
+
+// charClassCounts holds per-class character counts of a word
+type charClassCounts struct {
+	lower, upper, digits, symbols int
+	maxRun                        int // Longest run of the same character
+}
+
+func (c charClassCounts) classes() int {
+	n := 0
+	for _, v := range []int{c.lower, c.upper, c.digits, c.symbols} {
+		if v > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func countCharClasses(s string) charClassCounts {
+	var c charClassCounts
+	var prev rune
+	run := 0
+	for i, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z':
+			c.lower++
+		case r >= 'A' && r <= 'Z':
+			c.upper++
+		case r >= '0' && r <= '9':
+			c.digits++
+		default:
+			c.symbols++
+		}
+		if i > 0 && r == prev {
+			run++
+		} else {
+			run = 1
+		}
+		if run > c.maxRun {
+			c.maxRun = run
+		}
+		prev = r
+	}
+	return c
+}
+
+func (c *Config) hasCompositionFilters() bool {
+	return c.minDigits > 0 || c.maxDigits > 0 || c.minUpper > 0 || c.maxUpper > 0 ||
+		c.minLower > 0 || c.maxLower > 0 || c.minSymbols > 0 || c.maxSymbols > 0 ||
+		c.minClasses > 0 || c.maxRepeat > 0
+}
+
+// passesComposition checks the --min-*/--max-* character-class filters
+func (c *Config) passesComposition(word string) bool {
+	cc := countCharClasses(word)
+	within := func(v, min, max int) bool {
+		return v >= min && (max == 0 || v <= max)
+	}
+	return within(cc.digits, c.minDigits, c.maxDigits) &&
+		within(cc.upper, c.minUpper, c.maxUpper) &&
+		within(cc.lower, c.minLower, c.maxLower) &&
+		within(cc.symbols, c.minSymbols, c.maxSymbols) &&
+		cc.classes() >= c.minClasses &&
+		(c.maxRepeat == 0 || cc.maxRun <= c.maxRepeat)
+}
+
+// calculateStrength scores a password from 0 to 4 against the embedded
+// dictionary, measuring length in runes
+func calculateStrength(s string) int {
+	return defaultDictionary().strength(s, utf8.RuneCountInString(s))
+}
+
+// strength scores s using an externally measured length n
+func (d *wordDict) strength(s string, n int) int {
+	if n == 0 {
+		return 0
+	}
+	score := 0
+
+	// Criteria based on common complexity standards
+	hasLower := false
+	hasUpper := false
+	hasNumber := false
+	hasSpec := false
+
+	for _, r := range s {
+		if r >= 'a' && r <= 'z' {
+			hasLower = true
+		}
+		if r >= 'A' && r <= 'Z' {
+			hasUpper = true
+		}
+		if r >= '0' && r <= '9' {
+			hasNumber = true
+		}
+		if !((r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')) {
+			hasSpec = true
+		}
+	}
+
+	if hasLower {
+		score++
+	}
+	if hasUpper {
+		score++
+	}
+	if hasNumber {
+		score++
+	}
+	if hasSpec {
+		score++
+	}
+
+	// Length bonus
+	if n < 8 {
+		if score > 2 {
+			score = 2 // Cap weak short passwords
+		} else {
+			score--
+		}
+	}
+	if n >= 12 {
+		score++
+	}
+
+	// A dictionary word with trivial decorations is weak whatever its classes
+	if score > 1 {
+		if _, ok := d.base(s); ok {
+			score = 1
+		}
+	}
+
+	if score < 0 {
+		score = 0
+	}
+	if score > 4 {
+		score = 4
+	}
+	return score
+}
+
+//go:embed dictionary.txt
+var embeddedDictionary string
+
+// wordDict is the set of base words strength scoring sees through
+// decorations: the embedded list, plus the words of a --dict file for the
+// run that loaded it. Lookups are cached per word, in shards like dedupSet.
+// A nil *wordDict is the embedded dictionary.
+type wordDict struct {
+	words map[string]struct{}
+	cache [dictShards]struct {
+		mu    sync.Mutex
+		bases map[string]dictMatch
+	}
+}
+
+// dictMatch is a cached base lookup
+type dictMatch struct {
+	base string
+	ok   bool
+}
+
+// dictShards is the number of independently locked parts of the lookup
+// cache; a part holding dictCacheSize words is emptied before it grows
+const (
+	dictShards    = 64
+	dictCacheSize = 4096
+)
+
+var (
+	dictOnce    sync.Once
+	builtinDict *wordDict
+)
+
+// defaultDictionary returns the embedded dictionary, loading it on first use
+func defaultDictionary() *wordDict {
+	dictOnce.Do(func() {
+		builtinDict = &wordDict{words: make(map[string]struct{})}
+		addDictionaryWords(builtinDict.words, strings.NewReader(embeddedDictionary))
+	})
+	return builtinDict
+}
+
+func addDictionaryWords(dict map[string]struct{}, r io.Reader) error {
+	l := &wordLoader{maxLineLen: defaultMaxLineLen, commentPrefix: "#"}
+	words, err := l.load(r)
+	for _, w := range words {
+		if len(w) >= 3 {
+			dict[strings.ToLower(w)] = struct{}{}
+		}
+	}
+	return err
+}
+
+// builtinPrefix selects an embedded list wherever a wordlist path is taken,
+// e.g. -f builtin:eff-long --passphrase 5
+const builtinPrefix = "builtin:"
+
+//go:embed wordlists
+var builtinFiles embed.FS
+
+// builtinLists are the lists builtin:<name> can select. Each file must be
+// in wordlists/; TestBuiltinLists opens every entry.
+var builtinLists = []struct {
+	name, file, desc string
+}{
+	{"common", "", "base words of the most common passwords (the scoring dictionary)"},
+	{"eff-long", "wordlists/eff_large_wordlist.txt", "EFF long diceware list, 7776 words"},
+	{"eff-short", "wordlists/eff_short_wordlist_2_0.txt", "EFF short diceware list 2.0, 1296 words"},
+	{"en-freq", "wordlists/en_frequency.txt", "English words, most frequent first"},
+	{"top-passwords", "wordlists/top_passwords.txt", "1000 most common leaked passwords, most frequent first"},
+}
+
+// builtinListNames lists the names builtin:<name> accepts
+func builtinListNames() []string {
+	names := make([]string, len(builtinLists))
+	for i, l := range builtinLists {
+		names[i] = l.name
+	}
+	return names
+}
+
+// openBuiltinList returns the words of an embedded list, one per line
+func openBuiltinList(name string) (io.Reader, error) {
+	for _, l := range builtinLists {
+		if l.name != name {
+			continue
+		}
+		if l.file == "" {
+			return strings.NewReader(embeddedDictionary), nil
+		}
+		data, err := builtinFiles.ReadFile(l.file)
+		if err != nil {
+			return nil, fmt.Errorf("built-in list %q: %w", name, err)
+		}
+		return strings.NewReader(listWords(string(data))), nil
+	}
+	return nil, fmt.Errorf("unknown built-in list %q (use %s)", name, strings.Join(builtinListNames(), ", "))
+}
+
+// listWords reduces a published list to one word per line: dice roll
+// columns (11111<TAB>abacus) and trailing counts (the 2313584) are dropped,
+// so diceware and frequency lists can be embedded as is
+func listWords(data string) string {
+	isNumber := func(s string) bool { return strings.Trim(s, "0123456789") == "" }
+	var sb strings.Builder
+	for _, line := range strings.Split(data, "\n") {
+		f := strings.Fields(line)
+		switch {
+		case len(f) == 0 || strings.HasPrefix(f[0], "#"):
+			continue
+		case len(f) == 2 && isNumber(f[0]):
+			sb.WriteString(f[1])
+		case len(f) == 2 && isNumber(f[1]):
+			sb.WriteString(f[0])
+		default:
+			sb.WriteString(strings.TrimSpace(line))
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// freqRanks maps lowercase words of a --freq-list to their rank, 0 being
+// the most frequent; nil when no list was given
+var freqRanks map[string]int
+
+// loadFrequencyList reads a --freq-list, ignoring count columns. It must
+// run before any scoring starts.
+func loadFrequencyList(path string) error {
+	f, err := openInput(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	words := strings.Split(strings.TrimSuffix(listWords(string(data)), "\n"), "\n")
+	freqRanks = make(map[string]int, len(words))
+	for _, w := range words {
+		w = strings.ToLower(w)
+		if _, ok := freqRanks[w]; !ok && w != "" {
+			freqRanks[w] = len(freqRanks)
+		}
+	}
+	return nil
+}
+
+// frequencyWeight scales efficacy by how common the candidate's base word
+// is: from 2 for the most frequent word of the --freq-list down to 1 for
+// words not on it
+func frequencyWeight(s string) float64 {
+	if len(freqRanks) == 0 {
+		return 1
+	}
+	base := strings.ToLower(strings.TrimFunc(s, func(r rune) bool { return !unicode.IsLetter(r) }))
+	rank, ok := freqRanks[base]
+	if !ok {
+		return 1
+	}
+	return 2 - float64(rank)/float64(len(freqRanks))
+}
+
+// loadDictionary returns the embedded dictionary extended with the words of
+// a --dict file
+func loadDictionary(path string) (*wordDict, error) {
+	f, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	d := &wordDict{words: maps.Clone(defaultDictionary().words)}
+	if err := addDictionaryWords(d.words, f); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Leet undo tables; '1' is tried as both i and l
+var (
+	unleetI = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s")
+	unleetL = strings.NewReplacer("0", "o", "1", "l", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s")
+)
+
+// dictionaryBase reports the embedded dictionary word s is built on, if any
+func dictionaryBase(s string) (string, bool) {
+	return defaultDictionary().base(s)
+}
+
+// base reports the dictionary word s is built on, if any: the word plus
+// trivial decorations such as capitalisation, simple leet and leading or
+// trailing digits and symbols (Password123!, P@ssw0rd, 2024Summer)
+func (d *wordDict) base(s string) (string, bool) {
+	if d == nil {
+		d = defaultDictionary()
+	}
+	shard := &d.cache[crc32.ChecksumIEEE([]byte(s))%dictShards]
+	shard.mu.Lock()
+	m, hit := shard.bases[s]
+	shard.mu.Unlock()
+	if hit {
+		return m.base, m.ok
+	}
+	m.base, m.ok = d.lookup(s)
+	shard.mu.Lock()
+	if shard.bases == nil || len(shard.bases) >= dictCacheSize {
+		shard.bases = make(map[string]dictMatch)
+	}
+	// The key may point into an --mmap input, which the cache outlives
+	shard.bases[strings.Clone(s)] = m
+	shard.mu.Unlock()
+	return m.base, m.ok
+}
+
+func (d *wordDict) lookup(s string) (string, bool) {
+	dict := d.words
+	isDecor := func(r rune) bool { return !unicode.IsLetter(r) }
+	for _, core := range []string{strings.TrimRightFunc(s, isDecor), strings.TrimFunc(s, isDecor)} {
+		if len(core) < 3 {
+			continue
+		}
+		core = strings.ToLower(core)
+		for _, r := range []*strings.Replacer{unleetI, unleetL} {
+			w := r.Replace(core)
+			if _, ok := dict[w]; ok {
+				return w, true
+			}
+		}
+	}
+	return "", false
+}
+
+// crunchMask is a single parsed --crunch mask with optional length bounds
+type crunchMask struct {
+	pattern string
+	minLen  int
+	maxLen  int // 0 means unbounded
+}
+
+// parseCrunchMasks parses a comma-separated list of masks. Each mask may end
+// in a ":min-max" length modifier (e.g. "*##:8-10", "^*:8-", "*!:-12"); a
+// ':' followed by anything but a digit or '-' is a literal mask character.
+func parseCrunchMasks(spec string) ([]crunchMask, error) {
+	var masks []crunchMask
+	for _, part := range strings.Split(spec, ",") {
+		if part == "" {
+			continue
+		}
+		cm := crunchMask{pattern: part}
+		if idx := strings.LastIndex(part, ":"); idx >= 0 && idx+1 < len(part) && strings.ContainsRune("0123456789-", rune(part[idx+1])) {
+			lo, hi, ok := parseLengthRange(part[idx+1:])
+			if !ok {
+				return nil, fmt.Errorf("invalid --crunch mask %q: bad length %q (use N, N-, -M or N-M)", part, part[idx+1:])
+			}
+			cm.pattern = part[:idx]
+			cm.minLen, cm.maxLen = lo, hi
+		}
+		masks = append(masks, cm)
+	}
+	return masks, nil
+}
+
+// parseLengthRange parses "N", "N-M", "N-" or "-M"
+func parseLengthRange(s string) (int, int, bool) {
+	num := func(s string) (int, bool) {
+		if s == "" {
+			return 0, true
+		}
+		n, err := strconv.Atoi(s)
+		return n, err == nil && n >= 0 && s[0] != '+'
+	}
+	lo, hi, ranged := strings.Cut(s, "-")
+	if !ranged {
+		n, ok := num(s)
+		return n, n, ok && s != ""
+	}
+	l, lok := num(lo)
+	h, hok := num(hi)
+	if !lok || !hok || s == "-" || (h > 0 && l > h) {
+		return 0, 0, false
+	}
+	return l, h, true
+}
+
+func (c crunchMask) matches(s string, byteMode bool) bool {
+	su, pu := crunchUnits(s, byteMode), crunchUnits(c.pattern, byteMode)
+	if c.minLen > 0 && len(su) < c.minLen {
+		return false
+	}
+	if c.maxLen > 0 && len(su) > c.maxLen {
+		return false
+	}
+	return matchCrunchPattern(pu, su)
+}
+
+// crunchUnits splits s into the units a mask position stands for: runes,
+// or single bytes in --length-mode bytes
+func crunchUnits(s string, byteMode bool) []rune {
+	if !byteMode {
+		return []rune(s)
+	}
+	units := make([]rune, len(s))
+	for i := 0; i < len(s); i++ {
+		units[i] = rune(s[i])
+	}
+	return units
+}
+
+func (m *Mangler) matchesCrunch(s string) bool {
+	byteMode := m.config.lengthMode == "bytes"
+	for _, cm := range m.crunchMasks {
+		if cm.matches(s, byteMode) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesCrunchAnchors applies --crunch-prefix and --crunch-suffix. Each is
+// a comma-separated list of masks matched position by position against the
+// start or end of the word, whatever its length; one mask of each must match.
+func (c *Config) matchesCrunchAnchors(s string) bool {
+	byteMode := c.lengthMode == "bytes"
+	su := crunchUnits(s, byteMode)
+	anchored := func(spec string, atEnd bool) bool {
+		if spec == "" {
+			return true
+		}
+		for _, mask := range strings.Split(spec, ",") {
+			pu := crunchUnits(mask, byteMode)
+			if mask == "" || len(pu) > len(su) {
+				continue
+			}
+			off := 0
+			if atEnd {
+				off = len(su) - len(pu)
+			}
+			ok := true
+			for i, f := range pu {
+				if !crunchCharMatches(f, su[off+i]) {
+					ok = false
+					break
+				}
+			}
+			if ok {
+				return true
+			}
+		}
+		return false
+	}
+	return anchored(c.crunchPrefix, false) && anchored(c.crunchSuffix, true)
+}
+
+// matchCrunchPattern matches s against a crunch-style pattern where '*'
+// stands for zero or more characters of any kind
+func matchCrunchPattern(p, s []rune) bool {
+	pi, si := 0, 0
+	star, mark := -1, 0
+	for si < len(s) {
+		if pi < len(p) && p[pi] == '*' {
+			star, mark = pi, si
+			pi++
+		} else if pi < len(p) && crunchCharMatches(p[pi], s[si]) {
+			pi++
+			si++
+		} else if star >= 0 {
+			pi = star + 1
+			mark++
+			si = mark
+		} else {
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
+
+func crunchCharMatches(f, c rune) bool {
+	switch f {
+	case '.':
+		return true
+	case '#':
+		return c >= '0' && c <= '9'
+	case '^':
+		return c >= 'A' && c <= 'Z'
+	case '%':
+		return c >= 'a' && c <= 'z'
+	case '&':
+		return !((c >= '0' && c <= '9') || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z'))
+	default:
+		return c == f
+	}
+}
+
+func (m *Mangler) addNumberRange(word string, r string, prefix bool, rule string, res variantSet) {
+	parts := strings.Split(r, "-")
+	if len(parts) != 2 {
+		return
+	}
+	cur := m.config.currentYear()
+	parse := func(s string) int {
+		if strings.ToLower(strings.TrimSpace(s)) == "current" {
+			return cur
+		}
+		var v int
+		fmt.Sscanf(s, "%d", &v)
+		return v
+	}
+	sVal, eVal := parse(parts[0]), parse(parts[1])
+	pad := len(strings.TrimSpace(parts[0]))
+	fmtStr := "%d"
+	if strings.HasPrefix(strings.TrimSpace(parts[0]), "0") || (pad > 1 && sVal < 10) {
+		fmtStr = fmt.Sprintf("%%0%dd", pad)
+	}
+	for i := sVal; i <= eVal; i++ {
+		ns := fmt.Sprintf(fmtStr, i)
+		if prefix {
+			res.add(ns+word, rule)
+		} else {
+			res.add(word+ns, rule)
+		}
+	}
+}
+
+// maxNumeralAffix bounds --ordinals and --roman (roman numerals stop at 3999)
+const maxNumeralAffix = 3999
+
+// numeralAffixes formats every number of an "N-M" range with format, or
+// returns nil for an invalid range
+func numeralAffixes(r string, format func(int) string) []string {
+	lo, hi, ok := parseLengthRange(strings.TrimSpace(r))
+	if !ok || lo < 1 || hi < lo || hi > maxNumeralAffix {
+		return nil
+	}
+	res := make([]string, 0, hi-lo+1)
+	for i := lo; i <= hi; i++ {
+		res = append(res, format(i))
+	}
+	return res
+}
+
+// addAffixes adds word with each affix prepended and appended
+func addAffixes(word string, affixes []string, rule string, res variantSet) {
+	for _, a := range affixes {
+		res.add(a+word, rule)
+		res.add(word+a, rule)
+	}
+}
+
+// ordinal formats n as an English ordinal: 1st, 2nd, 3rd, 4th, 11th, 21st
+func ordinal(n int) string {
+	suffix := "th"
+	if n%100 < 11 || n%100 > 13 {
+		switch n % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return strconv.Itoa(n) + suffix
+}
+
+// romanNumeral formats n (1-3999) in roman numerals
+func romanNumeral(n int) string {
+	values := []int{1000, 900, 500, 400, 100, 90, 50, 40, 10, 9, 5, 4, 1}
+	symbols := []string{"M", "CM", "D", "CD", "C", "XC", "L", "XL", "X", "IX", "V", "IV", "I"}
+	var b strings.Builder
+	for i, v := range values {
+		for n >= v {
+			b.WriteString(symbols[i])
+			n -= v
+		}
+	}
+	return b.String()
+}
+
+func (m *Mangler) generatePermutations(words []string) []string {
+	var res []string
+	sep := ""
+	if m.config.space {
+		sep = " "
+	}
+	for l := 1; l <= len(words); l++ {
+		permuteHelper(words, l, []string{}, &res, sep, m.config.capitalWords)
+	}
+	return res
+}
+
+// permuteHelper appends every ordering of l distinct words. With title set
+// (--capital-words) each multi-word join is also added with every word
+// capitalised, as the boundaries are lost once the words are joined.
+func permuteHelper(words []string, l int, cur []string, res *[]string, sep string, title bool) {
+	if len(cur) == l {
+		*res = append(*res, strings.Join(cur, sep))
+		if title && l > 1 {
+			*res = append(*res, joinCapitalized(cur, sep))
+		}
+		return
+	}
+	for i := 0; i < len(words); i++ {
+		used := false
+		for _, w := range cur {
+			if w == words[i] {
+				used = true
+				break
+			}
+		}
+		if !used {
+			permuteHelper(words, l, append(cur, words[i]), res, sep, title)
+		}
+	}
+}
+
+// maxPunctAffixes bounds the punctuation affixes of one word: they are all
+// held in memory and each is added to every variant, at both ends with
+// --punct-prefix
+const maxPunctAffixes = 100000
+
+// punctAffixCount is the number of affixes punctuationAffixes returns,
+// stopping once it passes maxPunctAffixes
+func punctAffixCount(set string, maxLen int) int {
+	if set == "" {
+		set = defaultPunctSet
+	}
+	n := 0
+	seen := make(map[rune]struct{})
+	for _, r := range set {
+		if _, ok := seen[r]; !ok {
+			seen[r] = struct{}{}
+			n++
+		}
+	}
+	total, level := 0, 1
+	for l := 1; l <= max(maxLen, 1) && total <= maxPunctAffixes; l++ {
+		level *= n
+		total += level
+	}
+	return total
+}
+
+// punctuationAffixes returns every string of length 1..max built from the
+// characters in set (e.g. "!", "!!", "!@" for set "!@" and max 2)
+func punctuationAffixes(set string, max int) []string {
+	if set == "" {
+		set = defaultPunctSet
+	}
+	if max < 1 {
+		max = 1
+	}
+	var chars []string
+	seen := make(map[rune]struct{})
+	for _, r := range set {
+		if _, ok := seen[r]; !ok {
+			seen[r] = struct{}{}
+			chars = append(chars, string(r))
+		}
+	}
+
+	var res []string
+	level := []string{""}
+	for l := 1; l <= max; l++ {
+		var next []string
+		for _, p := range level {
+			for _, c := range chars {
+				next = append(next, p+c)
+			}
+		}
+		res = append(res, next...)
+		level = next
+	}
+	return res
+}
+
+// interleave alternates the characters of a and b, starting with a, and
+// appends the rest of the longer one (cat, 123 -> c1a2t3)
+func interleave(a, b string) string {
+	ra, rb := []rune(a), []rune(b)
+	out := make([]rune, 0, len(ra)+len(rb))
+	for i := 0; i < len(ra) || i < len(rb); i++ {
+		if i < len(ra) {
+			out = append(out, ra[i])
+		}
+		if i < len(rb) {
+			out = append(out, rb[i])
+		}
+	}
+	return string(out)
+}
+
+// interleavePairs zips every ordered pair of distinct input words
+func interleavePairs(words []string) []string {
+	var res []string
+	for i, a := range words {
+		for j, b := range words {
+			if i != j {
+				res = append(res, interleave(a, b))
+			}
+		}
+	}
+	return res
+}
+
+func generateAcronym(words []string) string {
+	var b strings.Builder
+	for _, w := range words {
+		if len(w) > 0 {
+			b.WriteByte(w[0])
+		}
+	}
+	return b.String()
+}
+
+// parseRepeatRange parses --repeat-to: "N", "N..M" or "N-M"
+func parseRepeatRange(s string) (int, int, bool) {
+	return parseLengthRange(strings.Replace(s, "..", "-", 1))
+}
+
+// parseRepeatTo checks --repeat-to and stores its bounds, so addRepeats
+// does not parse it for every word
+func (c *Config) parseRepeatTo() error {
+	c.repeatMin, c.repeatMax = 0, 0
+	if c.repeatTo == "" {
+		return nil
+	}
+	lo, hi, ok := parseRepeatRange(c.repeatTo)
+	if !ok || hi == 0 {
+		return fmt.Errorf("invalid --repeat-to %q (use N or N..M)", c.repeatTo)
+	}
+	c.repeatMin, c.repeatMax = lo, hi
+	return nil
+}
+
+// addRepeats adds word repeated two or more times, on its own and joined by
+// each --repeat-sep character, whenever the result's length is within
+// --repeat-to
+func addRepeats(cfg *Config, word string, res variantSet) {
+	lo, hi := cfg.repeatMin, cfg.repeatMax
+	n := cfg.wordLen(word)
+	if hi == 0 || n == 0 {
+		return
+	}
+	seps := []string{""}
+	for _, r := range cfg.repeatSep {
+		seps = append(seps, string(r))
+	}
+	for _, sep := range seps {
+		sl := cfg.wordLen(sep)
+		for k := 2; k*n+(k-1)*sl <= hi; k++ {
+			if k*n+(k-1)*sl >= lo {
+				res.add(strings.Repeat(word+sep, k-1)+word, "repeat-to")
+			}
+		}
+	}
+}
+
+// rotate shifts ASCII letters n places through the alphabet, keeping their
+// case (ROT13 for n = 13). Other characters are left alone.
+func rotate(s string, n int) string {
+	n = (n%26 + 26) % 26
+	b := []byte(s)
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z':
+			b[i] = 'a' + (c-'a'+byte(n))%26
+		case c >= 'A' && c <= 'Z':
+			b[i] = 'A' + (c-'A'+byte(n))%26
+		}
+	}
+	return string(b)
+}
+
+// ruleOperator returns the parameterized --rules operator named by rule, or
+// nil. Each takes its argument as a suffix, "rot3", or in flag form,
+// "--rot=3":
+//
+//	rot[N]      rotate letters by N (default 13)
+//	adjswapN    swap the characters at positions N and N+1
+//	dupN        duplicate the character at position N
+//	delN        delete the character at position N
+//	leet=PAIRS  replace only the given letters, e.g. leet=a@o0
+//
+// Positions are 1-based; negative ones count from the end (-1 is the last
+// character). A position outside the word leaves it unchanged.
+func ruleOperator(rule string) func(string) string {
+	if shift, ok := parseRotRule(rule); ok {
+		return func(w string) string { return rotate(w, shift) }
+	}
+	if arg, ok := ruleArg(rule, "leet"); ok && arg != "" {
+		pairs := []rune(arg)
+		if len(pairs)%2 != 0 {
+			return nil
+		}
+		var oldnew []string
+		for i := 0; i < len(pairs); i += 2 {
+			from, to := pairs[i], string(pairs[i+1])
+			oldnew = append(oldnew, string(from), to, string(unicode.ToUpper(from)), to)
+		}
+		return strings.NewReplacer(oldnew...).Replace
+	}
+	for name, typo := range map[string]func([]rune, int) []rune{
+		"adjswap": swapAdjacent,
+		"dup":     duplicateAt,
+		"del":     deleteAt,
+	} {
+		arg, ok := ruleArg(rule, name)
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(arg)
+		if err != nil || n == 0 {
+			return nil
+		}
+		return func(w string) string {
+			r := []rune(w)
+			i := n - 1
+			if n < 0 {
+				i = len(r) + n
+			}
+			if i < 0 || i >= len(r) {
+				return w
+			}
+			return string(typo(r, i))
+		}
+	}
+	return nil
+}
+
+// checkRuleSteps rejects a step of a --rules recipe that names a
+// parameterized operator but gives no usable argument, such as del0, dupx
+// or inc-num:0, which would otherwise leave every word unchanged
+func checkRuleSteps(rulesList string) error {
+	if rulesList == "" {
+		return nil
+	}
+	for _, recipe := range strings.Split(rulesList, "\n") {
+		for _, rule := range strings.Split(recipe, ",") {
+			if _, _, ok := affixStep(strings.TrimSpace(rule)); ok {
+				continue
+			}
+			rule = strings.TrimSpace(strings.ToLower(rule))
+			for _, name := range []string{"adjswap", "dup", "del"} {
+				if _, ok := ruleArg(rule, name); ok && ruleOperator(rule) == nil {
+					return fmt.Errorf("invalid --rules step %q: %s needs a nonzero position, e.g. %s2 or %s-1", rule, name, name, name)
+				}
+			}
+			for _, name := range []string{"inc-num", "dec-num"} {
+				if _, ok := ruleArg(rule, name); ok {
+					if _, ok := numberStepRule(rule); !ok {
+						return fmt.Errorf("invalid --rules step %q: %s takes a count of 1 or more, e.g. %s:3", rule, name, name)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// affixStep parses the append=S and prepend=S steps of a --rules recipe.
+// Unlike rule names, S keeps its case.
+func affixStep(rule string) (affix string, prepend, ok bool) {
+	name, affix, found := strings.Cut(rule, "=")
+	if !found {
+		return "", false, false
+	}
+	switch strings.ToLower(strings.TrimPrefix(name, "--")) {
+	case "append":
+		return affix, false, true
+	case "prepend":
+		return affix, true, true
+	}
+	return "", false, false
+}
+
+// ruleArg returns the argument of a "nameARG" or "--name=ARG" rule
+func ruleArg(rule, name string) (string, bool) {
+	rest, ok := strings.CutPrefix(strings.TrimPrefix(rule, "--"), name)
+	if !ok {
+		return "", false
+	}
+	return strings.TrimPrefix(rest, "="), true
+}
+
+// parseRotRule recognizes the rot operators of a --rules recipe: "rot" and
+// "--rot" shift by 13, "rotN" and "--rot=N" by N
+func parseRotRule(rule string) (int, bool) {
+	arg, ok := ruleArg(rule, "rot")
+	if !ok {
+		return 0, false
+	}
+	if arg == "" {
+		return 13, true
+	}
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > 25 {
+		return 0, false
+	}
+	return n, true
+}
+
+// restoreCase merges the casing of source back into word: each letter of
+// source that is upper or lower case sets the case of the matching letter of
+// word. The letters match from where source appears in word ignoring case
+// (after affixes), otherwise from the start (after leet).
+func restoreCase(word, source string) string {
+	w, src := []rune(word), []rune(source)
+	lw, ls := []rune(strings.ToLower(word)), []rune(strings.ToLower(source))
+	offset := 0
+	if len(lw) == len(w) && len(ls) == len(src) {
+		for i := 0; i+len(ls) <= len(lw); i++ {
+			if string(lw[i:i+len(ls)]) == string(ls) {
+				offset = i
+				break
+			}
+		}
+	}
+	for i, r := range src {
+		j := offset + i
+		if j >= len(w) {
+			break
+		}
+		switch {
+		case unicode.IsUpper(r):
+			w[j] = unicode.ToUpper(w[j])
+		case unicode.IsLower(r):
+			w[j] = unicode.ToLower(w[j])
+		}
+	}
+	return string(w)
+}
+
+// dropIf returns a strings.Map function that removes the runes matching f
+func dropIf(f func(rune) bool) func(rune) rune {
+	return func(r rune) rune {
+		if f(r) {
+			return -1
+		}
+		return r
+	}
+}
+
+// isSymbol reports whether r is neither a letter, a digit nor whitespace
+func isSymbol(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r)
+}
+
+// swapAdjacent swaps r[i] and r[i+1], if there is one
+func swapAdjacent(r []rune, i int) []rune {
+	if i+1 < len(r) {
+		r[i], r[i+1] = r[i+1], r[i]
+	}
+	return r
+}
+
+// duplicateAt types r[i] twice
+func duplicateAt(r []rune, i int) []rune {
+	return append(r[:i+1], r[i:]...)
+}
+
+// deleteAt drops r[i]
+func deleteAt(r []rune, i int) []rune {
+	return append(r[:i], r[i+1:]...)
+}
+
+func reverseString(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
+
+func capitalize(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+	r := []rune(s)
+	r[0] = []rune(strings.ToUpper(string(r[0])))[0]
+	return string(r)
+}
+
+// capitalizeTokens capitalises the first letter of every run of letters,
+// so words kept apart by digits, symbols or spaces each start upper case
+// (blue_dog42cat becomes Blue_Dog42Cat). Joins that lost their boundaries
+// are handled where the parts are still known, see joinCapitalized.
+func capitalizeTokens(s string) string {
+	var b strings.Builder
+	prevLetter := false
+	for _, r := range s {
+		isLetter := unicode.IsLetter(r)
+		if isLetter && !prevLetter {
+			r = unicode.ToUpper(r)
+		}
+		prevLetter = isLetter
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// joinCapitalized joins parts with each one capitalised (blue+dog: BlueDog)
+func joinCapitalized(parts []string, sep string) string {
+	title := make([]string, len(parts))
+	for i, p := range parts {
+		title[i] = capitalize(p)
+	}
+	return strings.Join(title, sep)
+}
+
+func swapCase(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= 'a' && r <= 'z' {
+			b.WriteRune(r - 32)
+		} else if r >= 'A' && r <= 'Z' {
+			b.WriteRune(r + 32)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func generateFullLeetVariations(word string) []string {
+	lw := strings.ToLower(word)
+	var sbs []substitution
+	for i, r := range lw {
+		if rps, ok := leetMap[r]; ok {
+			sbs = append(sbs, substitution{i, rps})
+		}
+	}
+	if len(sbs) == 0 {
+		return []string{word}
+	}
+	var res []string
+	generateLeetCombinations([]rune(word), sbs, 0, &res)
+	return res
+}
+
+// leetPositionSet resolves --leet-positions for a word to rune indexes. It
+// returns nil for an unknown position name.
+func leetPositionSet(spec string, word []rune) map[int]bool {
+	set := make(map[int]bool)
+	for _, p := range strings.Split(spec, ",") {
+		switch p = strings.ToLower(strings.TrimSpace(p)); p {
+		case "first":
+			set[0] = true
+		case "last":
+			set[len(word)-1] = true
+		case "vowels":
+			for i, r := range word {
+				if strings.ContainsRune("aeiou", unicode.ToLower(r)) {
+					set[i] = true
+				}
+			}
+		default:
+			n, err := strconv.Atoi(p)
+			if err != nil || n < 1 {
+				return nil
+			}
+			set[n-1] = true
+		}
+	}
+	return set
+}
+
+// positionalLeet returns every combination of leet substitutions limited to
+// the --leet-positions of word, excluding word itself. Only the first
+// substitute of each letter is used unless full is set.
+func positionalLeet(word, positions string, full bool) []string {
+	runes := []rune(word)
+	eligible := leetPositionSet(positions, runes)
+	var sbs []substitution
+	for i, r := range runes {
+		reps := leetMap[unicode.ToLower(r)]
+		if !eligible[i] || len(reps) == 0 {
+			continue
+		}
+		if !full {
+			reps = reps[:1]
+		}
+		sbs = append(sbs, substitution{i, reps})
+	}
+	if len(sbs) == 0 {
+		return nil
+	}
+	var res []string
+	generateLeetCombinations(runes, sbs, 0, &res)
+	return res[1:] // The first combination substitutes nothing
+}
+
+func generateLeetCombinations(w []rune, sbs []substitution, idx int, res *[]string) {
+	if idx == len(sbs) {
+		*res = append(*res, string(w))
+		return
+	}
+	sb := sbs[idx]
+	orig := w[sb.pos]
+	generateLeetCombinations(w, sbs, idx+1, res)
+	for _, r := range sb.chars {
+		w[sb.pos] = r
+		generateLeetCombinations(w, sbs, idx+1, res)
+	}
+	w[sb.pos] = orig
+}
+
+func generateAllCasePermutations(word string) []string {
+	var results []string
+	n := len(word)
+	max := 1 << n
+
+	// Pre-calculate lower and upper runes to avoid repeated calls
+	runes := []rune(word)
+	lowers := make([]rune, n)
+	uppers := make([]rune, n)
+
+	for i, r := range runes {
+		lowers[i] = []rune(strings.ToLower(string(r)))[0]
+		uppers[i] = []rune(strings.ToUpper(string(r)))[0]
+	}
+
+	for i := 0; i < max; i++ {
+		current := make([]rune, n)
+		for j := 0; j < n; j++ {
+			if (i>>j)&1 == 1 {
+				current[j] = uppers[j]
+			} else {
+				current[j] = lowers[j]
+			}
+		}
+		results = append(results, string(current))
+	}
+	return results
+}
+
+func getWordEfficacy(s string) float64 {
+	w := 1.0
+	l := len(s)
+	if v, ok := lengthChances[l]; ok {
+		w *= v
+	} else if l > 24 {
+		w *= 0.0001
+	}
+
+	combo := 0
+	hasLower, hasUpper, hasNumber, hasSpec := false, false, false, false
+	allLower, allUpper, onlyNumbers := true, true, true
+	firstUpper := false
+
+	for i, r := range s {
+		isLower := r >= 'a' && r <= 'z'
+		isUpper := r >= 'A' && r <= 'Z'
+		isNum := r >= '0' && r <= '9'
+		isSpec := !isLower && !isUpper && !isNum
+
+		if isLower {
+			hasLower = true
+			allUpper = false
+			onlyNumbers = false
+		}
+		if isUpper {
+			hasUpper = true
+			allLower = false
+			onlyNumbers = false
+			if i == 0 {
+				firstUpper = true
+			}
+		}
+		if isNum {
+			hasNumber = true
+			allLower = false
+			allUpper = false
+		}
+		if isSpec {
+			hasSpec = true
+			allLower = false
+			allUpper = false
+			onlyNumbers = false
+		}
+	}
+
+	if hasLower && allLower {
+		combo |= MaskAllLower
+	}
+	if hasUpper && allUpper {
+		combo |= MaskAllUpper
+	}
+	if hasLower {
+		combo |= MaskHasLower
+	}
+	if hasUpper {
+		combo |= MaskHasUpper
+	}
+	if hasNumber {
+		combo |= MaskHasNumber
+	}
+	if hasSpec {
+		combo |= MaskHasSpec
+	}
+	if onlyNumbers && hasNumber {
+		combo |= MaskOnlyNumbers
+	}
+	if firstUpper && len(s) > 1 {
+		// Check second char is not upper
+		r2 := []rune(s)[1]
+		if !(r2 >= 'A' && r2 <= 'Z') {
+			combo |= MaskFirstUpper
+		}
+	}
+
+	// Suffix checks
+	if len(s) > 0 {
+		last := s[len(s)-1]
+		if last >= '0' && last <= '9' {
+			combo |= MaskEndsInNumber
+		}
+		if !((last >= 'a' && last <= 'z') || (last >= 'A' && last <= 'Z') || (last >= '0' && last <= '9')) {
+			combo |= MaskEndsInSpec
+		}
+	}
+
+	// Leet check (very simplified: contains digit/spec and then a letter)
+	if (hasNumber || hasSpec) && (hasLower || hasUpper) {
+		combo |= MaskLeet
+	}
+
+	if v, ok := comboChances[combo]; ok {
+		w *= v
+	} else {
+		w *= 0.0001
+	}
+	return w * frequencyWeight(s)
+}
+
+// sampleInfo describes an --analyze --sample-rate run
+type sampleInfo struct {
+	rate       float64
+	population int // Words seen before sampling
+}
+
+// marginOfError is the worst-case 95% confidence half-width, in percentage
+// points, of a proportion estimated from n samples
+func marginOfError(n int) float64 {
+	if n == 0 {
+		return 100
+	}
+	return 1.96 * math.Sqrt(0.25/float64(n)) * 100
+}
+
+func analyzeWordlist(words []string, sample *sampleInfo, dict *wordDict) {
+	total := len(words)
+	var n, sp, u, l int
+	lens := make(map[int]int)
+	strengths := make(map[int]int)
+	bases := make(map[string]int)
+	var totalScore, dictBased int
+
+	rn, rs, ru, rl := regexp.MustCompile(`[0-9]`), regexp.MustCompile(`[^A-Za-z0-9]`), regexp.MustCompile(`[A-Z]`), regexp.MustCompile(`[a-z]`)
+	for _, w := range words {
+		if rn.MatchString(w) {
+			n++
+		}
+		if rs.MatchString(w) {
+			sp++
+		}
+		if ru.MatchString(w) {
+			u++
+		}
+		if rl.MatchString(w) {
+			l++
+		}
+		lens[len(w)]++
+
+		s := dict.strength(w, utf8.RuneCountInString(w))
+		strengths[s]++
+		totalScore += s
+		if base, ok := dict.base(w); ok {
+			dictBased++
+			bases[base]++
+		}
+	}
+	fmt.Printf(tr("\npassmut v%s Analysis Report\n====================================\nTotal words: %d\n"), version, total)
+	if sample != nil {
+		fmt.Printf(tr("Sampled:     %d of %d words (rate %g)\n"), total, sample.population, sample.rate)
+		fmt.Printf(tr("Confidence:  percentages are within ±%.2f points at 95%% confidence;\n"), marginOfError(total))
+		fmt.Printf(tr("             duplicate and reuse counts describe the sample only\n"))
+	}
+	fmt.Printf(tr("Contains lowercase: %d (%.1f%%)\nContains uppercase: %d (%.1f%%)\nContains numbers:   %d (%.1f%%)\nContains specials:  %d (%.1f%%)\n"), l, float64(l)/float64(total)*100, u, float64(u)/float64(total)*100, n, float64(n)/float64(total)*100, sp, float64(sp)/float64(total)*100)
+
+	fmt.Printf(tr("\nStrength Distribution (0-4):\n"))
+	for i := 0; i <= 4; i++ {
+		count := strengths[i]
+		fmt.Printf(tr("  Score %d: %6d (%5.1f%%)\n"), i, count, float64(count)/float64(total)*100)
+	}
+	fmt.Printf(tr("Avg Strength: %.2f / 4.00\n"), float64(totalScore)/float64(total))
+
+	fmt.Printf(tr("\nDictionary-based:   %d (%.1f%%)\n"), dictBased, float64(dictBased)/float64(total)*100)
+	top := make([]string, 0, len(bases))
+	for b := range bases {
+		top = append(top, b)
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if bases[top[i]] != bases[top[j]] {
+			return bases[top[i]] > bases[top[j]]
+		}
+		return top[i] < top[j]
+	})
+	if len(top) > 10 {
+		top = top[:10]
+	}
+	for _, b := range top {
+		fmt.Printf("  %-16s %6d\n", b, bases[b])
+	}
+
+	fmt.Println(tr("\nLength Distribution Chart:"))
+	printASCIIChart(lens, total)
+
+	printEntropyStats(words, dict)
+	printLanguageMix(words)
+}
+
+// chartBar is one labelled bar of an exported chart
+type chartBar struct {
+	label string
+	value int
+}
+
+// chart is a horizontal bar chart written by --charts
+type chart struct {
+	name  string // File name without extension
+	title string
+	bars  []chartBar
+	total int // Denominator for the percentages
+}
+
+// maxChartMasks caps the mask chart to the most common masks
+const maxChartMasks = 15
+
+// analysisCharts builds the length, strength and mask distributions of words
+func analysisCharts(words []string, dict *wordDict) []chart {
+	lens := make(map[int]int)
+	strengths := make(map[int]int)
+	masks := make(map[string]int)
+	for _, w := range words {
+		lens[len(w)]++
+		strengths[dict.strength(w, utf8.RuneCountInString(w))]++
+		masks[passwordMask(w)]++
+	}
+
+	length := chart{name: "length", title: "Length distribution", total: len(words)}
+	ks := make([]int, 0, len(lens))
+	for k := range lens {
+		ks = append(ks, k)
+	}
+	sort.Ints(ks)
+	for _, k := range ks {
+		length.bars = append(length.bars, chartBar{strconv.Itoa(k), lens[k]})
+	}
+
+	strength := chart{name: "strength", title: "Strength distribution (0-4)", total: len(words)}
+	for i := 0; i <= 4; i++ {
+		strength.bars = append(strength.bars, chartBar{strconv.Itoa(i), strengths[i]})
+	}
+
+	mask := chart{name: "masks", title: "Top masks (^ upper, % lower, # digit, & other)", total: len(words)}
+	for m, c := range masks {
+		mask.bars = append(mask.bars, chartBar{m, c})
+	}
+	sort.Slice(mask.bars, func(i, j int) bool {
+		if mask.bars[i].value != mask.bars[j].value {
+			return mask.bars[i].value > mask.bars[j].value
+		}
+		return mask.bars[i].label < mask.bars[j].label
+	})
+	if len(mask.bars) > maxChartMasks {
+		mask.bars = mask.bars[:maxChartMasks]
+	}
+
+	return []chart{length, strength, mask}
+}
+
+// writeCharts renders charts into dir as SVG and/or PNG and returns the
+// paths written
+func writeCharts(dir, format string, charts []chart) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	var exts []string
+	switch format {
+	case "png":
+		exts = []string{"png"}
+	case "both":
+		exts = []string{"svg", "png"}
+	default:
+		exts = []string{"svg"}
+	}
+	var files []string
+	for _, c := range charts {
+		for _, ext := range exts {
+			path := filepath.Join(dir, c.name+"."+ext)
+			f, err := os.Create(path)
+			if err != nil {
+				return files, err
+			}
+			if ext == "png" {
+				err = c.writePNG(f)
+			} else {
+				err = c.writeSVG(f)
+			}
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return files, err
+			}
+			files = append(files, path)
+		}
+	}
+	return files, nil
+}
+
+// Chart geometry shared by the SVG and PNG renderers
+const (
+	chartWidth    = 640
+	chartRow      = 20
+	chartTop      = 40
+	chartCharW    = 8
+	chartMinBarW  = 160
+	chartBarColor = "#4a7ebb"
+)
+
+// chartMaxLabel is the longest label drawn in full; longer ones are cut so
+// that bars keep at least chartMinBarW pixels
+const chartMaxLabel = (chartWidth-20*chartCharW-chartMinBarW)/chartCharW - 2
+
+// chartLabel returns s cut to chartMaxLabel runes, ending in ".." when cut
+func chartLabel(s string) string {
+	r := []rune(s)
+	if len(r) <= chartMaxLabel {
+		return s
+	}
+	return string(r[:chartMaxLabel-2]) + ".."
+}
+
+// layout returns the label column width, the maximum bar width and the
+// largest value
+func (c chart) layout() (labelW, barW, maxV int) {
+	maxLabel := 0
+	for _, b := range c.bars {
+		if n := utf8.RuneCountInString(chartLabel(b.label)); n > maxLabel {
+			maxLabel = n
+		}
+		if b.value > maxV {
+			maxV = b.value
+		}
+	}
+	labelW = (maxLabel + 2) * chartCharW
+	// Leave room for the "count (pct%)" annotation
+	barW = chartWidth - labelW - 20*chartCharW
+	return labelW, barW, maxV
+}
+
+// annotation is the text printed after a bar
+func (c chart) annotation(v int) string {
+	if c.total == 0 {
+		return strconv.Itoa(v)
+	}
+	return fmt.Sprintf("%d (%.1f%%)", v, float64(v)/float64(c.total)*100)
+}
+
+func (c chart) height() int {
+	return chartTop + len(c.bars)*chartRow + 10
+}
+
+func (c chart) writeSVG(w io.Writer) error {
+	labelW, barW, maxV := c.layout()
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="monospace" font-size="13">`+"\n", chartWidth, c.height())
+	fmt.Fprintf(bw, `<rect width="100%%" height="100%%" fill="white"/>`+"\n")
+	fmt.Fprintf(bw, `<text x="10" y="24" font-weight="bold">%s</text>`+"\n", html.EscapeString(c.title))
+	for i, b := range c.bars {
+		y := chartTop + i*chartRow
+		w := 0
+		if maxV > 0 {
+			w = b.value * barW / maxV
+		}
+		fmt.Fprintf(bw, `<text x="%d" y="%d" text-anchor="end">%s</text>`+"\n", labelW-chartCharW, y+14, html.EscapeString(chartLabel(b.label)))
+		fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`+"\n", labelW, y+3, w, chartRow-6, chartBarColor)
+		fmt.Fprintf(bw, `<text x="%d" y="%d">%s</text>`+"\n", labelW+w+chartCharW/2, y+14, c.annotation(b.value))
+	}
+	fmt.Fprintln(bw, "</svg>")
+	return bw.Flush()
+}
+
+func (c chart) writePNG(w io.Writer) error {
+	labelW, barW, maxV := c.layout()
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, c.height()))
+	fillRect(img, img.Bounds(), color.White)
+	black := color.RGBA{0, 0, 0, 255}
+	bar := color.RGBA{0x4a, 0x7e, 0xbb, 255}
+
+	drawText(img, 10, 14, c.title, black)
+	for i, b := range c.bars {
+		y := chartTop + i*chartRow
+		w := 0
+		if maxV > 0 {
+			w = b.value * barW / maxV
+		}
+		label := chartLabel(b.label)
+		drawText(img, labelW-chartCharW-utf8.RuneCountInString(label)*chartCharW, y+5, label, black)
+		fillRect(img, image.Rect(labelW, y+3, labelW+w, y+chartRow-3), bar)
+		drawText(img, labelW+w+chartCharW/2, y+5, c.annotation(b.value), black)
+	}
+	return png.Encode(w, img)
+}
+
+func fillRect(img *image.RGBA, r image.Rectangle, c color.Color) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.Set(x, y, c)
+		}
+	}
+}
+
+// chartGlyphs is a 3x5 bitmap font for PNG charts, one row of three pixels
+// per group. Letters are drawn upper case; unknown runes are left blank.
+var chartGlyphs = map[rune]string{
+	'0': "111 101 101 101 111", '1': "010 110 010 010 111", '2': "111 001 111 100 111",
+	'3': "111 001 111 001 111", '4': "101 101 111 001 001", '5': "111 100 111 001 111",
+	'6': "111 100 111 101 111", '7': "111 001 001 001 001", '8': "111 101 111 101 111",
+	'9': "111 101 111 001 111", 'A': "010 101 111 101 101", 'B': "110 101 110 101 110",
+	'C': "011 100 100 100 011", 'D': "110 101 101 101 110", 'E': "111 100 110 100 111",
+	'F': "111 100 110 100 100", 'G': "011 100 101 101 011", 'H': "101 101 111 101 101",
+	'I': "111 010 010 010 111", 'J': "001 001 001 101 010", 'K': "101 101 110 101 101",
+	'L': "100 100 100 100 111", 'M': "101 111 111 101 101", 'N': "110 101 101 101 101",
+	'O': "010 101 101 101 010", 'P': "110 101 110 100 100", 'Q': "010 101 101 110 011",
+	'R': "110 101 110 101 101", 'S': "011 100 010 001 110", 'T': "111 010 010 010 010",
+	'U': "101 101 101 101 111", 'V': "101 101 101 101 010", 'W': "101 101 111 111 101",
+	'X': "101 101 010 101 101", 'Y': "101 101 010 010 010", 'Z': "111 001 010 100 111",
+	'^': "010 101 000 000 000", '%': "101 001 010 100 101", '#': "101 111 101 111 101",
+	'&': "010 101 010 101 011", '-': "000 000 111 000 000", '.': "000 000 000 000 010",
+	'(': "001 010 010 010 001", ')': "100 010 010 010 100", ',': "000 000 000 010 100",
+}
+
+// drawText draws s at (x, y) with chartGlyphs scaled 2x, one glyph per
+// chartCharW pixels
+func drawText(img *image.RGBA, x, y int, s string, c color.Color) {
+	const scale = 2
+	for _, r := range strings.ToUpper(s) {
+		rows := strings.Fields(chartGlyphs[r])
+		for gy, row := range rows {
+			for gx, px := range row {
+				if px == '1' {
+					fillRect(img, image.Rect(x+gx*scale, y+gy*scale, x+(gx+1)*scale, y+(gy+1)*scale), c)
+				}
+			}
+		}
+		x += chartCharW
+	}
+}
+
+// estimateEntropy estimates a password's entropy in bits from its length and
+// the character classes it draws from. Dictionary-based passwords are scored
+// as a dictionary pick plus the decorating characters.
+func estimateEntropy(s string) float64 {
+	return defaultDictionary().entropy(s)
+}
+
+// entropy is estimateEntropy against d
+func (d *wordDict) entropy(s string) float64 {
+	if d == nil {
+		d = defaultDictionary()
+	}
+	var c charClassCounts
+	other := false
+	n := 0
+	for _, r := range s {
+		n++
+		switch {
+		case r >= 'a' && r <= 'z':
+			c.lower++
+		case r >= 'A' && r <= 'Z':
+			c.upper++
+		case r >= '0' && r <= '9':
+			c.digits++
+		case r < utf8.RuneSelf:
+			c.symbols++
+		default:
+			other = true
+		}
+	}
+	pool := 0
+	for _, class := range []struct{ count, size int }{{c.lower, 26}, {c.upper, 26}, {c.digits, 10}, {c.symbols, 33}} {
+		if class.count > 0 {
+			pool += class.size
+		}
+	}
+	if other {
+		pool += 100
+	}
+	if pool == 0 {
+		return 0
+	}
+	perChar := math.Log2(float64(pool))
+	bits := float64(n) * perChar
+	if base, ok := d.base(s); ok {
+		// One bit for capitalisation/leet choices on the base word
+		rest := n - utf8.RuneCountInString(base)
+		if dict := math.Log2(float64(len(d.words))) + 1 + float64(rest)*perChar; dict < bits {
+			bits = dict
+		}
+	}
+	return bits
+}
+
+// printEntropyStats prints an entropy histogram in 10-bit buckets plus
+// percentiles for --analyze
+func printEntropyStats(words []string, dict *wordDict) {
+	if len(words) == 0 {
+		return
+	}
+	bits := make([]float64, len(words))
+	buckets := make(map[int]int)
+	var sum float64
+	for i, w := range words {
+		bits[i] = dict.entropy(w)
+		sum += bits[i]
+		buckets[int(bits[i])/10*10]++
+	}
+	sort.Float64s(bits)
+	pct := func(p float64) float64 {
+		return bits[int(p*float64(len(bits)-1))]
+	}
+
+	fmt.Printf(tr("\nEntropy (bits): mean %.1f, p10 %.1f, p25 %.1f, median %.1f, p75 %.1f, p90 %.1f\n"),
+		sum/float64(len(bits)), pct(0.10), pct(0.25), pct(0.50), pct(0.75), pct(0.90))
+	fmt.Println(tr("Entropy Distribution Chart (10-bit buckets):"))
+	printASCIIChart(buckets, len(words))
+}
+
+// hashRate is the guessing speed of an attack against one hash type
+type hashRate struct {
+	hash   string
+	perSec float64
+}
+
+// hashRates are approximate hashcat speeds of a single RTX 4090, used when
+// --estimate-cracktime names a hash without a rate
+var hashRates = map[string]float64{
+	"md5":         164e9,
+	"ntlm":        288e9,
+	"sha1":        50e9,
+	"sha256":      22e9,
+	"sha512":      7.5e9,
+	"netntlmv2":   9e9,
+	"krb5tgs":     4e9,
+	"wpa2":        2.5e6,
+	"sha512crypt": 3.5e6,
+	"bcrypt":      184e3,
+}
+
+// parseHashRate parses HASH@RATE (e.g. "NTLM@300GH/s") or a bare hash name
+// from hashRates
+func parseHashRate(spec string) (*hashRate, error) {
+	name, rate, hasRate := strings.Cut(strings.TrimSpace(spec), "@")
+	if name == "" {
+		return nil, fmt.Errorf("missing hash name in %q", spec)
+	}
+	if !hasRate {
+		v, ok := hashRates[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("no built-in rate for %q (give one, e.g. %s@10GH/s)", name, name)
+		}
+		return &hashRate{hash: name, perSec: v}, nil
+	}
+	rate = strings.TrimSuffix(strings.TrimSpace(rate), "/s")
+	rate = strings.TrimRight(rate, "Hh")
+	n, err := parseCount(rate)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid rate in %q", spec)
+	}
+	return &hashRate{hash: name, perSec: float64(n)}, nil
+}
+
+func (h *hashRate) String() string {
+	return fmt.Sprintf("%s@%sH/s", h.hash, humanCount(h.perSec))
+}
+
+// seconds is the time to exhaust a keyspace of the given size
+func (h *hashRate) seconds(keyspace float64) float64 {
+	return keyspace / h.perSec
+}
+
+// humanDuration formats a number of seconds with the largest sensible unit
+func humanDuration(sec float64) string {
+	switch {
+	case sec < 1:
+		return tr("<1s")
+	case sec < 60:
+		return fmt.Sprintf(tr("%.0fs"), sec)
+	case sec < 3600:
+		return fmt.Sprintf(tr("%.0fm"), sec/60)
+	case sec < 86400:
+		return fmt.Sprintf(tr("%.1fh"), sec/3600)
+	case sec < 365*86400:
+		return fmt.Sprintf(tr("%.1f days"), sec/86400)
+	default:
+		return fmt.Sprintf(tr("%s years"), humanCount(sec/(365*86400)))
+	}
+}
+
+// guessKeyspace is the number of guesses needed to exhaust a password's
+// mask (e.g. ?u?l?l?l?d?d), or its dictionary estimate when that is smaller
+func guessKeyspace(s string) float64 {
+	return defaultDictionary().keyspace(s)
+}
+
+// keyspace is guessKeyspace against d
+func (d *wordDict) keyspace(s string) float64 {
+	space := 1.0
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+			space *= 26
+		case r >= '0' && r <= '9':
+			space *= 10
+		case r < utf8.RuneSelf:
+			space *= 33
+		default:
+			space *= 100
+		}
+	}
+	if _, ok := d.base(s); ok {
+		if dict := math.Exp2(d.entropy(s)); dict < space {
+			space = dict
+		}
+	}
+	return space
+}
+
+// crackWindows are the thresholds --estimate-cracktime reports on
+var crackWindows = []struct {
+	label string
+	sec   float64
+}{
+	{"1 minute", 60},
+	{"1 hour", 3600},
+	{"24 hours", 86400},
+	{"30 days", 30 * 86400},
+	{"1 year", 365 * 86400},
+}
+
+// printCrackTimes reports the share of passwords crackable within each of
+// crackWindows at the given rate
+func printCrackTimes(words []string, rate *hashRate, dict *wordDict) {
+	if len(words) == 0 {
+		return
+	}
+	secs := make([]float64, len(words))
+	for i, w := range words {
+		secs[i] = rate.seconds(dict.keyspace(w))
+	}
+	sort.Float64s(secs)
+
+	// Labels are padded to the widest one in runes, as translations differ
+	// in length from the English
+	labels := make([]string, len(crackWindows)+1)
+	for i, win := range crackWindows {
+		labels[i] = fmt.Sprintf(tr("within %s:"), tr(win.label))
+	}
+	labels[len(crackWindows)] = tr("Median:")
+	width := 0
+	for _, l := range labels {
+		width = max(width, utf8.RuneCountInString(l))
+	}
+
+	fmt.Printf(tr("\nEstimated crack time at %s (exhausting each password's mask):\n"), rate)
+	for i, win := range crackWindows {
+		n := sort.Search(len(secs), func(i int) bool { return secs[i] > win.sec })
+		fmt.Printf("  %-*s %6.1f%%\n", width, labels[i], float64(n)/float64(len(secs))*100)
+	}
+	fmt.Printf("  %-*s %s\n", width, labels[len(crackWindows)], humanDuration(secs[len(secs)/2]))
+}
+
+// splitPairs splits user:pass lines into parallel password and user slices,
+// dropping lines without a ':'
+func splitPairs(lines []string) (passwords, users []string) {
+	for _, l := range lines {
+		if user, pass, found := strings.Cut(l, ":"); found && pass != "" {
+			passwords = append(passwords, pass)
+			users = append(users, user)
+		}
+	}
+	return passwords, users
+}
+
+// reuseEntry is a password that occurs more than once
+type reuseEntry struct {
+	password string
+	count    int
+	users    []string // Distinct users sharing it, when known
+}
+
+// passwordReuse returns every repeated password, most frequent first. users
+// is parallel to words and may be nil.
+func passwordReuse(words, users []string) []reuseEntry {
+	counts := make(map[string]int)
+	owners := make(map[string]map[string]struct{})
+	for i, w := range words {
+		counts[w]++
+		if users != nil {
+			if owners[w] == nil {
+				owners[w] = make(map[string]struct{})
+			}
+			owners[w][users[i]] = struct{}{}
+		}
+	}
+	var entries []reuseEntry
+	for w, c := range counts {
+		if c < 2 {
+			continue
+		}
+		e := reuseEntry{password: w, count: c}
+		for u := range owners[w] {
+			e.users = append(e.users, u)
+		}
+		sort.Strings(e.users)
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].count != entries[j].count {
+			return entries[i].count > entries[j].count
+		}
+		return entries[i].password < entries[j].password
+	})
+	return entries
+}
+
+// printReuseStats reports duplicates and, with usernames, shared passwords
+func printReuseStats(words, users []string) {
+	if len(words) == 0 {
+		return
+	}
+	entries := passwordReuse(words, users)
+	dupes := 0
+	for _, e := range entries {
+		dupes += e.count - 1
+	}
+	fmt.Printf(tr("\nDuplicates & Reuse:\n"))
+	fmt.Printf(tr("  Unique passwords:   %d\n"), len(words)-dupes)
+	fmt.Printf(tr("  Duplicate entries:  %d (%.1f%%)\n"), dupes, float64(dupes)/float64(len(words))*100)
+	fmt.Printf(tr("  Repeated passwords: %d\n"), len(entries))
+	for i, e := range entries {
+		if i == 10 {
+			break
+		}
+		fmt.Printf("  [%6d] %s\n", e.count, e.password)
+	}
+
+	if users == nil {
+		return
+	}
+	var shared []reuseEntry
+	affected := 0
+	for _, e := range entries {
+		if len(e.users) > 1 {
+			shared = append(shared, e)
+			affected += len(e.users)
+		}
+	}
+	sort.SliceStable(shared, func(i, j int) bool { return len(shared[i].users) > len(shared[j].users) })
+	fmt.Printf(tr("\nShared Passwords: %d passwords used by %d users\n"), len(shared), affected)
+	for i, e := range shared {
+		if i == 10 {
+			break
+		}
+		names := e.users
+		more := ""
+		if len(names) > 5 {
+			names, more = names[:5], ", ..."
+		}
+		fmt.Printf(tr("  [%5d users] %s: %s%s\n"), len(e.users), e.password, strings.Join(names, ", "), more)
+	}
+}
+
+// clusterBase normalises a password to the word it is built on: letters
+// only, lowercased and with simple leet undone (Spring2023! -> spring)
+func clusterBase(w string) string {
+	core := strings.TrimFunc(w, func(r rune) bool { return !unicode.IsLetter(r) })
+	return unleetI.Replace(strings.ToLower(core))
+}
+
+// levenshtein returns the edit distance between a and b in runes
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// maxClusterBases bounds the pairwise edit-distance pass over distinct bases
+const maxClusterBases = 20000
+
+// clusterPasswords groups passwords sharing a base word, then merges groups
+// whose bases are within maxDist edits of each other. Clusters are returned
+// largest first; passwords without letters are left out.
+func clusterPasswords(words []string, maxDist int) [][]string {
+	byBase := make(map[string][]string)
+	for _, w := range words {
+		if b := clusterBase(w); b != "" {
+			byBase[b] = append(byBase[b], w)
+		}
+	}
+	bases := make([]string, 0, len(byBase))
+	for b := range byBase {
+		bases = append(bases, b)
+	}
+	sort.Slice(bases, func(i, j int) bool {
+		if len(bases[i]) != len(bases[j]) {
+			return len(bases[i]) < len(bases[j])
+		}
+		return bases[i] < bases[j]
+	})
+
+	// Union-find over bases; sorted by length so the inner loop can stop
+	// once lengths differ by more than maxDist
+	parent := make([]int, len(bases))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	if maxDist > 0 && len(bases) <= maxClusterBases {
+		for i := range bases {
+			for j := i + 1; j < len(bases) && len(bases[j])-len(bases[i]) <= maxDist; j++ {
+				if levenshtein(bases[i], bases[j]) <= maxDist {
+					parent[find(j)] = find(i)
+				}
+			}
+		}
+	} else if maxDist > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d distinct base words, clustering by shared base only\n", len(bases))
+	}
+
+	groups := make(map[int][]string)
+	for i, b := range bases {
+		root := find(i)
+		groups[root] = append(groups[root], byBase[b]...)
+	}
+	clusters := make([][]string, 0, len(groups))
+	for _, g := range groups {
+		sort.Strings(g)
+		clusters = append(clusters, g)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i]) != len(clusters[j]) {
+			return len(clusters[i]) > len(clusters[j])
+		}
+		return clusters[i][0] < clusters[j][0]
+	})
+	return clusters
+}
+
+// printClusters reports password reuse patterns for --analyze --clusters
+func printClusters(words []string, maxDist int) {
+	clusters := clusterPasswords(words, maxDist)
+	inClusters, multi := 0, 0
+	for _, c := range clusters {
+		if len(c) > 1 {
+			multi++
+			inClusters += len(c)
+		}
+	}
+	fmt.Printf(tr("\nPassword Clusters (shared base, edit distance <= %d):\n"), maxDist)
+	fmt.Printf(tr("  %d passwords in %d clusters of 2+ (%.1f%%)\n"), inClusters, multi, float64(inClusters)/float64(len(words))*100)
+	for i, c := range clusters {
+		if i == 10 || len(c) < 2 {
+			break
+		}
+		sample := c
+		if len(sample) > 5 {
+			sample = sample[:5]
+		}
+		more := ""
+		if len(c) > len(sample) {
+			more = ", ..."
+		}
+		fmt.Printf(tr("  [%5d] %s: %s%s\n"), len(c), clusterBase(c[0]), strings.Join(sample, ", "), more)
+	}
+}
+
+func printASCIIChart(lens map[int]int, total int) {
+	if total == 0 {
+		return
+	}
+	ks := make([]int, 0, len(lens))
+	for k := range lens {
 		ks = append(ks, k)
 	}
-	sort.Ints(ks)
-	mv := 0
-	for _, v := range lens {
-		if v > mv {
-			mv = v
+	sort.Ints(ks)
+	bar := asciiBar()
+	mv := 0
+	for _, v := range lens {
+		if v > mv {
+			mv = v
+		}
+	}
+	for _, k := range ks {
+		v := lens[k]
+		bl := (v * 40) / mv
+		if bl == 0 && v > 0 {
+			bl = 1
+		}
+		fmt.Printf("%2d [%6d] %s\n", k, v, bar(bl))
+	}
+}
+
+// asciiBar returns printASCIIChart's bar drawing: green blocks on a color
+// terminal, plain '#' for files, logs and consoles that render neither
+func asciiBar() func(n int) string {
+	if !colorEnabled(os.Stdout) {
+		return func(n int) string { return strings.Repeat("#", n) }
+	}
+	return func(n int) string { return "\033[32m" + strings.Repeat("█", n) + "\033[0m" }
+}
+
+const (
+	MaskAllUpper     = 1
+	MaskFirstUpper   = 2
+	MaskAllLower     = 4
+	MaskHasUpper     = 16
+	MaskHasLower     = 8
+	MaskEndsInNumber = 32
+	MaskEndsInSpec   = 64
+	MaskLeet         = 128
+	MaskHasNumber    = 256
+	MaskHasSpec      = 512
+	MaskOnlyNumbers  = 1024
+)
+
+var lengthChances = map[int]float64{
+	1: 0.00034, 2: 0.0023, 3: 0.017, 4: 0.127, 5: 1.81, 6: 13.58, 7: 17.47, 8: 20.68,
+	9: 15.27, 10: 14.04, 11: 6.03, 12: 3.86, 13: 2.53, 14: 1.73, 15: 1.12, 16: 0.82,
+	17: 0.25, 18: 0.16, 19: 0.10, 20: 0.08, 21: 0.05, 22: 0.04, 23: 0.03, 24: 0.02,
+}
+var comboChances = map[int]float64{
+	16: 0.78, 4: 0.76, 20: 0.76, 256: 0.49, 272: 0.29, 260: 0.29, 276: 0.29,
+	32: 0.28, 288: 0.28, 48: 0.27, 304: 0.27, 36: 0.27, 52: 0.27, 292: 0.27,
+	1024: 0.19, 1280: 0.19, 8: 0.03, 1: 0.02, 9: 0.02, 	128: 0.019,
+}
+
+func getKeyboardWalks() []string {
+	return []string{
+		"qwerty", "asdfgh", "zxcvbn", "123456", "qazwsx",
+		"qwer", "asdf", "zxcv", "1234", "1qaz", "zaq1",
+		"wsx", "edc", "rfv", "tgb", "yhn", "ujm", "ik,", "ol.", "p;/",
+		"plm", "okn", "ijb", "uhv", "ygc", "tfx", "rdz", "esz", "waq",
+		"!@#$", "!@#$%", "qwertyuiop", "asdfghjkl", "zxcvbnm",
+	}
+}
+
+// keyboardRow is one row of keys, unshifted and with Shift held. Rows are
+// listed top to bottom; offset is how many keys the row starts to the right
+// of the number row, so up and down follow the stagger.
+type keyboardRow struct {
+	plain, shifted string
+	offset         int
+}
+
+var keyboardLayouts = map[string][]keyboardRow{
+	"qwerty": {
+		{"`1234567890-=", "~!@#$%^&*()_+", 0},
+		{"qwertyuiop[]\\", "QWERTYUIOP{}|", 1},
+		{"asdfghjkl;'", "ASDFGHJKL:\"", 1},
+		{"zxcvbnm,./", "ZXCVBNM<>?", 1},
+	},
+	"qwertz": {
+		{"^1234567890ß´", "°!\"§$%&/()=?`", 0},
+		{"qwertzuiopü+", "QWERTZUIOPÜ*", 1},
+		{"asdfghjklöä#", "ASDFGHJKLÖÄ'", 1},
+		{"<yxcvbnm,.-", ">YXCVBNM;:_", 0},
+	},
+	"azerty": {
+		{"²&é\"'(-è_çà)=", "²1234567890°+", 0},
+		{"azertyuiop^$", "AZERTYUIOP¨£", 1},
+		{"qsdfghjklmù*", "QSDFGHJKLM%µ", 1},
+		{"<wxcvbn,;:!", ">WXCVBN?./§", 0},
+	},
+}
+
+// kbShiftMaps maps "layout:direction" to each key's neighbor in that
+// direction. A key keeps its Shift state, so P moves to { on qwerty.
+var kbShiftMaps = func() map[string]map[rune]rune {
+	maps := make(map[string]map[rune]rune)
+	for name, rows := range keyboardLayouts {
+		// grid[plane][row][column], with the stagger applied to the column
+		var grid [2][]map[int]rune
+		for _, row := range rows {
+			for plane, keys := range []string{row.plain, row.shifted} {
+				cols := make(map[int]rune)
+				for i, k := range []rune(keys) {
+					cols[i+row.offset] = k
+				}
+				grid[plane] = append(grid[plane], cols)
+			}
+		}
+		for dir, d := range map[string][2]int{"left": {0, -1}, "right": {0, 1}, "up": {-1, 0}, "down": {1, 0}} {
+			shift := make(map[rune]rune)
+			for _, plane := range grid {
+				for r, cols := range plane {
+					if r+d[0] < 0 || r+d[0] >= len(plane) {
+						continue
+					}
+					for c, k := range cols {
+						if n, ok := plane[r+d[0]][c+d[1]]; ok {
+							if _, seen := shift[k]; !seen {
+								shift[k] = n
+							}
+						}
+					}
+				}
+			}
+			maps[name+":"+dir] = shift
+		}
+	}
+	return maps
+}()
+
+// kbShiftWord retypes word with every key moved per shift; keys without a
+// neighbor (or not on the layout) are kept
+func kbShiftWord(word string, shift map[rune]rune) string {
+	out := []rune(word)
+	for i, c := range out {
+		if n, ok := shift[c]; ok {
+			out[i] = n
+		}
+	}
+	return string(out)
+}
+
+// tokenSub is one --substitute pair: from is replaced by to
+type tokenSub struct {
+	from, to string
+}
+
+// parseSubstitution parses an old=new pair; new may be empty to drop old
+func parseSubstitution(pair string) (tokenSub, error) {
+	from, to, ok := strings.Cut(strings.TrimSpace(pair), "=")
+	if !ok || from == "" {
+		return tokenSub{}, fmt.Errorf("invalid substitution %q (use old=new)", pair)
+	}
+	return tokenSub{from, to}, nil
+}
+
+// loadSubstitutions returns the pairs of a comma-separated --substitute
+// spec followed by those of a --substitute-file, one pair per line
+func loadSubstitutions(spec, path string) ([]tokenSub, error) {
+	var pairs []string
+	if spec != "" {
+		pairs = strings.Split(spec, ",")
+	}
+	if path != "" {
+		f, err := openInput(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load substitutions: %w", err)
+		}
+		defer f.Close()
+		l := &wordLoader{maxLineLen: defaultMaxLineLen, commentPrefix: "#"}
+		lines, err := l.load(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		pairs = append(pairs, lines...)
+	}
+	subs := make([]tokenSub, 0, len(pairs))
+	for _, p := range pairs {
+		sub, err := parseSubstitution(p)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+// substituteToken replaces every occurrence of sub.from in word, matched
+// in any case. An exact match takes sub.to as written; otherwise sub.to
+// follows the case of the occurrence (ACME -> GLOBEX, Acme -> Globex).
+func substituteToken(word string, sub tokenSub) string {
+	var b strings.Builder
+	last := 0
+	for i := 0; i+len(sub.from) <= len(word); {
+		match := word[i : i+len(sub.from)]
+		if !strings.EqualFold(match, sub.from) {
+			_, size := utf8.DecodeRuneInString(word[i:])
+			i += size
+			continue
+		}
+		b.WriteString(word[last:i])
+		if match == sub.from {
+			b.WriteString(sub.to)
+		} else {
+			b.WriteString(matchCase(strings.ToLower(sub.to), match))
+		}
+		i += len(match)
+		last = i
+	}
+	if last == 0 {
+		return word
+	}
+	b.WriteString(word[last:])
+	return b.String()
+}
+
+// Parquet physical and converted types, page types and encodings used by
+// parquetWriter, as numbered in the Parquet format's Thrift definitions
+const (
+	parquetInt32     = 1
+	parquetDouble    = 5
+	parquetByteArray = 6
+	parquetUTF8      = 0
+	parquetRequired  = 0
+	parquetDataPage  = 0
+	parquetPlain     = 0
+	parquetRLE       = 3
+)
+
+// parquetRowGroupRows bounds the rows buffered before a row group is written
+const parquetRowGroupRows = 1 << 20
+
+// parquetColumns is the --output-format parquet schema; every column is
+// required and PLAIN-encoded
+var parquetColumns = []struct {
+	name      string
+	ptype     int32
+	converted int32 // -1 = none
+}{
+	{"word", parquetByteArray, parquetUTF8},
+	{"length", parquetInt32, -1},
+	{"strength", parquetInt32, -1},
+	{"efficacy", parquetDouble, -1},
+}
+
+// parquetWriter streams candidates as an uncompressed Parquet file with the
+// parquetColumns schema. Each full row group is written as one data page per
+// column; close writes the footer. The first write error stops all further
+// writes and is returned by close.
+type parquetWriter struct {
+	w         io.Writer
+	cfg       *Config
+	dict      *wordDict
+	err       error
+	offset    int64          // Bytes written, for the footer's page offsets
+	pages     []bytes.Buffer // PLAIN-encoded values of the current row group
+	rows      int
+	total     int64
+	rowGroups []parquetRowGroup
+}
+
+type parquetRowGroup struct {
+	rows   int64
+	chunks []parquetChunk
+}
+
+// parquetChunk locates one column chunk (page header plus data) in the file
+type parquetChunk struct {
+	offset, size int64
+}
+
+func newParquetWriter(w io.Writer, cfg *Config, dict *wordDict) *parquetWriter {
+	p := &parquetWriter{w: w, cfg: cfg, dict: dict, pages: make([]bytes.Buffer, len(parquetColumns))}
+	p.write([]byte("PAR1"))
+	return p
+}
+
+func (p *parquetWriter) write(b []byte) {
+	if p.err != nil {
+		return
+	}
+	n, err := p.w.Write(b)
+	p.offset += int64(n)
+	p.err = err
+}
+
+// add appends one candidate row
+func (p *parquetWriter) add(word string) {
+	if p.err != nil {
+		return
+	}
+	strength, efficacy := wordScores(p.dict, word, p.cfg.pairMode)
+	var num [8]byte
+	binary.LittleEndian.PutUint32(num[:4], uint32(len(word)))
+	p.pages[0].Write(num[:4])
+	p.pages[0].WriteString(word)
+	binary.LittleEndian.PutUint32(num[:4], uint32(p.cfg.wordLen(word)))
+	p.pages[1].Write(num[:4])
+	binary.LittleEndian.PutUint32(num[:4], uint32(strength))
+	p.pages[2].Write(num[:4])
+	binary.LittleEndian.PutUint64(num[:], math.Float64bits(efficacy))
+	p.pages[3].Write(num[:])
+	if p.rows++; p.rows == parquetRowGroupRows {
+		p.flushRowGroup()
+	}
+}
+
+// flushRowGroup writes the buffered rows as a row group
+func (p *parquetWriter) flushRowGroup() {
+	if p.rows == 0 {
+		return
+	}
+	rg := parquetRowGroup{rows: int64(p.rows)}
+	for i := range p.pages {
+		data := p.pages[i].Bytes()
+		var h thriftWriter
+		h.begin()
+		h.i32(1, parquetDataPage)
+		h.i32(2, int32(len(data)))
+		h.i32(3, int32(len(data)))
+		h.structField(5)
+		h.i32(1, int32(p.rows))
+		h.i32(2, parquetPlain)
+		h.i32(3, parquetRLE)
+		h.i32(4, parquetRLE)
+		h.end()
+		h.end()
+		start := p.offset
+		p.write(h.buf.Bytes())
+		p.write(data)
+		rg.chunks = append(rg.chunks, parquetChunk{start, p.offset - start})
+		p.pages[i].Reset()
+	}
+	p.rowGroups = append(p.rowGroups, rg)
+	p.total += int64(p.rows)
+	p.rows = 0
+}
+
+// close writes any buffered rows and the file footer, and returns the first
+// write error
+func (p *parquetWriter) close() error {
+	p.flushRowGroup()
+	var t thriftWriter
+	t.begin()
+	t.i32(1, 1) // Format version
+	t.list(2, thriftStruct, len(parquetColumns)+1)
+	t.begin()
+	t.str(4, "schema")
+	t.i32(5, int32(len(parquetColumns)))
+	t.end()
+	for _, c := range parquetColumns {
+		t.begin()
+		t.i32(1, c.ptype)
+		t.i32(3, parquetRequired)
+		t.str(4, c.name)
+		if c.converted >= 0 {
+			t.i32(6, c.converted)
+		}
+		t.end()
+	}
+	t.i64(3, p.total)
+	t.list(4, thriftStruct, len(p.rowGroups))
+	for _, rg := range p.rowGroups {
+		t.begin()
+		t.list(1, thriftStruct, len(rg.chunks))
+		var size int64
+		for i, ch := range rg.chunks {
+			t.begin()
+			t.i64(2, ch.offset)
+			t.structField(3)
+			t.i32(1, parquetColumns[i].ptype)
+			t.list(2, thriftI32, 1)
+			t.varint(parquetPlain)
+			t.list(3, thriftBinary, 1)
+			t.binary(parquetColumns[i].name)
+			t.i32(4, 0) // Uncompressed
+			t.i64(5, rg.rows)
+			t.i64(6, ch.size)
+			t.i64(7, ch.size)
+			t.i64(9, ch.offset)
+			t.end()
+			t.end()
+			size += ch.size
+		}
+		t.i64(2, size)
+		t.i64(3, rg.rows)
+		t.end()
+	}
+	t.str(6, "passmut version "+version)
+	t.end()
+
+	footer := t.buf.Bytes()
+	p.write(footer)
+	var n [4]byte
+	binary.LittleEndian.PutUint32(n[:], uint32(len(footer)))
+	p.write(n[:])
+	p.write([]byte("PAR1"))
+	return p.err
+}
+
+// Thrift compact protocol type ids
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftStruct = 12
+)
+
+// thriftWriter encodes the Thrift compact protocol Parquet metadata uses.
+// begin opens a struct (top level or list element), structField a struct
+// valued field; end closes either.
+type thriftWriter struct {
+	buf  bytes.Buffer
+	last []int16 // Last field id of each open struct
+}
+
+func (t *thriftWriter) begin() { t.last = append(t.last, 0) }
+
+func (t *thriftWriter) end() {
+	t.buf.WriteByte(0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	top := &t.last[len(t.last)-1]
+	if d := id - *top; d > 0 && d <= 15 {
+		t.buf.WriteByte(byte(d)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.varint(int64(id))
+	}
+	*top = id
+}
+
+// varint writes a zigzag-encoded integer
+func (t *thriftWriter) varint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	t.buf.Write(b[:binary.PutVarint(b[:], v)])
+}
+
+func (t *thriftWriter) binary(s string) {
+	var b [binary.MaxVarintLen64]byte
+	t.buf.Write(b[:binary.PutUvarint(b[:], uint64(len(s)))])
+	t.buf.WriteString(s)
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(v)
+}
+
+func (t *thriftWriter) str(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.binary(s)
+}
+
+func (t *thriftWriter) structField(id int16) {
+	t.field(id, thriftStruct)
+	t.begin()
+}
+
+// list writes the header of an n-element list field
+func (t *thriftWriter) list(id int16, elem byte, n int) {
+	t.field(id, 9)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | elem)
+		return
+	}
+	t.buf.WriteByte(0xf0 | elem)
+	var b [binary.MaxVarintLen64]byte
+	t.buf.Write(b[:binary.PutUvarint(b[:], uint64(n))])
+}
+
+// localePack holds the language-specific material --detect-lang applies to
+// the words of one language
+type localePack struct {
+	seasons  []string        // Season names, added to start and end
+	months   []string        // Month names, for --season-cycle
+	translit map[rune]string // Spelling of diacritics on keyboards without them
+}
+
+var localePacks = map[string]localePack{
+	"en": {
+		seasons: []string{"spring", "summer", "autumn", "fall", "winter"},
+		months: []string{"january", "february", "march", "april", "may", "june", "july",
+			"august", "september", "october", "november", "december"},
+	},
+	"de": {
+		seasons: []string{"frühling", "sommer", "herbst", "winter"},
+		months: []string{"januar", "februar", "märz", "april", "mai", "juni", "juli",
+			"august", "september", "oktober", "november", "dezember"},
+		translit: map[rune]string{'ä': "ae", 'ö': "oe", 'ü': "ue", 'ß': "ss", 'Ä': "Ae", 'Ö': "Oe", 'Ü': "Ue"},
+	},
+	"fr": {
+		seasons: []string{"printemps", "été", "automne", "hiver"},
+		months: []string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet",
+			"août", "septembre", "octobre", "novembre", "décembre"},
+		translit: map[rune]string{'à': "a", 'â': "a", 'ç': "c", 'é': "e", 'è': "e", 'ê': "e", 'ë': "e",
+			'î': "i", 'ï': "i", 'ô': "o", 'ù': "u", 'û': "u", 'œ': "oe"},
+	},
+	"es": {
+		seasons: []string{"primavera", "verano", "otoño", "invierno"},
+		months: []string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio",
+			"agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		translit: map[rune]string{'á': "a", 'é': "e", 'í': "i", 'ó': "o", 'ú': "u", 'ü': "u", 'ñ': "n"},
+	},
+	"it": {
+		seasons: []string{"primavera", "estate", "autunno", "inverno"},
+		months: []string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio",
+			"agosto", "settembre", "ottobre", "novembre", "dicembre"},
+		translit: map[rune]string{'à': "a", 'è': "e", 'é': "e", 'ì': "i", 'ò': "o", 'ù': "u"},
+	},
+}
+
+// nameCycles are the season and month cycles of every locale pack, for
+// --season-cycle
+var nameCycles = func() [][]string {
+	var cycles [][]string
+	for _, name := range localePackNames() {
+		cycles = append(cycles, localePacks[name].seasons, localePacks[name].months)
+	}
+	return cycles
+}()
+
+// cycleNames finds season and month names in word and writes it with each
+// replaced by every other member of its cycle, in the same case. A name
+// must start a run of letters and end one, or be followed by an upper-case
+// letter (WinterXYZ), so "marshall" keeps its "mars".
+func cycleNames(word string) []string {
+	var res []string
+	prev := rune(-1)
+	for i, r := range word {
+		if unicode.IsLetter(prev) {
+			prev = r
+			continue
+		}
+		prev = r
+		for _, cycle := range nameCycles {
+			for _, name := range cycle {
+				end := i + len(name)
+				if end > len(word) || !strings.EqualFold(word[i:end], name) {
+					continue
+				}
+				if next, _ := utf8.DecodeRuneInString(word[end:]); end < len(word) && unicode.IsLetter(next) && !unicode.IsUpper(next) {
+					continue
+				}
+				for _, other := range cycle {
+					if other != name {
+						res = append(res, word[:i]+matchCase(other, word[i:end])+word[end:])
+					}
+				}
+			}
+		}
+	}
+	return res
+}
+
+// localePackNames lists the languages with a locale pack, sorted
+func localePackNames() []string {
+	names := make([]string, 0, len(localePacks))
+	for name := range localePacks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// languageLetters are letters that point strongly to one language
+var languageLetters = map[rune]string{
+	'ß': "de", 'ä': "de", 'ö': "de", 'ü': "de",
+	'ñ': "es", 'á': "es", 'í': "es", 'ó': "es", 'ú': "es", '¡': "es", '¿': "es",
+	'ç': "fr", 'é': "fr", 'è': "fr", 'ê': "fr", 'ë': "fr", 'â': "fr", 'î': "fr", 'ô': "fr", 'û': "fr", 'œ': "fr",
+	'à': "it", 'ì': "it", 'ò': "it", 'ù': "it",
+}
+
+// languageScripts identify a language by its writing system alone
+var languageScripts = []struct {
+	lang  string
+	table *unicode.RangeTable
+}{
+	{"ru", unicode.Cyrillic},
+	{"el", unicode.Greek},
+	{"ar", unicode.Arabic},
+	{"he", unicode.Hebrew},
+	{"ja", unicode.Hiragana},
+	{"ja", unicode.Katakana},
+	{"ko", unicode.Hangul},
+	{"zh", unicode.Han},
+}
+
+// languageHints are letter sequences typical of a language, for words
+// written without distinctive letters
+var languageHints = []struct {
+	lang  string
+	grams []string
+}{
+	{"en", []string{"th", "wh", "ing", "ght", "ough", "ness", "ship"}},
+	{"de", []string{"sch", "tz", "ung", "cht", "keit", "heit", "haus"}},
+	{"fr", []string{"eau", "oux", "eux", "ette", "oir", "ique"}},
+	{"es", []string{"cion", "dad", "rr", "ito", "ita"}},
+	{"it", []string{"zione", "zz", "gli", "cch", "etto", "cci"}},
+}
+
+// detectLanguage guesses the language of a word from its script, its
+// distinctive letters and typical letter sequences. It returns "" when no
+// language wins outright, which is the common case for short ASCII words.
+func detectLanguage(word string) string {
+	w := strings.ToLower(word)
+	scores := make(map[string]int)
+	for _, r := range w {
+		for _, s := range languageScripts {
+			if unicode.Is(s.table, r) {
+				return s.lang
+			}
+		}
+		if lang, ok := languageLetters[r]; ok {
+			scores[lang] += 3
 		}
 	}
-	for _, k := range ks {
-		v := lens[k]
-		bl := (v * 40) / mv
-		if bl == 0 && v > 0 {
-			bl = 1
+	for _, h := range languageHints {
+		for _, g := range h.grams {
+			scores[h.lang] += strings.Count(w, g) * (len(g) - 1)
+		}
+	}
+	best, top, tied := "", 0, false
+	for lang, n := range scores {
+		switch {
+		case n > top:
+			best, top, tied = lang, n, false
+		case n == top && n > 0:
+			tied = true
+		}
+	}
+	if tied {
+		return ""
+	}
+	return best
+}
+
+// transliterate spells out the characters of word found in table
+func transliterate(word string, table map[rune]string) string {
+	var sb strings.Builder
+	for _, r := range word {
+		if t, ok := table[r]; ok {
+			sb.WriteString(t)
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// printLanguageMix reports the detected languages of words for --analyze
+func printLanguageMix(words []string) {
+	if len(words) == 0 {
+		return
+	}
+	counts := make(map[string]int)
+	for _, w := range words {
+		lang := detectLanguage(w)
+		if lang == "" {
+			lang = tr("unknown")
+		}
+		counts[lang]++
+	}
+	langs := make([]string, 0, len(counts))
+	width := 8
+	for lang := range counts {
+		langs = append(langs, lang)
+		width = max(width, utf8.RuneCountInString(lang))
+	}
+	sort.Slice(langs, func(i, j int) bool {
+		if counts[langs[i]] != counts[langs[j]] {
+			return counts[langs[i]] > counts[langs[j]]
+		}
+		return langs[i] < langs[j]
+	})
+	fmt.Printf(tr("\nLanguage Mix (detected):\n"))
+	for _, lang := range langs {
+		fmt.Printf("  %-*s %6d (%5.1f%%)\n", width, lang, counts[lang], float64(counts[lang])/float64(len(words))*100)
+	}
+}
+
+//go:embed zipcodes.txt
+var embeddedZipcodes string
+
+// maxZipcodes caps what one --zipcodes spec may expand to
+const maxZipcodes = 100000
+
+// zipPack maps "country:REGION" to the postal code patterns of the region;
+// an x in a pattern stands for any digit
+type zipPack map[string][]string
+
+// parseZipPack reads "<country> <region> <patterns...>" lines; blank lines
+// and lines starting with '#' are skipped
+func parseZipPack(r io.Reader) (zipPack, error) {
+	pack := make(zipPack)
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Fields(line)
+		if len(f) < 3 {
+			return nil, fmt.Errorf("line %d: want <country> <region> <patterns...>", n)
+		}
+		for _, p := range f[2:] {
+			if !isZipPattern(p) {
+				return nil, fmt.Errorf("line %d: invalid pattern %q", n, p)
+			}
+		}
+		pack[strings.ToLower(f[0])+":"+strings.ToUpper(f[1])] = f[2:]
+	}
+	return pack, sc.Err()
+}
+
+// load merges a pack file or http(s) URL into p
+func (p zipPack) load(path string) error {
+	var r io.ReadCloser
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		resp, err := http.Get(path)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("%s: HTTP %d", path, resp.StatusCode)
+		}
+		r = resp.Body
+	} else {
+		f, err := openInput(path)
+		if err != nil {
+			return err
+		}
+		r = f
+	}
+	defer r.Close()
+	extra, err := parseZipPack(r)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for k, v := range extra {
+		p[k] = v
+	}
+	return nil
+}
+
+func isZipPattern(s string) bool {
+	return s != "" && strings.Trim(strings.ToLower(s), "0123456789x") == ""
+}
+
+// expand turns a --zipcodes spec such as "us:CA,94xxx" into sorted postal
+// codes. Items are regions of the country or digit patterns.
+func (p zipPack) expand(spec string) ([]string, error) {
+	country, items, ok := strings.Cut(spec, ":")
+	country = strings.ToLower(strings.TrimSpace(country))
+	if !ok || country == "" {
+		return nil, fmt.Errorf("invalid --zipcodes %q (use <country>:<regions or patterns>, e.g. us:CA,94xxx)", spec)
+	}
+	seen := make(map[string]struct{})
+	for _, item := range strings.Split(items, ",") {
+		item = strings.TrimSpace(item)
+		patterns := p[country+":"+strings.ToUpper(item)]
+		if patterns == nil {
+			if !isZipPattern(item) {
+				return nil, fmt.Errorf("unknown region %q for %s in --zipcodes (see --zip-pack)", item, country)
+			}
+			patterns = []string{item}
+		}
+		for _, pat := range patterns {
+			if err := expandZipPattern(strings.ToLower(pat), seen); err != nil {
+				return nil, err
+			}
+		}
+	}
+	codes := make([]string, 0, len(seen))
+	for c := range seen {
+		codes = append(codes, c)
+	}
+	sort.Strings(codes)
+	return codes, nil
+}
+
+// expandZipPattern adds every code matching pattern to seen
+func expandZipPattern(pattern string, seen map[string]struct{}) error {
+	cur := []string{""}
+	for _, c := range pattern {
+		var next []string
+		for _, prefix := range cur {
+			if c != 'x' {
+				next = append(next, prefix+string(c))
+				continue
+			}
+			for d := '0'; d <= '9'; d++ {
+				next = append(next, prefix+string(d))
+			}
+		}
+		if len(seen)+len(next) > maxZipcodes {
+			return fmt.Errorf("--zipcodes expands to more than %d codes; use narrower regions or patterns", maxZipcodes)
+		}
+		cur = next
+	}
+	for _, code := range cur {
+		seen[code] = struct{}{}
+	}
+	return nil
+}
+
+// commonPINs are the most used 4-digit PINs
+var commonPINs = []string{
+	"1234", "1111", "0000", "1212", "7777", "1004", "2000", "4444", "2222", "6969",
+	"9999", "3333", "5555", "6666", "1122", "1313", "8888", "4321", "2001", "1010",
+}
+
+// numericPatterns are the --numeric-patterns tails: every digit repeated 2-6
+// times, ascending and descending runs of 3-6 digits, and common PINs
+var numericPatterns = func() []string {
+	var res []string
+	seen := make(map[string]struct{})
+	add := func(p string) {
+		if _, ok := seen[p]; !ok {
+			seen[p] = struct{}{}
+			res = append(res, p)
+		}
+	}
+	const digits = "0123456789"
+	for n := 2; n <= 6; n++ {
+		for _, d := range digits {
+			add(strings.Repeat(string(d), n))
+		}
+	}
+	for n := 3; n <= 6; n++ {
+		for i := 0; i+n <= len(digits); i++ {
+			add(digits[i : i+n])
+			add(reverseString(digits[i : i+n]))
 		}
-		fmt.Printf("%2d [%6d] %s\n", k, v, strings.Repeat("█", bl))
 	}
+	for _, p := range commonPINs {
+		add(p)
+	}
+	return res
+}()
+
+// phoneNumbers expands --phone-patterns. For NANP each area code yields the
+// 7-digit local number and the 10-digit number for every exchange (200-999),
+// with the line number limited to the 4-digit numericPatterns.
+func phoneNumbers(spec string) ([]string, error) {
+	plan, codes, _ := strings.Cut(spec, ":")
+	if !strings.EqualFold(strings.TrimSpace(plan), "NANP") {
+		return nil, fmt.Errorf("invalid --phone-patterns %q (use NANP:<area codes>, e.g. NANP:415,650)", spec)
+	}
+	var lines []string
+	for _, p := range numericPatterns {
+		if len(p) == 4 {
+			lines = append(lines, p)
+		}
+	}
+	var local []string
+	for exchange := 200; exchange <= 999; exchange++ {
+		for _, line := range lines {
+			local = append(local, strconv.Itoa(exchange)+line)
+		}
+	}
+	res := local
+	for _, code := range strings.Split(codes, ",") {
+		code = strings.TrimSpace(code)
+		if len(code) != 3 || code[0] < '2' || code[0] > '9' || strings.Trim(code, "0123456789") != "" {
+			return nil, fmt.Errorf("invalid NANP area code %q in --phone-patterns (3 digits, not starting with 0 or 1)", code)
+		}
+		for _, n := range local {
+			res = append(res, code+n)
+		}
+	}
+	return res, nil
 }
 
+// wpaMinLength and wpaMaxLength bound a WPA/WPA2 passphrase
 const (
-	MaskAllUpper     = 1
-	MaskFirstUpper   = 2
-	MaskAllLower     = 4
-	MaskHasUpper     = 16
-	MaskHasLower     = 8
-	MaskEndsInNumber = 32
-	MaskEndsInSpec   = 64
-	MaskLeet         = 128
-	MaskHasNumber    = 256
-	MaskHasSpec      = 512
-	MaskOnlyNumbers  = 1024
+	wpaMinLength = 8
+	wpaMaxLength = 63
 )
 
-var lengthChances = map[int]float64{
-	1: 0.00034, 2: 0.0023, 3: 0.017, 4: 0.127, 5: 1.81, 6: 13.58, 7: 17.47, 8: 20.68,
-	9: 15.27, 10: 14.04, 11: 6.03, 12: 3.86, 13: 2.53, 14: 1.73, 15: 1.12, 16: 0.82,
-	17: 0.25, 18: 0.16, 19: 0.10, 20: 0.08, 21: 0.05, 22: 0.04, 23: 0.03, 24: 0.02,
+// isPrintableASCII reports whether s only has the characters a WPA
+// passphrase may contain (space to '~')
+func isPrintableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < ' ' || s[i] > '~' {
+			return false
+		}
+	}
+	return true
 }
-var comboChances = map[int]float64{
-	16: 0.78, 4: 0.76, 20: 0.76, 256: 0.49, 272: 0.29, 260: 0.29, 276: 0.29,
-	32: 0.28, 288: 0.28, 48: 0.27, 304: 0.27, 36: 0.27, 52: 0.27, 292: 0.27,
-	1024: 0.19, 1280: 0.19, 8: 0.03, 1: 0.02, 9: 0.02, 	128: 0.019,
+
+// mailboxName spells a name part the way mail systems do: lower case,
+// diacritics transliterated by the locale packs and anything but letters,
+// digits and hyphens dropped (O'Brien -> obrien, Müller -> mueller)
+func mailboxName(part string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(part) {
+		if r < utf8.RuneSelf {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' {
+				b.WriteRune(r)
+			}
+			continue
+		}
+		for _, name := range localePackNames() {
+			if t, ok := localePacks[name].translit[r]; ok {
+				b.WriteString(t)
+				break
+			}
+		}
+	}
+	return b.String()
 }
 
-func getKeyboardWalks() []string {
-	return []string{
-		"qwerty", "asdfgh", "zxcvbn", "123456", "qazwsx",
-		"qwer", "asdf", "zxcv", "1234", "1qaz", "zaq1",
-		"wsx", "edc", "rfv", "tgb", "yhn", "ujm", "ik,", "ol.", "p;/",
-		"plm", "okn", "ijb", "uhv", "ygc", "tfx", "rdz", "esz", "waq",
-		"!@#$", "!@#$%", "qwertyuiop", "asdfghjkl", "zxcvbnm",
+// mailboxLocals returns the usual local parts of the addresses (or user
+// names) for a full name, likeliest first: first.last, flast, f.last,
+// last.first, firstlast, first_last and first. "Last, First" is read as
+// such and middle names are left out; a single name is used as it is.
+func mailboxLocals(name string) []string {
+	if last, first, ok := strings.Cut(name, ","); ok {
+		name = first + " " + last
+	}
+	var parts []string
+	for _, f := range strings.Fields(name) {
+		if p := mailboxName(f); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	switch len(parts) {
+	case 0:
+		return nil
+	case 1:
+		return parts
+	}
+	first, last := parts[0], parts[len(parts)-1]
+	f := string([]rune(first)[:1])
+	return []string{first + "." + last, f + last, f + "." + last, last + "." + first,
+		first + last, first + "_" + last, first}
+}
+
+// emailAddresses expands every name into its mailbox formats at each of the
+// comma-separated domains, in input order and without duplicates
+func emailAddresses(names []string, domains string) []string {
+	var doms []string
+	for _, d := range strings.Split(domains, ",") {
+		if d = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "@")); d != "" {
+			doms = append(doms, d)
+		}
+	}
+	seen := make(map[string]struct{})
+	var res []string
+	for _, n := range names {
+		for _, d := range doms {
+			for _, local := range mailboxLocals(n) {
+				addr := local + "@" + d
+				if _, dup := seen[addr]; !dup {
+					seen[addr] = struct{}{}
+					res = append(res, addr)
+				}
+			}
+		}
+	}
+	return res
+}
+
+// ssidSuffixes are band, extender and guest markers routers add to a
+// network name; they say nothing about the passphrase
+var ssidSuffixes = []string{"5ghz", "2.4ghz", "5g", "2.4g", "2.4", "2g", "ext", "guest"}
+
+// ssidWords derives seed words from --ssid network names: each name as
+// given and in lowercase, without band and extender suffixes, its parts
+// (split at separators and between letters and digits) and the parts joined
+func ssidWords(spec string) []string {
+	var res []string
+	seen := make(map[string]struct{})
+	digit := func(c byte) bool { return c >= '0' && c <= '9' }
+	add := func(w string) {
+		if _, ok := seen[w]; w != "" && !ok {
+			seen[w] = struct{}{}
+			res = append(res, w)
+		}
+	}
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		add(name)
+		add(strings.ToLower(name))
+		base := name
+		for trimmed := true; trimmed; {
+			trimmed = false
+			for _, suf := range ssidSuffixes {
+				lower := strings.ToLower(base)
+				if strings.HasSuffix(lower, suf) && len(base) > len(suf) {
+					base = strings.TrimRight(base[:len(base)-len(suf)], "-_. ")
+					trimmed = true
+				}
+			}
+		}
+		add(base)
+		add(strings.ToLower(base))
+		var parts []string
+		for _, field := range strings.FieldsFunc(base, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+			start := 0
+			for i := 1; i < len(field); i++ {
+				if digit(field[i]) != digit(field[i-1]) {
+					parts = append(parts, field[start:i])
+					start = i
+				}
+			}
+			parts = append(parts, field[start:])
+		}
+		if len(parts) > 1 {
+			for _, p := range parts {
+				add(p)
+				add(strings.ToLower(p))
+			}
+			add(strings.Join(parts, ""))
+			add(strings.ToLower(strings.Join(parts, "")))
+		}
+	}
+	return res
+}
+
+// patternLocks expands --pattern-locks: every valid Android unlock pattern
+// connecting the given number of dots, written as the digits of the dots
+//
+//	1 2 3
+//	4 5 6
+//	7 8 9
+//
+// A stroke passing over a dot selects it, so the pair may only be joined
+// directly once the dot between is used (1-3 needs 2 first). The patterns
+// come likeliest first, by patternCost.
+func patternLocks(spec string) ([]string, error) {
+	lo, hi, ok := parseLengthRange(spec)
+	if lo == 0 {
+		lo = 4
+	}
+	if hi == 0 {
+		hi = 9
+	}
+	if !ok || lo < 4 || hi > 9 || lo > hi {
+		return nil, fmt.Errorf("invalid --pattern-locks %q (patterns connect 4 to 9 dots, e.g. 4-6)", spec)
+	}
+	type scored struct {
+		digits string
+		cost   float64
+	}
+	var res []scored
+	var used [10]bool
+	path := make([]int, 0, 9)
+	var walk func()
+	walk = func() {
+		if len(path) >= lo {
+			res = append(res, scored{patternDigits(path), patternCost(path)})
+		}
+		if len(path) == hi {
+			return
+		}
+		for next := 1; next <= 9; next++ {
+			if used[next] {
+				continue
+			}
+			if len(path) > 0 {
+				if mid := patternBetween(path[len(path)-1], next); mid != 0 && !used[mid] {
+					continue
+				}
+			}
+			used[next] = true
+			path = append(path, next)
+			walk()
+			path = path[:len(path)-1]
+			used[next] = false
+		}
+	}
+	walk()
+	sort.SliceStable(res, func(i, j int) bool { return res[i].cost < res[j].cost })
+	patterns := make([]string, len(res))
+	for i, p := range res {
+		patterns[i] = p.digits
+	}
+	return patterns, nil
+}
+
+// patternBetween returns the dot a stroke from a to b passes over, or 0
+func patternBetween(a, b int) int {
+	ra, ca, rb, cb := (a-1)/3, (a-1)%3, (b-1)/3, (b-1)%3
+	if (ra+rb)%2 != 0 || (ca+cb)%2 != 0 {
+		return 0
+	}
+	return (ra+rb)/2*3 + (ca+cb)/2 + 1
+}
+
+func patternDigits(path []int) string {
+	b := make([]byte, len(path))
+	for i, d := range path {
+		b[i] = byte('0' + d)
+	}
+	return string(b)
+}
+
+// patternCost scores how unlikely a person is to draw a pattern, after
+// studies of user-chosen unlock patterns: most start in the top-left
+// corner, join neighbouring dots, keep their direction and use few dots
+func patternCost(path []int) float64 {
+	cost := float64(len(path)-4) * 1.5
+	switch path[0] {
+	case 1:
+	case 3, 7, 9:
+		cost++
+	case 2, 4:
+		cost += 1.5
+	default:
+		cost += 2
+	}
+	var prevR, prevC int
+	for i := 1; i < len(path); i++ {
+		a, b := path[i-1]-1, path[i]-1
+		dr, dc := b/3-a/3, b%3-a%3
+		switch adr, adc := max(dr, -dr), max(dc, -dc); {
+		case adr+adc == 1: // Neighbour
+		case adr == 1 && adc == 1: // Diagonal neighbour
+			cost++
+		case adr == 1 || adc == 1: // Knight's move
+			cost += 3
+		default: // Over a used dot
+			cost += 1.5
+		}
+		// Direction of the stroke, so 1-3 and 1-2 count as the same
+		r, c := dr/max(dr, -dr, 1), dc/max(dc, -dc, 1)
+		switch {
+		case i == 1 || (r == prevR && c == prevC):
+		case r == -prevR && c == -prevC: // Doubling back
+			cost++
+		default:
+			cost += 0.5
+		}
+		prevR, prevC = r, c
+	}
+	return cost
+}
+
+// rotationNext maps a season or month to the one after it. Passwords that
+// must be changed every quarter or month tend to move along these.
+var rotationNext = map[string]string{
+	"spring": "summer", "summer": "autumn", "autumn": "winter", "fall": "winter", "winter": "spring",
+	"january": "february", "february": "march", "march": "april", "april": "may",
+	"may": "june", "june": "july", "july": "august", "august": "september",
+	"september": "october", "october": "november", "november": "december", "december": "january",
+	"jan": "feb", "feb": "mar", "mar": "apr", "apr": "may", "jun": "jul", "jul": "aug",
+	"aug": "sep", "sep": "oct", "oct": "nov", "nov": "dec", "dec": "jan",
+}
+
+// rotationWraps are the names whose successor falls in the next year
+var rotationWraps = map[string]bool{"winter": true, "december": true, "dec": true}
+
+// predictRotations guesses what a user changes an expiring password to:
+// the last number incremented by one and two (keeping zero padding, so years
+// and counters move on), the next season or month in the same case (with
+// the number bumped when the year wraps) and one more trailing symbol.
+func predictRotations(word string) []string {
+	if word == "" {
+		return nil
+	}
+	var res []string
+	for by := 1; by <= 2; by++ {
+		if w, ok := incrementLastNumber(word, by); ok {
+			res = append(res, w)
+		}
+	}
+	for start := 0; start < len(word); {
+		end := start
+		for end < len(word) && ((word[end] >= 'a' && word[end] <= 'z') || (word[end] >= 'A' && word[end] <= 'Z')) {
+			end++
+		}
+		if end == start {
+			start++
+			continue
+		}
+		token := word[start:end]
+		if next, ok := rotationNext[strings.ToLower(token)]; ok {
+			w := word[:start] + matchCase(next, token) + word[end:]
+			res = append(res, w)
+			if rotationWraps[strings.ToLower(token)] {
+				if bumped, ok := incrementLastNumber(w, 1); ok {
+					res = append(res, bumped)
+				}
+			}
+		}
+		start = end
+	}
+	if last := word[len(word)-1]; unicode.IsPunct(rune(last)) || unicode.IsSymbol(rune(last)) {
+		res = append(res, word+string(last))
+	} else {
+		res = append(res, word+"!")
+	}
+	return res
+}
+
+// bumpYears finds years in word - runs of exactly 4 digits from 1900 to
+// 2099, or of exactly 2 digits - and writes it with each replaced by the
+// year before, of and after cur in the same width
+func bumpYears(word string, cur int) []string {
+	var res []string
+	for start := 0; start < len(word); {
+		end := start
+		for end < len(word) && word[end] >= '0' && word[end] <= '9' {
+			end++
+		}
+		if end == start {
+			start++
+			continue
+		}
+		digits := word[start:end]
+		n, _ := strconv.Atoi(digits)
+		if (len(digits) == 4 && n >= 1900 && n <= 2099) || len(digits) == 2 {
+			for y := cur - 1; y <= cur+1; y++ {
+				year := strconv.Itoa(y)
+				if len(digits) == 2 {
+					year = fmt.Sprintf("%02d", y%100)
+				}
+				if year != digits {
+					res = append(res, word[:start]+year+word[end:])
+				}
+			}
+		}
+		start = end
+	}
+	return res
+}
+
+// incrementLastNumber adds by (which may be negative) to the last run of
+// digits in word, keeping its width when it was zero-padded (Summer08 ->
+// Summer09, pass10 -> pass9). It reports false without digits or below 0.
+func incrementLastNumber(word string, by int) (string, bool) {
+	end := len(word)
+	for end > 0 && (word[end-1] < '0' || word[end-1] > '9') {
+		end--
+	}
+	start := end
+	for start > 0 && word[start-1] >= '0' && word[start-1] <= '9' {
+		start--
+	}
+	if start == end || end-start > 9 {
+		return "", false
+	}
+	n, _ := strconv.Atoi(word[start:end])
+	if n+by < 0 {
+		return "", false
+	}
+	width := 0
+	if word[start] == '0' {
+		width = end - start
+	}
+	return word[:start] + fmt.Sprintf("%0*d", width, n+by) + word[end:], true
+}
+
+// numberStepRule recognizes the inc-num and dec-num operators of a --rules
+// recipe: "inc-num" steps by 1, "inc-num:N" (or "inc-numN", "--inc-num=N")
+// writes every step from 1 to N. Decrements are negative.
+func numberStepRule(rule string) (int, bool) {
+	for name, sign := range map[string]int{"inc-num": 1, "dec-num": -1} {
+		arg, ok := ruleArg(rule, name)
+		if !ok {
+			continue
+		}
+		if arg = strings.TrimPrefix(arg, ":"); arg == "" {
+			return sign, true
+		}
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 {
+			return 0, false
+		}
+		return sign * n, true
+	}
+	return 0, false
+}
+
+// stepNumber writes word with its last number moved by 1 to |steps| in the
+// direction of steps, or word unchanged when it has no number to move
+func stepNumber(word string, steps int) []string {
+	sign := 1
+	if steps < 0 {
+		sign, steps = -1, -steps
 	}
+	var res []string
+	for k := 1; k <= steps; k++ {
+		if w, ok := incrementLastNumber(word, sign*k); ok {
+			res = append(res, w)
+		}
+	}
+	if res == nil {
+		return []string{word}
+	}
+	return res
+}
+
+// matchCase writes s in the case style of like: all upper, capitalized or
+// lower
+func matchCase(s, like string) string {
+	first, _ := utf8.DecodeRuneInString(like)
+	switch {
+	case strings.ToUpper(like) == like:
+		return strings.ToUpper(s)
+	case unicode.IsUpper(first):
+		return capitalize(s)
+	}
+	return s
 }
 
-func (m *Mangler) addSmartAffixes(word string, res map[string]struct{}) {
+func (m *Mangler) addSmartAffixes(word string, res variantSet) {
 	// Years: current and past 5
-	cur := time.Now().Year()
+	cur := m.config.currentYear()
 	for i := 0; i <= 5; i++ {
 		y := cur - i
 		ys := fmt.Sprintf("%d", y)
-		res[word+ys] = struct{}{}
-		res[ys+word] = struct{}{}
+		res.add(word+ys, "smart-affix")
+		res.add(ys+word, "smart-affix")
 		// Short year
 		if len(ys) >= 4 {
 			sys := ys[2:]
-			res[word+sys] = struct{}{}
-			res[sys+word] = struct{}{}
+			res.add(word+sys, "smart-affix")
+			res.add(sys+word, "smart-affix")
 		}
 	}
 
 	// 123 variations
 	seqs := []string{"1", "12", "123", "1234", "12345", "123456", "0", "01", "012"}
 	for _, s := range seqs {
-		res[word+s] = struct{}{}
-		res[s+word] = struct{}{}
+		res.add(word+s, "smart-affix")
+		res.add(s+word, "smart-affix")
 	}
 
 	// Common symbols
 	syms := []string{"!", ".", "?", "*", "#", "@", "$"}
 	for _, s := range syms {
-		res[word+s] = struct{}{}
-		res[s+word] = struct{}{}
+		res.add(word+s, "smart-affix")
+		res.add(s+word, "smart-affix")
 	}
 }
 
@@ -3,11 +3,29 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"image/png"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"os/exec"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Helper to create a mangler with a captured output buffer
@@ -16,7 +34,7 @@ func createTestMangler(cfg *Config) (*Mangler, *bytes.Buffer) {
 	m := &Mangler{
 		config:           cfg,
 		output:           &buf,
-		seenCRCs:         make(map[uint32]struct{}),
+		seen:             newDedupSet(),
 		blacklistedWords: make(map[string]struct{}),
 		bufWriter:        bufio.NewWriter(&buf),
 	}
@@ -118,6 +136,15 @@ func TestMangleWord_Filters(t *testing.T) {
 		{"NoSymbols_Fail", Config{noSymbols: true}, "abc!", false},
 		{"NoCapitals_Pass", Config{noCapitals: true}, "abc", true},
 		{"NoCapitals_Fail", Config{noCapitals: true}, "Abc", false},
+		{"MinDigits_Pass", Config{minDigits: 2}, "abc12", true},
+		{"MinDigits_Fail", Config{minDigits: 2}, "abc1", false},
+		{"MaxDigits_Fail", Config{maxDigits: 2}, "abc123", false},
+		{"MaxUpper_Fail", Config{maxUpper: 1}, "ABc", false},
+		{"MinSymbols_Pass", Config{minSymbols: 1}, "abc!", true},
+		{"MinClasses_Pass", Config{minClasses: 3}, "Abc1", true},
+		{"MinClasses_Fail", Config{minClasses: 3}, "Abc", false},
+		{"MaxRepeat_Pass", Config{maxRepeat: 2}, "aabb", true},
+		{"MaxRepeat_Fail", Config{maxRepeat: 2}, "aaab", false},
 	}
 
 	for _, tt := range tests {
@@ -153,16 +180,293 @@ func TestMatchesCrunch(t *testing.T) {
 		{"%%%", "Abc", false},
 		{"&&&", "!@#", true},
 		{"&&&", "abc", false},
+		{"*##", "pass12", true},
+		{"*##", "pass1", false},
+		{"*##:8-10", "pass12", false},
+		{"*##:8-10", "password12", true},
+		{"*##:8-10", "password123", false},
+		{"^*:8-", "Password", true},
+		{"^*", "password", false},
+		{"a*z", "az", true},
+		{"a*z", "abcz", true},
+		{"...,###", "123", true},
+		{"###,^^^", "abc", false},
 	}
 
 	for _, tt := range tests {
+		var err error
 		m.config.crunchFilter = tt.filter
+		if m.crunchMasks, err = parseCrunchMasks(tt.filter); err != nil {
+			t.Fatalf("parseCrunchMasks(%q): %v", tt.filter, err)
+		}
 		if got := m.matchesCrunch(tt.input); got != tt.match {
 			t.Errorf("matchesCrunch(%q, %q) = %v, want %v", tt.filter, tt.input, got, tt.match)
 		}
 	}
 }
 
+func TestFitBudget(t *testing.T) {
+	words := []string{"summer", "winter", "monkey", "dragon"}
+	cfg := &Config{mutationLevel: 2, yearsCount: "1980-2020", capital: true, allCases: true, leet: true}
+	m, _ := createTestMangler(cfg)
+	full := m.estimateKeyspace(words).total
+
+	m.budget = int64(full) + 1
+	m.fitBudget(words)
+	if cfg.mutationLevel != 2 || !cfg.allCases || !cfg.leet || cfg.yearsCount == "" {
+		t.Errorf("a budget above the estimate pruned rules: %+v", cfg)
+	}
+
+	m.budget = int64(full / 50)
+	m.fitBudget(words)
+	if got := m.estimateKeyspace(words).total; got > float64(m.budget) {
+		t.Errorf("estimate after pruning = %.0f, budget %d", got, m.budget)
+	}
+	if cfg.mutationLevel == 2 && cfg.allCases && cfg.leet && cfg.yearsCount != "" && cfg.capital {
+		t.Error("nothing was pruned")
+	}
+
+	// Unreachable: every rule goes; the level stays as it no longer matters
+	m.budget = 1
+	m.fitBudget(words)
+	for _, r := range budgetRules {
+		if r.on(cfg) && r.name != "--level" {
+			t.Errorf("%s still enabled with an unreachable budget", r.name)
+		}
+	}
+}
+
+func TestInputWeights(t *testing.T) {
+	osint := []string{"acme", "globex"}
+	generic := []string{"summer", "winter", "monkey", "dragon"}
+	words := append(slices.Clone(osint), generic...)
+	cfg := &Config{mutationLevel: 2, yearsCount: "1980-2020", capital: true, leet: true}
+	m, _ := createTestMangler(cfg)
+	m.weights = make(map[string]float64)
+	assignWeight(m.weights, osint, 5)
+	assignWeight(m.weights, generic, 1)
+
+	// Room for the osint words' full keyspace, not for everything
+	m.budget = int64(m.estimateKeyspace(osint).total * 1.5)
+	m.fitBudget(words)
+	for _, w := range osint {
+		if p := m.profiles[w]; p == nil || p.yearsCount == "" || p.mutationLevel != 2 || !p.leet {
+			t.Errorf("%s (weight 5) lost rules: %+v", w, p)
+		}
+	}
+	if _, ok := m.profiles["summer"]; ok {
+		t.Error("generic words got the unpruned profile")
+	}
+	if cfg.mutationLevel == 2 && cfg.yearsCount != "" && cfg.leet && cfg.capital {
+		t.Error("nothing was pruned for the generic words")
+	}
+
+	// --sort e: the weight multiplies efficacy
+	m, buf := createTestMangler(&Config{sortMode: "e", threads: 1})
+	m.weights = map[string]float64{"zqxj": 1000}
+	if err := m.process([]string{"password", "zqxj"}); err != nil {
+		t.Fatal(err)
+	}
+	m.bufWriter.Flush()
+	if got := strings.Fields(buf.String()); !slices.Equal(got, []string{"zqxj", "password"}) {
+		t.Errorf("weighted efficacy order = %v, want zqxj first", got)
+	}
+
+	// A candidate keeps the highest weight of the inputs it came from,
+	// whichever copy is accepted first
+	for _, words := range [][]string{{"Zqxj", "zqxj", "password"}, {"zqxj", "password", "Zqxj"}} {
+		for _, tt := range []struct {
+			scope  string
+			window int
+		}{{"global", 0}, {"global", 2}, {"worker", 0}} {
+			m, buf := createTestMangler(&Config{sortMode: "e", lower: true, threads: 4, dedupScope: tt.scope})
+			m.window = tt.window
+			m.weights = map[string]float64{"Zqxj": 1000, "zqxj": 1, "password": 1}
+			if err := m.process(words); err != nil {
+				t.Fatal(err)
+			}
+			m.bufWriter.Flush()
+			got := strings.Fields(buf.String())
+			if i, j := slices.Index(got, "zqxj"), slices.Index(got, "password"); i < 0 || j < 0 || i > j {
+				t.Errorf("%v, %s scope, window %d: order %v, want zqxj before password", words, tt.scope, tt.window, got)
+			}
+		}
+	}
+}
+
+func TestSourceTagging(t *testing.T) {
+	m, buf := createTestMangler(&Config{sortMode: "source-then-efficacy", annotate: true, threads: 1})
+	m.sources = make(map[string]int)
+	m.sourceNames = []string{"target.txt", "generic.txt"}
+	assignSource(m.sources, []string{"zqxj"}, 0)
+	assignSource(m.sources, []string{"password", "zqxj"}, 1)
+	if err := m.process([]string{"password", "zqxj"}); err != nil {
+		t.Fatal(err)
+	}
+	m.bufWriter.Flush()
+	want := "zqxj\ttarget.txt\npassword\tgeneric.txt\n"
+	if got := buf.String(); got != want {
+		t.Errorf("source-then-efficacy output = %q, want %q", got, want)
+	}
+
+	rec := jsonRecord("acme1", "acme", "target.txt", nil, &Config{}, nil)
+	if !strings.Contains(rec, `"source":"acme","file":"target.txt"`) {
+		t.Errorf("jsonl record = %s", rec)
+	}
+}
+
+func TestConcurrentAccept(t *testing.T) {
+	m, buf := createTestMangler(&Config{})
+	done := make(chan struct{})
+	for g := 0; g < 8; g++ {
+		go func() {
+			for i := 0; i < 1000; i++ {
+				m.accept(fmt.Sprintf("w%d", i))
+			}
+			done <- struct{}{}
+		}()
+	}
+	for g := 0; g < 8; g++ {
+		<-done
+	}
+	if got := len(getResults(m, buf)); got != 1000 || m.emitted.Load() != 1000 {
+		t.Errorf("wrote %d lines, counted %d; want 1000 of each", got, m.emitted.Load())
+	}
+}
+
+func TestWarmStart(t *testing.T) {
+	m, buf := createTestMangler(&Config{minLength: 8})
+	if err := m.warmStart(20); err != nil {
+		t.Fatal(err)
+	}
+	m.accept("password") // already written
+	m.accept("zqxjzqxj")
+	m.bufWriter.Flush()
+	got := strings.Fields(buf.String())
+	if len(got) == 0 || got[0] != "password" || got[len(got)-1] != "zqxjzqxj" {
+		t.Fatalf("warm start output = %v", got)
+	}
+	for _, w := range got[1:] {
+		if len(w) < 8 {
+			t.Errorf("%q passed --min 8", w)
+		}
+		if w == "password" {
+			t.Error("password was written twice")
+		}
+	}
+
+	// Warm-start words are shaped like the mangled ones
+	m, buf = createTestMangler(&Config{maxBytes: 4, maxBytesAction: "truncate"})
+	if err := m.warmStart(20); err != nil {
+		t.Fatal(err)
+	}
+	m.bufWriter.Flush()
+	got = strings.Fields(buf.String())
+	if len(got) == 0 || got[0] != "1234" {
+		t.Fatalf("warm start output = %v", got)
+	}
+	for _, w := range got {
+		if len(w) > 4 {
+			t.Errorf("%q passed --max-bytes 4", w)
+		}
+	}
+}
+
+func TestCollapseRuns(t *testing.T) {
+	// A limit of 1500 flushes summer while winter is still coming in
+	for _, limit := range []int{collapseMaxHeld, 1500} {
+		out := t.TempDir() + "/cands.txt"
+		m, buf := createTestMangler(&Config{outputFile: out})
+		m.collapser = newRunCollapser(100)
+		m.collapser.limit = limit
+		for i := 0; i < 1000; i++ {
+			m.emit(fmt.Sprintf("summer%03d", i), noOrigin) // one block of 1000
+		}
+		for i := 100; i < 1000; i++ {
+			m.emit(fmt.Sprintf("winter%d", i), noOrigin) // nine blocks of 100
+			if m.collapser.held > limit {
+				t.Fatalf("limit %d: %d candidates held", limit, m.collapser.held)
+			}
+		}
+		for i := 0; i < 10; i++ {
+			m.emit(fmt.Sprintf("%dfall", i), noOrigin) // below the minimum
+		}
+		m.emit("autumn", noOrigin)
+		if err := m.finish(); err != nil {
+			t.Fatal(err)
+		}
+
+		rest := getResults(m, buf)
+		if len(rest) != 11 || rest[0] != "0fall" || rest[10] != "autumn" {
+			t.Errorf("limit %d: leftovers = %v", limit, rest)
+		}
+		base := strings.TrimSuffix(out, ".txt")
+		for file, want := range map[string]string{
+			base + ".a6-d3.words":  "summer\n",
+			base + ".a6-d3.hcmask": "?d?d?d\n",
+			base + ".a6-d2.words":  "winter1\nwinter2\nwinter3\nwinter4\nwinter5\nwinter6\nwinter7\nwinter8\nwinter9\n",
+			base + ".a6-d2.hcmask": "?d?d\n",
+		} {
+			data, err := os.ReadFile(file)
+			if err != nil || string(data) != want {
+				t.Errorf("limit %d: %s = %q (%v), want %q", limit, file, data, err, want)
+			}
+		}
+	}
+}
+
+func TestFitToLength(t *testing.T) {
+	tests := []struct {
+		pad, mode string
+		input     string
+		want      string
+		ok        bool
+	}{
+		{"", "", "summertime", "summerti", true},
+		{"", "", "summer", "", false},
+		{"", "", "password", "password", true},
+		{"!", "", "sun", "sun!!!!!", true},
+		{"ab", "", "summer", "summerab", true},
+		{"ab", "", "summer1", "summer1a", true},
+		{fitDigits, "", "dog", "dog12345", true},
+		{"", "", "größenwahn", "größenwa", true},
+		{"", "bytes", "größenwahn", "größen", true},
+		{"", "bytes", "abcdefgü", "", false}, // ü does not fit into the last byte
+		{"!", "bytes", "abcdefgü", "abcdefg!", true},
+	}
+	for _, tt := range tests {
+		cfg := &Config{fitLength: 8, fitPad: tt.pad, lengthMode: tt.mode}
+		got, ok := cfg.fitToLength(tt.input)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("fitToLength(%q) pad %q %s = %q, %v; want %q, %v", tt.input, tt.pad, tt.mode, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCrunchAnchors(t *testing.T) {
+	tests := []struct {
+		prefix, suffix string
+		input          string
+		match          bool
+	}{
+		{"^^", "", "ABcdef", true},
+		{"^^", "", "Abcdef", false},
+		{"", "##&", "summer24!", true},
+		{"", "##&", "summer2024", false},
+		{"^", "##&", "Summer2024!", true},
+		{"^", "##&", "S1!", false},
+		{"", "##&", "1!", false},
+		{"#,^", "", "9lives", true},
+		{"%", "!,?", "hello?", true},
+	}
+	for _, tt := range tests {
+		cfg := &Config{crunchPrefix: tt.prefix, crunchSuffix: tt.suffix}
+		if got := cfg.matchesCrunchAnchors(tt.input); got != tt.match {
+			t.Errorf("prefix %q suffix %q on %q = %v, want %v", tt.prefix, tt.suffix, tt.input, got, tt.match)
+		}
+	}
+}
+
 func TestGeneratePermutations(t *testing.T) {
 	m, _ := createTestMangler(&Config{})
 	words := []string{"a", "b"}
@@ -192,145 +496,3491 @@ func TestGeneratePermutations(t *testing.T) {
 	}
 }
 
-func TestGenerateAcronym(t *testing.T) {
-	words := []string{"Hello", "World"}
-	got := generateAcronym(words)
-	if got != "HW" {
-		t.Errorf("generateAcronym failed: got %s, want HW", got)
+func TestProcess_PermsAndAcronymAreJobs(t *testing.T) {
+	// Without dedup, a candidate written both by the feeder and by a worker
+	// would show up twice
+	m, buf := createTestMangler(&Config{perms: true, acronym: true, dedupScope: "none", threads: 4})
+	if err := m.process([]string{"alpha", "bravo"}); err != nil {
+		t.Fatal(err)
+	}
+	got := getResults(m, buf)
+	want := "ab,alpha,alphabravo,bravo,bravoalpha"
+	if strings.Join(got, ",") != want {
+		t.Errorf("got %v, want %s", got, want)
 	}
 }
 
-func TestApplySequence(t *testing.T) {
-	// Rule: reverse, then upper
-	cfg := &Config{rulesList: "reverse,upper"}
-	m, buf := createTestMangler(cfg)
-	
-	m.applySequence("abc")
-	got := getResults(m, buf)
-	
-	// Steps:
-	// 1. abc -> cba (reverse)
-	// 2. cba -> CBA (upper)
-	// Result should be CBA
-	
-	if len(got) != 1 || got[0] != "CBA" {
-		t.Errorf("applySequence failed: got %v, want [CBA]", got)
+func TestRot(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"bare flag is rot13", []string{"--rot"}, "apple,nccyr"},
+		{"explicit shift", []string{"--rot=3"}, "apple,dssoh"},
+		{"separate shift", []string{"--rot", "3"}, "apple,dssoh"},
+		{"bare flag before another", []string{"--rot", "-c"}, "Apple,apple,nccyr"},
+		{"rules recipe", []string{"--rules", "rot1,-c"}, "Bqqmf"},
+		{"rules rot13", []string{"--rules", "--rot"}, "nccyr"},
+	}
+	for _, tt := range tests {
+		cfg, err := parseFlags(optionalValues(tt.args))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		cfg.threads = 1
+		m, buf := createTestMangler(cfg)
+		m.mangleWord("apple")
+		if got := strings.Join(getResults(m, buf), ","); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+	var n int
+	if err := (&rotFlag{&n}).Set("30"); err == nil {
+		t.Error("--rot=30 should be rejected")
 	}
 }
 
-func TestGenerateToggleVariations(t *testing.T) {
+func TestKBShift(t *testing.T) {
+	for name, rows := range keyboardLayouts {
+		for _, row := range rows {
+			if utf8.RuneCountInString(row.plain) != utf8.RuneCountInString(row.shifted) {
+				t.Errorf("%s: row %q and its shifted row %q differ in length", name, row.plain, row.shifted)
+			}
+		}
+	}
+
 	tests := []struct {
-		input    string
-		expected []string
+		layout, dir, word, want string
 	}{
-		{
-			"test",
-			[]string{"Test", "tesT", "tEsT", "TeSt"},
-		},
-		{
-			"TEST",
-			[]string{"tEST", "TESt", "tEsT", "TeSt"},
-		},
-		{
-			"a",
-			[]string{"A", "A", "a", "A"}, // Duplicates are handled by the map in the caller, but function returns raw list
-		},
+		{"qwerty", "right", "password", "[sddeptf"},
+		{"qwerty", "left", "password", "oaaaqies"},
+		{"qwerty", "up", "qaz", "1qa"},
+		{"qwerty", "down", "1qa", "qaz"},
+		{"qwerty", "right", "Pass1!", "{sdd2@"}, // Shift state is kept
+		{"qwerty", "left", "q`", "q`"},          // No neighbor: unchanged
+		{"qwertz", "right", "zug", "uih"},
+		{"azerty", "down", "aq", "qw"},
+	}
+	for _, tt := range tests {
+		if got := kbShiftWord(tt.word, kbShiftMaps[tt.layout+":"+tt.dir]); got != tt.want {
+			t.Errorf("%s %s %q = %q, want %q", tt.layout, tt.dir, tt.word, got, tt.want)
+		}
 	}
+}
 
+func TestSubstituteToken(t *testing.T) {
+	tests := []struct {
+		pair, word, want string
+	}{
+		{"acme=globex", "acme2023", "globex2023"},
+		{"acme=globex", "Acme2023!", "Globex2023!"},
+		{"acme=globex", "ACME-acme", "GLOBEX-globex"},
+		{"Acme=GlobeX", "Acme1", "GlobeX1"}, // Exact match: as written
+		{"acme=globex", "pacmen", "pglobexn"},
+		{"acme=", "acmeadmin", "admin"},
+		{"acme=globex", "admin", "admin"},
+	}
 	for _, tt := range tests {
-		got := generateToggleVariations(tt.input)
-		// Sort for comparison
+		sub, err := parseSubstitution(tt.pair)
+		if err != nil {
+			t.Fatalf("parseSubstitution(%q): %v", tt.pair, err)
+		}
+		if got := substituteToken(tt.word, sub); got != tt.want {
+			t.Errorf("%s on %q = %q, want %q", tt.pair, tt.word, got, tt.want)
+		}
+	}
+
+	path := t.TempDir() + "/renames.txt"
+	if err := os.WriteFile(path, []byte("# merger\nfoo=bar\n\nold co=new,co\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	subs, err := loadSubstitutions("acme=globex", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []tokenSub{{"acme", "globex"}, {"foo", "bar"}, {"old co", "new,co"}}
+	if !slices.Equal(subs, want) {
+		t.Errorf("loadSubstitutions = %v, want %v", subs, want)
+	}
+	for _, spec := range []string{"acme", "=globex", "a=b,"} {
+		if _, err := loadSubstitutions(spec, ""); err == nil {
+			t.Errorf("loadSubstitutions(%q) accepted", spec)
+		}
+	}
+}
+
+func TestAddRepeats(t *testing.T) {
+	tests := []struct {
+		repeatTo, sep, word string
+		want                string
+	}{
+		{"4..6", "", "ab", "abab,ababab"},
+		{"6", "", "abc", "abcabc"},
+		{"7..8", "-", "abc", "abc-abc"},
+		{"8..12", "", "abcdefghi", ""}, // Two copies are already too long
+		{"2..4", "", "", ""},
+	}
+	for _, tt := range tests {
+		cfg := &Config{repeatTo: tt.repeatTo, repeatSep: tt.sep}
+		if err := cfg.parseRepeatTo(); err != nil {
+			t.Fatal(err)
+		}
+		res := make(variantSet)
+		addRepeats(cfg, tt.word, res)
+		var got []string
+		for w := range res {
+			got = append(got, w)
+		}
 		sort.Strings(got)
-		sort.Strings(tt.expected)
-		
-		if len(got) != len(tt.expected) {
-			t.Errorf("generateToggleVariations(%q) returned %d results, want %d", tt.input, len(got), len(tt.expected))
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("--repeat-to %s --repeat-sep %q %q = %v, want %s", tt.repeatTo, tt.sep, tt.word, got, tt.want)
 		}
 	}
 }
 
-func TestGetKeyboardWalks(t *testing.T) {
-	walks := getKeyboardWalks()
-	if len(walks) == 0 {
-		t.Error("getKeyboardWalks returned empty list")
+func TestInterleave(t *testing.T) {
+	tests := []struct {
+		a, b, want string
+	}{
+		{"cat", "123", "c1a2t3"},
+		{"123", "cat", "1c2a3t"},
+		{"cats", "12", "c1a2ts"},
+		{"ab", "1234", "a1b234"},
+		{"né", "12", "n1é2"},
+		{"", "12", "12"},
 	}
-	
-	contains := false
-	for _, w := range walks {
-		if w == "qwerty" {
-			contains = true
-			break
+	for _, tt := range tests {
+		if got := interleave(tt.a, tt.b); got != tt.want {
+			t.Errorf("interleave(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
 		}
 	}
-	if !contains {
-		t.Error("getKeyboardWalks missing 'qwerty'")
+
+	m, buf := createTestMangler(&Config{interleaveWords: true, threads: 1})
+	if err := m.process([]string{"ab", "xy"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(getResults(m, buf), ","); got != "ab,axby,xayb,xy" {
+		t.Errorf("--interleave-words = %s", got)
 	}
 }
 
-func TestSmartAffixes(t *testing.T) {
-	m := &Mangler{
-		config: &Config{},
+func TestNumeralAffixes(t *testing.T) {
+	tests := []struct {
+		r      string
+		format func(int) string
+		want   string
+	}{
+		{"1-4", ordinal, "1st,2nd,3rd,4th"},
+		{"11-13", ordinal, "11th,12th,13th"},
+		{"21-23", ordinal, "21st,22nd,23rd"},
+		{"111-112", ordinal, "111th,112th"},
+		{"1-5", romanNumeral, "I,II,III,IV,V"},
+		{"9", romanNumeral, "IX"},
+		{"1994", romanNumeral, "MCMXCIV"},
+		{"3999", romanNumeral, "MMMCMXCIX"},
+		{"0-3", romanNumeral, ""},
+		{"5-2", ordinal, ""},
+		{"4000", romanNumeral, ""},
 	}
-	
-	res := make(map[string]struct{})
-	word := "pass"
-	m.addSmartAffixes(word, res)
-	
-	// Check for current year
-	curYear := time.Now().Year()
-	yearStr := fmt.Sprintf("%d", curYear)
-	if _, ok := res["pass"+yearStr]; !ok {
-		t.Errorf("addSmartAffixes missing current year suffix: %s", yearStr)
+	for _, tt := range tests {
+		if got := strings.Join(numeralAffixes(tt.r, tt.format), ","); got != tt.want {
+			t.Errorf("numeralAffixes(%q) = %s, want %s", tt.r, got, tt.want)
+		}
 	}
-	
-	if len(res) == 0 {
-		t.Error("addSmartAffixes produced no results")
+}
+
+func TestCurrencyAndEmojiAffixes(t *testing.T) {
+	for _, e := range append(append([]string{}, currencySymbols...), emojiSymbols...) {
+		if !utf8.ValidString(e) || utf8.RuneCountInString(e) != 1 {
+			t.Errorf("affix %q is not a single valid code point", e)
+		}
 	}
-	
-	// Check for "123" suffix
-	if _, ok := res["pass123"]; !ok {
-		t.Error("addSmartAffixes missing '123' suffix")
+
+	m, buf := createTestMangler(&Config{currency: true, emoji: true, minLength: 5, maxLength: 5, threads: 1})
+	m.mangleWord("love")
+	got := getResults(m, buf)
+	if want := 2 * (len(currencySymbols) + len(emojiSymbols)); len(got) != want {
+		t.Errorf("got %d candidates of 5 characters, want %d: %v", len(got), want, got)
 	}
-	
-	// Check for "!" suffix
-	if _, ok := res["pass!"]; !ok {
-		t.Error("addSmartAffixes missing '!' suffix")
+	if !slices.Contains(got, "love€") || !slices.Contains(got, "🔥love") {
+		t.Errorf("missing love€ or 🔥love in %v", got)
 	}
 }
 
-func TestLeetMapCoverage(t *testing.T) {
-	// Verify some new mappings exist
-	if len(leetMap['a']) < 3 {
-		t.Error("leetMap['a'] seems to be missing comprehensive mappings")
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"größe", "de"},
+		{"Schatz", "de"},
+		{"café", "fr"},
+		{"château", "fr"},
+		{"corazón", "es"},
+		{"pizza", "it"},
+		{"nothing", "en"},
+		{"москва", "ru"},
+		{"abc", ""},
+		{"password123", ""},
 	}
-	
-	foundAt := false
-	for _, r := range leetMap['a'] {
-		if r == '@' {
-			foundAt = true
-			break
+	for _, tt := range tests {
+		if got := detectLanguage(tt.word); got != tt.want {
+			t.Errorf("detectLanguage(%q) = %q, want %q", tt.word, got, tt.want)
 		}
 	}
-	if !foundAt {
-		t.Error("leetMap['a'] missing '@'")
+
+	m, buf := createTestMangler(&Config{detectLang: true, threads: 1})
+	m.mangleWord("größe")
+	m.mangleWord("abc")
+	got := getResults(m, buf)
+	for _, want := range []string{"groesse", "größesommer", "herbstgröße"} {
+		if !slices.Contains(got, want) {
+			t.Errorf("missing %s in %v", want, got)
+		}
+	}
+	for _, w := range got {
+		if strings.HasPrefix(w, "abc") && w != "abc" {
+			t.Errorf("undetected word got a locale pack: %s", w)
+		}
 	}
 }
 
-func TestCalculateStrength(t *testing.T) {
+func TestNumericAndPhonePatterns(t *testing.T) {
+	for _, p := range []string{"77", "999999", "345", "87654", "6969", "1212"} {
+		if !slices.Contains(numericPatterns, p) {
+			t.Errorf("numericPatterns lacks %s", p)
+		}
+	}
+
+	phones, err := phoneNumbers("NANP:415")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"5551234", "4155551234", "4152006969", "4159990000"} {
+		if !slices.Contains(phones, want) {
+			t.Errorf("phone numbers lack %s", want)
+		}
+	}
+	for _, p := range phones {
+		if len(p) != 7 && len(p) != 10 || strings.HasPrefix(p, "1") || strings.HasPrefix(p, "0") {
+			t.Errorf("bad phone number %q", p)
+		}
+	}
+	for _, spec := range []string{"NANP:123", "NANP:41", "UK:020", "NANP:41a"} {
+		if _, err := phoneNumbers(spec); err == nil {
+			t.Errorf("phoneNumbers(%q) should fail", spec)
+		}
+	}
+}
+
+func TestForHash(t *testing.T) {
 	tests := []struct {
-		pass string
-		want int
+		format string
+		input  string
+		want   []string
 	}{
-		{"abc", 0},       // Too short, simple
-		{"password", 0},  // Common, simple
-		{"Password123!", 4}, // Strong
+		{"descrypt", "password123", []string{"password"}},
+		{"descrypt", "pass", []string{"pass"}},
+		{"descrypt", "pässword", nil},
+		{"bcrypt", strings.Repeat("a", 80), []string{strings.Repeat("a", 72)}},
+		{"ntlm", "pässword", []string{"pässword"}},
+		{"ntlm", strings.Repeat("a", 257), nil},
+		{"wpa2", "short", nil},
+		{"lm", "Password123", []string{"PASSWOR", "D123"}},
+		{"lm", "SummerTime2024!x", []string{"SUMMERT", "IME2024"}},
+		{"lm", "secret", []string{"SECRET"}},
 	}
-	
 	for _, tt := range tests {
-		got := calculateStrength(tt.pass)
-		// Exact score might vary based on implementation details, but we can check ranges
-		if tt.pass == "Password123!" && got < 3 {
-			t.Errorf("calculateStrength(%q) = %d; want >= 3", tt.pass, got)
+		m, _ := createTestMangler(&Config{})
+		limits := hashFormats[tt.format]
+		m.forHash = &limits
+		var got []string
+		m.shape(tt.input, func(s string) { got = append(got, s) })
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("--for-hash %s on %q = %q, want %q", tt.format, tt.input, got, tt.want)
+		}
+	}
+
+	m, buf := createTestMangler(&Config{threads: 2})
+	m.forHash = &hashLimits{significant: 8, ascii: true}
+	if err := m.process([]string{"password1", "password2", "dragon"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := getResults(m, buf); !slices.Equal(got, []string{"dragon", "password"}) {
+		t.Errorf("descrypt output = %v, want one password", got)
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	for _, tt := range []struct {
+		action string
+		want   []string
+	}{
+		{"drop", []string{"abc", "ééé"}},
+		{"truncate", []string{"abc", "abcdef", "ééé"}}, // éééééé is cut to ééé
+	} {
+		m, buf := createTestMangler(&Config{threads: 2, maxBytes: 6, maxBytesAction: tt.action})
+		if err := m.process([]string{"abc", "abcdefgh", "ééé", "éééééé"}); err != nil {
+			t.Fatal(err)
+		}
+		if got := getResults(m, buf); !slices.Equal(got, tt.want) {
+			t.Errorf("--max-bytes 6 %s = %q, want %q", tt.action, got, tt.want)
 		}
+		if n := m.overBytes.Load(); n != 2 {
+			t.Errorf("--max-bytes 6 %s counted %d candidates, want 2", tt.action, n)
+		}
+	}
+}
+
+func TestLMMode(t *testing.T) {
+	cfg, err := parseFlags([]string{"--lm-mode"})
+	if err != nil || cfg.lmMode != "split" {
+		t.Fatalf("bare --lm-mode = %q, %v", cfg.lmMode, err)
+	}
+	for _, args := range [][]string{{"--lm-mode", "recombine"}, {"--lm-mode=recombine"}} {
+		c, err := parseFlags(optionalValues(args))
+		if err != nil {
+			t.Fatalf("%q: %v", args, err)
+		}
+		if c.lmMode != "recombine" {
+			t.Errorf("%q: lm-mode = %q", args, c.lmMode)
+		}
+	}
+	if args := optionalValues([]string{"--lm-mode", "words.txt"}); !slices.Equal(args, []string{"--lm-mode", "words.txt"}) {
+		t.Errorf("--lm-mode took a file as its value: %q", args)
+	}
+	m, _ := createTestMangler(cfg)
+	m.forHash = &hashLimits{significant: lmMaxLength, ascii: true, lm: true, whole: true}
+	var got []string
+	m.shape("Password123456789", func(s string) { got = append(got, s) })
+	if want := []string{"PASSWORD123456", "PASSWOR", "D123456"}; !slices.Equal(got, want) {
+		t.Errorf("split = %q, want %q", got, want)
+	}
+
+	got = lmRecombine([]string{"passwor", "D123", "PASSWOR", "toolongforahalf"})
+	want := []string{"PASSWOR", "D123", "PASSWORPASSWOR", "PASSWORD123"}
+	if !slices.Equal(got, want) {
+		t.Errorf("recombine = %q, want %q", got, want)
+	}
+}
+
+func TestCycleNames(t *testing.T) {
+	got := cycleNames("WinterXYZ")
+	for _, want := range []string{"SpringXYZ", "SummerXYZ", "AutumnXYZ", "FallXYZ"} {
+		if !slices.Contains(got, want) {
+			t.Errorf("cycleNames(WinterXYZ) lacks %s: %v", want, got)
+		}
+	}
+	if slices.Contains(got, "WinterXYZ") {
+		t.Error("cycleNames(WinterXYZ) kept the original")
+	}
+	for word, want := range map[string]string{
+		"MÄRZ2024":   "DEZEMBER2024",
+		"été!":       "hiver!",
+		"123june":    "123july",
+		"Otoño":      "Verano",
+		"my-August1": "my-September1",
+	} {
+		if got := cycleNames(word); !slices.Contains(got, want) {
+			t.Errorf("cycleNames(%q) lacks %q: %v", word, want, got)
+		}
+	}
+	for _, word := range []string{"marshall", "email", "mayday", "wintertime"} {
+		if got := cycleNames(word); len(got) != 0 {
+			t.Errorf("cycleNames(%q) = %v, want none", word, got)
+		}
+	}
+}
+
+func TestBumpYears(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"Giants2019!", "Giants2023!,Giants2024!,Giants2025!"},
+		{"Giants2024!", "Giants2023!,Giants2025!"},
+		{"summer19", "summer23,summer24,summer25"},
+		{"1999abc2001", "2023abc2001,2024abc2001,2025abc2001,1999abc2023,1999abc2024,1999abc2025"},
+		{"pass123", ""},
+		{"pin2345", ""}, // Out of the year range
+		{"password", ""},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(bumpYears(tt.input, 2024), ","); got != tt.want {
+			t.Errorf("bumpYears(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestPredictRotations(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"Summer2023!", []string{"Summer2024!", "Summer2025!", "Autumn2023!", "Summer2023!!"}},
+		{"winter23", []string{"winter24", "winter25", "spring23", "spring24", "winter23!"}},
+		{"pass09", []string{"pass10", "pass11", "pass09!"}},
+		{"DEC2024#", []string{"DEC2025#", "DEC2026#", "JAN2024#", "JAN2025#", "DEC2024##"}},
+		{"waterfall", []string{"waterfall!"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := predictRotations(tt.input); !slices.Equal(got, tt.want) {
+			t.Errorf("predictRotations(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestWifiPreset(t *testing.T) {
+	cfg, err := parseFlags([]string{"--wifi", "--max", "20"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.minLength != 8 || cfg.maxLength != 20 || cfg.dedupOrder != "first" {
+		t.Errorf("--wifi: min %d, max %d, dedup order %q", cfg.minLength, cfg.maxLength, cfg.dedupOrder)
+	}
+	m, _ := createTestMangler(cfg)
+	for word, ok := range map[string]bool{"password": true, "pass": false, "pass word!": true, "pässword": false, "tab\tword": false} {
+		if got := m.passesFilters(word); got != ok {
+			t.Errorf("passesFilters(%q) = %v, want %v", word, got, ok)
+		}
+	}
+
+	words := ssidWords("NETGEAR42-5G, Smith_Family")
+	for _, want := range []string{"NETGEAR42-5G", "NETGEAR42", "netgear42", "NETGEAR", "42", "Smith_Family", "SmithFamily", "smithfamily", "family"} {
+		if !slices.Contains(words, want) {
+			t.Errorf("ssidWords lacks %q: %v", want, words)
+		}
+	}
+	if words[0] != "NETGEAR42-5G" {
+		t.Errorf("ssidWords starts with %q, want the name as given", words[0])
+	}
+}
+
+func TestPatternLocks(t *testing.T) {
+	all, err := patternLocks("4-9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The known number of valid patterns per dot count
+	want := map[int]int{4: 1624, 5: 7152, 6: 26016, 7: 72912, 8: 140704, 9: 140704}
+	got := make(map[int]int)
+	for _, p := range all {
+		got[len(p)]++
+	}
+	for n, c := range want {
+		if got[n] != c {
+			t.Errorf("%d patterns of %d dots, want %d", got[n], n, c)
+		}
+	}
+	for _, p := range []string{"1478", "123654789", "2163"} {
+		if !slices.Contains(all, p) {
+			t.Errorf("valid pattern %s missing", p)
+		}
+	}
+	for _, p := range []string{"1379", "1928", "1212"} {
+		if slices.Contains(all, p) {
+			t.Errorf("invalid pattern %s generated", p)
+		}
+	}
+	if i := slices.Index(all, "1236"); i > 10 {
+		t.Errorf("simple pattern 1236 ranked %d", i)
+	}
+	if slices.Index(all, "1672") < slices.Index(all, "3214") {
+		t.Error("knight's moves 1672 ranked above 3214")
+	}
+	for _, spec := range []string{"3-5", "4-10", "6-4", "x"} {
+		if _, err := patternLocks(spec); err == nil {
+			t.Errorf("patternLocks(%q) should fail", spec)
+		}
+	}
+}
+
+func TestZipcodes(t *testing.T) {
+	pack, err := parseZipPack(strings.NewReader(embeddedZipcodes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra := t.TempDir() + "/pack.txt"
+	os.WriteFile(extra, []byte("# test pack\nde BERLIN 101xx 1020x\nus RI 02903\n"), 0644)
+	if err := pack.load(extra); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		spec  string
+		count int
+		has   string
+		err   bool
+	}{
+		{"us:CA", 6200, "94105", false},
+		{"us:ca,94xxx", 6200, "90210", false}, // 94xxx is already in CA
+		{"us:RI", 1, "02903", false},          // Replaced by the extra pack
+		{"de:Berlin", 110, "10115", false},
+		{"us:12x45,12345", 10, "12945", false},
+		{"us:ZZ", 0, "", true},
+		{"CA", 0, "", true},
+		{"us:xxxxxx", 0, "", true}, // Over maxZipcodes
+	}
+	for _, tt := range tests {
+		codes, err := pack.expand(tt.spec)
+		if (err != nil) != tt.err {
+			t.Errorf("expand(%q) error = %v", tt.spec, err)
+			continue
+		}
+		if len(codes) != tt.count || tt.has != "" && !slices.Contains(codes, tt.has) {
+			t.Errorf("expand(%q) = %d codes, want %d including %q", tt.spec, len(codes), tt.count, tt.has)
+		}
+	}
+}
+
+func TestPositionalLeet(t *testing.T) {
+	tests := []struct {
+		word, positions string
+		full            bool
+		want            string
+	}{
+		{"password", "first,last", false, "passwor|,|assword,|asswor|"},
+		{"password", "vowels", false, "p4ssw0rd,p4ssword,passw0rd"},
+		{"Abc", "1", true, "4bc,@bc,^bc"}, // Capitals are substituted too
+		{"abc", "3", false, "ab("},
+		{"123", "first", false, ""},
+	}
+	for _, tt := range tests {
+		got := positionalLeet(tt.word, tt.positions, tt.full)
+		sort.Strings(got)
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("positionalLeet(%q, %q) = %v, want %s", tt.word, tt.positions, got, tt.want)
+		}
+	}
+	if leetPositionSet("first,middle", []rune("abc")) != nil {
+		t.Error("unknown position should be rejected")
+	}
+}
+
+func TestTypoRuleOperators(t *testing.T) {
+	tests := []struct {
+		rules, word, want string
+	}{
+		{"adjswap2", "password", "psasword"},
+		{"adjswap-2", "password", "passwodr"},
+		{"adjswap8", "password", "password"}, // No next character
+		{"dup1", "password", "ppassword"},
+		{"--dup=-1", "password", "passwordd"},
+		{"del3", "password", "pasword"},
+		{"del-1,dup1", "héllo", "hhéll"},
+		{"del9", "password", "password"},
+		{"del0", "password", "password"}, // Not an operator: unchanged
+		{"strip-digits", "pa55 w0rd!1", "pa wrd!"},
+		{"strip-symbols", "P@ss w0rd!_€", "Pss w0rd"},
+		{"strip-spaces", " pass\tword ", "password"},
+		{"strip-digits,strip-symbols,strip-spaces", "P@ss w0rd!2019", "Psswrd"},
+		{"capital,leet=a@o0", "password", "P@ssw0rd"},
+		{"upper,leet=a4", "banana", "B4N4N4"},
+		{"leet=a", "banana", "banana"}, // Odd pairs: unchanged
+		{"append=2024!,--prepend=Xx", "summer", "Xxsummer2024!"},
+	}
+	for _, tt := range tests {
+		if got := sequenceVariants(tt.rules, tt.word, tt.word); len(got) != 1 || got[0] != tt.want {
+			t.Errorf("--rules %s on %q = %v, want %s", tt.rules, tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestNumberStepRules(t *testing.T) {
+	tests := []struct {
+		rules, word, want string
+	}{
+		{"inc-num", "Summer08", "Summer09"},
+		{"inc-num:3", "Summer08", "Summer09,Summer10,Summer11"},
+		{"--inc-num=2", "pass9!", "pass10!,pass11!"},
+		{"dec-num:2", "Spring2024!", "Spring2023!,Spring2022!"},
+		{"dec-num", "pass10", "pass9"},
+		{"dec-num:2", "pass01", "pass00"}, // Not below zero
+		{"inc-num", "password", "password"},
+		{"inc-num,-c", "summer99", "Summer100"},
+		{"inc-num:0", "pass1", "pass1"}, // Not an operator: unchanged
+	}
+	for _, tt := range tests {
+		if got := strings.Join(sequenceVariants(tt.rules, tt.word, tt.word), ","); got != tt.want {
+			t.Errorf("--rules %s on %q = %s, want %s", tt.rules, tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestRestoreCase(t *testing.T) {
+	tests := []struct {
+		word, source, want string
+	}{
+		{"mcd0nald", "McDonald", "McD0nald"},
+		{"2024mcdonald!", "McDonald", "2024McDonald!"}, // Aligned after a prefix
+		{"MCDONALD", "McDonald", "McDonald"},
+		{"mcdonaldmcdonald", "McDonald", "McDonaldmcdonald"},
+		{"mc", "McDonald", "Mc"},
+		{"élan", "Élan", "Élan"},
+	}
+	for _, tt := range tests {
+		if got := restoreCase(tt.word, tt.source); got != tt.want {
+			t.Errorf("restoreCase(%q, %q) = %q, want %q", tt.word, tt.source, got, tt.want)
+		}
+	}
+
+	// The source word is tracked through chained passes and --rules
+	m, buf := createTestMangler(&Config{lower: true, suffixStrings: "1", restoreCase: true, mutationLevel: 2, threads: 1})
+	m.mangleWord("McDonald")
+	if got := getResults(m, buf); !slices.Contains(got, "McDonald11") || !slices.Contains(got, "mcdonald1") {
+		t.Errorf("--restore-case over two passes = %v", got)
+	}
+	if got := sequenceVariants("lower,double,restore-case", "McDonald", "McDonald"); got[0] != "McDonaldmcdonald" {
+		t.Errorf("restore-case rule = %v", got)
+	}
+}
+
+func TestGenerateAcronym(t *testing.T) {
+	words := []string{"Hello", "World"}
+	got := generateAcronym(words)
+	if got != "HW" {
+		t.Errorf("generateAcronym failed: got %s, want HW", got)
+	}
+}
+
+func TestApplySequence(t *testing.T) {
+	// Rule: reverse, then upper
+	cfg := &Config{rulesList: "reverse,upper"}
+	m, buf := createTestMangler(cfg)
+	
+	m.applySequence("abc")
+	got := getResults(m, buf)
+	
+	// Steps:
+	// 1. abc -> cba (reverse)
+	// 2. cba -> CBA (upper)
+	// Result should be CBA
+	
+	if len(got) != 1 || got[0] != "CBA" {
+		t.Errorf("applySequence failed: got %v, want [CBA]", got)
+	}
+}
+
+func TestGenerateToggleVariations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			"test",
+			[]string{"Test", "tesT", "tEsT", "TeSt"},
+		},
+		{
+			"TEST",
+			[]string{"tEST", "TESt", "tEsT", "TeSt"},
+		},
+		{
+			"a",
+			[]string{"A", "A", "a", "A"}, // Duplicates are handled by the map in the caller, but function returns raw list
+		},
+	}
+
+	for _, tt := range tests {
+		got := generateToggleVariations(tt.input)
+		// Sort for comparison
+		sort.Strings(got)
+		sort.Strings(tt.expected)
+		
+		if len(got) != len(tt.expected) {
+			t.Errorf("generateToggleVariations(%q) returned %d results, want %d", tt.input, len(got), len(tt.expected))
+		}
+	}
+}
+
+func TestGetKeyboardWalks(t *testing.T) {
+	walks := getKeyboardWalks()
+	if len(walks) == 0 {
+		t.Error("getKeyboardWalks returned empty list")
+	}
+	
+	contains := false
+	for _, w := range walks {
+		if w == "qwerty" {
+			contains = true
+			break
+		}
+	}
+	if !contains {
+		t.Error("getKeyboardWalks missing 'qwerty'")
+	}
+}
+
+func TestSmartAffixes(t *testing.T) {
+	m := &Mangler{
+		config: &Config{},
+	}
+	
+	res := make(variantSet)
+	word := "pass"
+	m.addSmartAffixes(word, res)
+	
+	// Check for current year
+	curYear := time.Now().Year()
+	yearStr := fmt.Sprintf("%d", curYear)
+	if _, ok := res["pass"+yearStr]; !ok {
+		t.Errorf("addSmartAffixes missing current year suffix: %s", yearStr)
+	}
+	
+	if len(res) == 0 {
+		t.Error("addSmartAffixes produced no results")
+	}
+	
+	// Check for "123" suffix
+	if _, ok := res["pass123"]; !ok {
+		t.Error("addSmartAffixes missing '123' suffix")
+	}
+	
+	// Check for "!" suffix
+	if _, ok := res["pass!"]; !ok {
+		t.Error("addSmartAffixes missing '!' suffix")
+	}
+}
+
+func TestLeetMapCoverage(t *testing.T) {
+	// Verify some new mappings exist
+	if len(leetMap['a']) < 3 {
+		t.Error("leetMap['a'] seems to be missing comprehensive mappings")
+	}
+	
+	foundAt := false
+	for _, r := range leetMap['a'] {
+		if r == '@' {
+			foundAt = true
+			break
+		}
+	}
+	if !foundAt {
+		t.Error("leetMap['a'] missing '@'")
+	}
+}
+
+func TestCalculateStrength(t *testing.T) {
+	tests := []struct {
+		pass string
+		want int
+	}{
+		{"abc", 0},          // Too short, simple
+		{"password", 1},     // Common, simple
+		{"Password123!", 1}, // Dictionary word with trivial decorations
+		{"P@ssw0rd2024", 1}, // Leet does not hide the base word
+		{"Tr0ub4dor&3x", 4}, // Strong
+		{"xK9#mP2$vL7q", 4}, // Strong
+	}
+
+	for _, tt := range tests {
+		if got := calculateStrength(tt.pass); got != tt.want {
+			t.Errorf("calculateStrength(%q) = %d; want %d", tt.pass, got, tt.want)
+		}
+	}
+}
+
+func TestDictionaryBase(t *testing.T) {
+	tests := []struct {
+		pass string
+		want string
+	}{
+		{"Password123!", "password"},
+		{"P@ssw0rd", "password"},
+		{"2024Summer!", "summer"},
+		{"4dmin", "admin"},
+		{"L1nux#1", "linux"},
+		{"Tr0ub4dor&3x", ""},
+		{"correct-horse", ""},
+		{"pw1", ""},
+	}
+
+	for _, tt := range tests {
+		got, ok := dictionaryBase(tt.pass)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("dictionaryBase(%q) = %q, %v; want %q", tt.pass, got, ok, tt.want)
+		}
+		// A second lookup comes from the cache
+		if again, _ := dictionaryBase(tt.pass); again != got {
+			t.Errorf("cached dictionaryBase(%q) = %q, want %q", tt.pass, again, got)
+		}
+	}
+
+	// --dict words belong to the dictionary that loaded them only
+	path := t.TempDir() + "/dict.txt"
+	os.WriteFile(path, []byte("# extra\nzorblax\n"), 0644)
+	dict, err := loadDictionary(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base, ok := dict.base("Zorblax99"); !ok || base != "zorblax" {
+		t.Errorf("--dict base = %q, %v", base, ok)
+	}
+	if _, ok := dict.base("Password1"); !ok {
+		t.Error("--dict dictionary lost the embedded words")
+	}
+	if _, ok := dictionaryBase("Zorblax99"); ok {
+		t.Error("--dict words leaked into the embedded dictionary")
+	}
+}
+
+func TestPunctuationAffixes(t *testing.T) {
+	got := punctuationAffixes("!?", 2)
+	expected := []string{"!", "?", "!!", "!?", "?!", "??"}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("punctuationAffixes(\"!?\", 2) = %v, want %v", got, expected)
+	}
+
+	if got := punctuationAffixes("", 1); len(got) != len(defaultPunctSet) {
+		t.Errorf("default punctuation set returned %d affixes, want %d", len(got), len(defaultPunctSet))
+	}
+
+	// Duplicate characters in the set must not produce duplicate affixes
+	if got := punctuationAffixes("!!", 2); len(got) != 2 {
+		t.Errorf("punctuationAffixes(\"!!\", 2) = %v, want [! !!]", got)
+	}
+}
+
+func TestMangleWord_PunctPrefix(t *testing.T) {
+	m, buf := createTestMangler(&Config{punctuation: true, punctSet: "!", punctMax: 2, punctPrefix: true})
+	m.mangleWord("pw")
+	got := getResults(m, buf)
+	expected := []string{"!!pw", "!pw", "pw", "pw!", "pw!!"}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("got %v, want %v", got, expected)
+	}
+}
+
+func TestApplyImplied_PunctMax(t *testing.T) {
+	// An explicit --punct-max implies --punctuation even at its default of 1
+	for _, args := range [][]string{{"--punct-max", "1"}, {"--punct-max", "2"}, {"--punct-set", "!"}} {
+		cfg, err := parseFlags(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cfg.punctuation {
+			t.Errorf("%q does not imply --punctuation", args)
+		}
+	}
+}
+
+func TestProcess_FilterOnly(t *testing.T) {
+	cfg := &Config{filterOnly: true, capital: true, minLength: 4, sortMode: "a"}
+	m, buf := createTestMangler(cfg)
+	if err := m.process([]string{"zeta", "abc", "alpha", "zeta"}); err != nil {
+		t.Fatalf("process returned error: %v", err)
+	}
+	m.bufWriter.Flush()
+	// No mutations (no "Zeta"), min length applied, deduplicated and sorted
+	if got := buf.String(); got != "alpha\nzeta\n" {
+		t.Errorf("filter-only output = %q, want %q", got, "alpha\nzeta\n")
+	}
+}
+
+func TestExtSorter_SpillAndMerge(t *testing.T) {
+	// A tiny chunk size forces several on-disk runs
+	s := newExtSorter(2, func(a, b string) bool { return a < b }, true)
+	defer s.cleanup()
+	for _, w := range []string{"pear", "apple", "fig", "apple", "kiwi", "fig", "banana"} {
+		if err := s.add(w); err != nil {
+			t.Fatalf("add failed: %v", err)
+		}
+	}
+	if len(s.runs) == 0 {
+		t.Fatal("expected extSorter to spill runs to disk")
+	}
+
+	var got []string
+	s.each(func(line string) error {
+		if len(got) == 0 || got[len(got)-1] != line {
+			got = append(got, line)
+		}
+		return nil
+	})
+	expected := []string{"apple", "banana", "fig", "kiwi", "pear"}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("merged output = %v, want %v", got, expected)
+	}
+}
+
+func TestRunMerge_Errors(t *testing.T) {
+	dir := t.TempDir()
+	in := dir + "/in.txt"
+	os.WriteFile(in, []byte("a\nb\n"), 0644)
+	// A missing input fails the merge instead of leaving its words out
+	if err := runMerge([]string{in, dir + "/missing.txt", "-o", dir + "/out.txt"}); err == nil || !strings.Contains(err.Error(), "missing.txt") {
+		t.Errorf("runMerge with a missing input: error = %v, want one naming the file", err)
+	}
+
+	// The buffered output only reaches the device on the final flush
+	if _, err := os.Stat("/dev/full"); err == nil {
+		if err := runMerge([]string{in, "-o", "/dev/full"}); err == nil {
+			t.Error("runMerge to a full device should fail")
+		}
+	}
+}
+
+func TestRunFreq(t *testing.T) {
+	dir := t.TempDir()
+	in := dir + "/in.txt"
+	out := dir + "/out.txt"
+	os.WriteFile(in, []byte("a\nb\na\nc\na\nb\n"), 0644)
+
+	// --chunk 1 forces every distinct word through the disk-backed path
+	if err := runFreq([]string{in, "-o", out, "--chunk", "1"}); err != nil {
+		t.Fatalf("runFreq failed: %v", err)
+	}
+	got, _ := os.ReadFile(out)
+	if string(got) != "3\ta\n2\tb\n1\tc\n" {
+		t.Errorf("freq output = %q", got)
+	}
+
+	// A missing input fails the count instead of leaving its words out
+	if err := runFreq([]string{in, dir + "/missing.txt", "-o", out}); err == nil || !strings.Contains(err.Error(), "missing.txt") {
+		t.Errorf("runFreq with a missing input: error = %v, want one naming the file", err)
+	}
+
+	if _, err := os.Stat("/dev/full"); err == nil {
+		if err := runFreq([]string{in, "-o", "/dev/full"}); err == nil {
+			t.Error("runFreq to a full device should fail")
+		}
+	}
+}
+
+func TestParseCount(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+		err  bool
+	}{
+		{"1000", 1000, false},
+		{"10K", 10000, false},
+		{"500M", 500000000, false},
+		{"1e9", 1000000000, false},
+		{"2G", 2000000000, false},
+		{"10k", 10000, false},
+		{"1.5K", 1500, false},
+		{"abc", 0, true},
+		{"10x", 0, true},
+		{"5abc", 0, true},
+		{"10KK", 0, true},
+		{"-5", 0, true},
+		{"99999999T", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseCount(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("parseCount(%q) = %d, %v; want %d, err=%v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestDiskShuffler_Raw(t *testing.T) {
+	d := newDiskShuffler(rand.New(rand.NewSource(1)))
+	if err := d.openBuckets(shuffleBuckets); err != nil {
+		t.Fatal(err)
+	}
+	defer d.cleanup()
+	in := []string{" lead", "trail ", "cr\r", "#hash", "\ufeffbom", "tab\tbed"}
+	for i, w := range in {
+		d.add(w, origin{weight: 1, source: i - 1})
+	}
+	var got []string
+	if err := d.drain(func(w string, from origin) {
+		// The input index comes back with the word
+		if i := slices.Index(in, w); i-1 != from.source {
+			t.Errorf("%q came back from input %d, want %d", w, from.source, i-1)
+		}
+		got = append(got, w)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	want := append([]string(nil), in...)
+	sort.Strings(want)
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("spilled words = %q, want %q", got, want)
+	}
+}
+
+func TestReservoirSampler(t *testing.T) {
+	r := newReservoirSampler(10, rand.New(rand.NewSource(1)))
+	for i := 0; i < 1000; i++ {
+		r.add(fmt.Sprintf("w%04d", i), origin{weight: 1, source: i})
+	}
+	var got []string
+	for _, w := range r.words() {
+		if w.word != fmt.Sprintf("w%04d", w.from.source) {
+			t.Errorf("%s sampled with input %d", w.word, w.from.source)
+		}
+		got = append(got, w.word)
+	}
+	if len(got) != 10 {
+		t.Fatalf("sample size = %d, want 10", len(got))
+	}
+	// Samples are returned in stream order
+	if !sort.StringsAreSorted(got) {
+		t.Errorf("sample not in stream order: %v", got)
+	}
+}
+
+func TestDiskShuffler(t *testing.T) {
+	// A 64-byte bucket limit makes drain split every bucket, more than once
+	for _, bucketBytes := range []int64{shuffleBucketBytes, 64} {
+		d := newDiskShuffler(rand.New(rand.NewSource(1)))
+		d.bucketBytes = bucketBytes
+		defer d.cleanup()
+		if err := d.openBuckets(2); err != nil {
+			t.Fatalf("openBuckets failed: %v", err)
+		}
+		var in []string
+		for i := 0; i < 500; i++ {
+			w := fmt.Sprintf("w%03d", i)
+			in = append(in, w)
+			d.add(w, origin{weight: 1, source: i})
+		}
+		var out []string
+		if err := d.drain(func(w string, from origin) {
+			if w != fmt.Sprintf("w%03d", from.source) {
+				t.Errorf("bucket limit %d: %s came back from input %d", bucketBytes, w, from.source)
+			}
+			out = append(out, w)
+		}); err != nil {
+			t.Fatalf("bucket limit %d: drain failed: %v", bucketBytes, err)
+		}
+		if strings.Join(out, ",") == strings.Join(in, ",") {
+			t.Errorf("bucket limit %d: output was not shuffled", bucketBytes)
+		}
+		sort.Strings(out)
+		if strings.Join(out, ",") != strings.Join(in, ",") {
+			t.Errorf("bucket limit %d: shuffled output lost or duplicated words", bucketBytes)
+		}
+	}
+}
+
+func TestLengthMode(t *testing.T) {
+	word := "größe" // 5 runes, 7 bytes
+	tests := []struct {
+		mode      string
+		maxLength int
+		shouldOut bool
+	}{
+		{"runes", 5, true},
+		{"", 5, true},
+		{"bytes", 5, false},
+		{"bytes", 7, true},
+	}
+	for _, tt := range tests {
+		m, buf := createTestMangler(&Config{lengthMode: tt.mode, maxLength: tt.maxLength})
+		m.writeWord(word)
+		if got := len(getResults(m, buf)) > 0; got != tt.shouldOut {
+			t.Errorf("mode %q max %d: output=%v, want %v", tt.mode, tt.maxLength, got, tt.shouldOut)
+		}
+	}
+
+	m := &Mangler{config: &Config{crunchFilter: "....."}, crunchMasks: []crunchMask{{pattern: "....."}}}
+	if !m.matchesCrunch("abcdé") {
+		t.Error("rune mode crunch should treat é as a single position")
+	}
+	m.config.lengthMode = "bytes"
+	if m.matchesCrunch("abcdé") {
+		t.Error("byte mode crunch should count é as two positions")
+	}
+}
+
+func TestChainPasses(t *testing.T) {
+	if got := (&Config{}).chainPasses(); len(got) != 1 {
+		t.Errorf("level 0 passes = %d, want 1", len(got))
+	}
+	if got := (&Config{mutationLevel: 3}).chainPasses(); len(got) != 3 || got[2] != familyCase|familyAffix {
+		t.Errorf("level 3 passes = %v", got)
+	}
+	if got := (&Config{mutationLevel: 1, chainDepth: 5}).chainPasses(); len(got) != 5 {
+		t.Errorf("chain-depth 5 passes = %d, want 5", len(got))
+	}
+}
+
+func TestChainMangle_Level2(t *testing.T) {
+	m, buf := createTestMangler(&Config{mutationLevel: 2, reverse: true, suffixStrings: "1"})
+	m.mangleWord("ab")
+	got := getResults(m, buf)
+	// Pass 1: ab, ba, ab1. Pass 2 re-mangles each of those.
+	expected := []string{"1ba", "ab", "ab1", "ab11", "ba", "ba1"}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("got %v, want %v", got, expected)
+	}
+}
+
+func TestDeterministicOutput(t *testing.T) {
+	run := func() string {
+		cfg := &Config{deterministic: true, threads: 8, capital: true, leet: true, smartAffix: true}
+		m, buf := createTestMangler(cfg)
+		m.rng = newRand(cfg)
+		if err := m.process([]string{"summer", "yellow", "autumn"}); err != nil {
+			t.Fatal(err)
+		}
+		m.bufWriter.Flush()
+		return buf.String()
+	}
+	first := run()
+	for i := 0; i < 5; i++ {
+		if got := run(); got != first {
+			t.Fatalf("run %d differs from the first run", i+2)
+		}
+	}
+	// Words come out in input order with the pinned year
+	year := strings.Index(first, "\nsummer2024\n")
+	if year < 0 || year > strings.Index(first, "\nyellow\n") {
+		t.Errorf("summer2024 missing or after the yellow variants:\n%.200s", first)
+	}
+}
+
+func TestEstimateKeyspace(t *testing.T) {
+	m, _ := createTestMangler(&Config{capital: true, suffixRange: "0-9"})
+	est := m.estimateKeyspace([]string{"alpha", "bravo"})
+	// word + capital + 10 suffixes per word
+	if est.perWord != 12 || est.total != 24 {
+		t.Errorf("estimate = %+v, want 12 per word, 24 total", est)
+	}
+
+	m.config.mutationLevel = 2
+	if est := m.estimateKeyspace([]string{"alpha"}); est.perWord <= 12 {
+		t.Errorf("level 2 estimate should exceed a single pass, got %v", est.perWord)
+	}
+}
+
+func TestParseOutputLimit(t *testing.T) {
+	tests := []struct {
+		in           string
+		count, bytes int64
+		ok           bool
+	}{
+		{"500M", 500e6, 0, true},
+		{"1B", 1e9, 0, true}, // B alone still means billion
+		{"500MB", 0, 500e6, true},
+		{"2gb", 0, 2e9, true},
+		{"10k", 10e3, 0, true},
+		{"lots", 0, 0, false},
+	}
+	for _, tt := range tests {
+		count, bytes, err := parseOutputLimit(tt.in)
+		if (err == nil) != tt.ok || count != tt.count || bytes != tt.bytes {
+			t.Errorf("parseOutputLimit(%q) = %d, %d, %v; want %d, %d, ok=%v", tt.in, count, bytes, err, tt.count, tt.bytes, tt.ok)
+		}
+	}
+}
+
+func TestOutputLimits(t *testing.T) {
+	words := []string{"alpha", "bravo", "charlie", "delta", "echo"}
+	m, buf := createTestMangler(&Config{threads: 1, capital: true, upper: true})
+	m.limits.maxCount = 7
+	if err := m.process(words); err != nil {
+		t.Fatal(err)
+	}
+	if got := getResults(m, buf); len(got) != 7 || !m.limits.stopped.Load() {
+		t.Fatalf("got %d candidates (stopped=%v), want 7", len(got), m.limits.stopped.Load())
+	}
+	// Three candidates per word: alpha and bravo are done, charlie was cut off
+	if m.limits.doneUpTo != 2 {
+		t.Errorf("doneUpTo = %d, want 2", m.limits.doneUpTo)
+	}
+
+	// Resuming skips the finished words
+	m, buf = createTestMangler(&Config{threads: 1, capital: true, upper: true})
+	m.skip = 2
+	if err := m.process(words); err != nil {
+		t.Fatal(err)
+	}
+	got := getResults(m, buf)
+	if len(got) != 9 || got[0] != "CHARLIE" {
+		t.Errorf("resumed output = %v, want the 9 candidates of charlie, delta and echo", got)
+	}
+
+	m, buf = createTestMangler(&Config{threads: 1})
+	m.limits.maxBytes = 12 // "alpha\nbravo\n"
+	m.process(words)
+	if got := getResults(m, buf); strings.Join(got, ",") != "alpha,bravo" {
+		t.Errorf("byte-limited output = %v, want alpha,bravo", got)
+	}
+}
+
+func TestCheckDiskSpace(t *testing.T) {
+	if _, ok := freeDiskSpace(t.TempDir()); !ok {
+		t.Skip("free space is not available on this platform")
+	}
+	// 30 permuted words estimate far more output than any disk holds
+	words := make([]string, 30)
+	for i := range words {
+		words[i] = fmt.Sprintf("word%d", i)
+	}
+	cfg := &Config{perms: true, outputFile: t.TempDir() + "/out.txt"}
+	if err := checkDiskSpace(cfg, nil, words); err == nil || !strings.Contains(err.Error(), "--assume-yes") {
+		t.Errorf("checkDiskSpace error = %v, want a free space error", err)
+	}
+	cfg.maxOutput = "1MB"
+	if err := checkDiskSpace(cfg, nil, words); err != nil {
+		t.Errorf("--max-output 1MB should fit: %v", err)
+	}
+	cfg.maxOutput, cfg.assumeYes = "", true
+	if err := checkDiskSpace(cfg, nil, words); err != nil {
+		t.Errorf("--assume-yes should only warn: %v", err)
+	}
+	if err := checkDiskSpace(&Config{outputFile: cfg.outputFile}, nil, words[:3]); err != nil {
+		t.Errorf("small output should fit: %v", err)
+	}
+}
+
+func TestProcess_ChainConcurrent(t *testing.T) {
+	words := []string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot"}
+	outputFor := func(threads int) []string {
+		cfg := &Config{mutationLevel: 2, threads: threads, capital: true, reverse: true, suffixStrings: "1,2", minLength: 6}
+		m, buf := createTestMangler(cfg)
+		if err := m.process(words); err != nil {
+			t.Fatalf("process failed: %v", err)
+		}
+		return getResults(m, buf)
+	}
+	single := outputFor(1)
+	multi := outputFor(8)
+	if strings.Join(single, ",") != strings.Join(multi, ",") {
+		t.Errorf("-L 2 output differs between 1 and 8 threads: %d vs %d results", len(single), len(multi))
+	}
+	// Short intermediates must still be chained: "echo" -> "echo1" -> "echo11"
+	found := false
+	for _, w := range multi {
+		if w == "echo11" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("expected chained candidate echo11 in output")
+	}
+}
+
+func TestProcess_WorkerDedupScope(t *testing.T) {
+	words := []string{"alpha", "alpha", "bravo", "Alpha", "bravo"}
+	outputFor := func(scope string, threads int) []string {
+		cfg := &Config{threads: threads, dedupScope: scope, capital: true, suffixStrings: "1"}
+		m, buf := createTestMangler(cfg)
+		if err := m.process(words); err != nil {
+			t.Fatalf("process failed: %v", err)
+		}
+		m.bufWriter.Flush()
+		if scope == "worker" {
+			for i := range m.seen.shards {
+				if n := len(m.seen.shards[i].crcs); n > 0 {
+					t.Errorf("worker scope filled the global dedup set (%d in shard %d)", n, i)
+				}
+			}
+		}
+		// Raw output must contain no duplicates, across workers too
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		seen := make(map[string]bool)
+		for _, l := range lines {
+			if seen[l] {
+				t.Errorf("scope %s, %d threads: duplicate candidate %q", scope, threads, l)
+			}
+			seen[l] = true
+		}
+		sort.Strings(lines)
+		return lines
+	}
+	global := strings.Join(outputFor("global", 4), ",")
+	for _, threads := range []int{1, 4} {
+		if worker := strings.Join(outputFor("worker", threads), ","); worker != global {
+			t.Errorf("worker scope output on %d threads %q differs from global %q", threads, worker, global)
+		}
+	}
+
+	// The origin of a candidate survives the spill file
+	d, err := newWorkerDedup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.cleanup()
+	d.add("a\tb", origin{weight: 2.5, source: 3})
+	d.add("a\tb", noOrigin)
+	d.add("c", noOrigin)
+	var got []sinkWord
+	if err := d.replay(func(w string, from origin) { got = append(got, sinkWord{w, from}) }); err != nil {
+		t.Fatal(err)
+	}
+	if want := []sinkWord{{"a\tb", origin{2.5, 3}}, {"c", noOrigin}}; !slices.Equal(got, want) {
+		t.Errorf("replayed %v, want %v", got, want)
+	}
+}
+
+func TestProcess_DedupOrderFirst(t *testing.T) {
+	var words []string
+	for i := 0; i < 50; i++ {
+		// Later words repeat candidates of earlier ones
+		words = append(words, fmt.Sprintf("word%d", i), fmt.Sprintf("Word%d", i/2))
+	}
+	output := func(threads int, words []string) []string {
+		m, buf := createTestMangler(&Config{threads: threads, dedupOrder: "first", capital: true, reverse: true})
+		if err := m.process(words); err != nil {
+			t.Fatalf("process failed: %v", err)
+		}
+		m.bufWriter.Flush()
+		return strings.Fields(buf.String())
+	}
+	// The input word whose variants first include each candidate
+	first := make(map[string]int)
+	for i, w := range words {
+		for _, c := range output(1, []string{w}) {
+			if _, ok := first[c]; !ok {
+				first[c] = i
+			}
+		}
+	}
+	for run := 0; run < 5; run++ {
+		got := output(8, words)
+		if len(got) != len(first) {
+			t.Fatalf("%d candidates, want %d", len(got), len(first))
+		}
+		for i := 1; i < len(got); i++ {
+			if first[got[i]] < first[got[i-1]] {
+				t.Fatalf("%q (word %d) written after %q (word %d)", got[i], first[got[i]], got[i-1], first[got[i-1]])
+			}
+		}
+	}
+}
+
+func TestProcess_Ordered(t *testing.T) {
+	var words []string
+	for i := 0; i < 200; i++ {
+		words = append(words, fmt.Sprintf("word%d", i))
+	}
+	output := func(cfg *Config) string {
+		m, buf := createTestMangler(cfg)
+		if err := m.process(words); err != nil {
+			t.Fatalf("process failed: %v", err)
+		}
+		m.bufWriter.Flush()
+		return buf.String()
+	}
+	// --ordered writes each word's variants before the next word's
+	cfg := &Config{threads: 8, ordered: true, capital: true, reverse: true}
+	cfg.applyImplied(nil)
+	last := -1
+	for _, c := range strings.Fields(output(cfg)) {
+		n, _ := strconv.Atoi(strings.TrimLeft(strings.ToLower(c), "word"))
+		if strings.HasSuffix(c, "drow") {
+			n, _ = strconv.Atoi(reverseString(strings.TrimSuffix(c, "drow")))
+		}
+		if n < last {
+			t.Fatalf("%q (word %d) written after word %d", c, n, last)
+		}
+		last = n
+	}
+	if last != len(words)-1 {
+		t.Errorf("last word written is %d, want %d", last, len(words)-1)
+	}
+
+	// --deterministic is byte-identical on one and eight threads
+	one, eight := &Config{threads: 1, deterministic: true, capital: true, reverse: true}, &Config{threads: 8, deterministic: true, capital: true, reverse: true}
+	if output(one) != output(eight) {
+		t.Error("--deterministic output changed with 8 threads")
+	}
+
+	// The feeder stops once the window is full, until the oldest job commits
+	var accepted []string
+	o := newOrderedCommit(2, func(c orderedCandidate) { accepted = append(accepted, c.word) })
+	o.reserve()
+	o.reserve()
+	blocked := make(chan struct{})
+	go func() {
+		o.reserve()
+		close(blocked)
+	}()
+	// Job 1 is only done once its candidates are accepted, after job 0's
+	o.commit(1, []orderedCandidate{{word: "b"}}, func() { accepted = append(accepted, "done 1") })
+	select {
+	case <-blocked:
+		t.Fatal("reserve did not wait for job 0")
+	case <-time.After(20 * time.Millisecond):
+	}
+	o.commit(0, []orderedCandidate{{word: "a"}}, nil)
+	<-blocked
+	if want := []string{"a", "b", "done 1"}; !slices.Equal(accepted, want) {
+		t.Errorf("accepted %v, want %v", accepted, want)
+	}
+}
+
+func TestProcess_RelaxedDedupScopes(t *testing.T) {
+	words := []string{"alpha", "alpha", "Alpha"}
+	count := func(scope string) int {
+		m, buf := createTestMangler(&Config{threads: 1, dedupScope: scope, capital: true})
+		if err := m.process(words); err != nil {
+			t.Fatalf("process failed: %v", err)
+		}
+		m.bufWriter.Flush()
+		return strings.Count(buf.String(), "\n")
+	}
+	// alpha yields alpha and Alpha, Alpha only Alpha
+	tests := []struct {
+		scope string
+		want  int
+	}{
+		{"global", 2},
+		{"word", 5},
+		{"none", 5},
+	}
+	for _, tt := range tests {
+		if got := count(tt.scope); got != tt.want {
+			t.Errorf("scope %s: %d candidates, want %d", tt.scope, got, tt.want)
+		}
+	}
+}
+
+func TestLoadWordsMmap(t *testing.T) {
+	path := t.TempDir() + "/words.txt"
+	os.WriteFile(path, []byte("alpha\n\n  bravo \r\ncharlie"), 0644)
+
+	words, release, err := (&wordLoader{}).loadMmap(path)
+	if err != nil {
+		t.Skipf("mmap unavailable: %v", err)
+	}
+	defer release()
+	if strings.Join(words, ",") != "alpha,bravo,charlie" {
+		t.Errorf("loadMmap = %q", words)
+	}
+}
+
+func TestWordLoader_CRLFLineLength(t *testing.T) {
+	// The CR of a CRLF (or of an unterminated last line) is not part of the
+	// line length, whether the file is read buffered or mapped
+	input := "abc\r\nabcd\r\nxyz\r"
+	path := t.TempDir() + "/words.txt"
+	os.WriteFile(path, []byte(input), 0644)
+
+	l := &wordLoader{maxLineLen: 3}
+	words, err := l.load(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if strings.Join(words, ",") != "abc,xyz" || l.longLines != 1 {
+		t.Errorf("load = %q with %d long lines, want abc,xyz with 1", words, l.longLines)
+	}
+
+	lm := &wordLoader{maxLineLen: 3}
+	mapped, release, err := lm.loadMmap(path)
+	if err != nil {
+		t.Skipf("mmap unavailable: %v", err)
+	}
+	defer release()
+	if strings.Join(mapped, ",") != "abc,xyz" || lm.longLines != 1 {
+		t.Errorf("loadMmap = %q with %d long lines, want abc,xyz with 1", mapped, lm.longLines)
+	}
+}
+
+func TestWordLoader_LongLines(t *testing.T) {
+	long := strings.Repeat("x", 200*1024)
+	input := "alpha\n" + long + "\nbravo\n" + long[:100] + "\r\ncharlie"
+
+	tests := []struct {
+		name       string
+		maxLineLen int
+		wantWords  int
+		wantLong   int
+	}{
+		{"default limit keeps everything", defaultMaxLineLen, 5, 0},
+		{"no limit", 0, 5, 0},
+		{"long line skipped", 1024, 4, 1},
+		{"both long lines skipped", 50, 3, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &wordLoader{maxLineLen: tt.maxLineLen}
+			words, err := l.load(strings.NewReader(input))
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			if len(words) != tt.wantWords || l.longLines != tt.wantLong {
+				t.Errorf("got %d words, %d long lines; want %d, %d", len(words), l.longLines, tt.wantWords, tt.wantLong)
+			}
+			if words[len(words)-1] != "charlie" {
+				t.Errorf("loading stopped early, last word %q", words[len(words)-1])
+			}
+		})
+	}
+}
+
+func TestWordLoader_CommentsAndBOM(t *testing.T) {
+	input := "\uFEFF# Source: SecLists\nalpha\n  # indented comment\n\n\uFEFFbravo\n#hashtag"
+
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{"", "# Source: SecLists,alpha,# indented comment,bravo,#hashtag"},
+		{"#", "alpha,bravo"},
+		{"//", "# Source: SecLists,alpha,# indented comment,bravo,#hashtag"},
+	}
+
+	for _, tt := range tests {
+		l := &wordLoader{commentPrefix: tt.prefix}
+		words, _ := l.load(strings.NewReader(input))
+		if got := strings.Join(words, ","); got != tt.want {
+			t.Errorf("prefix %q: got %q, want %q", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestWordLoader_LineMode(t *testing.T) {
+	input := "john smith\nalice\n  mary\tann  lee \n"
+
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{"keep", "john smith,alice,mary\tann  lee"},
+		{"split", "john,smith,alice,mary,ann,lee"},
+		{"both", "john smith,john,smith,alice,mary\tann  lee,mary,ann,lee"},
+	}
+
+	for _, tt := range tests {
+		l := &wordLoader{lineMode: tt.mode}
+		words, _ := l.load(strings.NewReader(input))
+		if got := strings.Join(words, ","); got != tt.want {
+			t.Errorf("mode %q: got %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestWordLoader_SeedLength(t *testing.T) {
+	input := "a\nab\nabc\nabcd\ngröße\nx y zz\n"
+
+	tests := []struct {
+		name    string
+		l       wordLoader
+		want    string
+		dropped int
+	}{
+		{"off", wordLoader{}, "a,ab,abc,abcd,größe,x y zz", 0},
+		{"min", wordLoader{seedMin: 3}, "abc,abcd,größe,x y zz", 2},
+		{"max", wordLoader{seedMax: 4}, "a,ab,abc,abcd", 2},
+		{"bytes", wordLoader{seedMax: 6, byteLen: true}, "a,ab,abc,abcd,x y zz", 1},
+		{"after split", wordLoader{seedMin: 2, lineMode: "split"}, "ab,abc,abcd,größe,zz", 3},
+	}
+
+	for _, tt := range tests {
+		words, _ := tt.l.load(strings.NewReader(input))
+		if got := strings.Join(words, ","); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+		if tt.l.seedDropped != tt.dropped {
+			t.Errorf("%s: dropped %d, want %d", tt.name, tt.l.seedDropped, tt.dropped)
+		}
+	}
+}
+
+func TestStopwords(t *testing.T) {
+	en, err := loadStopwords("en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := t.TempDir() + "/stop.txt"
+	if err := os.WriteFile(path, []byte("# corp filler\nInc\nltd\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	custom, err := loadStopwords(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadStopwords(t.TempDir() + "/missing.txt"); err == nil {
+		t.Error("missing stop word file: expected an error")
+	}
+
+	input := "The Quick fox\nand\nACME inc\nwith\n"
+	tests := []struct {
+		name string
+		stop map[string]struct{}
+		want string
+	}{
+		{"en", en, "Quick,fox,ACME,inc"},
+		{"file", custom, "The,Quick,fox,and,ACME,with"},
+	}
+	for _, tt := range tests {
+		l := &wordLoader{lineMode: "split", stopwords: tt.stop}
+		words, _ := l.load(strings.NewReader(input))
+		if got := strings.Join(words, ","); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBuiltinLists(t *testing.T) {
+	in, err := openInput("builtin:common")
+	if err != nil {
+		t.Fatal(err)
+	}
+	words, _ := loadWords(in)
+	in.Close()
+	if !slices.Contains(words, "password") {
+		t.Errorf("builtin:common is missing %q", "password")
+	}
+	if _, err := openInput("builtin:nope"); err == nil || !strings.Contains(err.Error(), "top-passwords") {
+		t.Errorf("unknown list: got %v", err)
+	}
+	sizes := map[string]int{"eff-long": 7776, "eff-short": 1296, "en-freq": 32545, "top-passwords": 1000}
+	for _, l := range builtinLists {
+		in, err := openBuiltinList(l.name)
+		if err != nil {
+			t.Errorf("builtin:%s: %v", l.name, err)
+			continue
+		}
+		words, _ := loadWords(in)
+		if n, ok := sizes[l.name]; (ok && len(words) != n) || len(words) == 0 {
+			t.Errorf("builtin:%s has %d words, want %d", l.name, len(words), n)
+		}
+	}
+	eff, _ := openBuiltinList("eff-long")
+	if words, _ := loadWords(eff); len(words) == 0 || words[0] != "abacus" || words[len(words)-1] != "zoom" {
+		t.Errorf("builtin:eff-long should start at abacus and end at zoom, without the dice rolls")
+	}
+
+	published := "11111\tabacus\n11112\tabdomen\n\nthe 2313584\nof 1290121\nice cream\n"
+	if got := listWords(published); got != "abacus\nabdomen\nthe\nof\nice cream\n" {
+		t.Errorf("listWords = %q", got)
+	}
+
+	path := t.TempDir() + "/freq.txt"
+	if err := os.WriteFile(path, []byte("the 100\nsummer 50\nwinter 10\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { freqRanks = nil }()
+	base := getWordEfficacy("Summer1")
+	if err := loadFrequencyList(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := getWordEfficacy("Summer1"); got <= getWordEfficacy("Winter1") || got <= base {
+		t.Errorf("--freq-list did not rank summer above winter and unlisted words")
+	}
+	if getWordEfficacy("qzxv1") != getWordEfficacy("abcd1") {
+		t.Errorf("unlisted words should keep their weight")
+	}
+}
+
+func TestExtractField(t *testing.T) {
+	tests := []struct {
+		line   string
+		format string
+		col    int
+		want   string
+		ok     bool
+	}{
+		{"alice:s3cr:et", "userpass", 2, "s3cr:et", true},
+		{"alice:s3cr:et", "userpass", 1, "alice", true},
+		{"nocolon", "userpass", 2, "", false},
+		{"a\tb\tc", "tsv", 3, "c", true},
+		{"a\tb", "tsv", 3, "", false},
+		{"1,bob,hunter2", "csv", 3, "hunter2", true},
+		{`1,"smith, bob","pa""ss,word"`, "csv", 2, "smith, bob", true},
+		{`1,"smith, bob","pa""ss,word"`, "csv", 3, `pa"ss,word`, true},
+		{"1,bob", "csv", 3, "", false},
+		{"1,,x", "csv", 2, "", true},
+	}
+
+	for _, tt := range tests {
+		got, ok := extractField(tt.line, tt.format, tt.col)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("extractField(%q, %s, %d) = %q, %v; want %q, %v", tt.line, tt.format, tt.col, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	l := newWordLoader(&Config{inputFormat: "userpass"})
+	words, _ := l.load(strings.NewReader("alice:pw1\nbroken\nbob:pw2\n"))
+	if strings.Join(words, ",") != "pw1,pw2" || l.shortLines != 1 {
+		t.Errorf("userpass load = %q (short %d)", words, l.shortLines)
+	}
+
+	// Unset, --column keeps 0 so the format picks its column
+	cfg := &Config{}
+	fs := newFlagSet(cfg, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	for _, v := range []string{"0", "-2", "x"} {
+		if err := fs.Set("column", v); err == nil {
+			t.Errorf("--column %s accepted", v)
+		}
+	}
+	if cfg.column != 0 {
+		t.Errorf("rejected values changed the column to %d", cfg.column)
+	}
+	if err := fs.Set("column", "3"); err != nil || cfg.column != 3 {
+		t.Errorf("--column 3 = %d, %v", cfg.column, err)
+	}
+}
+
+func TestJSONField(t *testing.T) {
+	tests := []struct {
+		line string
+		path string
+		want string
+		ok   bool
+	}{
+		{`{"password":"hunter2"}`, "password", "hunter2", true},
+		{`{"creds":{"password":"s3cret"}}`, "creds.password", "s3cret", true},
+		{`{"pins":[1234,"0000"]}`, "pins.0", "1234", true},
+		{`{"pins":[1234,"0000"]}`, "pins.1", "0000", true},
+		{`{"pins":[1234]}`, "pins.5", "", false},
+		{`{"pin":123456789012345678}`, "pin", "123456789012345678", true},
+		{`{"password":null}`, "password", "", false},
+		{`{"user":"bob"}`, "password", "", false},
+		{`not json`, "password", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := jsonField(tt.line, tt.path)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("jsonField(%s, %s) = %q, %v; want %q, %v", tt.line, tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestProcess_PairMode(t *testing.T) {
+	cfg := &Config{threads: 2, pairMode: true, capital: true, minLength: 6}
+	m, buf := createTestMangler(cfg)
+	if err := m.process([]string{"alice:secret", "nopair", "bob:a:b:cd", "carol:pw"}); err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+	got := strings.Join(getResults(m, buf), ",")
+	// carol's "pw" fails --min 6 on its own even though "carol:pw" would pass
+	want := "alice:Secret,alice:secret,bob:A:b:cd,bob:a:b:cd"
+	if got != want {
+		t.Errorf("pair mode output = %q, want %q", got, want)
+	}
+}
+
+func TestPassphraseFiltersFinalPhrases(t *testing.T) {
+	// --min 5 would drop every component, but applies to the joined phrase
+	m, buf := createTestMangler(&Config{passphraseCount: 2, passphraseSep: "-", minLength: 5, threads: 1})
+	if err := m.process([]string{"ab", "cd"}); err != nil {
+		t.Fatal(err)
+	}
+	got := getResults(m, buf)
+	if strings.Join(got, ",") != "ab-ab,ab-cd,cd-ab,cd-cd" {
+		t.Errorf("phrases = %v", got)
+	}
+
+	// Components are limited separately by --component-len
+	m, buf = createTestMangler(&Config{passphraseCount: 2, passphraseSep: "", threads: 1})
+	m.componentMin = 3
+	if err := m.process([]string{"ab", "cde"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := getResults(m, buf); strings.Join(got, ",") != "cdecde" {
+		t.Errorf("phrases with --component-len 3- = %v, want cdecde", got)
+	}
+}
+
+func TestPassphraseConstraints(t *testing.T) {
+	tests := []struct {
+		unique, sorted bool
+		want           string
+	}{
+		{false, false, "aa,ab,ac,ba,bb,bc,ca,cb,cc"},
+		{true, false, "ab,ac,ba,bc,ca,cb"},
+		{false, true, "aa,ab,ac,bb,bc,cc"},
+		{true, true, "ab,ac,bc"},
+	}
+	for _, tt := range tests {
+		cfg := &Config{passphraseCount: 2, ppUniqueWords: tt.unique, ppSorted: tt.sorted, threads: 1}
+		m, buf := createTestMangler(cfg)
+		if err := m.generateCombinedPassphrases([]string{"a", "b", "c"}); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(getResults(m, buf), ","); got != tt.want {
+			t.Errorf("unique=%v sorted=%v: got %s, want %s", tt.unique, tt.sorted, got, tt.want)
+		}
+		if n := phraseSpace(3, 2, tt.unique, tt.sorted); int(n) != strings.Count(tt.want, ",")+1 {
+			t.Errorf("unique=%v sorted=%v: phraseSpace = %v", tt.unique, tt.sorted, n)
+		}
+
+		// --pp-exhaustive-max 1 always samples, within the same constraints
+		cfg.ppExhaustiveMax = 1
+		m, buf = createTestMangler(cfg)
+		m.rng = rand.New(rand.NewSource(1))
+		m.generateCombinedPassphrases([]string{"a", "b", "c"})
+		for _, p := range getResults(m, buf) {
+			if !strings.Contains(tt.want, p) {
+				t.Errorf("unique=%v sorted=%v: sampled %q", tt.unique, tt.sorted, p)
+			}
+		}
+	}
+
+	m, _ := createTestMangler(&Config{passphraseCount: 3, ppUniqueWords: true, threads: 1})
+	if err := m.generateCombinedPassphrases([]string{"a", "b"}); err == nil {
+		t.Error("--pp-unique-words with too small a pool: expected an error")
+	}
+}
+
+func TestCapitalWords(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"bluedog42", "Bluedog42"},
+		{"blue_dog42cat", "Blue_Dog42Cat"},
+		{"blue dog", "Blue Dog"},
+		{"BlueDog", "BlueDog"},
+		{"élan-vital", "Élan-Vital"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := capitalizeTokens(tt.in); got != tt.want {
+			t.Errorf("capitalizeTokens(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	// Permutations keep the word boundaries, so joins become BlueDog
+	m, buf := createTestMangler(&Config{perms: true, capitalWords: true, suffixStrings: "42", threads: 1})
+	if err := m.process([]string{"blue", "dog"}); err != nil {
+		t.Fatal(err)
+	}
+	got := getResults(m, buf)
+	for _, want := range []string{"bluedog", "BlueDog", "BlueDog42", "DogBlue"} {
+		if !slices.Contains(got, want) {
+			t.Errorf("perms with --capital-words: missing %q in %v", want, got)
+		}
+	}
+
+	m, buf = createTestMangler(&Config{passphraseCount: 2, passphraseSep: "", capitalWords: true, ppUniqueWords: true, threads: 1})
+	m.generateCombinedPassphrases([]string{"blue", "dog"})
+	if got := strings.Join(getResults(m, buf), ","); got != "BlueDog,DogBlue,bluedog,dogblue" {
+		t.Errorf("passphrases with --capital-words = %s", got)
+	}
+}
+
+func TestPhraseMutations(t *testing.T) {
+	got := phraseMutations([]string{"blue", "horse"}, "-")
+	for _, want := range []string{"blue-horse", "Blue-horse!", "Blue-Horse123", "blu3-h0r53", "blu3-h0r531!"} {
+		if !slices.Contains(got, want) {
+			t.Errorf("missing %q in %v", want, got)
+		}
+	}
+	if len(got) != 20 {
+		t.Errorf("got %d mutations, want 20", len(got))
+	}
+	// Digits only: capitalising and leet change nothing, so only suffixes remain
+	if got := phraseMutations([]string{"12", "34"}, ""); len(got) != 5 {
+		t.Errorf("1234 mutations = %v", got)
+	}
+
+	m, buf := createTestMangler(&Config{passphraseCount: 2, passphraseSep: "-", ppMutate: true, minLength: 8, threads: 1})
+	if err := m.process([]string{"ab"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := getResults(m, buf); strings.Join(got, ",") != "4b-4b123,Ab-Ab123,Ab-ab123,ab-ab123" {
+		t.Errorf("--pp-mutate with --min 8 = %v", got)
+	}
+}
+
+func TestWeightedPicker(t *testing.T) {
+	pool := []string{"password", "zQ#9", "summer"}
+	pick := weightedPicker(pool, rand.New(rand.NewSource(1)))
+	counts := make([]int, len(pool))
+	for i := 0; i < 3000; i++ {
+		counts[pick()]++
+	}
+	if counts[0] <= counts[1] || counts[2] <= counts[1] {
+		t.Errorf("efficacy weighting favoured the unlikely component: %v", counts)
+	}
+	if counts[0]+counts[1]+counts[2] != 3000 {
+		t.Errorf("picked indices outside the pool: %v", counts)
+	}
+}
+
+func TestWithScores(t *testing.T) {
+	m, buf := createTestMangler(&Config{withScores: true, threads: 1})
+	m.writeWord("Summer2024!")
+	m.finish()
+	m.bufWriter.Flush()
+	want := fmt.Sprintf("Summer2024!\t%d\t%s\n", calculateStrength("Summer2024!"), strconv.FormatFloat(getWordEfficacy("Summer2024!"), 'g', 6, 64))
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if got, want := scoredLine(nil, "alice:abc", true), scoredLine(nil, "abc", false); !strings.HasPrefix(got, "alice:abc\t") || got[len("alice:"):] != want {
+		t.Errorf("pair mode scored %q, want the password scored as %q", got, want)
+	}
+}
+
+func TestControlCommands(t *testing.T) {
+	m, buf := createTestMangler(&Config{threads: 1})
+	c := &controller{m: m, total: 3, started: time.Now()}
+	m.control = c
+
+	steps := []struct {
+		cmd  string
+		want string
+	}{
+		{"pause", "ok paused"},
+		{"status", `"state":"paused"`},
+		{"resume", "ok running"},
+		{"set-rate 2K", "ok rate 2000/s"},
+		{"set-rate fast", "error: set-rate"},
+		{"status", `"rate":2000`},
+		{"set-rate 0", "ok rate 0/s"},
+		{"stop-after 2", "ok stopping after 2 more candidates"},
+		{"stop-after soon", "error: stop-after"},
+		{"rewind", `error: unknown command "rewind"`},
+	}
+	for _, st := range steps {
+		if got := c.handle(st.cmd); !strings.Contains(got, st.want) {
+			t.Errorf("%s: got %q, want %q", st.cmd, got, st.want)
+		}
+	}
+
+	for _, w := range []string{"alpha", "bravo", "charlie"} {
+		m.writeWord(w)
+	}
+	m.bufWriter.Flush()
+	if got := strings.Fields(buf.String()); len(got) != 2 {
+		t.Errorf("stop-after 2 let through %v", got)
+	}
+	if !m.limits.stopped.Load() || !strings.Contains(m.limits.reason, "--control stop-after 2") {
+		t.Errorf("stop reason = %q", m.limits.reason)
+	}
+
+	// A stop releases paused workers
+	c.handle("pause")
+	done := make(chan struct{})
+	go func() {
+		c.hold()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("hold did not return after the run stopped")
+	}
+}
+
+func TestSession(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/words.txt", []byte("alpha\nbravo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{}
+	newFlagSet(cfg, flag.ContinueOnError)
+	cfg.session = "nightly"
+	cfg.outputFile = dir + "/cands.txt"
+	cfg.reverse = true
+	s, err := newSession(cfg, []inputSpec{{path: dir + "/words.txt"}, {path: "-"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// -r and --reverse share a value and are listed once; -o is not part of the hash
+	if got := strings.Join(s.manifest.Options, " "); got != "reverse=true" {
+		t.Errorf("options = %q", got)
+	}
+	if in := s.manifest.Inputs; len(in) != 2 || in[0].Bytes != 12 || len(in[0].SHA256) != 64 || in[1].SHA256 != "" {
+		t.Errorf("inputs = %+v", in)
+	}
+
+	cfg.outputFile = dir + "/other.txt"
+	if again, _ := newSession(cfg, nil); again.manifest.ConfigHash != s.manifest.ConfigHash {
+		t.Errorf("config hash changed with -o")
+	}
+
+	m, _ := createTestMangler(cfg)
+	m.bufWriter = bufio.NewWriter(s.track(io.Discard))
+	m.writeWord("ahpla")
+	m.writeWord("ovarb")
+	m.bufWriter.Flush()
+	path, err := s.finish(cfg, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != dir+"/nightly.manifest.json" {
+		t.Errorf("manifest path = %q", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got sessionManifest
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("ahpla\novarb\n"))
+	if got.Candidates != 2 || got.Bytes != 12 || got.OutputSHA256 != hex.EncodeToString(sum[:]) || got.Finished.Before(got.Started) {
+		t.Errorf("manifest = %+v", got)
+	}
+}
+
+func TestJSONLOutput(t *testing.T) {
+	m, buf := createTestMangler(&Config{capital: true, suffixRange: "1-1", outputFormat: "jsonl", mutationLevel: 2, threads: 1})
+	if err := m.process([]string{"pass"}); err != nil {
+		t.Fatal(err)
+	}
+	m.bufWriter.Flush()
+
+	records := make(map[string]candidateRecord)
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec candidateRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("invalid record %q: %v", line, err)
+		}
+		records[rec.Candidate] = rec
+	}
+	tests := []struct {
+		candidate string
+		rules     string
+	}{
+		{"pass", ""},
+		{"Pass", "capital"},
+		{"pass1", "suffix-range"},
+		{"Pass1", "capital,suffix-range"},
+		{"pass11", "suffix-range,suffix-range"},
+	}
+	for _, tt := range tests {
+		rec, ok := records[tt.candidate]
+		if !ok {
+			t.Errorf("no record for %s", tt.candidate)
+			continue
+		}
+		if got := strings.Join(rec.Rules, ","); got != tt.rules || rec.Source != "pass" {
+			t.Errorf("%s: source %q rules %q, want pass and %q", tt.candidate, rec.Source, got, tt.rules)
+		}
+		if rec.Score != calculateStrength(tt.candidate) {
+			t.Errorf("%s: score %d, want %d", tt.candidate, rec.Score, calculateStrength(tt.candidate))
+		}
+	}
+	if got := jsonRecord("bob:a&b", "a&b", "", []string{"capital, reverse"}, &Config{pairMode: true}, nil); !strings.Contains(got, `"candidate":"a&b","user":"bob"`) || !strings.Contains(got, `"rules":["capital","reverse"]`) {
+		t.Errorf("pair-mode record = %s", got)
+	}
+}
+
+func TestParquetOutput(t *testing.T) {
+	var buf bytes.Buffer
+	p := newParquetWriter(&buf, &Config{}, nil)
+	p.add("café")
+	p.add("Summer2024!")
+	p.close()
+	data := buf.Bytes()
+
+	if !bytes.HasPrefix(data, []byte("PAR1")) || !bytes.HasSuffix(data, []byte("PAR1")) {
+		t.Fatalf("missing PAR1 magic: %q", data)
+	}
+	n := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	if n <= 0 || n > len(data)-12 {
+		t.Fatalf("footer length %d out of range for %d bytes", n, len(data))
+	}
+	footer := data[len(data)-8-n : len(data)-8]
+	for _, c := range parquetColumns {
+		if !bytes.Contains(footer, []byte(c.name)) {
+			t.Errorf("footer lacks column %s", c.name)
+		}
+	}
+
+	// The word column is the first page; PLAIN byte arrays are length-prefixed
+	want := []byte("\x05\x00\x00\x00café\x0b\x00\x00\x00Summer2024!")
+	if i := bytes.Index(data, want); i < 0 || i > 64 {
+		t.Errorf("word page not found after the first page header: %q", data[:64])
+	}
+	var eff [8]byte
+	binary.LittleEndian.PutUint64(eff[:], math.Float64bits(getWordEfficacy("Summer2024!")))
+	if !bytes.Contains(data, eff[:]) {
+		t.Error("efficacy column lacks the score of Summer2024!")
+	}
+
+	var empty bytes.Buffer
+	newParquetWriter(&empty, &Config{}, nil).close()
+	if !bytes.HasPrefix(empty.Bytes(), []byte("PAR1")) || !bytes.HasSuffix(empty.Bytes(), []byte("PAR1")) {
+		t.Errorf("empty output is not a Parquet file: %q", empty.Bytes())
+	}
+
+	if full, err := os.OpenFile("/dev/full", os.O_WRONLY, 0); err == nil {
+		p := newParquetWriter(full, &Config{}, nil)
+		p.add("password")
+		if err := p.close(); err == nil {
+			t.Error("close on /dev/full returned no error")
+		}
+		full.Close()
+	}
+}
+
+// TestParquetRoundTrip reads the output back with pyarrow, when installed
+func TestParquetRoundTrip(t *testing.T) {
+	if err := exec.Command("python3", "-c", "import pyarrow.parquet").Run(); err != nil {
+		t.Skip("python3 with pyarrow not available")
+	}
+	path := t.TempDir() + "/out.parquet"
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newParquetWriter(f, &Config{}, nil)
+	words := []string{"café", "Summer2024!", "x"}
+	for _, w := range words {
+		p.add(w)
+	}
+	if err := p.close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	script := `import sys, pyarrow.parquet as pq
+t = pq.read_table(sys.argv[1])
+print(",".join(t.column_names))
+for w, n, s, e in zip(*(t.column(c).to_pylist() for c in t.column_names)):
+    print("%s|%d|%d|%.17g" % (w, n, s, e))`
+	out, err := exec.Command("python3", "-c", script, path).CombinedOutput()
+	if err != nil {
+		t.Fatalf("pyarrow could not read the file: %v\n%s", err, out)
+	}
+	want := []string{"word,length,strength,efficacy"}
+	for _, w := range words {
+		strength, efficacy := wordScores(nil, w, false)
+		want = append(want, fmt.Sprintf("%s|%d|%d|%.17g", w, utf8.RuneCountInString(w), strength, efficacy))
+	}
+	if got := strings.Split(strings.TrimSpace(string(out)), "\n"); !slices.Equal(got, want) {
+		t.Errorf("pyarrow read %q, want %q", got, want)
+	}
+}
+
+func TestOutputSinks(t *testing.T) {
+	tests := []struct {
+		sortMode string
+		want     string
+	}{
+		{"", "b,a,c"},
+		{"a", "a,b,c"},
+		{"x", "b,a,c"}, // Collected, generation order kept
+	}
+	for _, tt := range tests {
+		m, buf := createTestMangler(&Config{sortMode: tt.sortMode, threads: 1})
+		for _, w := range []string{"b", "a", "b", "c"} {
+			m.accept(w)
+		}
+		m.outputSink().close()
+		m.bufWriter.Flush()
+		if got := strings.ReplaceAll(strings.TrimSpace(buf.String()), "\n", ","); got != tt.want {
+			t.Errorf("sort %q: got %s, want %s", tt.sortMode, got, tt.want)
+		}
+	}
+
+	// A window of 2 writes the best of the first three first, then drains
+	// the rest in order
+	m, buf := createTestMangler(&Config{sortMode: "a", threads: 1})
+	m.window = 2
+	for _, w := range []string{"d", "b", "c", "a", "b"} {
+		m.accept(w)
+	}
+	m.outputSink().close()
+	m.bufWriter.Flush()
+	if got := strings.ReplaceAll(strings.TrimSpace(buf.String()), "\n", ","); got != "b,a,c,d" {
+		t.Errorf("window 2: got %s, want b,a,c,d", got)
+	}
+
+	pool := &poolSink{min: 2, max: 3, cfg: &Config{}}
+	for _, w := range []string{"a", "ab", "abcd", "ab"} {
+		if pool.keep(w) {
+			pool.add(w, noOrigin)
+		}
+	}
+	if got := strings.Join(pool.words, ","); got != "ab,ab" {
+		t.Errorf("pool = %s, want ab,ab", got)
+	}
+}
+
+func TestColorEnabled(t *testing.T) {
+	// A pipe is never a color terminal
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if colorEnabled(w) {
+		t.Error("colors enabled for a pipe")
+	}
+	if y, b, rs := usageColors(); colorEnabled(os.Stderr) != (y+b+rs != "") {
+		t.Errorf("usageColors %q %q %q disagrees with colorEnabled", y, b, rs)
+	}
+
+	// NO_COLOR and --no-color win over a terminal
+	t.Setenv("NO_COLOR", "1")
+	if colorEnabled(os.Stderr) {
+		t.Error("colors enabled with NO_COLOR set")
+	}
+	t.Setenv("NO_COLOR", "")
+	defer func() { noColor = false }()
+	if _, err := parseFlags([]string{"--no-color"}); err != nil {
+		t.Fatal(err)
+	}
+	if colorEnabled(os.Stderr) {
+		t.Error("colors enabled with --no-color")
+	}
+	if got := asciiBar()(3); got != "###" {
+		t.Errorf("plain bar = %q, want ###", got)
+	}
+}
+
+// trStrings parses main.go and returns the English strings it translates:
+// the literals passed to tr() and the crackWindows labels, which reach tr()
+// through a variable. funcs maps each function to its tr() literals and to
+// the fmt formats it prints without tr().
+func trStrings(t *testing.T) (keys map[string]bool, funcs map[string][2][]string) {
+	t.Helper()
+	f, err := parser.ParseFile(token.NewFileSet(), "main.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	literal := func(e ast.Expr) (string, bool) {
+		lit, ok := e.(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return "", false
+		}
+		s, err := strconv.Unquote(lit.Value)
+		return s, err == nil
+	}
+	keys = make(map[string]bool)
+	funcs = make(map[string][2][]string)
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				if v, ok := spec.(*ast.ValueSpec); ok && v.Names[0].Name == "crackWindows" {
+					ast.Inspect(v, func(n ast.Node) bool {
+						if e, ok := n.(ast.Expr); ok {
+							if s, ok := literal(e); ok {
+								keys[s] = true
+							}
+						}
+						return true
+					})
+				}
+			}
+		case *ast.FuncDecl:
+			var uses [2][]string
+			ast.Inspect(d, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok || len(call.Args) == 0 {
+					return true
+				}
+				switch fun := call.Fun.(type) {
+				case *ast.Ident:
+					if s, ok := literal(call.Args[0]); ok && fun.Name == "tr" {
+						keys[s] = true
+						uses[0] = append(uses[0], s)
+					}
+				case *ast.SelectorExpr:
+					if pkg, ok := fun.X.(*ast.Ident); ok && pkg.Name == "fmt" {
+						if s, ok := literal(call.Args[0]); ok {
+							uses[1] = append(uses[1], s)
+						}
+					}
+				}
+				return true
+			})
+			funcs[d.Name.Name] = uses
+		}
+	}
+	return keys, funcs
+}
+
+func TestLocales(t *testing.T) {
+	defer loadCatalog("")
+	keys, funcs := trStrings(t)
+	for _, lang := range builtinLangs() {
+		data, _ := localeFiles.ReadFile("locales/" + lang + ".json")
+		var entries map[string]string
+		if err := json.Unmarshal(data, &entries); err != nil {
+			t.Fatalf("%s: %v", lang, err)
+		}
+		if err := loadCatalog(lang); err != nil {
+			t.Fatalf("%s: %v", lang, err)
+		}
+		if len(catalog) != len(entries) {
+			t.Errorf("%s: %d of %d entries loaded", lang, len(catalog), len(entries))
+		}
+		// An entry whose English text was since edited is never shown
+		for en := range entries {
+			if !keys[en] {
+				t.Errorf("%s: stale entry %q, not passed to tr()", lang, en)
+			}
+		}
+	}
+
+	// The --analyze report is translated in full: its labels go through
+	// tr(), and every label with words in it has an entry in each language
+	report := []string{"analyzeWordlist", "printEntropyStats", "printLanguageMix", "printReuseStats", "printClusters", "printCrackTimes", "humanDuration"}
+	hasWords := func(s string) bool {
+		return strings.IndexFunc(formatVerbRe.ReplaceAllString(s, ""), unicode.IsLetter) >= 0
+	}
+	for _, name := range report {
+		uses, ok := funcs[name]
+		if !ok {
+			t.Errorf("report function %s not found", name)
+			continue
+		}
+		for _, s := range uses[1] {
+			if hasWords(s) {
+				t.Errorf("%s prints %q without tr()", name, s)
+			}
+		}
+		for _, s := range uses[0] {
+			for _, lang := range builtinLangs() {
+				if err := loadCatalog(lang); err != nil {
+					t.Fatal(err)
+				}
+				if _, ok := catalog[s]; !ok && hasWords(s) {
+					t.Errorf("%s: no translation of %s label %q", lang, name, s)
+				}
+			}
+		}
+	}
+	if err := loadCatalog("de"); err != nil {
+		t.Fatal(err)
+	}
+	if got := tr("\nDuplicates & Reuse:\n"); got != "\nDuplikate & Wiederverwendung:\n" {
+		t.Errorf("tr = %q", got)
+	}
+	if got := tr("not translated"); got != "not translated" {
+		t.Errorf("untranslated text = %q", got)
+	}
+
+	// A translation file with a wrong verb falls back to English for it
+	path := t.TempDir() + "/x.json"
+	os.WriteFile(path, []byte(`{"Avg Strength: %.2f / 4.00\n": "Moyenne : %d\n", "1 hour": "1 heure"}`), 0644)
+	if err := loadCatalog(path); err != nil {
+		t.Fatal(err)
+	}
+	if tr("Avg Strength: %.2f / 4.00\n") != "Avg Strength: %.2f / 4.00\n" || tr("1 hour") != "1 heure" {
+		t.Errorf("catalog = %v", catalog)
+	}
+	if err := loadCatalog("xx"); err == nil {
+		t.Error("unknown --lang accepted")
+	}
+}
+
+func TestParseFlagsValidation(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string // Substring of the error, "" for none
+	}{
+		{[]string{"-c", "-u", "-m", "3"}, ""},
+		{[]string{"-c", "-c", "-t", "-t"}, ""}, // Repeated booleans are harmless
+		{[]string{"-m", "5", "--min", "6"}, "-m and --min set the same option"},
+		{[]string{"-m=5", "-m", "6"}, "-m is given more than once"},
+		{[]string{"-ss", "1", "--suffix-strings=2"}, "-ss and --suffix-strings"},
+		{[]string{"-u", "--no-capitals"}, "--upper only adds candidates with capitals"},
+		{[]string{"-sr", "0-9", "--no-numbers"}, "--suffix-range"},
+		{[]string{"--ordinals", "1-3", "--no-numbers"}, "--ordinals only adds"},
+		{[]string{"--punctuation", "--no-symbols"}, "--no-symbols removes"},
+		{[]string{"--emoji", "--no-symbols"}, "--emoji only adds"},
+		{[]string{"-a", "-o", "out.txt"}, "--analyze prints a report"},
+		{[]string{"-a", "--estimate"}, "separate modes"},
+		{[]string{"-pp", "2", "-S", "a"}, "--sort does not apply to --passphrase"},
+		{[]string{"--pp-mutate"}, "--pp-mutate decorates --passphrase output"},
+		{[]string{"--pp-sorted"}, "--pp-unique-words and --pp-sorted shape --passphrase output"},
+		{[]string{"--budget", "1M", "-pp", "3"}, "--budget prunes the mangling options"},
+		{[]string{"--collapse-runs"}, "--collapse-runs writes wordlist and mask files"},
+		{[]string{"--fit-strategy", "pad-digits"}, "--fit-strategy only applies to --fit-length"},
+		{[]string{"--wifi", "--max", "64"}, "--wifi candidates are 8-63 characters"},
+		{[]string{"--email-as", "seeds"}, "--email-as only applies to --domains"},
+		{[]string{"--max-bytes-action", "truncate"}, "--max-bytes-action only applies to --max-bytes"},
+		{[]string{"--lm-mode", "--for-hash", "lm"}, "--lm-mode already shapes candidates for LM"},
+		{[]string{"--fit-length", "8", "--max", "6"}, "--fit-length 8 is outside --min/--max"},
+		{[]string{"--dedup-order", "first", "--dedup-scope", "worker"}, "--dedup-order first needs one shared dedup set"},
+		{[]string{"--collapse-runs", "-o", "x.txt", "--shuffle"}, "--collapse-runs needs plain text candidates"},
+		{[]string{"--shuffle", "-S", "e"}, "--shuffle discards"},
+		{[]string{"--window", "10M"}, "--window bounds the memory"},
+		{[]string{"--no-dedup", "--dedup-scope", "worker"}, "--no-dedup turns deduplication off"},
+		{[]string{"--no-dedup", "--dedup-scope", "none"}, ""},
+		{[]string{"-S", "e", "--window", "10M"}, ""},
+		{[]string{"-S", "source-then-efficacy", "--window", "10M"}, ""},
+		{[]string{"-S", "x"}, "unknown --sort"},
+		{[]string{"--annotate", "--output-format", "jsonl"}, "--annotate adds a column"},
+		{[]string{"--warm-start", "top1k", "-pp", "3"}, "--warm-start writes single passwords"},
+		{[]string{"--rules-file", "r.pmr", "--rules", "upper"}, "--rules-file and --rules"},
+		{[]string{"--ordered", "--dedup-scope", "worker"}, "--ordered keeps the input order"},
+		{[]string{"--ordered", "--shuffle"}, "--ordered keeps the input order"},
+		{[]string{"-m", "9", "-x", "3"}, "--min 9 is greater than --max 3"},
+		{[]string{"--seed-min", "9", "--seed-max", "3"}, "--seed-min 9 is greater than --seed-max 3"},
+		{[]string{"--session", "x", "--estimate"}, "--session records a generation run"},
+		{[]string{"--output-format", "parquet", "--with-scores"}, "always includes the strength"},
+		{[]string{"--output-format", "jsonl", "-S", "e"}, "--output-format jsonl writes each record"},
+		{[]string{"--punct-max", "12"}, "more than 100000 punctuation affixes"},
+		{[]string{"--punct-max", "0"}, "invalid --punct-max 0"},
+		{[]string{"--punct-set", "!?", "--punct-max", "12"}, ""},
+		{[]string{"--crunch", "*##:8x"}, `bad length "8x"`},
+		{[]string{"--crunch", "...,*#:10-8"}, `bad length "10-8"`},
+		{[]string{"--crunch", "*#:8-10,a:b"}, ""},
+		{[]string{"--repeat-to", "8..x"}, `invalid --repeat-to "8..x"`},
+		{[]string{"--repeat-to", "0"}, `invalid --repeat-to "0"`},
+		{[]string{"--rules", "c,del0"}, `invalid --rules step "del0"`},
+		{[]string{"--rules", "dupx"}, `invalid --rules step "dupx"`},
+		{[]string{"--rules", "adjswap"}, `invalid --rules step "adjswap"`},
+		{[]string{"--rules", "del-1,dup2,append=del"}, ""},
+		{[]string{"--rules", "inc-num:0"}, `invalid --rules step "inc-num:0"`},
+		{[]string{"--rules", "dec-num:x"}, `invalid --rules step "dec-num:x"`},
+		{[]string{"--rules", "inc-num,dec-num:3,--inc-num=2"}, ""},
+		{[]string{"-f", "a.txt", "--file", "b.txt"}, ""},
+		{[]string{"-m", "3", "-x", "3"}, ""},
+	}
+	for _, tt := range tests {
+		_, err := parseFlags(tt.args)
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("parseFlags(%q) = %v, want no error", tt.args, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("parseFlags(%q) = %v, want error containing %q", tt.args, err, tt.want)
+		}
+	}
+}
+
+func TestParseInputSpecs(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(dir+"/my;list.txt", []byte("word\n"), 0644)
+	tests := []struct {
+		list string
+		want string
+	}{
+		{"a.txt,b.txt", "a.txt|;b.txt|"},
+		{"names.txt[rules=capital,suffix-range=0-99];pets.txt[rules=lower]", "names.txt|rules=capital,suffix-range=0-99;pets.txt|rules=lower"},
+		{"names.txt[rules=capital,suffix-range=0-99],pets.txt[rules=lower]", "names.txt|rules=capital,suffix-range=0-99;pets.txt|rules=lower"},
+		{" a.txt ; b.txt[leet,rules=upper] ", "a.txt|;b.txt|leet,rules=upper"},
+		// An existing file whose name contains ';' is not split
+		{dir + "/my;list.txt,c.txt", dir + "/my;list.txt|;c.txt|"},
+		{"my;list.txt", "my|;list.txt|"},
+		// A glob without matches is dropped with a warning
+		{dir + "/nomatch*.txt,a.txt", "a.txt|"},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, s := range parseInputSpecs(tt.list) {
+			got = append(got, s.path+"|"+s.overrides)
+		}
+		if strings.Join(got, ";") != tt.want {
+			t.Errorf("parseInputSpecs(%q) = %q, want %q", tt.list, strings.Join(got, ";"), tt.want)
+		}
+	}
+
+	// -f is repeatable; each occurrence adds its list
+	cfg := &Config{}
+	if err := newFlagSet(cfg, flag.ContinueOnError).Parse([]string{"-f", "names.txt[rules=capital,reverse]", "--file", "my;list.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.inputFile != "names.txt[rules=capital,reverse],my;list.txt" {
+		t.Errorf("repeated -f = %q", cfg.inputFile)
+	}
+
+	specs := parseInputSpecs("osint.txt:weight=5,names.txt[rules=lower]:weight=2.5,generic.txt")
+	var got []string
+	for _, s := range specs {
+		got = append(got, s.path+"|"+s.overrides+"|"+s.weight)
+	}
+	if want := "osint.txt||5;names.txt|rules=lower|2.5;generic.txt||"; strings.Join(got, ";") != want {
+		t.Errorf("weighted specs = %q, want %q", strings.Join(got, ";"), want)
+	}
+}
+
+func TestConfigWithOverrides(t *testing.T) {
+	base := &Config{capital: true, suffixRange: "1-2", threads: 3, rulesList: "upper"}
+
+	p, err := base.withOverrides("leet,rules=capital,reverse,suffix-range=0-99,punct-max=2")
+	if err != nil {
+		t.Fatalf("withOverrides: %v", err)
+	}
+	if p.rulesList != "capital,reverse" || p.suffixRange != "0-99" || !p.leet || !p.punctuation {
+		t.Errorf("overrides not applied: rules=%q sr=%q leet=%v punct=%v", p.rulesList, p.suffixRange, p.leet, p.punctuation)
+	}
+	if !p.capital || p.threads != 3 {
+		t.Errorf("base options lost: capital=%v threads=%d", p.capital, p.threads)
+	}
+	if base.rulesList != "upper" || base.leet {
+		t.Errorf("base config was modified")
+	}
+
+	for _, bad := range []string{"nope=1", "level=x", "stray"} {
+		if _, err := base.withOverrides(bad); err == nil {
+			t.Errorf("withOverrides(%q) should fail", bad)
+		}
+	}
+}
+
+func TestProcess_Profiles(t *testing.T) {
+	cfg := &Config{threads: 2, lower: true}
+	m, buf := createTestMangler(cfg)
+	upper, _ := cfg.withOverrides("upper,lower=false")
+	m.profiles = map[string]*Config{"Alpha": cfg, "Bravo": upper}
+	if err := m.process([]string{"Alpha", "Bravo"}); err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+	got := strings.Join(getResults(m, buf), ",")
+	if want := "Alpha,BRAVO,Bravo,alpha"; got != want {
+		t.Errorf("profile output = %q, want %q", got, want)
+	}
+}
+
+func TestRunJob(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(dir+"/names.txt", []byte("alice\n"), 0644)
+	os.WriteFile(dir+"/pets.txt", []byte("Rex\n"), 0644)
+	os.WriteFile(dir+"/job.yaml", []byte(`
+inputs:
+  - names.txt
+  - path: pets.txt
+    options:
+      rules: [lower, double]
+seeds: [bob]
+options:
+  threads: 2
+  capital: true
+filters:
+  min: 3
+outputs:
+  - path: all.txt
+  - path: long.txt
+    filters:
+      min: 6
+`), 0644)
+
+	if err := runJob([]string{dir + "/job.yaml"}); err != nil {
+		t.Fatalf("runJob: %v", err)
+	}
+	read := func(name string) string {
+		data, _ := os.ReadFile(dir + "/" + name)
+		lines := strings.Fields(string(data))
+		sort.Strings(lines)
+		return strings.Join(lines, ",")
+	}
+	if got, want := read("all.txt"), "Alice,Bob,alice,bob,rexrex"; got != want {
+		t.Errorf("all.txt = %q, want %q", got, want)
+	}
+	if got, want := read("long.txt"), "rexrex"; got != want {
+		t.Errorf("long.txt = %q, want %q", got, want)
+	}
+
+	// Outputs re-read the candidates verbatim and only apply their filters
+	cands := " lead\ntrail \n#cc\n\ufeffbom\nab\n"
+	os.WriteFile(dir+"/cands.txt", []byte(cands), 0644)
+	oc := &Config{}
+	newFlagSet(oc, flag.ContinueOnError)
+	oc.filterOnly, oc.minLength, oc.commentPrefix, oc.outputFile = true, 3, "#", dir+"/filtered.txt"
+	if err := runFiltered(oc, dir+"/cands.txt"); err != nil {
+		t.Fatalf("runFiltered: %v", err)
+	}
+	if got, _ := os.ReadFile(dir + "/filtered.txt"); string(got) != " lead\ntrail \n#cc\n\ufeffbom\n" {
+		t.Errorf("filtered output = %q", got)
+	}
+
+	os.WriteFile(dir+"/bad.yaml", []byte("inputs: [a.txt]\nfilters:\n  capital: true\n"), 0644)
+	if _, err := loadJob(dir + "/bad.yaml"); err == nil {
+		t.Errorf("loadJob should reject non-filter options under filters")
+	}
+	os.WriteFile(dir+"/typo.yaml", []byte("inputs: [a.txt]\noutput: x.txt\n"), 0644)
+	if _, err := loadJob(dir + "/typo.yaml"); err == nil {
+		t.Errorf("loadJob should reject unknown keys")
+	}
+}
+
+func TestRecipe(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(dir+"/extra.txt", []byte("corp\nhq\n"), 0644)
+	os.Mkdir(dir+"/shared", 0755)
+
+	cfg := &Config{}
+	fs := newFlagSet(cfg, flag.ContinueOnError)
+	args := []string{"--leet", "--years", "2024", "--min", "6", "--common", "builtin:seasons," + dir + "/extra.txt",
+		"--stopwords", "en", "--detect-lang", "-n", "4", "-f", "words.txt"}
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := exportRecipe(cfg, dir+"/shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Threads and inputs are left out; each option lands in its section
+	if rec.Rules["leet"] != true || rec.Rules["detect-lang"] != true || len(rec.Rules) != 2 {
+		t.Errorf("rules = %v", rec.Rules)
+	}
+	if rec.Affixes["years"] != 2024 || rec.Filters["min"] != 6 || len(rec.Locales) != len(localePacks) {
+		t.Errorf("affixes = %v, filters = %v, locales = %v", rec.Affixes, rec.Filters, rec.Locales)
+	}
+	sum := sha256.Sum256([]byte("corp\nhq\n"))
+	want := []recipeWordpack{
+		{Option: "common", Path: "builtin:seasons"},
+		{Option: "common", Path: "../extra.txt", SHA256: hex.EncodeToString(sum[:])},
+		{Option: "stopwords", Path: "en"},
+	}
+	if !slices.Equal(rec.Wordpacks, want) {
+		t.Errorf("wordpacks = %+v, want %+v", rec.Wordpacks, want)
+	}
+
+	path := dir + "/shared/team.pmrecipe"
+	if err := runRecipe(append([]string{"export", "-o", path}, args...)); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if err := validateRecipe(path); err != nil {
+		t.Fatalf("validateRecipe: %v", err)
+	}
+	loaded, err := loadRecipe(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := &Config{}
+	if err := loaded.apply(newFlagSet(got, flag.ContinueOnError), dir+"/shared"); err != nil {
+		t.Fatal(err)
+	}
+	if got.common != "builtin:seasons,"+dir+"/extra.txt" || !got.leet || got.yearsCount != "2024" || got.minLength != 6 {
+		t.Errorf("imported config: common %q, leet %v, years %q, min %d", got.common, got.leet, got.yearsCount, got.minLength)
+	}
+
+	// The seed is kept, or pinned, only when the output depends on it
+	seeds := []struct {
+		args []string
+		want any
+	}{
+		{[]string{"--sample", "10", "--random-seed", "7"}, 7},
+		{[]string{"--random-seed", "7"}, nil},
+		{[]string{"--shuffle"}, "pinned"},
+		{[]string{"--shuffle", "--deterministic"}, nil},
+	}
+	for _, tt := range seeds {
+		cfg := &Config{}
+		if err := newFlagSet(cfg, flag.ContinueOnError).Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		rec, err := exportRecipe(cfg, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := rec.Rules["random-seed"]
+		switch {
+		case tt.want == "pinned" && (!ok || got == 0):
+			t.Errorf("%v: no seed pinned, rules = %v", tt.args, rec.Rules)
+		case tt.want != "pinned" && got != tt.want:
+			t.Errorf("%v: random-seed = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+	a, b := newRand(&Config{randomSeed: 7}), newRand(&Config{randomSeed: 7})
+	if a.Int63() != b.Int63() {
+		t.Error("--random-seed 7 drew different numbers")
+	}
+
+	os.WriteFile(dir+"/extra.txt", []byte("corp\n"), 0644)
+	if err := validateRecipe(path); err == nil || !strings.Contains(err.Error(), "SHA-256") {
+		t.Errorf("changed wordpack: err = %v", err)
+	}
+
+	bad := []struct {
+		name, yaml string
+	}{
+		{"format", "pmrecipe: 2\n"},
+		{"version", "pmrecipe: 1\npassmut: '>=99'\n"},
+		{"unknown key", "pmrecipe: 1\noptions: {leet: true}\n"},
+		{"filter", "pmrecipe: 1\nfilters: {leet: true}\n"},
+		{"affix", "pmrecipe: 1\naffixes: {min: 3}\n"},
+		{"locale", "pmrecipe: 1\nlocales: [xx]\n"},
+		{"unpinned", "pmrecipe: 1\nwordpacks:\n  - {option: dict, path: words.txt}\n"},
+		{"not a wordpack", "pmrecipe: 1\nwordpacks:\n  - {option: leet, path: x, sha256: ab}\n"},
+	}
+	for _, tt := range bad {
+		os.WriteFile(dir+"/bad.pmrecipe", []byte(tt.yaml), 0644)
+		if _, err := loadRecipe(dir + "/bad.pmrecipe"); err == nil {
+			t.Errorf("%s: loadRecipe should fail", tt.name)
+		}
+	}
+}
+
+func TestRecipeDiff(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(dir+"/a.pmrecipe", []byte("pmrecipe: 1\nrules:\n  capital: true\n"), 0644)
+	os.WriteFile(dir+"/b.pmrecipe", []byte("pmrecipe: 1\nrules:\n  capital: true\n  reverse: true\n"), 0644)
+	os.WriteFile(dir+"/sample.txt", []byte("alpha\nbravo\n"), 0644)
+
+	a, err := tryRecipe(dir+"/a.pmrecipe", []string{"alpha", "bravo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := tryRecipe(dir+"/b.pmrecipe", []string{"alpha", "bravo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := a.onlyIn(b); len(got) != 0 {
+		t.Errorf("only in a = %v", got)
+	}
+	if got := strings.Join(b.onlyIn(a), ","); got != "ahpla,ovarb" {
+		t.Errorf("only in b = %q", got)
+	}
+	if b.est.perWord <= a.est.perWord {
+		t.Errorf("candidates/word a = %.1f, b = %.1f", a.est.perWord, b.est.perWord)
+	}
+
+	report := dir + "/diff.txt"
+	if err := runRecipeDiff([]string{dir + "/a.pmrecipe", dir + "/b.pmrecipe", "--sample", dir + "/sample.txt", "--words", "1000", "-o", report}, func() {}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(report)
+	for _, want := range []string{"Keyspace (1.0K words)", "Only in A (0):", "Only in B (2):\n  ahpla\n  ovarb\n"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("report lacks %q:\n%s", want, data)
+		}
+	}
+
+	// Candidates are compared byte for byte, surrounding spaces included
+	os.WriteFile(dir+"/c.pmrecipe", []byte("pmrecipe: 1\nrules:\n  substitute: 'alpha= alpha'\n"), 0644)
+	c, err := tryRecipe(dir+"/c.pmrecipe", []string{"alpha", "bravo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.onlyIn(a); !slices.Equal(got, []string{" alpha"}) {
+		t.Errorf("only in c = %q", got)
+	}
+
+	// A recipe that pairs words cannot be scaled to --words
+	os.WriteFile(dir+"/p.pmrecipe", []byte("pmrecipe: 1\nrules:\n  perms: true\n"), 0644)
+	err = runRecipeDiff([]string{dir + "/a.pmrecipe", dir + "/p.pmrecipe", "--sample", dir + "/sample.txt", "--words", "1000", "-o", report}, func() {})
+	if err == nil || !strings.Contains(err.Error(), "--words 1000") {
+		t.Errorf("paired recipe with --words: err = %v", err)
+	}
+	if err := runRecipeDiff([]string{dir + "/a.pmrecipe", dir + "/p.pmrecipe", "--sample", dir + "/sample.txt", "-o", report}, func() {}); err != nil {
+		t.Errorf("paired recipe without --words: %v", err)
+	}
+}
+
+func TestRunVerify(t *testing.T) {
+	dir := t.TempDir()
+	recipe, golden, sample := dir+"/r.pmrecipe", dir+"/r.golden", dir+"/sample.txt"
+	os.WriteFile(recipe, []byte("pmrecipe: 1\nrules:\n  capital: true\n  reverse: true\n"), 0644)
+	os.WriteFile(sample, []byte("alpha\nbravo\ncharlie\n"), 0644)
+	args := []string{"--recipe", recipe, "--golden", golden, "--sample", sample}
+
+	if err := runVerify(append(args, "--update")); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := os.ReadFile(golden)
+	// Input order, each word's variants sorted
+	if string(want) != "Alpha\nahpla\nalpha\nBravo\nbravo\novarb\nCharlie\ncharlie\neilrahc\n" {
+		t.Errorf("golden file:\n%s", want)
+	}
+	for i := 0; i < 3; i++ {
+		if err := runVerify(args); err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+	}
+
+	os.WriteFile(recipe, []byte("pmrecipe: 1\nrules:\n  capital: true\n"), 0644)
+	if err := runVerify(args); err == nil {
+		t.Errorf("changed recipe should fail verification")
+	}
+}
+
+func TestDiffGolden(t *testing.T) {
+	tests := []struct {
+		golden, got    string
+		missing, added string
+		first          int
+	}{
+		{"a\nb\n", "a\nb\n", "", "", 0},
+		{"a\nb\n", "b\na\n", "", "", 1},
+		{"a\nb\nc\n", "a\nc\nd\n", "b", "d", 2},
+		{"a\n", "a\nb\n", "", "b", 2},
+		{"", "a\n", "", "a", 1},
+	}
+	for _, tt := range tests {
+		d := diffGolden([]byte(tt.golden), []byte(tt.got))
+		if got := strings.Join(d.missing, ","); got != tt.missing {
+			t.Errorf("%q vs %q: missing = %q, want %q", tt.golden, tt.got, got, tt.missing)
+		}
+		if got := strings.Join(d.added, ","); got != tt.added {
+			t.Errorf("%q vs %q: added = %q, want %q", tt.golden, tt.got, got, tt.added)
+		}
+		if d.firstMismatch != tt.first {
+			t.Errorf("%q vs %q: first mismatch = %d, want %d", tt.golden, tt.got, d.firstMismatch, tt.first)
+		}
+	}
+}
+
+func TestRunWord(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	dir := t.TempDir()
+	saved := clipboardCommands
+	defer func() { clipboardCommands = saved }()
+	clipboardCommands = [][]string{{"passmut-no-such-clipboard"}, {"sh", "-c", "cat > " + dir + "/clip.txt"}}
+
+	if err := runWord([]string{"acme corp", "-c", "-o", dir + "/out.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(dir + "/out.txt")
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	sort.Strings(lines)
+	if got := strings.Join(lines, ","); got != "Acme corp,acme corp" {
+		t.Errorf("output = %q", data)
+	}
+	if _, err := os.Stat(dir + "/clip.txt"); err == nil {
+		t.Errorf("clipboard set without --copy")
+	}
+
+	if err := runWord([]string{"acme", "-r", "-c", "--copy", "--top", "2", "-o", dir + "/out.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	out, _ := os.ReadFile(dir + "/out.txt")
+	clip, _ := os.ReadFile(dir + "/clip.txt")
+	if lines := strings.SplitAfter(string(out), "\n"); len(lines) < 3 || string(clip) != lines[0]+lines[1] {
+		t.Errorf("clipboard = %q, output = %q", clip, out)
+	}
+
+	clipboardCommands = [][]string{{"passmut-no-such-clipboard"}}
+	if err := runWord([]string{"acme", "--copy", "-o", dir + "/out.txt"}); err == nil || !strings.Contains(err.Error(), "no clipboard tool") {
+		t.Errorf("missing clipboard tool: err = %v", err)
+	}
+}
+
+func TestVersionSatisfies(t *testing.T) {
+	tests := []struct {
+		version, constraint string
+		want                bool
+	}{
+		{"0.0.2", ">=0.0.2", true},
+		{"0.0.2", ">0.0.2", false},
+		{"0.0.2", ">=0.0.1,<0.1", true},
+		{"0.1.0", ">=0.0.1,<0.1", false},
+		{"0.0.2", "0.0.2", true},
+		{"0.0.2", "v0.0.2", true},
+		{"1.2", "<=1.2.0", true},
+		{"1.10.0", ">1.9", true},
+		{"0.0.2", "!=0.0.2", false},
+	}
+	for _, tt := range tests {
+		got, err := versionSatisfies(tt.version, tt.constraint)
+		if err != nil || got != tt.want {
+			t.Errorf("versionSatisfies(%q, %q) = %v, %v, want %v", tt.version, tt.constraint, got, err, tt.want)
+		}
+	}
+	if _, err := versionSatisfies("0.0.2", ">=one"); err == nil {
+		t.Errorf("invalid version should be an error")
+	}
+}
+
+func TestProcess_Plugin(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	dir := t.TempDir()
+	// A plugin answers every word as it reads it; answer is a printf format
+	// fed the word as often as it takes %s
+	script := func(name, answer string) string {
+		args := strings.Repeat(` "$w"`, strings.Count(answer, "%s"))
+		path := dir + "/" + name + ".sh"
+		os.WriteFile(path, []byte("while IFS= read -r w; do printf '"+answer+"\\n'"+args+"; done\n"), 0644)
+		return "sh " + path
+	}
+	tests := []struct {
+		plugin string
+		format string
+		pair   bool
+		words  []string
+		want   string
+	}{
+		{script("bang", "%s!\\n"), "line", false, []string{"abc", "xyz"}, "abc,abc!,xyz,xyz!"},
+		{script("none", ""), "line", false, []string{"abc", "xyz"}, "abc,xyz"},
+		{script("several", "%s1\\n%s2\\n%s3\\n"), "line", false, []string{"abc", "xyz"}, "abc,abc1,abc2,abc3,xyz,xyz1,xyz2,xyz3"},
+		{script("array", `[%s,"x"]`), "json", false, []string{"abc", "xyz"}, "abc,x,xyz"},
+		{script("broken", "{%s"), "json", false, []string{"abc", "xyz"}, "abc,xyz"},
+		{script("wrap", "<%s>\\n"), "line", true, []string{"bob:abc"}, "bob:<abc>,bob:abc"},
+	}
+
+	for _, tt := range tests {
+		cfg := &Config{threads: 2, plugin: tt.plugin, pluginFormat: tt.format, pairMode: tt.pair}
+		m, buf := createTestMangler(cfg)
+		if err := m.process(tt.words); err != nil {
+			t.Fatalf("%s: process failed: %v", tt.plugin, err)
+		}
+		if got := strings.Join(getResults(m, buf), ","); got != tt.want {
+			t.Errorf("%s (%s) = %q, want %q", tt.plugin, tt.format, got, tt.want)
+		}
+	}
+
+	m, _ := createTestMangler(&Config{threads: 1, plugin: "false"})
+	if err := m.process([]string{"abc"}); err == nil {
+		t.Errorf("failing plugin should return an error")
+	}
+
+	// An answer without its closing empty line never completes
+	m, _ = createTestMangler(&Config{threads: 1, plugin: script("unended", "%s!"), pluginTimeout: 200 * time.Millisecond})
+	if err := m.process([]string{"abc"}); err == nil || !strings.Contains(err.Error(), "--plugin-timeout") {
+		t.Errorf("plugin that never ends its answer: error = %v, want a --plugin-timeout error", err)
+	}
+}
+
+// bangWasm is a minimal rule module whose mutate appends "!" to the word
+var bangWasm = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, 0x01, 0x0c, 0x02, 0x60, 0x01, 0x7f, 0x01, 0x7f,
+	0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7e, 0x03, 0x03, 0x02, 0x00, 0x01, 0x05, 0x03, 0x01, 0x00, 0x01,
+	0x07, 0x1b, 0x03, 0x06, 0x6d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x02, 0x00, 0x05, 0x61, 0x6c, 0x6c,
+	0x6f, 0x63, 0x00, 0x00, 0x06, 0x6d, 0x75, 0x74, 0x61, 0x74, 0x65, 0x00, 0x01, 0x0a, 0x21, 0x02,
+	0x05, 0x00, 0x41, 0x80, 0x08, 0x0b, 0x19, 0x00, 0x20, 0x00, 0x20, 0x01, 0x6a, 0x41, 0x21, 0x3a,
+	0x00, 0x00, 0x20, 0x00, 0xad, 0x42, 0x20, 0x86, 0x20, 0x01, 0x41, 0x01, 0x6a, 0xad, 0x84, 0x0b,
+}
+
+func TestProcess_WasmRule(t *testing.T) {
+	path := t.TempDir() + "/bang.wasm"
+	os.WriteFile(path, bangWasm, 0644)
+
+	cfg := &Config{threads: 3, wasmRule: path, capital: true}
+	m, buf := createTestMangler(cfg)
+	if err := m.process([]string{"abc", "xyz"}); err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+	if got, want := strings.Join(getResults(m, buf), ","), "Abc,Xyz,abc,abc!,xyz,xyz!"; got != want {
+		t.Errorf("wasm output = %q, want %q", got, want)
+	}
+
+	os.WriteFile(path, bangWasm[:40], 0644)
+	m, _ = createTestMangler(&Config{threads: 1, wasmRule: path})
+	if err := m.process([]string{"abc"}); err == nil {
+		t.Errorf("invalid module should return an error")
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"spring", "spring", 0},
+		{"kitten", "sitting", 3},
+		{"", "abc", 3},
+		{"héllo", "hello", 1},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestClusterPasswords(t *testing.T) {
+	words := []string{"Spring2023!", "Spring2024!", "spr1ng99", "Sprint1", "Winter2023", "w1nter!", "xk9#mp", "123456"}
+	clusters := clusterPasswords(words, 1)
+
+	got := make([]string, len(clusters))
+	for i, c := range clusters {
+		got[i] = strings.Join(c, " ")
+	}
+	want := []string{"Spring2023! Spring2024! Sprint1 spr1ng99", "Winter2023 w1nter!", "xk9#mp"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("clusterPasswords = %q, want %q", got, want)
+	}
+
+	// Distance 0 only groups identical bases
+	if n := len(clusterPasswords(words, 0)[0]); n != 3 {
+		t.Errorf("largest distance-0 cluster has %d members, want 3", n)
+	}
+}
+
+func TestEstimateEntropy(t *testing.T) {
+	tests := []struct {
+		pass     string
+		min, max float64
+	}{
+		{"", 0, 0},
+		{"abc", 14.0, 14.2},          // 3 * log2(26)
+		{"xK9#mP2$vL7q", 78.8, 78.9}, // 12 * log2(95)
+		{"Password123!", 20, 40},     // Dictionary word plus 4 decorations
+	}
+	for _, tt := range tests {
+		if got := estimateEntropy(tt.pass); got < tt.min || got > tt.max {
+			t.Errorf("estimateEntropy(%q) = %.2f, want %.1f-%.1f", tt.pass, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestParseHashRate(t *testing.T) {
+	tests := []struct {
+		spec   string
+		perSec float64
+		ok     bool
+	}{
+		{"NTLM@300GH/s", 300e9, true},
+		{"md5@1.5TH/s", 1.5e12, true},
+		{"bcrypt@184kH/s", 184e3, true},
+		{"custom@5000", 5000, true},
+		{"ntlm", 288e9, true},
+		{"unknown", 0, false},
+		{"@10GH/s", 0, false},
+		{"ntlm@fast", 0, false},
+	}
+	for _, tt := range tests {
+		h, err := parseHashRate(tt.spec)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseHashRate(%q) error = %v, want ok=%v", tt.spec, err, tt.ok)
+			continue
+		}
+		if tt.ok && h.perSec != tt.perSec {
+			t.Errorf("parseHashRate(%q) = %g H/s, want %g", tt.spec, h.perSec, tt.perSec)
+		}
+	}
+}
+
+func TestGuessKeyspace(t *testing.T) {
+	tests := []struct {
+		pass string
+		want float64
+	}{
+		{"abc", 26 * 26 * 26},
+		{"Ab1!", 26 * 26 * 10 * 33},
+	}
+	for _, tt := range tests {
+		if got := guessKeyspace(tt.pass); got != tt.want {
+			t.Errorf("guessKeyspace(%q) = %g, want %g", tt.pass, got, tt.want)
+		}
+	}
+	// Dictionary words are cheaper than their mask
+	if got, mask := guessKeyspace("Password2024"), math.Pow(26, 8)*1e4; got >= mask {
+		t.Errorf("guessKeyspace(Password2024) = %g, want below mask %g", got, mask)
+	}
+
+	rate := &hashRate{hash: "ntlm", perSec: 1e9}
+	if got := humanDuration(rate.seconds(guessKeyspace("abcdefgh"))); got != "3m" {
+		t.Errorf("crack time for 8 lowercase at 1GH/s = %s, want 3m", got)
+	}
+}
+
+func TestWriteCharts(t *testing.T) {
+	charts := analysisCharts([]string{"abc", "abd", "Abc1", "x&y"}, nil)
+	if len(charts) != 3 {
+		t.Fatalf("analysisCharts returned %d charts, want 3", len(charts))
+	}
+	masks := charts[2]
+	if masks.bars[0].label != "%%%" || masks.bars[0].value != 2 {
+		t.Errorf("top mask = %+v, want %%%%%% x2", masks.bars[0])
+	}
+
+	dir := t.TempDir()
+	files, err := writeCharts(dir, "both", charts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 6 {
+		t.Errorf("writeCharts wrote %d files, want 6", len(files))
+	}
+	svg, err := os.ReadFile(dir + "/masks.svg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(svg), "%&amp;%") || !strings.HasSuffix(string(svg), "</svg>\n") {
+		t.Errorf("masks.svg not escaped or truncated:\n%s", svg)
+	}
+	f, err := os.Open(dir + "/length.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if img, err := png.Decode(f); err != nil || img.Bounds().Dx() != chartWidth {
+		t.Errorf("length.png does not decode: %v", err)
+	}
+
+	// Long labels are cut so the bars keep their room
+	long := chart{name: "long", bars: []chartBar{{strings.Repeat("?l", 60), 3}, {"?d", 1}}}
+	if _, barW, _ := long.layout(); barW < chartMinBarW {
+		t.Errorf("bar width with a long label = %d, want at least %d", barW, chartMinBarW)
+	}
+	if got := chartLabel(strings.Repeat("?l", 60)); len(got) != chartMaxLabel || !strings.HasSuffix(got, "..") {
+		t.Errorf("chartLabel = %q", got)
+	}
+}
+
+func TestScoreList(t *testing.T) {
+	ref := map[string]int{"password": 3, "summer": 1, "dragon": 1}
+	s, err := scoreList(strings.NewReader("password\nabc\npassword\nsummer\nxyz\n"), ref, &wordLoader{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.size != 5 || s.hits != 2 || s.weighted != 4 {
+		t.Errorf("scoreList = %+v, want size 5, hits 2, weighted 4", s)
+	}
+	if got := s.hitsPerMillion(); got != 400000 {
+		t.Errorf("hitsPerMillion = %g, want 400000", got)
+	}
+	if got := (listScore{}).hitsPerMillion(); got != 0 {
+		t.Errorf("empty list hitsPerMillion = %g, want 0", got)
+	}
+}
+
+func TestSelfTestVectors(t *testing.T) {
+	for _, v := range selfTestVectors {
+		if got := v.got(); got != v.want {
+			t.Errorf("%s %s: got %q, want %q", v.group, v.name, got, v.want)
+		}
+	}
+}
+
+func TestPasswordReuse(t *testing.T) {
+	passwords, users := splitPairs([]string{"alice:Spring1", "bob:Spring1", "carol:x", "alice:Spring1", "dave:x", "broken", "erin:solo"})
+	entries := passwordReuse(passwords, users)
+
+	var got []string
+	for _, e := range entries {
+		got = append(got, fmt.Sprintf("%s=%d[%s]", e.password, e.count, strings.Join(e.users, " ")))
+	}
+	want := "Spring1=3[alice bob],x=2[carol dave]"
+	if strings.Join(got, ",") != want {
+		t.Errorf("passwordReuse = %q, want %q", strings.Join(got, ","), want)
+	}
+
+	if entries := passwordReuse([]string{"a", "b", "a"}, nil); len(entries) != 1 || entries[0].users != nil {
+		t.Errorf("passwordReuse without users = %+v", entries)
+	}
+}
+
+func TestWordLoader_SampleRate(t *testing.T) {
+	input := strings.Repeat("word\n", 10000)
+	l := &wordLoader{sampleRate: 0.1, rng: rand.New(rand.NewSource(1))}
+	words, _ := l.load(strings.NewReader(input))
+	if l.sampled != 10000 {
+		t.Errorf("sampled = %d, want 10000", l.sampled)
+	}
+	if len(words) < 900 || len(words) > 1100 {
+		t.Errorf("kept %d of 10000 words at rate 0.1", len(words))
+	}
+	if m := marginOfError(len(words)); m < 2.5 || m > 3.5 {
+		t.Errorf("marginOfError(%d) = %.2f, want about 3.1", len(words), m)
+	}
+}
+
+func TestLoadCommon(t *testing.T) {
+	path := t.TempDir() + "/terms.txt"
+	if err := os.WriteFile(path, []byte("acme\nspring\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		spec string
+		want []string
+	}{
+		{"BUILT_IN", commonCategories["admin-terms"]},
+		{"builtin:device-defaults", commonCategories["device-defaults"]},
+		{"builtin:seasons," + path, []string{"spring", "summer", "autumn", "fall", "winter", "acme"}},
+		{"builtin:admin,sports", append(slices.Clone(commonCategories["admin-terms"]), commonCategories["sports"]...)},
+	}
+	for _, tt := range tests {
+		got, err := loadCommon(tt.spec)
+		if err != nil {
+			t.Fatalf("loadCommon(%q): %v", tt.spec, err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("loadCommon(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+	if got := commonCategories["admin-terms"][:4]; !slices.Equal(got, []string{"pw", "pwd", "admin", "sys"}) {
+		t.Errorf("admin-terms starts with %v, want the former built-ins", got)
+	}
+	for _, spec := range []string{"builtin:nope", "sports"} {
+		if _, err := loadCommon(spec); err == nil {
+			t.Errorf("loadCommon(%q) accepted", spec)
+		}
+	}
+}
+
+func TestEmailAddresses(t *testing.T) {
+	got := mailboxLocals("John Smith")
+	want := []string{"john.smith", "jsmith", "j.smith", "smith.john", "johnsmith", "john_smith", "john"}
+	if !slices.Equal(got, want) {
+		t.Errorf("mailboxLocals(John Smith) = %v, want %v", got, want)
+	}
+	for name, first := range map[string]string{
+		"Smith, John":        "john.smith",
+		"José María García":  "jose.garcia",
+		"Seán O'Brien":       "sean.obrien",
+		"Jürgen Müller-Lang": "juergen.mueller-lang",
+		"cher":               "cher",
+	} {
+		if got := mailboxLocals(name); len(got) == 0 || got[0] != first {
+			t.Errorf("mailboxLocals(%q) = %v, want %s first", name, got, first)
+		}
+	}
+
+	addrs := emailAddresses([]string{"John Smith", "John Smith", "Ann Lee"}, "corp.com, @Corp.co.uk")
+	if len(addrs) != 28 || addrs[0] != "john.smith@corp.com" || addrs[7] != "john.smith@corp.co.uk" || addrs[14] != "ann.lee@corp.com" {
+		t.Errorf("emailAddresses = %v", addrs)
+	}
+}
+
+func TestDelta(t *testing.T) {
+	seen := map[string]struct{}{"Winter2024!": {}, "Spring2024!": {}}
+	got := deltaCandidates([]string{"Winter2024!", "Spring2024!"}, nil, 2025, seen)
+	for _, w := range []string{"Winter2025!", "Summer2024!", "Winter2024!!"} {
+		if !slices.Contains(got, w) {
+			t.Errorf("deltaCandidates lacks %q: %v", w, got)
+		}
+	}
+	for _, w := range []string{"Winter2024!", "Spring2024!"} {
+		if slices.Contains(got, w) {
+			t.Errorf("deltaCandidates kept old %q", w)
+		}
+	}
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/old.txt", []byte("pass1\npass2\n"), 0o644)
+	os.WriteFile(dir+"/r.pmr", []byte("# next counter\ninc-num\n"), 0o644)
+	args := []string{"--old", dir + "/old.txt", "--rules", dir + "/r.pmr", "--seen", dir + "/seen.txt", "-o", dir + "/out.txt"}
+	for run, want := range []string{"pass3\n", ""} {
+		if err := runDelta(args); err != nil {
+			t.Fatalf("runDelta: %v", err)
+		}
+		if out, _ := os.ReadFile(dir + "/out.txt"); string(out) != want {
+			t.Errorf("run %d wrote %q, want %q", run+1, out, want)
+		}
+	}
+	if db, _ := os.ReadFile(dir + "/seen.txt"); string(db) != "pass3\n" {
+		t.Errorf("seen file = %q, want pass3", db)
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	creds, err := parseDefaults(strings.NewReader(embeddedDefaults))
+	if err != nil || len(creds) == 0 {
+		t.Fatalf("built-in credentials: %d, %v", len(creds), err)
+	}
+	if _, err := parseDefaults(strings.NewReader("acme admin\n")); err == nil {
+		t.Error("parseDefaults accepted a line without password")
+	}
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/extra.txt", []byte("# newer firmware\nacme admin <blank>\nubiquiti ubnt ubnt\n"), 0o644)
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--vendor", "ubiquiti"}, "ubnt:ubnt\n"},
+		{[]string{"--vendor", "acme,ubiquiti", "--data", dir + "/extra.txt", "--sep", "\t"}, "admin\t\nubnt\tubnt\n"},
+		{[]string{"--vendor", "raspberrypi", "--rules", "capital", "--format", "passwords"}, "raspberry\nRaspberry\n"},
+	}
+	for _, tt := range tests {
+		if err := runDefaults(append(tt.args, "-o", dir+"/out.txt")); err != nil {
+			t.Fatalf("runDefaults(%v): %v", tt.args, err)
+		}
+		if out, _ := os.ReadFile(dir + "/out.txt"); string(out) != tt.want {
+			t.Errorf("runDefaults(%v) wrote %q, want %q", tt.args, out, tt.want)
+		}
+	}
+	if err := runDefaults([]string{"--vendor", "nosuch", "-o", dir + "/out.txt"}); err == nil {
+		t.Error("runDefaults accepted an unknown vendor")
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	c := newCoverageCheck([]string{"password", "Password1", "P@ssw0rd", "2024acme!", "MONKEY", "zebra99", "password"})
+	for _, w := range []string{"password", "acme", "monkey", "Monkey"} {
+		c.see(w)
+	}
+	want := [][2]string{
+		{"Password1", "suffix+casing"},
+		{"P@ssw0rd", "leet+casing"},
+		{"2024acme!", "prefix+suffix"},
+		{"MONKEY", "casing"},
+		{"zebra99", ""},
+	}
+	if got := c.missed(); !slices.Equal(got, want) {
+		t.Errorf("missed = %q, want %q", got, want)
+	}
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/gen.txt", []byte("summer\n"), 0o644)
+	os.WriteFile(dir+"/cracked.txt", []byte("summer\nSummer!\n"), 0o644)
+	args := []string{"--generated", dir + "/gen.txt", "--cracked", dir + "/cracked.txt", "--missed", dir + "/missed.txt", "-o", dir + "/report.txt"}
+	if err := runCoverage(args); err != nil {
+		t.Fatal(err)
+	}
+	if report, _ := os.ReadFile(dir + "/report.txt"); !strings.Contains(string(report), "1 of 2 cracked plaintexts (50.0%)") {
+		t.Errorf("report = %s", report)
+	}
+	if missed, _ := os.ReadFile(dir + "/missed.txt"); string(missed) != "Summer!\tsuffix+casing\n" {
+		t.Errorf("missed file = %q", missed)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	bases := map[string][]string{"password": {"password"}, "summer": {"summer"}, "acme": {"Acme"}}
+	tests := []struct {
+		cracked, recipe string
+		ok              bool
+	}{
+		{"Password1", "capital,append=1", true},
+		{"P@ssw0rd", "capital,leet=a@o0", true},
+		{"2024summer!", "prepend=2024,append=!", true},
+		{"ACME", "upper", true},
+		{"acme", "lower", true},
+		{"password", "", true},
+		{"zebra99", "", false},
+		{"1234", "", false},
+	}
+	for _, tt := range tests {
+		recipe, _, ok := suggestRecipe(tt.cracked, bases)
+		if recipe != tt.recipe || ok != tt.ok {
+			t.Errorf("suggestRecipe(%q) = %q, %v, want %q, %v", tt.cracked, recipe, ok, tt.recipe, tt.ok)
+		}
+	}
+
+	ranked, unchanged, unexplained := suggestRecipes([]string{"Summer1", "Password1", "Password1", "ACME", "password", "zebra"}, bases)
+	if len(ranked) != 2 || ranked[0].recipe != "capital,append=1" || ranked[0].count != 2 || unchanged != 1 || unexplained != 1 {
+		t.Errorf("suggestRecipes = %+v, %d unchanged, %d unexplained", ranked, unchanged, unexplained)
+	}
+
+	// The suggested file reproduces the passwords with --rules-file
+	dir := t.TempDir()
+	os.WriteFile(dir+"/base.txt", []byte("summer\npassword\n"), 0o644)
+	os.WriteFile(dir+"/cracked.txt", []byte("Summer1\nP@ssw0rd\n"), 0o644)
+	if err := runSuggest([]string{"--cracked", dir + "/cracked.txt", "--base", dir + "/base.txt", "-o", dir + "/s.pmr"}); err != nil {
+		t.Fatal(err)
+	}
+	recipes, err := loadRecipes(dir + "/s.pmr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, spec := range []string{dir + "/missing", "corp.rule", "best64.txt"} {
+		if _, err := loadRecipes(spec); err == nil {
+			t.Errorf("loadRecipes(%q) took a missing file as a recipe", spec)
+		}
+	}
+	for _, spec := range []string{"capital,append=1", "append=1/2"} {
+		if got, err := loadRecipes(spec); err != nil || !slices.Equal(got, []string{spec}) {
+			t.Errorf("loadRecipes(%q) = %q, %v", spec, got, err)
+		}
+	}
+	m, buf := createTestMangler(&Config{rulesList: strings.Join(recipes, "\n"), threads: 1})
+	if err := m.process([]string{"summer", "password"}); err != nil {
+		t.Fatal(err)
+	}
+	got := getResults(m, buf)
+	for _, w := range []string{"Summer1", "P@ssw0rd"} {
+		if !slices.Contains(got, w) {
+			t.Errorf("--rules-file output %v lacks %s", got, w)
+		}
+	}
+}
+
+func TestInferRule(t *testing.T) {
+	tests := []struct {
+		from, to, recipe, hashcat string
+	}{
+		{"summer", "Summ3r2024!", "capital,leet=e3,append=2024!", "c se3 $2 $0 $2 $4 $!"},
+		{"password", "P@SSW0RD", "upper,leet=a@o0", "u sA@ sO0"},
+		{"password", "drowssap1", "reverse,append=1", "r $1"},
+		{"admin", "!!admin", "prepend=!!", "^! ^!"},
+		{"abc", "abcabc", "double", "d"},
+	}
+	for _, tt := range tests {
+		got := inferRules(tt.from, tt.to)
+		if len(got) == 0 || got[0] != tt.recipe {
+			t.Errorf("inferRules(%q, %q) = %q, want %q first", tt.from, tt.to, got, tt.recipe)
+			continue
+		}
+		if h := hashcatRule(got[0], tt.from); h != tt.hashcat {
+			t.Errorf("hashcatRule(%q) = %q, want %q", got[0], h, tt.hashcat)
+		}
+	}
+	if got := inferRules("summer", "summer"); !slices.Equal(got, []string{""}) {
+		t.Errorf("identical words = %q", got)
+	}
+	if got := inferRules("abc", "xyz"); len(got) != 0 {
+		t.Errorf("unrelated words = %q", got)
+	}
+}
+
+func TestDocs(t *testing.T) {
+	// Every recipe step example holds
+	for _, s := range recipeSteps {
+		if got := sequenceVariants(s.recipe, s.in, s.in)[0]; got != s.out {
+			t.Errorf("%s: %s on %q = %q, documented %q", s.names, s.recipe, s.in, got, s.out)
+		}
+	}
+	for name := range subcommands {
+		if subcommandSummaries[name] == "" {
+			t.Errorf("subcommand %s has no summary", name)
+		}
+	}
+	if len(subcommandSummaries) != len(subcommands) {
+		t.Errorf("%d summaries for %d subcommands", len(subcommandSummaries), len(subcommands))
+	}
+
+	// Every flag appears once, folded with its shorthands
+	var man, md bytes.Buffer
+	writeManPage(&man)
+	writeMarkdownReference(&md)
+	opts := docOptions()
+	seen := make(map[string]bool)
+	for _, o := range opts {
+		for _, n := range o.names {
+			if seen[n] {
+				t.Errorf("%s documented twice", n)
+			}
+			seen[n] = true
+		}
+	}
+	newFlagSet(&Config{}, flag.ContinueOnError).VisitAll(func(f *flag.Flag) {
+		name := "--" + f.Name
+		if len(f.Name) <= 2 {
+			name = "-" + f.Name
+		}
+		if !seen[name] {
+			t.Errorf("%s missing from docs", name)
+		}
+		if !strings.Contains(md.String(), "`"+name) {
+			t.Errorf("%s missing from the markdown", name)
+		}
+	})
+	for _, o := range opts {
+		if o.name == "file" && (!slices.Equal(o.names, []string{"-f", "--file"}) || o.arg != " <list>") {
+			t.Errorf("--file documented as %v%s", o.names, o.arg)
+		}
+		if o.name == "rot" && o.arg != "[=N]" {
+			t.Errorf("--rot argument = %q", o.arg)
+		}
+	}
+	for _, want := range []string{".TH PASSMUT 1", "\\fB\\-f\\fR, \\fB\\-\\-file\\fR", ".SH RECIPE STEPS", "\\fBinfer\\-rule\\fR"} {
+		if !strings.Contains(man.String(), want) {
+			t.Errorf("man page lacks %q", want)
+		}
+	}
+}
+
+func TestRunAudit(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(dir+"/banned.txt", []byte("Winter2024!\n"), 0644)
+	os.WriteFile(dir+"/policy.yaml", []byte(`
+min-length: 10
+require: [upper, digit]
+no-username: true
+blocklist: banned.txt
+`), 0644)
+	os.WriteFile(dir+"/dump.txt", []byte("alice:Xk9mP2vL7qZ\nbob:bob12345678X\ncarol:short1A\ndave:Winter2024!\nnopair\n"), 0644)
+
+	err := runAudit([]string{"--policy", dir + "/policy.yaml", "--pair-mode", "--csv", dir + "/v.csv", "-o", dir + "/report.txt", dir + "/dump.txt"})
+	if err != nil {
+		t.Fatalf("runAudit: %v", err)
+	}
+
+	csvData, _ := os.ReadFile(dir + "/v.csv")
+	wantCSV := "user,violations\nbob,no-username\ncarol,min-length 10\ndave,blocklist\n"
+	if string(csvData) != wantCSV {
+		t.Errorf("csv = %q, want %q", csvData, wantCSV)
+	}
+	report, _ := os.ReadFile(dir + "/report.txt")
+	for _, want := range []string{"Passwords:        4", "Fully compliant:  1 (25.0%)", "min-length 10", "[     1] %%%%%#^", "[     1] ^%%%%%####&"} {
+		if !strings.Contains(string(report), want) {
+			t.Errorf("report missing %q:\n%s", want, report)
+		}
+	}
+
+	if _, err := (&auditPolicy{Require: []string{"emoji"}}).rules(); err == nil {
+		t.Errorf("unknown required class should fail")
+	}
+	if _, err := (&auditPolicy{}).rules(); err == nil {
+		t.Errorf("empty policy should fail")
 	}
 }
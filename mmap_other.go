@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile is not supported on this platform; callers fall back to
+// buffered reading
+func mmapFile(f *os.File) ([]byte, func() error, error) {
+	return nil, nil, errors.New("mmap is not supported on this platform")
+}